@@ -10,14 +10,34 @@ import (
 	"github.com/go-ozzo/ozzo-routing/v2/content"
 	"github.com/go-ozzo/ozzo-routing/v2/cors"
 	_ "github.com/lib/pq"
+	"github.com/qiangxue/go-rest-api/internal/audit"
+	"github.com/qiangxue/go-rest-api/internal/auth"
+	"github.com/qiangxue/go-rest-api/internal/campaign"
 	"github.com/qiangxue/go-rest-api/internal/config"
+	"github.com/qiangxue/go-rest-api/internal/emailchange"
 	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/event"
 	"github.com/qiangxue/go-rest-api/internal/healthcheck"
 	"github.com/qiangxue/go-rest-api/internal/idea"
+	"github.com/qiangxue/go-rest-api/internal/invitation"
+	"github.com/qiangxue/go-rest-api/internal/mailgun"
+	"github.com/qiangxue/go-rest-api/internal/media"
+	"github.com/qiangxue/go-rest-api/internal/moderation"
+	"github.com/qiangxue/go-rest-api/internal/notification"
+	"github.com/qiangxue/go-rest-api/internal/privacy"
+	"github.com/qiangxue/go-rest-api/internal/registration"
+	"github.com/qiangxue/go-rest-api/internal/reputation"
+	"github.com/qiangxue/go-rest-api/internal/report"
+	"github.com/qiangxue/go-rest-api/internal/stream"
+	"github.com/qiangxue/go-rest-api/internal/tag"
 	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/internal/usercsv"
+	"github.com/qiangxue/go-rest-api/internal/webhook"
 	"github.com/qiangxue/go-rest-api/pkg/accesslog"
+	"github.com/qiangxue/go-rest-api/pkg/blob"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/scheduler"
 	"net/http"
 	"os"
 	"time"
@@ -55,13 +75,28 @@ func main() {
 		}
 	}()
 
+	// open the storage of uploaded media
+	storage, err := buildStorage(cfg)
+	if err != nil {
+		logger.Errorf("failed to open media storage: %s", err)
+		os.Exit(-1)
+	}
+
+	// the hub of the real-time updates streamed to clients
+	hub := stream.NewHub(1000)
+
 	// build HTTP server
 	address := fmt.Sprintf(":%v", cfg.ServerPort)
 	hs := &http.Server{
 		Addr:    address,
-		Handler: buildHandler(logger, dbcontext.New(db), cfg),
+		Handler: buildHandler(logger, dbcontext.New(db), storage, hub, cfg),
 	}
 
+	// start the background jobs; they stop when the server exits
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startJobs(ctx, logger, dbcontext.New(db), storage, hub, cfg)
+
 	// start the HTTP server with graceful shutdown
 	go routing.GracefulShutdown(hs, 10*time.Second, logger.Infof)
 	logger.Infof("server %v is running at %v", Version, address)
@@ -72,11 +107,12 @@ func main() {
 }
 
 // buildHandler sets up the HTTP routing and builds an HTTP handler.
-func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.Handler {
+func buildHandler(logger log.Logger, db *dbcontext.DB, storage blob.Storage, hub *stream.Hub, cfg *config.Config) http.Handler {
 	router := routing.New()
 
 	router.Use(
 		accesslog.Handler(logger),
+		audit.Handler(cfg.TrustedProxies),
 		errors.Handler(logger),
 		content.TypeNegotiator(content.JSON),
 		cors.Handler(cors.AllowAll),
@@ -86,19 +122,247 @@ func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.
 
 	rg := router.Group("/v1")
 
-	userService := user.NewUserService(user.NewUsersRepository(db, logger), logger)
+	events := event.NewBus(db, logger)
+	userService := user.NewUserService(user.NewUsersRepository(db, logger), logger, events, db.Transactional)
+	auditService := audit.NewService(audit.NewRepository(db, logger), userService, logger)
+	audit.RegisterHandlers(rg.Group(""), auditService, logger)
+	// the security-relevant and administrative actions are recorded in the audit log from here on
+	userService = audit.NewUserService(userService, auditService, db.Transactional)
+
+	auth.RegisterHandlers(rg.Group(""),
+		audit.NewAuthService(auth.NewService(auth.NewRepository(db, logger), userService, buildMailer(cfg, logger),
+			cfg.JWTSigningKey, cfg.JWTExpiration, time.Duration(cfg.LoginCodeExpiration)*time.Minute, logger), auditService),
+		logger,
+	)
+
 	user.RegisterHandlers(rg.Group(""),
 		userService,
 		logger,
 	)
 
-	idea.RegisterHandlers(rg.Group(""),
-		idea.NewService(idea.NewRepository(db, logger), logger, userService), logger,
+	tagService := tag.NewService(tag.NewRepository(db, logger), userService, logger)
+	tag.RegisterHandlers(rg.Group(""), tagService, logger)
+
+	mediaService := media.NewService(media.NewRepository(db, logger), storage, userService,
+		cfg.MediaMaxSize, cfg.MediaBaseURL, logger)
+	media.RegisterHandlers(rg.Group(""), mediaService, cfg.MediaMaxSize, logger)
+
+	campaignService := campaign.NewService(campaign.NewRepository(db, logger), userService, logger)
+	campaign.RegisterHandlers(rg.Group(""), campaignService, logger)
+
+	notificationService := notification.NewService(notification.NewRepository(db, logger), userService,
+		buildMailer(cfg, logger), cfg.JWTSigningKey, cfg.PublicURL, logger)
+	notification.RegisterHandlers(rg.Group(""), notificationService, logger)
+
+	webhookService := webhook.NewService(webhook.NewRepository(db, logger), userService, nil, logger)
+	webhook.RegisterHandlers(rg.Group(""), webhookService, logger)
+
+	registration.RegisterHandlers(rg.Group(""),
+		registration.NewService(registration.Policy{
+			Enabled:        cfg.RegistrationEnabled,
+			AllowedDomains: cfg.RegistrationAllowedDomains,
+			DeniedDomains:  cfg.RegistrationDeniedDomains,
+		}, userService, buildMailer(cfg, logger), cfg.PublicURL, logger),
+		logger,
+	)
+
+	invitation.RegisterHandlers(rg.Group(""),
+		invitation.NewService(invitation.NewRepository(db, logger), userService, buildMailer(cfg, logger), db.Transactional,
+			time.Duration(cfg.InvitationExpiration)*time.Hour, cfg.PublicURL, logger),
+		logger,
+	)
+
+	emailchange.RegisterHandlers(rg.Group(""),
+		emailchange.NewService(emailchange.NewRepository(db, logger), userService, buildMailer(cfg, logger), db.Transactional,
+			time.Duration(cfg.EmailChangeExpiration)*time.Hour, cfg.PublicURL, logger),
+		logger,
+	)
+
+	privacy.RegisterHandlers(rg.Group(""),
+		audit.NewPrivacyService(privacy.NewService(privacy.NewRepository(db, logger), userService, storage, db.Transactional, logger),
+			auditService, db.Transactional),
+		logger,
+	)
+
+	usercsv.RegisterHandlers(rg.Group(""),
+		usercsv.NewService(usercsv.NewRepository(db, logger), userService, db.Transactional, logger),
+		logger,
+	)
+
+	ideaRepo := idea.NewRepository(db, logger)
+	policy := buildReputationPolicy(cfg)
+	reputation.RegisterHandlers(rg.Group(""),
+		reputation.NewService(reputation.NewRepository(db, logger), userService, policy, db.Transactional, logger),
+		logger,
+	)
+
+	ideaService := audit.NewIdeaService(idea.NewService(ideaRepo, logger, userService, tagService, mediaService,
+		campaignService, events, db.Transactional, policy), auditService, db.Transactional)
+	idea.RegisterHandlers(rg.Group(""), ideaService, logger)
+
+	stream.RegisterHandlers(rg.Group(""), hub, ideaService, auth.Handler(cfg.JWTSigningKey), logger)
+
+	reportRepo := report.NewRepository(db, logger)
+	moderationService := moderation.NewService(audit.NewModerationRepository(moderation.NewRepository(db, logger), auditService),
+		ideaRepo, reportRepo, userService, events, db.Transactional, logger)
+	moderation.RegisterHandlers(rg.Group(""), moderationService, logger)
+
+	report.RegisterHandlers(rg.Group(""),
+		report.NewService(reportRepo, ideaRepo, userService, cfg.ReportAutoHideThreshold, moderationService, policy,
+			db.Transactional, logger),
+		logger,
 	)
 
 	return router
 }
 
+// startJobs starts the background jobs of the application.
+func startJobs(ctx context.Context, logger log.Logger, db *dbcontext.DB, storage blob.Storage, hub *stream.Hub, cfg *config.Config) {
+	events := event.NewBus(db, logger)
+	userService := user.NewUserService(user.NewUsersRepository(db, logger), logger, events, db.Transactional)
+	tagService := tag.NewService(tag.NewRepository(db, logger), userService, logger)
+	mediaService := media.NewService(media.NewRepository(db, logger), storage, userService,
+		cfg.MediaMaxSize, cfg.MediaBaseURL, logger)
+	campaignService := campaign.NewService(campaign.NewRepository(db, logger), userService, logger)
+	notificationService := notification.NewService(notification.NewRepository(db, logger), userService,
+		buildMailer(cfg, logger), cfg.JWTSigningKey, cfg.PublicURL, logger)
+	webhookService := webhook.NewService(webhook.NewRepository(db, logger), userService, nil, logger)
+	policy := buildReputationPolicy(cfg)
+	reputationService := reputation.NewService(reputation.NewRepository(db, logger), userService, policy, db.Transactional, logger)
+	ideaService := idea.NewService(idea.NewRepository(db, logger), logger, userService, tagService, mediaService,
+		campaignService, events, db.Transactional, policy)
+
+	// side effects of the domain events, such as scoring, notifications and webhooks, happen in the dispatcher
+	reputation.RegisterSubscribers(events, reputationService, policy)
+	notification.RegisterSubscribers(events, notificationService)
+	webhook.RegisterSubscribers(events, webhookService)
+	stream.RegisterSubscribers(events, db)
+
+	// every instance forwards the updates notified through the database to its own streams
+	go func() {
+		if err := stream.Listen(ctx, cfg.DSN, hub, logger); err != nil {
+			logger.Errorf("failed to listen to stream updates: %s", err)
+		}
+	}()
+
+	go scheduler.Every(ctx, time.Second, logger, "dispatch events", func(ctx context.Context) error {
+		for {
+			n, err := events.Dispatch(ctx, 100)
+			if err != nil || n == 0 {
+				return err
+			}
+		}
+	})
+
+	go scheduler.Every(ctx, 30*time.Second, logger, "process media", func(ctx context.Context) error {
+		for {
+			n, err := mediaService.ProcessPending(ctx, 20)
+			if err != nil || n == 0 {
+				return err
+			}
+		}
+	})
+
+	go scheduler.Every(ctx, time.Duration(cfg.RankingRefreshMinutes)*time.Minute, logger, "refresh ranking", func(ctx context.Context) error {
+		halfLife := time.Duration(cfg.HotHalfLifeHours * float64(time.Hour))
+		window := time.Duration(cfg.RisingWindowHours * float64(time.Hour))
+		_, err := ideaService.RefreshRanking(ctx, halfLife, window)
+		return err
+	})
+
+	go scheduler.Every(ctx, time.Minute, logger, "send notification emails", func(ctx context.Context) error {
+		for {
+			n, err := notificationService.SendInstant(ctx, 100)
+			if err != nil || n == 0 {
+				return err
+			}
+		}
+	})
+
+	go scheduler.Every(ctx, time.Hour, logger, "send digests", func(ctx context.Context) error {
+		now := time.Now()
+		for _, frequency := range []string{notification.DeliveryDaily, notification.DeliveryWeekly} {
+			for {
+				n, err := notificationService.SendDigests(ctx, frequency, now, 100)
+				if err != nil {
+					return err
+				}
+				if n == 0 {
+					break
+				}
+			}
+		}
+		return nil
+	})
+
+	go scheduler.Every(ctx, 10*time.Second, logger, "deliver webhooks", func(ctx context.Context) error {
+		for {
+			n, err := webhookService.Deliver(ctx, 20)
+			if err != nil || n == 0 {
+				return err
+			}
+		}
+	})
+
+	go scheduler.Every(ctx, time.Hour, logger, "purge trash", func(ctx context.Context) error {
+		before := time.Now().AddDate(0, 0, -cfg.TrashRetentionDays)
+		ideas, err := ideaService.PurgeDeleted(ctx, before)
+		if err != nil {
+			return err
+		}
+		users, err := userService.PurgeDeleted(ctx, before)
+		if err != nil {
+			return err
+		}
+		logger.With(ctx).Infof("purged %d ideas and %d users from the trash", ideas, users)
+		return nil
+	})
+
+	go scheduler.Every(ctx, time.Hour, logger, "purge events", func(ctx context.Context) error {
+		n, err := events.Purge(ctx, time.Now().AddDate(0, 0, -cfg.EventRetentionDays))
+		if err == nil && n > 0 {
+			logger.With(ctx).Infof("purged %d events from the outbox", n)
+		}
+		return err
+	})
+}
+
+// buildStorage creates the blob storage configured for uploaded media.
+func buildStorage(cfg *config.Config) (blob.Storage, error) {
+	if cfg.MediaStorage == config.MediaStorageS3 {
+		return blob.NewS3(blob.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		}, nil), nil
+	}
+	return blob.NewLocal(cfg.MediaLocalDir)
+}
+
+// buildReputationPolicy creates the reputation policy from the configured points and levels.
+func buildReputationPolicy(cfg *config.Config) reputation.Policy {
+	var levels []reputation.Level
+	for _, level := range cfg.ReputationLevels {
+		levels = append(levels, reputation.Level{Name: level.Name, MinScore: level.MinScore, Capabilities: level.Capabilities})
+	}
+	return reputation.NewPolicy(reputation.Points{
+		IdeaCreated:  cfg.PointsIdeaCreated,
+		VoteReceived: cfg.PointsVoteReceived,
+		IdeaAccepted: cfg.PointsIdeaAccepted,
+		VoteCast:     cfg.PointsVoteCast,
+	}, levels)
+}
+
+// buildMailer creates the mailer of notification emails. Emails are only logged if Mailgun is not configured.
+func buildMailer(cfg *config.Config, logger log.Logger) notification.Mailer {
+	if cfg.MailgunDomain == "" {
+		return notification.NewLogMailer(logger)
+	}
+	return mailgun.NewMailer(cfg.MailgunDomain, cfg.MailgunAPIKey, cfg.MailFrom)
+}
+
 // logDBQuery returns a logging function that can be used to log SQL queries.
 func logDBQuery(logger log.Logger) dbx.QueryLogFunc {
 	return func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"strconv"
+	"time"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/admin/audit", res.query)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) query(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	req := QueryRequest{
+		RequesterUserEmail: c.Query("requester_user_email"),
+		Filter: Filter{
+			ActorID:    c.Query("actor_id"),
+			Action:     c.Query("action"),
+			TargetType: c.Query("target_type"),
+			TargetID:   c.Query("target_id"),
+		},
+	}
+	var err error
+	if req.Since, err = parseTime(c.Query("since")); err != nil {
+		return errors.BadRequest("since must be a date (YYYY-MM-DD) or an RFC 3339 time")
+	}
+	if req.Until, err = parseTime(c.Query("until")); err != nil {
+		return errors.BadRequest("until must be a date (YYYY-MM-DD) or an RFC 3339 time")
+	}
+
+	pages, err := r.service.Query(c.Request.Context(), req, page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
+
+// parseTime parses a query parameter holding either a date or an RFC 3339 time. It returns nil if the value is empty.
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", value); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
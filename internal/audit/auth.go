@@ -0,0 +1,36 @@
+package audit
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/auth"
+)
+
+// authService records the login attempts made through an authentication service.
+type authService struct {
+	auth.Service
+	audit Service
+}
+
+// NewAuthService returns an authentication service which records the successful and the failed logins
+// in the audit log.
+func NewAuthService(service auth.Service, audit Service) auth.Service {
+	return authService{service, audit}
+}
+
+// Login authenticates a user and records the attempt, whether it succeeded or not. The username, which is the email
+// address of the user, is only used to find the user, and is not recorded as it may be personal data.
+func (s authService) Login(ctx context.Context, username, password string) (string, error) {
+	token, err := s.Service.Login(ctx, username, password)
+	action := ActionLogin
+	if err != nil {
+		action = ActionLoginFailed
+	}
+	if err := s.audit.Record(ctx, Record{
+		ActorEmail: username,
+		Action:     action,
+		TargetType: TargetUser,
+	}); err != nil {
+		return "", err
+	}
+	return token, err
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const clientIPKey contextKey = iota
+
+// Handler returns a middleware that associates the IP address of the client with the request context,
+// so that it can be recorded in the audit log. The X-Real-IP and X-Forwarded-For headers are only trusted
+// when the request comes from one of the given reverse proxies, which are IP addresses or CIDR ranges.
+func Handler(trustedProxies []string) routing.Handler {
+	proxies := parseNetworks(trustedProxies)
+	return func(c *routing.Context) error {
+		ctx := WithClientIP(c.Request.Context(), clientIP(c.Request, proxies))
+		c.Request = c.Request.WithContext(ctx)
+		return nil
+	}
+}
+
+// WithClientIP returns a context which knows the IP address of the client.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// ClientIP returns the IP address of the client recorded in the given context, or an empty string.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
+
+// parseNetworks parses IP addresses and CIDR ranges, such as "10.0.0.1" and "10.0.0.0/8", skipping the invalid
+// ones.
+func parseNetworks(values []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(value); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+// clientIP returns the IP address of the client of an HTTP request. When the request comes from one of
+// the trusted proxies, it is the address the proxies report: the X-Real-IP header, or else the last address
+// of the X-Forwarded-For header which isn't a trusted proxy, as the addresses before it may be forged by the client.
+// Otherwise the headers are ignored, as any client can send them.
+func clientIP(req *http.Request, trustedProxies []*net.IPNet) string {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		remote = host
+	}
+	if !isTrusted(remote, trustedProxies) {
+		return remote
+	}
+	if ip := strings.TrimSpace(req.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	forwarded := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if ip := strings.TrimSpace(forwarded[i]); ip != "" && (i == 0 || !isTrusted(ip, trustedProxies)) {
+			return ip
+		}
+	}
+	return remote
+}
+
+// isTrusted reports whether the given IP address belongs to one of the trusted proxies.
+func isTrusted(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
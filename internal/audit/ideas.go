@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/idea"
+	"github.com/qiangxue/go-rest-api/internal/moderation"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+)
+
+// ideaValues are the values of an idea recorded in the audit log. Empty values are left out. The reasons and
+// the notes written by moderators are not recorded, as they may hold personal data; they are kept with the status
+// changes and the moderation actions of the idea, where erasure can blank them.
+type ideaValues struct {
+	Status string `json:"status,omitempty"`
+	// the moderation action taken on the idea
+	Moderation string `json:"moderation,omitempty"`
+}
+
+// ideaService records the moderation of ideas made through an idea service.
+type ideaService struct {
+	idea.Service
+	audit       Service
+	transaction dbcontext.TransactionFunc
+}
+
+// NewIdeaService returns an idea service which records the status changes and the restorations of ideas
+// in the audit log, in the same transaction as the changes.
+func NewIdeaService(service idea.Service, audit Service, transaction dbcontext.TransactionFunc) idea.Service {
+	return ideaService{service, audit, transaction}
+}
+
+// ChangeStatus changes the status of an idea and records the previous and the new status.
+func (s ideaService) ChangeStatus(ctx context.Context, id string, req idea.ChangeStatusRequest) (i idea.Idea, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		// the service reports a missing idea
+		before, _ := s.Service.Get(ctx, id)
+		if i, err = s.Service.ChangeStatus(ctx, id, req); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorEmail: req.RequesterUserEmail,
+			Action:     ActionIdeaStatus,
+			TargetType: TargetIdea,
+			TargetID:   id,
+			Before:     ideaValues{Status: before.Status},
+			After:      ideaValues{Status: i.Status},
+		})
+	})
+	return i, err
+}
+
+// Restore moves an idea out of the trash and records who restored it.
+func (s ideaService) Restore(ctx context.Context, id string, req idea.RestoreIdeaRequest) (i idea.Idea, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if i, err = s.Service.Restore(ctx, id, req); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorEmail: req.RequesterUserEmail,
+			Action:     ActionIdeaRestored,
+			TargetType: TargetIdea,
+			TargetID:   id,
+		})
+	})
+	return i, err
+}
+
+// moderationRepository records the moderation decisions saved through a moderation repository.
+type moderationRepository struct {
+	moderation.Repository
+	audit Service
+}
+
+// NewModerationRepository returns a moderation repository which records the moderation decisions in the audit log,
+// in the same transaction as the decisions: the actions moderators apply, the decisions on reports and the ideas
+// hidden automatically once reported enough. Moderator notes are left out.
+func NewModerationRepository(repo moderation.Repository, audit Service) moderation.Repository {
+	return moderationRepository{repo, audit}
+}
+
+// CreateAction saves a moderation action and records it, unless it is a note.
+func (r moderationRepository) CreateAction(ctx context.Context, action entity.ModerationAction) error {
+	if err := r.Repository.CreateAction(ctx, action); err != nil || action.Action == moderation.ActionNote {
+		return err
+	}
+	return r.audit.Record(ctx, Record{
+		ActorID:    action.ModeratorID,
+		Action:     ActionIdeaModerated,
+		TargetType: TargetIdea,
+		TargetID:   action.IdeaID,
+		After:      ideaValues{Moderation: action.Action},
+	})
+}
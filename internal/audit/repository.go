@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Repository encapsulates the logic to access the audit log from the data source.
+type Repository interface {
+	// Create appends an entry to the audit log.
+	Create(ctx context.Context, entry entity.AuditEntry) error
+	// Count returns the number of entries matching the filter.
+	Count(ctx context.Context, filter Filter) (int, error)
+	// Query returns the entries matching the filter, newest first.
+	Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.AuditEntry, error)
+}
+
+// Filter represents the conditions audit entries are listed by. Empty conditions are ignored.
+type Filter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	// the entries created at or after this time
+	Since *time.Time
+	// the entries created before this time
+	Until *time.Time
+}
+
+// repository persists the audit log in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new audit repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Create saves a new audit entry in the database.
+func (r repository) Create(ctx context.Context, entry entity.AuditEntry) error {
+	return r.db.With(ctx).Model(&entry).Insert()
+}
+
+// Count returns the number of audit entries in the database matching the filter.
+func (r repository) Count(ctx context.Context, filter Filter) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("audit_entry").Where(filterExp(filter)).Row(&count)
+	return count, err
+}
+
+// Query reads the audit entries matching the filter from the database, newest first.
+func (r repository) Query(ctx context.Context, filter Filter, offset, limit int) ([]entity.AuditEntry, error) {
+	var entries []entity.AuditEntry
+	err := r.db.With(ctx).
+		Select().
+		Where(filterExp(filter)).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&entries)
+	return entries, err
+}
+
+func filterExp(filter Filter) dbx.Expression {
+	exp := dbx.HashExp{}
+	if filter.ActorID != "" {
+		exp["actor_id"] = filter.ActorID
+	}
+	if filter.Action != "" {
+		exp["action"] = filter.Action
+	}
+	if filter.TargetType != "" {
+		exp["target_type"] = filter.TargetType
+	}
+	if filter.TargetID != "" {
+		exp["target_id"] = filter.TargetID
+	}
+	exps := []dbx.Expression{exp}
+	if filter.Since != nil {
+		exps = append(exps, dbx.NewExp("created_at >= {:since}", dbx.Params{"since": *filter.Since}))
+	}
+	if filter.Until != nil {
+		exps = append(exps, dbx.NewExp("created_at < {:until}", dbx.Params{"until": *filter.Until}))
+	}
+	return dbx.And(exps...)
+}
@@ -0,0 +1,152 @@
+// Package audit keeps an append-only trail of the security-relevant and administrative actions: who did what to
+// which user or idea, from which IP address and in which request.
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"time"
+)
+
+// The actions recorded in the audit log.
+const (
+	ActionLogin          = "auth.login"
+	ActionLoginFailed    = "auth.login_failed"
+	ActionRegistered     = "auth.registered"
+	ActionEmailConfirmed = "auth.email_confirmed"
+	ActionUserCreated    = "user.created"
+	ActionUserUpdated    = "user.updated"
+	ActionUserDeleted    = "user.deleted"
+	ActionUserRestored   = "user.restored"
+	ActionUserErased     = "user.erased"
+	ActionRoleChanged    = "user.role_changed"
+	ActionEmailChanged   = "user.email_changed"
+	ActionIdeaStatus     = "idea.status_changed"
+	ActionIdeaModerated  = "idea.moderated"
+	ActionIdeaRestored   = "idea.restored"
+)
+
+// The types of the targets of the actions.
+const (
+	TargetUser = "user"
+	TargetIdea = "idea"
+)
+
+// Service encapsulates usecase logic for the audit log.
+type Service interface {
+	Record(ctx context.Context, record Record) error
+	Query(ctx context.Context, req QueryRequest, page, perPage int) (*pagination.Pages, error)
+}
+
+// Record represents an action to be appended to the audit log.
+type Record struct {
+	// the ID of the user who took the action
+	ActorID string
+	// the email address of the user who took the action, if the ID is not known
+	ActorEmail string
+	Action     string
+	TargetType string
+	TargetID   string
+	// the values of the target before and after the action, which are encoded in JSON. nil if not applicable
+	Before interface{}
+	After  interface{}
+}
+
+// QueryRequest represents a request to list audit entries.
+type QueryRequest struct {
+	RequesterUserEmail string
+	Filter
+}
+
+// Entry represents an audit entry, with the values before and after the action as JSON documents.
+type Entry struct {
+	entity.AuditEntry
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+type service struct {
+	repo        Repository
+	userService user.UserService
+	logger      log.Logger
+}
+
+// NewService creates a new audit service. The user service must not record in the audit log itself.
+func NewService(repo Repository, userService user.UserService, logger log.Logger) Service {
+	return service{repo, userService, logger}
+}
+
+// Record appends an action to the audit log, along with the IP address and the ID of the request in the context.
+// An actor given by an email address which doesn't belong to anybody is recorded as unknown.
+func (s service) Record(ctx context.Context, record Record) error {
+	if record.ActorID == "" && record.ActorEmail != "" {
+		actor, err := s.userService.GetUser(ctx, record.ActorEmail)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		record.ActorID = actor.ID
+	}
+	before, err := encode(record.Before)
+	if err != nil {
+		return err
+	}
+	after, err := encode(record.After)
+	if err != nil {
+		return err
+	}
+	return s.repo.Create(ctx, entity.AuditEntry{
+		ID:         entity.GenerateID(),
+		ActorID:    record.ActorID,
+		Action:     record.Action,
+		TargetType: record.TargetType,
+		TargetID:   record.TargetID,
+		Before:     before,
+		After:      after,
+		IP:         ClientIP(ctx),
+		RequestID:  log.RequestID(ctx),
+		CreatedAt:  time.Now(),
+	})
+}
+
+// Query returns a page of the audit entries matching the filter of the request, newest first.
+// Only admins may read the audit log.
+func (s service) Query(ctx context.Context, req QueryRequest, page, perPage int) (*pagination.Pages, error) {
+	requester, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return nil, errors.InternalServerError("Requester User doesn't exists")
+	}
+	if !user.IsAdmin(requester.Role) {
+		return nil, errors.Forbidden("Requester User doesn't have required permission")
+	}
+
+	count, err := s.repo.Count(ctx, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	items, err := s.repo.Query(ctx, req.Filter, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for _, item := range items {
+		entries = append(entries, Entry{item, json.RawMessage(item.Before), json.RawMessage(item.After)})
+	}
+	pages.Items = entries
+	return pages, nil
+}
+
+// encode returns the JSON encoding of a value, or an empty string if the value is nil.
+func encode(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
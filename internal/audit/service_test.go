@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/moderation"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+type recordingRepository struct {
+	Repository
+	entries []entity.AuditEntry
+}
+
+func (r *recordingRepository) Create(ctx context.Context, entry entity.AuditEntry) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func TestService_Record(t *testing.T) {
+	repo := &recordingRepository{}
+	logger, _ := log.NewForTest()
+	s := NewService(repo, nil, logger)
+
+	req := httptest.NewRequest("PUT", "/v1/admin/users/ada@example.com/role", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	req.RemoteAddr = "192.0.2.1:54321"
+	ctx := WithClientIP(log.WithRequest(context.Background(), req), clientIP(req, nil))
+
+	err := s.Record(ctx, Record{
+		ActorID:    "admin-1",
+		Action:     ActionRoleChanged,
+		TargetType: TargetUser,
+		TargetID:   "user-1",
+		Before:     userValues{Role: "visitor"},
+		After:      userValues{Role: "admin"},
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, repo.entries, 1) {
+		entry := repo.entries[0]
+		assert.NotEmpty(t, entry.ID)
+		assert.Equal(t, "admin-1", entry.ActorID)
+		assert.Equal(t, `{"role":"visitor"}`, entry.Before)
+		assert.Equal(t, `{"role":"admin"}`, entry.After)
+		assert.Equal(t, "192.0.2.1", entry.IP)
+		assert.Equal(t, "req-1", entry.RequestID)
+	}
+
+	assert.Nil(t, s.Record(context.Background(), Record{Action: ActionUserErased, TargetType: TargetUser, TargetID: "user-1"}))
+	assert.Equal(t, "", repo.entries[1].Before)
+}
+
+func Test_clientIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:54321"
+	assert.Equal(t, "192.0.2.1", clientIP(req, nil))
+
+	// the headers are ignored unless the request comes from a trusted proxy
+	req.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.1")
+	assert.Equal(t, "192.0.2.1", clientIP(req, nil))
+	assert.Equal(t, "192.0.2.1", clientIP(req, parseNetworks([]string{"10.0.0.0/8"})))
+
+	// the forged addresses at the start of X-Forwarded-For are skipped
+	proxies := parseNetworks([]string{"192.0.2.1", "10.0.0.0/8", "invalid"})
+	assert.Len(t, proxies, 2)
+	assert.Equal(t, "198.51.100.7", clientIP(req, proxies))
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7, 10.0.0.1")
+	assert.Equal(t, "198.51.100.7", clientIP(req, proxies))
+	req.Header.Set("X-Forwarded-For", "10.0.0.2, 10.0.0.1")
+	assert.Equal(t, "10.0.0.2", clientIP(req, proxies))
+
+	req.Header.Set("X-Real-IP", "203.0.113.5")
+	assert.Equal(t, "203.0.113.5", clientIP(req, proxies))
+}
+
+func Test_changedFields(t *testing.T) {
+	before := user.User{Users: entity.Users{Email: "ada@example.com", Name: "Ada", Country: "UK"}}
+	assert.Nil(t, changedFields(before, before))
+	after := user.User{Users: entity.Users{Email: "ada@example.com", Name: "Ada Lovelace", Country: "UK"}}
+	assert.Equal(t, []string{"name"}, changedFields(before, after))
+	after.Country = "FR"
+	assert.Equal(t, []string{"name", "country"}, changedFields(before, after))
+}
+
+type mockModerationRepository struct {
+	moderation.Repository
+	actions []entity.ModerationAction
+}
+
+func (r *mockModerationRepository) CreateAction(ctx context.Context, action entity.ModerationAction) error {
+	r.actions = append(r.actions, action)
+	return nil
+}
+
+func TestModerationRepository_CreateAction(t *testing.T) {
+	repo := &recordingRepository{}
+	logger, _ := log.NewForTest()
+	moderationRepo := &mockModerationRepository{}
+	r := NewModerationRepository(moderationRepo, NewService(repo, nil, logger))
+	ctx := context.Background()
+
+	assert.Nil(t, r.CreateAction(ctx, entity.ModerationAction{IdeaID: "i1", ModeratorID: "m1", Action: moderation.ActionHide, Note: "spam from Ada"}))
+	assert.Nil(t, r.CreateAction(ctx, entity.ModerationAction{IdeaID: "i1", ModeratorID: "m1", Action: moderation.ActionNote, Note: "watch"}))
+	assert.Nil(t, r.CreateAction(ctx, entity.ModerationAction{IdeaID: "i2", Action: "auto_hide"}))
+	assert.Len(t, moderationRepo.actions, 3)
+
+	// notes are not recorded, nor the text of the notes of the decisions
+	if assert.Len(t, repo.entries, 2) {
+		assert.Equal(t, "m1", repo.entries[0].ActorID)
+		assert.Equal(t, ActionIdeaModerated, repo.entries[0].Action)
+		assert.Equal(t, "i1", repo.entries[0].TargetID)
+		assert.Equal(t, `{"moderation":"hide"}`, repo.entries[0].After)
+		assert.Equal(t, "", repo.entries[1].ActorID)
+		assert.Equal(t, `{"moderation":"auto_hide"}`, repo.entries[1].After)
+	}
+}
@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/privacy"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+)
+
+// userValues are the values of a user recorded in the audit log. Empty values are left out. The email address,
+// the name and the country of users are personal data, which would outlive the erasure of the user in the audit
+// log, so only the names of the fields which changed are recorded.
+type userValues struct {
+	Role    string   `json:"role,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// userService records the changes made to users through a user service.
+type userService struct {
+	user.UserService
+	audit       Service
+	transaction dbcontext.TransactionFunc
+}
+
+// NewUserService returns a user service which records the changes of users, roles and email addresses
+// in the audit log, in the same transaction as the changes.
+func NewUserService(service user.UserService, audit Service, transaction dbcontext.TransactionFunc) user.UserService {
+	return userService{service, audit, transaction}
+}
+
+// CreateUser creates a user and records who created them.
+func (s userService) CreateUser(ctx context.Context, req user.CreateUserRequest) (u user.User, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if u, err = s.UserService.CreateUser(ctx, req); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorEmail: req.RequesterUserEmail,
+			Action:     ActionUserCreated,
+			TargetType: TargetUser,
+			TargetID:   u.ID,
+			After:      userValues{Role: u.Role},
+		})
+	})
+	return u, err
+}
+
+// RegisterUser creates a user who signs up on their own and records the registration.
+func (s userService) RegisterUser(ctx context.Context, req user.RegisterUserRequest) (u user.User, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if u, err = s.UserService.RegisterUser(ctx, req); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorID:    u.ID,
+			Action:     ActionRegistered,
+			TargetType: TargetUser,
+			TargetID:   u.ID,
+			After:      userValues{Role: u.Role},
+		})
+	})
+	return u, err
+}
+
+// UpdateUser updates a user and records which fields a requester changed. The internal updates which bypass
+// the permission checks are not recorded.
+func (s userService) UpdateUser(ctx context.Context, email string, req user.UpdateUserRequest, bypassAuth bool) (u user.User, err error) {
+	if bypassAuth {
+		return s.UserService.UpdateUser(ctx, email, req, bypassAuth)
+	}
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		// the service reports a missing user
+		before, _ := s.UserService.GetUser(ctx, email)
+		if u, err = s.UserService.UpdateUser(ctx, email, req, bypassAuth); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorEmail: req.RequesterUserEmail,
+			Action:     ActionUserUpdated,
+			TargetType: TargetUser,
+			TargetID:   u.ID,
+			After:      userValues{Changed: changedFields(before, u)},
+		})
+	})
+	return u, err
+}
+
+// DeleteUser moves a user to the trash and records who deleted them.
+func (s userService) DeleteUser(ctx context.Context, email string, req user.DeleteUserRequest) (u user.User, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if u, err = s.UserService.DeleteUser(ctx, email, req); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorEmail: req.RequesterUserEmail,
+			Action:     ActionUserDeleted,
+			TargetType: TargetUser,
+			TargetID:   u.ID,
+			Before:     userValues{Role: u.Role},
+		})
+	})
+	return u, err
+}
+
+// RestoreUser moves a user out of the trash and records who restored them.
+func (s userService) RestoreUser(ctx context.Context, email string, req user.RestoreUserRequest) (u user.User, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if u, err = s.UserService.RestoreUser(ctx, email, req); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorEmail: req.RequesterUserEmail,
+			Action:     ActionUserRestored,
+			TargetType: TargetUser,
+			TargetID:   u.ID,
+			After:      userValues{Role: u.Role},
+		})
+	})
+	return u, err
+}
+
+// ChangeRole changes the role of a user and records the previous and the new role, unless the role is unchanged.
+func (s userService) ChangeRole(ctx context.Context, email string, req user.ChangeRoleRequest) (u user.User, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		// the service reports a missing user
+		before, _ := s.UserService.GetUser(ctx, email)
+		if u, err = s.UserService.ChangeRole(ctx, email, req); err != nil || u.Role == before.Role {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorEmail: req.RequesterUserEmail,
+			Action:     ActionRoleChanged,
+			TargetType: TargetUser,
+			TargetID:   u.ID,
+			Before:     userValues{Role: before.Role},
+			After:      userValues{Role: u.Role},
+		})
+	})
+	return u, err
+}
+
+// SetEmail changes the email address of a user, which they confirmed, and records the change without the addresses.
+func (s userService) SetEmail(ctx context.Context, id string, email string) (u user.User, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if u, err = s.UserService.SetEmail(ctx, id, email); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorID:    id,
+			Action:     ActionEmailChanged,
+			TargetType: TargetUser,
+			TargetID:   id,
+		})
+	})
+	return u, err
+}
+
+// AuthenticateUser confirms the email address of a user and records the confirmation.
+func (s userService) AuthenticateUser(ctx context.Context, email string, code string) (u user.User, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if u, err = s.UserService.AuthenticateUser(ctx, email, code); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, Record{
+			ActorID:    u.ID,
+			Action:     ActionEmailConfirmed,
+			TargetType: TargetUser,
+			TargetID:   u.ID,
+		})
+	})
+	return u, err
+}
+
+// changedFields returns the names of the fields of a user which an update changed.
+func changedFields(before, after user.User) []string {
+	var fields []string
+	if before.Name != after.Name {
+		fields = append(fields, "name")
+	}
+	if before.Country != after.Country {
+		fields = append(fields, "country")
+	}
+	return fields
+}
+
+// privacyService records the erasures made through a privacy service.
+type privacyService struct {
+	privacy.Service
+	audit       Service
+	transaction dbcontext.TransactionFunc
+}
+
+// NewPrivacyService returns a privacy service which records the erasures of personal data in the audit log.
+func NewPrivacyService(service privacy.Service, audit Service, transaction dbcontext.TransactionFunc) privacy.Service {
+	return privacyService{service, audit, transaction}
+}
+
+// Erase erases the personal data of a user and records who erased it. Only the ID of the user is recorded,
+// as the rest is personal data.
+func (s privacyService) Erase(ctx context.Context, email string, req privacy.EraseRequest) (u entity.Users, err error) {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if u, err = s.Service.Erase(ctx, email, req); err != nil {
+			return err
+		}
+		record := Record{ActorEmail: req.RequesterUserEmail, Action: ActionUserErased, TargetType: TargetUser, TargetID: u.ID}
+		// users erasing their own data can no longer be found by their email address
+		if req.RequesterUserEmail == email {
+			record.ActorID = u.ID
+		}
+		return s.audit.Record(ctx, record)
+	})
+	return u, err
+}
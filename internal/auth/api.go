@@ -4,13 +4,34 @@ import (
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/qiangxue/go-rest-api/internal/errors"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"net/http"
 )
 
 // RegisterHandlers registers handlers for different HTTP requests.
 func RegisterHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
+	rg.Post("/login/code", requestCode(service, logger))
 	rg.Post("/login", login(service, logger))
 }
 
+// requestCode returns a handler that handles the request of a login code.
+func requestCode(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req struct {
+			Email string `json:"email"`
+		}
+
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		if err := service.RequestCode(c.Request.Context(), req.Email); err != nil {
+			return err
+		}
+		return c.WriteWithStatus(struct{}{}, http.StatusAccepted)
+	}
+}
+
 // login returns a handler that handles user login request.
 func login(service Service, logger log.Logger) routing.Handler {
 	return func(c *routing.Context) error {
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access login codes from the data source.
+type Repository interface {
+	// Get returns the pending login code of the specified user.
+	Get(ctx context.Context, userID string) (entity.LoginCode, error)
+
+	// Save saves the pending login code of a user, replacing the previous one if any.
+	Save(ctx context.Context, code entity.LoginCode) error
+
+	// Delete removes the pending login code of the specified user.
+	Delete(ctx context.Context, userID string) error
+}
+
+// repository persists login codes in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new login code repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the pending login code of the specified user from the database.
+func (r repository) Get(ctx context.Context, userID string) (entity.LoginCode, error) {
+	var code entity.LoginCode
+	err := r.db.With(ctx).Select().Model(userID, &code)
+	return code, err
+}
+
+// Save saves the pending login code of a user in the database, replacing the previous one if any.
+func (r repository) Save(ctx context.Context, code entity.LoginCode) error {
+	if err := r.Delete(ctx, code.UserID); err != nil {
+		return err
+	}
+	return r.db.With(ctx).Model(&code).Insert()
+}
+
+// Delete removes the pending login code of the specified user from the database.
+func (r repository) Delete(ctx context.Context, userID string) error {
+	_, err := r.db.With(ctx).Delete("login_code", dbx.HashExp{"user_id": userID}).Execute()
+	return err
+}
@@ -1,18 +1,39 @@
 package auth
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/notification"
+	"github.com/qiangxue/go-rest-api/internal/user"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"strings"
+	"text/template"
 	"time"
 )
 
+var codeEmail = template.Must(template.New("code").Parse(`Hello {{.Name}},
+
+Your login code, valid until {{.ExpiresAt.Format "January 2, 2006 15:04 MST"}}:
+{{.Code}}
+
+If you didn't try to log in, you can ignore this email.
+`))
+
 // Service encapsulates the authentication logic.
 type Service interface {
-	// authenticate authenticates a user using username and password.
-	// It returns a JWT token if authentication succeeds. Otherwise, an error is returned.
+	// RequestCode emails a single-use login code to the user with the given email address.
+	RequestCode(ctx context.Context, email string) error
+	// authenticate authenticates a user using username and password, which are their email address and
+	// a login code. It returns a JWT token if authentication succeeds. Otherwise, an error is returned.
 	Login(ctx context.Context, username, password string) (string, error)
 }
 
@@ -25,38 +46,103 @@ type Identity interface {
 }
 
 type service struct {
+	repo            Repository
+	userService     user.UserService
+	mailer          notification.Mailer
 	signingKey      string
 	tokenExpiration int
+	codeExpiration  time.Duration
 	logger          log.Logger
 }
 
-// NewService creates a new authentication service.
-func NewService(signingKey string, tokenExpiration int, logger log.Logger) Service {
-	return service{signingKey, tokenExpiration, logger}
+// NewService creates a new authentication service. Login codes expire after the given duration.
+func NewService(repo Repository, userService user.UserService, mailer notification.Mailer, signingKey string,
+	tokenExpiration int, codeExpiration time.Duration, logger log.Logger) Service {
+	return service{repo, userService, mailer, signingKey, tokenExpiration, codeExpiration, logger}
+}
+
+// RequestCode emails a login code to the user with the given email address, replacing their previous code.
+// Nothing is sent if nobody has the address, without telling the requester, so that the addresses of the users
+// cannot be discovered.
+func (s service) RequestCode(ctx context.Context, email string) error {
+	u, err := s.userService.GetUser(ctx, strings.TrimSpace(email))
+	if err == sql.ErrNoRows {
+		s.logger.With(ctx).Info("login code requested for an unknown email address")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	loginCode := entity.LoginCode{
+		UserID:    u.ID,
+		CodeHash:  hashCode(code),
+		ExpiresAt: now.Add(s.codeExpiration),
+		CreatedAt: now,
+	}
+	if err := s.repo.Save(ctx, loginCode); err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	err = codeEmail.Execute(&body, struct {
+		Name      string
+		ExpiresAt time.Time
+		Code      string
+	}{u.Name, loginCode.ExpiresAt, code})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, u.Email, "Your login code", body.String())
 }
 
 // Login authenticates a user and generates a JWT token if authentication succeeds.
 // Otherwise, an error is returned.
 func (s service) Login(ctx context.Context, username, password string) (string, error) {
-	if identity := s.authenticate(ctx, username, password); identity != nil {
-		return s.generateJWT(identity)
+	identity, err := s.authenticate(ctx, username, password)
+	if err != nil {
+		return "", err
+	}
+	if identity == nil {
+		return "", errors.Unauthorized("")
 	}
-	return "", errors.Unauthorized("")
+	return s.generateJWT(identity)
 }
 
-// authenticate authenticates a user using username and password.
-// If username and password are correct, an identity is returned. Otherwise, nil is returned.
-func (s service) authenticate(ctx context.Context, username, password string) Identity {
-	logger := s.logger.With(ctx, "user", username)
+// authenticate authenticates a user using username and password: their email address and a login code, which
+// can only be used once. If they are correct, an identity is returned. Otherwise, nil is returned.
+func (s service) authenticate(ctx context.Context, username, password string) (Identity, error) {
+	logger := s.logger.With(ctx)
 
-	// TODO: the following authentication logic is only for demo purpose
-	if username == "demo" && password == "pass" {
-		logger.Infof("authentication successful")
-		return entity.Users{ID: "100", Name: "demo"}
+	u, err := s.userService.GetUser(ctx, strings.TrimSpace(username))
+	if err == sql.ErrNoRows {
+		logger.Infof("authentication failed")
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	logger = s.logger.With(ctx, "user", u.ID)
+	loginCode, err := s.repo.Get(ctx, u.ID)
+	if err == sql.ErrNoRows {
+		logger.Infof("authentication failed")
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(loginCode.CodeHash), []byte(hashCode(password))) != 1 ||
+		!loginCode.ExpiresAt.After(time.Now()) {
+		logger.Infof("authentication failed")
+		return nil, nil
+	}
+	if err := s.repo.Delete(ctx, u.ID); err != nil {
+		return nil, err
 	}
 
-	logger.Infof("authentication failed")
-	return nil
+	logger.Infof("authentication successful")
+	return u.Users, nil
 }
 
 // generateJWT generates a JWT that encodes an identity.
@@ -67,3 +153,18 @@ func (s service) generateJWT(identity Identity) (string, error) {
 		"exp":  time.Now().Add(time.Duration(s.tokenExpiration) * time.Hour).Unix(),
 	}).SignedString([]byte(s.signingKey))
 }
+
+// generateCode returns a random login code.
+func generateCode() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashCode returns the hash under which a login code is stored.
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockUserService struct {
+	user.UserService
+	users []entity.Users
+}
+
+func (m mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	for _, u := range m.users {
+		if u.Email == email {
+			return user.User{Users: u}, nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+type mockRepository struct {
+	codes map[string]entity.LoginCode
+}
+
+func (m mockRepository) Get(ctx context.Context, userID string) (entity.LoginCode, error) {
+	if code, ok := m.codes[userID]; ok {
+		return code, nil
+	}
+	return entity.LoginCode{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Save(ctx context.Context, code entity.LoginCode) error {
+	m.codes[code.UserID] = code
+	return nil
+}
+
+func (m mockRepository) Delete(ctx context.Context, userID string) error {
+	delete(m.codes, userID)
+	return nil
+}
+
+type mockMailer struct {
+	to, body []string
+}
+
+func (m *mockMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.to = append(m.to, to)
+	m.body = append(m.body, body)
+	return nil
+}
+
+// code returns the login code in the last email sent.
+func (m *mockMailer) code() string {
+	lines := strings.Split(m.body[len(m.body)-1], "\n")
+	return lines[3]
+}
+
+func TestService_Login(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := mockRepository{map[string]entity.LoginCode{}}
+	mailer := &mockMailer{}
+	users := mockUserService{users: []entity.Users{{ID: "u1", Email: "ann@example.com", Name: "Ann"}}}
+	s := NewService(repo, users, mailer, "key", 1, time.Minute, logger)
+	ctx := context.Background()
+
+	// nothing is sent to unknown addresses, without failing
+	assert.Nil(t, s.RequestCode(ctx, "bob@example.com"))
+	assert.Empty(t, mailer.to)
+	_, err := s.Login(ctx, "ann@example.com", "")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, s.RequestCode(ctx, "ann@example.com"))
+	assert.Equal(t, []string{"ann@example.com"}, mailer.to)
+	code := mailer.code()
+	assert.NotEqual(t, code, repo.codes["u1"].CodeHash)
+
+	_, err = s.Login(ctx, "ann@example.com", "wrong")
+	assert.NotNil(t, err)
+	_, err = s.Login(ctx, "bob@example.com", code)
+	assert.NotNil(t, err)
+
+	token, err := s.Login(ctx, "ann@example.com", code)
+	assert.Nil(t, err)
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return []byte("key"), nil })
+	if assert.Nil(t, err) {
+		assert.Equal(t, "u1", parsed.Claims.(jwt.MapClaims)["id"])
+		assert.Equal(t, "Ann", parsed.Claims.(jwt.MapClaims)["name"])
+	}
+
+	// a code can only be used once
+	_, err = s.Login(ctx, "ann@example.com", code)
+	assert.NotNil(t, err)
+
+	// nor after it expired
+	assert.Nil(t, s.RequestCode(ctx, "ann@example.com"))
+	expired := repo.codes["u1"]
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	repo.codes["u1"] = expired
+	_, err = s.Login(ctx, "ann@example.com", mailer.code())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,98 @@
+package campaign
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"net/http"
+	"strconv"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/campaigns", res.query)
+	r.Get("/campaigns/<id>", res.get)
+	r.Post("/campaigns", res.create)
+	r.Put("/campaigns/<id>", res.update)
+	r.Delete("/campaigns/<id>", res.delete)
+	r.Get("/campaigns/<id>/leaderboard", res.leaderboard)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) query(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Query(c.Request.Context(), c.Query("state"), page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
+
+func (r resource) get(c *routing.Context) error {
+	campaign, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(campaign)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateCampaignRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	campaign, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(campaign, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	var input UpdateCampaignRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	campaign, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(campaign)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	var input DeleteCampaignRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	campaign, err := r.service.Delete(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(campaign)
+}
+
+func (r resource) leaderboard(c *routing.Context) error {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	leaderboard, err := r.service.Leaderboard(c.Request.Context(), c.Param("id"), limit)
+	if err != nil {
+		return err
+	}
+	return c.Write(leaderboard)
+}
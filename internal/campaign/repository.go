@@ -0,0 +1,153 @@
+package campaign
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Repository encapsulates the logic to access campaigns from the data source.
+type Repository interface {
+	// Get returns the campaign with the specified ID.
+	Get(ctx context.Context, id string) (entity.Campaign, error)
+
+	// Count returns the number of campaigns in the given state at the given time.
+	Count(ctx context.Context, state string, now time.Time) (int, error)
+
+	// Query returns the campaigns in the given state at the given time, latest opening first.
+	Query(ctx context.Context, state string, now time.Time, offset, limit int) ([]entity.Campaign, error)
+
+	// Create saves a new campaign in the storage.
+	Create(ctx context.Context, campaign entity.Campaign) error
+
+	// Update saves the changes to a campaign in the storage.
+	Update(ctx context.Context, campaign entity.Campaign) error
+
+	// Delete removes the campaign with the specified ID from the storage.
+	Delete(ctx context.Context, id string) error
+
+	// CountIdeas returns the number of ideas attached to the campaign, including the ideas in the trash.
+	CountIdeas(ctx context.Context, id string) (int, error)
+
+	// TopIdeas returns the visible ideas of the campaign with the most votes.
+	TopIdeas(ctx context.Context, id string, limit int) ([]entity.Idea, error)
+
+	// TopAuthors returns the authors whose visible ideas in the campaign received the most votes.
+	TopAuthors(ctx context.Context, id string, limit int) ([]AuthorStanding, error)
+}
+
+// AuthorStanding represents the results of an author in a campaign.
+type AuthorStanding struct {
+	AuthorID string `json:"author_id"`
+	Ideas    int    `json:"ideas"`
+	Votes    int    `json:"votes"`
+}
+
+// visibleIdea matches the ideas that are neither in the trash nor hidden by moderation.
+var visibleIdea = dbx.NewExp("deleted_at IS NULL AND bad_flag IS NOT TRUE")
+
+// repository persists campaigns in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new campaign repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the campaign with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Campaign, error) {
+	var campaign entity.Campaign
+	err := r.db.With(ctx).Select().Model(id, &campaign)
+	return campaign, err
+}
+
+// Count returns the number of campaigns in the given state.
+func (r repository) Count(ctx context.Context, state string, now time.Time) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("campaign").Where(stateExp(state, now)).Row(&count)
+	return count, err
+}
+
+// Query retrieves the campaigns in the given state from the database.
+func (r repository) Query(ctx context.Context, state string, now time.Time, offset, limit int) ([]entity.Campaign, error) {
+	var campaigns []entity.Campaign
+	err := r.db.With(ctx).
+		Select().
+		Where(stateExp(state, now)).
+		OrderBy("opens_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&campaigns)
+	return campaigns, err
+}
+
+// Create saves a new campaign record in the database.
+func (r repository) Create(ctx context.Context, campaign entity.Campaign) error {
+	return r.db.With(ctx).Model(&campaign).Insert()
+}
+
+// Update saves the changes to a campaign in the database.
+func (r repository) Update(ctx context.Context, campaign entity.Campaign) error {
+	return r.db.With(ctx).Model(&campaign).Update()
+}
+
+// Delete deletes the campaign with the specified ID from the database.
+func (r repository) Delete(ctx context.Context, id string) error {
+	campaign, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.With(ctx).Model(&campaign).Delete()
+}
+
+// CountIdeas returns the number of ideas attached to the campaign.
+func (r repository) CountIdeas(ctx context.Context, id string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("idea").Where(dbx.HashExp{"campaign_id": id}).Row(&count)
+	return count, err
+}
+
+// TopIdeas returns the visible ideas of the campaign with the most votes, oldest first on ties.
+func (r repository) TopIdeas(ctx context.Context, id string, limit int) ([]entity.Idea, error) {
+	var ideas []entity.Idea
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.And(dbx.HashExp{"campaign_id": id}, visibleIdea)).
+		OrderBy("votes DESC", "created_at", "id").
+		Limit(int64(limit)).
+		All(&ideas)
+	return ideas, err
+}
+
+// TopAuthors returns the authors whose visible ideas in the campaign received the most votes.
+func (r repository) TopAuthors(ctx context.Context, id string, limit int) ([]AuthorStanding, error) {
+	var authors []AuthorStanding
+	err := r.db.With(ctx).
+		Select("author_id", "COUNT(*) AS ideas", "SUM(votes) AS votes").
+		From("idea").
+		Where(dbx.And(dbx.HashExp{"campaign_id": id}, visibleIdea)).
+		GroupBy("author_id").
+		OrderBy("votes DESC", "ideas DESC", "author_id").
+		Limit(int64(limit)).
+		All(&authors)
+	return authors, err
+}
+
+// stateExp returns the condition matching the campaigns in the given state. All campaigns match an empty state.
+func stateExp(state string, now time.Time) dbx.Expression {
+	switch state {
+	case StateUpcoming:
+		return dbx.NewExp("opens_at > {:now}", dbx.Params{"now": now})
+	case StateOpen:
+		return dbx.NewExp("opens_at <= {:now} AND closes_at > {:now}", dbx.Params{"now": now})
+	case StateClosed:
+		return dbx.NewExp("closes_at <= {:now}", dbx.Params{"now": now})
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package campaign
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"strings"
+	"time"
+)
+
+// States of a campaign relative to its submission window.
+const (
+	StateUpcoming = "upcoming"
+	StateOpen     = "open"
+	StateClosed   = "closed"
+)
+
+const (
+	// defaultLeaderboardSize is the number of ideas and authors returned by a leaderboard by default.
+	defaultLeaderboardSize = 10
+	// maxLeaderboardSize is the largest number of ideas and authors returned by a leaderboard.
+	maxLeaderboardSize = 100
+)
+
+// Service encapsulates usecase logic for campaigns.
+type Service interface {
+	Get(ctx context.Context, id string) (Campaign, error)
+	Query(ctx context.Context, state string, page, perPage int) (*pagination.Pages, error)
+	Create(ctx context.Context, req CreateCampaignRequest) (Campaign, error)
+	Update(ctx context.Context, id string, req UpdateCampaignRequest) (Campaign, error)
+	Delete(ctx context.Context, id string, req DeleteCampaignRequest) (Campaign, error)
+	Leaderboard(ctx context.Context, id string, limit int) (Leaderboard, error)
+	CheckSubmit(ctx context.Context, id string, role string) error
+	CheckVote(ctx context.Context, id string, role string) error
+}
+
+// Campaign represents a campaign together with its current state.
+type Campaign struct {
+	entity.Campaign
+	// one of "upcoming", "open" or "closed"
+	State string `json:"state"`
+}
+
+// Leaderboard represents the ranking of the ideas and the authors of a campaign.
+type Leaderboard struct {
+	Campaign Campaign         `json:"campaign"`
+	Ideas    []entity.Idea    `json:"ideas"`
+	Authors  []AuthorStanding `json:"authors"`
+}
+
+// CreateCampaignRequest represents a campaign creation request.
+type CreateCampaignRequest struct {
+	RequesterUserEmail string    `json:"requester_user_email"`
+	Title              string    `json:"title"`
+	Description        string    `json:"description"`
+	OpensAt            time.Time `json:"opens_at"`
+	ClosesAt           time.Time `json:"closes_at"`
+	// the roles allowed to submit ideas. Everyone may submit if empty.
+	SubmitRoles []string `json:"submit_roles"`
+	// the roles allowed to vote on ideas. Everyone may vote if empty.
+	VoteRoles []string `json:"vote_roles"`
+}
+
+// UpdateCampaignRequest represents a campaign update request.
+type UpdateCampaignRequest struct {
+	RequesterUserEmail string    `json:"requester_user_email"`
+	Title              string    `json:"title"`
+	Description        string    `json:"description"`
+	OpensAt            time.Time `json:"opens_at"`
+	ClosesAt           time.Time `json:"closes_at"`
+	SubmitRoles        []string  `json:"submit_roles"`
+	VoteRoles          []string  `json:"vote_roles"`
+}
+
+// DeleteCampaignRequest represents a campaign deletion request.
+type DeleteCampaignRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
+
+type service struct {
+	repo        Repository
+	userService user.UserService
+	logger      log.Logger
+	// the clock the submission windows are checked against
+	now func() time.Time
+}
+
+// NewService creates a new campaign service.
+func NewService(repo Repository, userService user.UserService, logger log.Logger) Service {
+	return service{repo, userService, logger, time.Now}
+}
+
+// Get returns the campaign with the specified ID.
+func (s service) Get(ctx context.Context, id string) (Campaign, error) {
+	campaign, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Campaign{}, err
+	}
+	return withState(campaign, s.now()), nil
+}
+
+// Query returns a page of the campaigns in the given state, or of all campaigns if the state is empty.
+func (s service) Query(ctx context.Context, state string, page, perPage int) (*pagination.Pages, error) {
+	if state != "" && state != StateUpcoming && state != StateOpen && state != StateClosed {
+		return nil, errors.BadRequest("Unknown campaign state : " + state)
+	}
+	now := s.now()
+	count, err := s.repo.Count(ctx, state, now)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	items, err := s.repo.Query(ctx, state, now, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	result := []Campaign{}
+	for _, item := range items {
+		result = append(result, withState(item, now))
+	}
+	pages.Items = result
+	return pages, nil
+}
+
+// Create creates a new campaign. Only admins may create campaigns.
+func (s service) Create(ctx context.Context, req CreateCampaignRequest) (Campaign, error) {
+	requester, err := s.checkAdmin(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return Campaign{}, err
+	}
+	now := s.now()
+	campaign := entity.Campaign{
+		ID:          entity.GenerateID(),
+		Title:       strings.TrimSpace(req.Title),
+		Description: req.Description,
+		OpensAt:     req.OpensAt,
+		ClosesAt:    req.ClosesAt,
+		SubmitRoles: nonNil(req.SubmitRoles),
+		VoteRoles:   nonNil(req.VoteRoles),
+		CreatedBy:   requester.ID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := validate(campaign); err != nil {
+		return Campaign{}, err
+	}
+	if err := s.repo.Create(ctx, campaign); err != nil {
+		return Campaign{}, err
+	}
+	return withState(campaign, now), nil
+}
+
+// Update changes the details and the submission window of a campaign. Only admins may update campaigns.
+func (s service) Update(ctx context.Context, id string, req UpdateCampaignRequest) (Campaign, error) {
+	if _, err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return Campaign{}, err
+	}
+	campaign, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Campaign{}, err
+	}
+	now := s.now()
+	campaign.Title = strings.TrimSpace(req.Title)
+	campaign.Description = req.Description
+	campaign.OpensAt = req.OpensAt
+	campaign.ClosesAt = req.ClosesAt
+	campaign.SubmitRoles = nonNil(req.SubmitRoles)
+	campaign.VoteRoles = nonNil(req.VoteRoles)
+	campaign.UpdatedAt = now
+	if err := validate(campaign); err != nil {
+		return Campaign{}, err
+	}
+	if err := s.repo.Update(ctx, campaign); err != nil {
+		return Campaign{}, err
+	}
+	return withState(campaign, now), nil
+}
+
+// Delete deletes a campaign that has no ideas. Only admins may delete campaigns.
+func (s service) Delete(ctx context.Context, id string, req DeleteCampaignRequest) (Campaign, error) {
+	if _, err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return Campaign{}, err
+	}
+	campaign, err := s.Get(ctx, id)
+	if err != nil {
+		return Campaign{}, err
+	}
+	count, err := s.repo.CountIdeas(ctx, id)
+	if err != nil {
+		return Campaign{}, err
+	}
+	if count > 0 {
+		return Campaign{}, errors.BadRequest("A campaign with ideas cannot be deleted")
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return Campaign{}, err
+	}
+	return campaign, nil
+}
+
+// Leaderboard returns the ideas of a campaign with the most votes and the authors whose ideas received the most votes.
+func (s service) Leaderboard(ctx context.Context, id string, limit int) (Leaderboard, error) {
+	campaign, err := s.Get(ctx, id)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+	if limit <= 0 || limit > maxLeaderboardSize {
+		limit = defaultLeaderboardSize
+	}
+	ideas, err := s.repo.TopIdeas(ctx, id, limit)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+	authors, err := s.repo.TopAuthors(ctx, id, limit)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+	if ideas == nil {
+		ideas = []entity.Idea{}
+	}
+	if authors == nil {
+		authors = []AuthorStanding{}
+	}
+	return Leaderboard{campaign, ideas, authors}, nil
+}
+
+// CheckSubmit checks that a user with the given role can submit an idea to the campaign now.
+func (s service) CheckSubmit(ctx context.Context, id string, role string) error {
+	return s.check(ctx, id, role, "submit ideas to", func(c entity.Campaign) []string { return c.SubmitRoles })
+}
+
+// CheckVote checks that a user with the given role can vote on the ideas of the campaign now.
+func (s service) CheckVote(ctx context.Context, id string, role string) error {
+	return s.check(ctx, id, role, "vote in", func(c entity.Campaign) []string { return c.VoteRoles })
+}
+
+func (s service) check(ctx context.Context, id, role, action string, allowed func(entity.Campaign) []string) error {
+	campaign, err := s.repo.Get(ctx, id)
+	if err == sql.ErrNoRows {
+		return errors.BadRequest("This campaign doesn't exists in the system : " + id)
+	} else if err != nil {
+		return err
+	}
+	if !campaign.IsOpen(s.now()) {
+		return errors.BadRequest("The campaign is not open, it runs from " +
+			campaign.OpensAt.Format(time.RFC3339) + " to " + campaign.ClosesAt.Format(time.RFC3339))
+	}
+	roles := allowed(campaign)
+	if len(roles) == 0 {
+		return nil
+	}
+	for _, r := range roles {
+		if r == role {
+			return nil
+		}
+	}
+	return errors.Forbidden("Users with the role " + role + " cannot " + action + " this campaign")
+}
+
+func (s service) checkAdmin(ctx context.Context, requesterEmail string) (user.User, error) {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return user.User{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	if !user.IsAdmin(requester.Role) {
+		return user.User{}, errors.Forbidden("Requester User doesn't have permission to manage campaigns")
+	}
+	return requester, nil
+}
+
+// validate checks the details of a campaign.
+func validate(campaign entity.Campaign) error {
+	if campaign.Title == "" {
+		return errors.BadRequest("A campaign title is required")
+	}
+	if campaign.OpensAt.IsZero() || campaign.ClosesAt.IsZero() {
+		return errors.BadRequest("The opening and closing dates of the campaign are required")
+	}
+	if !campaign.ClosesAt.After(campaign.OpensAt) {
+		return errors.BadRequest("A campaign must close after it opens")
+	}
+	for _, role := range append(append([]string{}, campaign.SubmitRoles...), campaign.VoteRoles...) {
+		if !user.IsRole(role) {
+			return errors.BadRequest("This role doesn't exists in the system : " + role)
+		}
+	}
+	return nil
+}
+
+// withState adds the state of the campaign at the given time.
+func withState(campaign entity.Campaign, now time.Time) Campaign {
+	state := StateOpen
+	if now.Before(campaign.OpensAt) {
+		state = StateUpcoming
+	} else if !now.Before(campaign.ClosesAt) {
+		state = StateClosed
+	}
+	return Campaign{campaign, state}
+}
+
+func nonNil(roles []string) []string {
+	if roles == nil {
+		return []string{}
+	}
+	return roles
+}
@@ -0,0 +1,234 @@
+package campaign
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+)
+
+// now is the fixed time the tests run at.
+var now = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+type mockRepository struct {
+	Repository
+	campaigns map[string]entity.Campaign
+	ideas     []entity.Idea
+	// the limit of the last leaderboard query
+	limit int
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.Campaign, error) {
+	if campaign, ok := m.campaigns[id]; ok {
+		return campaign, nil
+	}
+	return entity.Campaign{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Create(ctx context.Context, campaign entity.Campaign) error {
+	m.campaigns[campaign.ID] = campaign
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, campaign entity.Campaign) error {
+	m.campaigns[campaign.ID] = campaign
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	delete(m.campaigns, id)
+	return nil
+}
+
+func (m *mockRepository) CountIdeas(ctx context.Context, id string) (int, error) {
+	count := 0
+	for _, item := range m.ideas {
+		if item.CampaignID == id {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockRepository) TopIdeas(ctx context.Context, id string, limit int) ([]entity.Idea, error) {
+	m.limit = limit
+	var ideas []entity.Idea
+	for _, item := range m.ideas {
+		if item.CampaignID == id {
+			ideas = append(ideas, item)
+		}
+	}
+	sort.SliceStable(ideas, func(i, j int) bool { return ideas[i].Votes > ideas[j].Votes })
+	if len(ideas) > limit {
+		ideas = ideas[:limit]
+	}
+	return ideas, nil
+}
+
+func (m *mockRepository) TopAuthors(ctx context.Context, id string, limit int) ([]AuthorStanding, error) {
+	return nil, nil
+}
+
+type mockUserService struct {
+	user.UserService
+}
+
+func (m mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	if email == "admin@example.com" {
+		return user.User{Users: entity.Users{ID: "admin-1", Email: email, Role: user.ADMIN}}, nil
+	}
+	return user.User{Users: entity.Users{ID: "visitor-1", Email: email, Role: user.VISITOR}}, nil
+}
+
+func newTestService() (service, *mockRepository) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{
+		campaigns: map[string]entity.Campaign{
+			"upcoming": {ID: "upcoming", Title: "Upcoming", OpensAt: now.Add(time.Hour), ClosesAt: now.Add(48 * time.Hour)},
+			"open": {ID: "open", Title: "Open", OpensAt: now.Add(-time.Hour), ClosesAt: now.Add(time.Hour),
+				SubmitRoles: []string{user.ADMIN}, VoteRoles: []string{}},
+			"closed": {ID: "closed", Title: "Closed", OpensAt: now.Add(-48 * time.Hour), ClosesAt: now},
+		},
+		ideas: []entity.Idea{
+			{ID: "i1", CampaignID: "open", Votes: 3},
+			{ID: "i2", CampaignID: "open", Votes: 7},
+		},
+	}
+	return service{repo, mockUserService{}, logger, func() time.Time { return now }}, repo
+}
+
+func TestService_Get_state(t *testing.T) {
+	s, _ := newTestService()
+	ctx := context.Background()
+
+	for id, state := range map[string]string{"upcoming": StateUpcoming, "open": StateOpen, "closed": StateClosed} {
+		campaign, err := s.Get(ctx, id)
+		assert.Nil(t, err)
+		assert.Equal(t, state, campaign.State, id)
+	}
+}
+
+func TestService_CheckSubmit(t *testing.T) {
+	s, _ := newTestService()
+	ctx := context.Background()
+
+	assert.Nil(t, s.CheckSubmit(ctx, "open", user.ADMIN))
+	// only the listed roles may submit
+	err := s.CheckSubmit(ctx, "open", user.VISITOR)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusForbidden, err.(errors.ErrorResponse).StatusCode())
+	}
+	// and only while the campaign is open; it closes at its closing time
+	assert.NotNil(t, s.CheckSubmit(ctx, "upcoming", user.ADMIN))
+	assert.NotNil(t, s.CheckSubmit(ctx, "closed", user.ADMIN))
+	assert.NotNil(t, s.CheckSubmit(ctx, "unknown", user.ADMIN))
+
+	// the window is checked against the clock
+	s.now = func() time.Time { return now.Add(time.Hour) }
+	assert.Nil(t, s.CheckSubmit(ctx, "upcoming", user.VISITOR))
+	assert.NotNil(t, s.CheckSubmit(ctx, "open", user.ADMIN))
+}
+
+func TestService_CheckVote(t *testing.T) {
+	s, _ := newTestService()
+	ctx := context.Background()
+
+	// everyone may vote when no role is listed
+	assert.Nil(t, s.CheckVote(ctx, "open", user.VISITOR))
+	assert.Nil(t, s.CheckVote(ctx, "open", user.ADMIN))
+	assert.NotNil(t, s.CheckVote(ctx, "closed", user.VISITOR))
+	assert.NotNil(t, s.CheckVote(ctx, "upcoming", user.VISITOR))
+}
+
+func TestService_Create(t *testing.T) {
+	s, repo := newTestService()
+	ctx := context.Background()
+	req := CreateCampaignRequest{
+		RequesterUserEmail: "admin@example.com",
+		Title:              " Green office ",
+		OpensAt:            now,
+		ClosesAt:           now.Add(24 * time.Hour),
+		VoteRoles:          []string{user.VISITOR},
+	}
+
+	campaign, err := s.Create(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "Green office", campaign.Title)
+	assert.Equal(t, StateOpen, campaign.State)
+	assert.Equal(t, "admin-1", campaign.CreatedBy)
+	assert.Empty(t, campaign.SubmitRoles)
+	assert.NotNil(t, campaign.SubmitRoles)
+	assert.Equal(t, now, campaign.CreatedAt)
+	assert.Contains(t, repo.campaigns, campaign.ID)
+
+	invalid := req
+	invalid.RequesterUserEmail = "ann@example.com"
+	_, err = s.Create(ctx, invalid)
+	assert.NotNil(t, err)
+	invalid = req
+	invalid.ClosesAt = req.OpensAt
+	_, err = s.Create(ctx, invalid)
+	assert.NotNil(t, err)
+	invalid = req
+	invalid.SubmitRoles = []string{"owner"}
+	_, err = s.Create(ctx, invalid)
+	assert.NotNil(t, err)
+	invalid = req
+	invalid.Title = " "
+	_, err = s.Create(ctx, invalid)
+	assert.NotNil(t, err)
+	assert.Len(t, repo.campaigns, 4)
+}
+
+func TestService_Delete(t *testing.T) {
+	s, repo := newTestService()
+	ctx := context.Background()
+
+	// campaigns with ideas are kept
+	_, err := s.Delete(ctx, "open", DeleteCampaignRequest{RequesterUserEmail: "admin@example.com"})
+	assert.NotNil(t, err)
+	_, err = s.Delete(ctx, "closed", DeleteCampaignRequest{RequesterUserEmail: "ann@example.com"})
+	assert.NotNil(t, err)
+
+	campaign, err := s.Delete(ctx, "closed", DeleteCampaignRequest{RequesterUserEmail: "admin@example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, StateClosed, campaign.State)
+	assert.NotContains(t, repo.campaigns, "closed")
+}
+
+func TestService_Leaderboard(t *testing.T) {
+	s, repo := newTestService()
+	ctx := context.Background()
+
+	leaderboard, err := s.Leaderboard(ctx, "open", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultLeaderboardSize, repo.limit)
+	assert.Equal(t, StateOpen, leaderboard.Campaign.State)
+	if assert.Len(t, leaderboard.Ideas, 2) {
+		assert.Equal(t, "i2", leaderboard.Ideas[0].ID)
+		assert.Equal(t, "i1", leaderboard.Ideas[1].ID)
+	}
+	assert.Equal(t, []AuthorStanding{}, leaderboard.Authors)
+
+	leaderboard, err = s.Leaderboard(ctx, "open", 1)
+	assert.Nil(t, err)
+	assert.Len(t, leaderboard.Ideas, 1)
+	_, err = s.Leaderboard(ctx, "open", maxLeaderboardSize+1)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultLeaderboardSize, repo.limit)
+
+	// campaigns without ideas have empty leaderboards
+	leaderboard, err = s.Leaderboard(ctx, "closed", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, []entity.Idea{}, leaderboard.Ideas)
+
+	_, err = s.Leaderboard(ctx, "unknown", 5)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
@@ -3,14 +3,40 @@ package config
 import (
 	"github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/qiangxue/go-env"
+	"github.com/qiangxue/go-rest-api/internal/reputation"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"net"
+	"strings"
 )
 
 const (
-	defaultServerPort         = 8080
-	defaultJWTExpirationHours = 72
+	defaultServerPort              = 8080
+	defaultJWTExpirationHours      = 72
+	defaultReportAutoHideThreshold = 3
+	defaultTrashRetentionDays      = 30
+	defaultEventRetentionDays      = 7
+	defaultMediaLocalDir           = "./data/media"
+	defaultMediaMaxSize            = 10 << 20
+	defaultHotHalfLifeHours        = 24
+	defaultRisingWindowHours       = 6
+	defaultRankingRefreshMinutes   = 5
+	defaultPublicURL               = "http://localhost:8080"
+	defaultInvitationExpiration    = 7 * 24
+	defaultEmailChangeExpiration   = 24
+	defaultLoginCodeExpiration     = 15
+	defaultPointsIdeaCreated       = 5
+	defaultPointsVoteReceived      = 2
+	defaultPointsIdeaAccepted      = 20
+	defaultPointsVoteCast          = 1
+)
+
+const (
+	// MediaStorageLocal keeps uploaded media in a directory of the local file system.
+	MediaStorageLocal = "local"
+	// MediaStorageS3 keeps uploaded media in a bucket of an S3-compatible object storage.
+	MediaStorageS3 = "s3"
 )
 
 // Config represents an application configuration.
@@ -23,6 +49,96 @@ type Config struct {
 	JWTSigningKey string `yaml:"jwt_signing_key" env:"JWT_SIGNING_KEY,secret"`
 	// JWT expiration in hours. Defaults to 72 hours (3 days)
 	JWTExpiration int `yaml:"jwt_expiration" env:"JWT_EXPIRATION"`
+	// the number of open reports after which an idea is hidden automatically. Defaults to 3
+	ReportAutoHideThreshold int `yaml:"report_auto_hide_threshold" env:"REPORT_AUTO_HIDE_THRESHOLD"`
+	// the number of days deleted ideas and users are kept in the trash. Defaults to 30 days
+	TrashRetentionDays int `yaml:"trash_retention_days" env:"TRASH_RETENTION_DAYS"`
+	// the number of days dispatched events, and the events given up on, are kept in the outbox. Defaults to 7 days
+	EventRetentionDays int `yaml:"event_retention_days" env:"EVENT_RETENTION_DAYS"`
+	// where uploaded media are stored, either "local" or "s3". Defaults to "local"
+	MediaStorage string `yaml:"media_storage" env:"MEDIA_STORAGE"`
+	// the directory of uploaded media when the storage is "local". Defaults to "./data/media"
+	MediaLocalDir string `yaml:"media_local_dir" env:"MEDIA_LOCAL_DIR"`
+	// the maximum size of an uploaded file in bytes. Defaults to 10 MB
+	MediaMaxSize int64 `yaml:"media_max_size" env:"MEDIA_MAX_SIZE"`
+	// the public base URL of the stored media, e.g. a CDN. If empty, media are served by the API
+	MediaBaseURL string `yaml:"media_base_url" env:"MEDIA_BASE_URL"`
+	// the S3 endpoint, e.g. "https://s3.eu-west-1.amazonaws.com". required when the storage is "s3".
+	S3Endpoint string `yaml:"s3_endpoint" env:"S3_ENDPOINT"`
+	// the S3 region. required when the storage is "s3".
+	S3Region string `yaml:"s3_region" env:"S3_REGION"`
+	// the S3 bucket. required when the storage is "s3".
+	S3Bucket string `yaml:"s3_bucket" env:"S3_BUCKET"`
+	// the S3 access key. required when the storage is "s3".
+	S3AccessKey string `yaml:"s3_access_key" env:"S3_ACCESS_KEY,secret"`
+	// the S3 secret key. required when the storage is "s3".
+	S3SecretKey string `yaml:"s3_secret_key" env:"S3_SECRET_KEY,secret"`
+	// the number of hours after which a vote counts half as much in the hot ranking. Defaults to 24 hours
+	HotHalfLifeHours float64 `yaml:"hot_half_life_hours" env:"HOT_HALF_LIFE_HOURS"`
+	// the number of hours of recent votes the rising ranking is based on. Defaults to 6 hours
+	RisingWindowHours float64 `yaml:"rising_window_hours" env:"RISING_WINDOW_HOURS"`
+	// how often the hot and rising scores are recomputed, in minutes. Defaults to 5 minutes
+	RankingRefreshMinutes int `yaml:"ranking_refresh_minutes" env:"RANKING_REFRESH_MINUTES"`
+	// the base URL at which clients reach the API, used in the links of emails. Defaults to "http://localhost:8080"
+	PublicURL string `yaml:"public_url" env:"PUBLIC_URL"`
+	// the Mailgun domain notification emails are sent from. If empty, emails are only logged
+	MailgunDomain string `yaml:"mailgun_domain" env:"MAILGUN_DOMAIN"`
+	// the Mailgun API key. required when the Mailgun domain is set.
+	MailgunAPIKey string `yaml:"mailgun_api_key" env:"MAILGUN_API_KEY,secret"`
+	// the sender of notification emails, e.g. "Ideas <noreply@example.com>". required when the Mailgun domain is set.
+	MailFrom string `yaml:"mail_from" env:"MAIL_FROM"`
+	// the number of hours after which an invitation link expires. Defaults to 168 hours (7 days)
+	InvitationExpiration int `yaml:"invitation_expiration" env:"INVITATION_EXPIRATION"`
+	// the number of hours after which the link confirming a new email address expires. Defaults to 24 hours
+	EmailChangeExpiration int `yaml:"email_change_expiration" env:"EMAIL_CHANGE_EXPIRATION"`
+	// the number of minutes after which a login code expires. Defaults to 15 minutes
+	LoginCodeExpiration int `yaml:"login_code_expiration" env:"LOGIN_CODE_EXPIRATION"`
+	// the reputation points for each idea submitted. Defaults to 5
+	PointsIdeaCreated int `yaml:"points_idea_created" env:"POINTS_IDEA_CREATED"`
+	// the reputation points for each vote received on one's ideas. Defaults to 2
+	PointsVoteReceived int `yaml:"points_vote_received" env:"POINTS_VOTE_RECEIVED"`
+	// the reputation points for each of one's ideas accepted. Defaults to 20
+	PointsIdeaAccepted int `yaml:"points_idea_accepted" env:"POINTS_IDEA_ACCEPTED"`
+	// the reputation points for each vote cast. Defaults to 1
+	PointsVoteCast int `yaml:"points_vote_cast" env:"POINTS_VOTE_CAST"`
+	// the reputation levels and the capabilities they unlock. The built-in levels are used if empty
+	ReputationLevels []ReputationLevel `yaml:"reputation_levels" env:"REPUTATION_LEVELS"`
+	// whether people may sign up on their own as visitors. Defaults to false
+	RegistrationEnabled bool `yaml:"registration_enabled" env:"REGISTRATION_ENABLED"`
+	// the email domains allowed to sign up, e.g. ["example.com"]. Every domain is allowed if empty
+	RegistrationAllowedDomains []string `yaml:"registration_allowed_domains" env:"REGISTRATION_ALLOWED_DOMAINS"`
+	// the email domains never allowed to sign up
+	RegistrationDeniedDomains []string `yaml:"registration_denied_domains" env:"REGISTRATION_DENIED_DOMAINS"`
+	// the IP addresses or CIDR ranges of the reverse proxies in front of the server, e.g. ["10.0.0.0/8"], whose
+	// X-Real-IP and X-Forwarded-For headers tell the IP address of the client. The headers are ignored if empty
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// ReputationLevel represents a reputation level, reached at a minimum score, and the capabilities it unlocks.
+type ReputationLevel struct {
+	Name         string   `yaml:"name" json:"name"`
+	MinScore     int      `yaml:"min_score" json:"min_score"`
+	Capabilities []string `yaml:"capabilities" json:"capabilities"`
+}
+
+// Validate validates a reputation level.
+func (l ReputationLevel) Validate() error {
+	return validation.ValidateStruct(&l,
+		validation.Field(&l.Name, validation.Required),
+		validation.Field(&l.MinScore, validation.Min(0)),
+		validation.Field(&l.Capabilities, validation.Each(validation.By(isCapability))),
+	)
+}
+
+// isCapability checks that a value is the name of a capability reputation levels can unlock.
+func isCapability(value interface{}) error {
+	s, _ := value.(string)
+	for _, capability := range reputation.Capabilities {
+		if s == capability {
+			return nil
+		}
+	}
+	return validation.NewError("validation_is_capability", "must be one of "+strings.Join(reputation.Capabilities, ", "))
 }
 
 // Validate validates the application configuration.
@@ -30,15 +146,61 @@ func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.DSN, validation.Required),
 		validation.Field(&c.JWTSigningKey, validation.Required),
+		validation.Field(&c.MediaStorage, validation.In(MediaStorageLocal, MediaStorageS3)),
+		validation.Field(&c.MediaMaxSize, validation.Min(int64(1))),
+		validation.Field(&c.S3Endpoint, validation.When(c.MediaStorage == MediaStorageS3, validation.Required)),
+		validation.Field(&c.S3Region, validation.When(c.MediaStorage == MediaStorageS3, validation.Required)),
+		validation.Field(&c.S3Bucket, validation.When(c.MediaStorage == MediaStorageS3, validation.Required)),
+		validation.Field(&c.S3AccessKey, validation.When(c.MediaStorage == MediaStorageS3, validation.Required)),
+		validation.Field(&c.S3SecretKey, validation.When(c.MediaStorage == MediaStorageS3, validation.Required)),
+		validation.Field(&c.HotHalfLifeHours, validation.Min(0.01)),
+		validation.Field(&c.RisingWindowHours, validation.Min(0.01)),
+		validation.Field(&c.RankingRefreshMinutes, validation.Min(1)),
+		validation.Field(&c.PublicURL, validation.Required),
+		validation.Field(&c.MailgunAPIKey, validation.When(c.MailgunDomain != "", validation.Required)),
+		validation.Field(&c.MailFrom, validation.When(c.MailgunDomain != "", validation.Required)),
+		validation.Field(&c.TrashRetentionDays, validation.Min(1)),
+		validation.Field(&c.EventRetentionDays, validation.Min(1)),
+		validation.Field(&c.InvitationExpiration, validation.Min(1)),
+		validation.Field(&c.EmailChangeExpiration, validation.Min(1)),
+		validation.Field(&c.LoginCodeExpiration, validation.Min(1)),
+		validation.Field(&c.ReputationLevels),
+		validation.Field(&c.TrustedProxies, validation.Each(validation.By(isNetwork))),
 	)
 }
 
+// isNetwork checks that a value is an IP address or a CIDR range.
+func isNetwork(value interface{}) error {
+	s, _ := value.(string)
+	if _, _, err := net.ParseCIDR(s); err == nil || !strings.Contains(s, "/") && net.ParseIP(s) != nil {
+		return nil
+	}
+	return validation.NewError("validation_is_network", "must be an IP address or a CIDR range")
+}
+
 // Load returns an application configuration which is populated from the given configuration file and environment variables.
 func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
 	c := Config{
-		ServerPort:    defaultServerPort,
-		JWTExpiration: defaultJWTExpirationHours,
+		ServerPort:              defaultServerPort,
+		JWTExpiration:           defaultJWTExpirationHours,
+		ReportAutoHideThreshold: defaultReportAutoHideThreshold,
+		TrashRetentionDays:      defaultTrashRetentionDays,
+		EventRetentionDays:      defaultEventRetentionDays,
+		MediaStorage:            MediaStorageLocal,
+		MediaLocalDir:           defaultMediaLocalDir,
+		MediaMaxSize:            defaultMediaMaxSize,
+		HotHalfLifeHours:        defaultHotHalfLifeHours,
+		RisingWindowHours:       defaultRisingWindowHours,
+		RankingRefreshMinutes:   defaultRankingRefreshMinutes,
+		PublicURL:               defaultPublicURL,
+		InvitationExpiration:    defaultInvitationExpiration,
+		EmailChangeExpiration:   defaultEmailChangeExpiration,
+		LoginCodeExpiration:     defaultLoginCodeExpiration,
+		PointsIdeaCreated:       defaultPointsIdeaCreated,
+		PointsVoteReceived:      defaultPointsVoteReceived,
+		PointsIdeaAccepted:      defaultPointsIdeaAccepted,
+		PointsVoteCast:          defaultPointsVoteCast,
 	}
 
 	// load from YAML config file
@@ -0,0 +1,60 @@
+package emailchange
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"net/http"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Post("/me/email", res.request)
+	r.Get("/me/email/confirm/<token>", res.confirmPage)
+	r.Post("/me/email/confirm/<token>", res.confirm)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) request(c *routing.Context) error {
+	var input ChangeEmailRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	change, err := r.service.Request(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(change, http.StatusAccepted)
+}
+
+// confirmPage serves the page a confirmation link opens, which asks the user to confirm. Following the link
+// changes nothing, as mail scanners and link previews open it too.
+func (r resource) confirmPage(c *routing.Context) error {
+	return writePage(c, http.StatusOK, confirmPage{
+		Title:   "Change your email address",
+		Message: "Do you confirm the change of the email address of your account?",
+		Form:    true,
+	})
+}
+
+// confirm confirms the email change of a link, posted from the confirmation page.
+func (r resource) confirm(c *routing.Context) error {
+	confirmation, err := r.service.Confirm(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		status := http.StatusInternalServerError
+		if e, ok := err.(errors.ErrorResponse); ok {
+			status = e.StatusCode()
+		}
+		return writePage(c, status, confirmPage{Title: "Change your email address", Message: "This link is not valid."})
+	}
+	return writePage(c, http.StatusOK, confirmPage{Title: "Email address confirmed", Message: confirmationMessage(confirmation)})
+}
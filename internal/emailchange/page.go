@@ -0,0 +1,49 @@
+package emailchange
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"html/template"
+)
+
+var confirmTemplate = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .Form}}<form method="post">
+<button type="submit">Confirm</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// confirmPage represents the page of a confirmation link.
+type confirmPage struct {
+	Title   string
+	Message string
+	// whether the page asks to confirm the change, by posting to the link
+	Form bool
+}
+
+// confirmationMessage returns the message shown once an email change is confirmed from one of the addresses.
+func confirmationMessage(confirmation Confirmation) string {
+	if confirmation.Done {
+		return "Your email address is now " + confirmation.Change.NewEmail + "."
+	}
+	if confirmation.Change.CurrentConfirmedAt == nil {
+		return "Your email address will change once you confirm it from the link sent to your current address."
+	}
+	return "Your email address will change once you confirm it from the link sent to " + confirmation.Change.NewEmail + "."
+}
+
+// writePage writes an HTML page in the response.
+func writePage(c *routing.Context, status int, page confirmPage) error {
+	c.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response.WriteHeader(status)
+	return confirmTemplate.Execute(c.Response, page)
+}
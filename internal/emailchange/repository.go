@@ -0,0 +1,64 @@
+package emailchange
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access pending email changes from the data source.
+type Repository interface {
+	// GetByTokenHash returns the pending email change whose token, sent to either address, has the given hash.
+	GetByTokenHash(ctx context.Context, tokenHash string) (entity.EmailChange, error)
+
+	// Save saves the pending email change of a user, replacing the previous one if any.
+	Save(ctx context.Context, change entity.EmailChange) error
+
+	// Update saves the changes to a pending email change.
+	Update(ctx context.Context, change entity.EmailChange) error
+
+	// Delete removes the pending email change of the specified user.
+	Delete(ctx context.Context, userID string) error
+}
+
+// repository persists pending email changes in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new email change repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetByTokenHash reads the pending email change whose token, sent to either address, has the given hash from
+// the database.
+func (r repository) GetByTokenHash(ctx context.Context, tokenHash string) (entity.EmailChange, error) {
+	var change entity.EmailChange
+	err := r.db.With(ctx).Select().
+		Where(dbx.Or(dbx.HashExp{"token_hash": tokenHash}, dbx.HashExp{"current_token_hash": tokenHash})).
+		One(&change)
+	return change, err
+}
+
+// Save saves the pending email change of a user in the database, replacing the previous one if any.
+func (r repository) Save(ctx context.Context, change entity.EmailChange) error {
+	if err := r.Delete(ctx, change.UserID); err != nil {
+		return err
+	}
+	return r.db.With(ctx).Model(&change).Insert()
+}
+
+// Update saves the changes to a pending email change in the database.
+func (r repository) Update(ctx context.Context, change entity.EmailChange) error {
+	return r.db.With(ctx).Model(&change).Update()
+}
+
+// Delete removes the pending email change of the specified user from the database.
+func (r repository) Delete(ctx context.Context, userID string) error {
+	_, err := r.db.With(ctx).Delete("email_change", dbx.HashExp{"user_id": userID}).Execute()
+	return err
+}
@@ -0,0 +1,228 @@
+// Package emailchange lets users change their email address once they confirm they own the new one.
+package emailchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/notification"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var confirmationEmail = template.Must(template.New("confirmation").Parse(`Hello {{.Name}},
+
+Please confirm your new email address by opening the link below before {{.ExpiresAt.Format "January 2, 2006 15:04 MST"}}:
+{{.Link}}
+
+Your email address won't change until you do, and your current address confirms the change too. If you didn't ask
+for this change, you can ignore this email.
+`))
+
+var approvalEmail = template.Must(template.New("approval").Parse(`Hello {{.Name}},
+
+A change of the email address of your account to {{.NewEmail}} was requested.
+To approve it, open the link below before {{.ExpiresAt.Format "January 2, 2006 15:04 MST"}}:
+{{.Link}}
+
+Your email address won't change unless you do. If you didn't ask for this change, ignore this email and
+please contact an administrator.
+`))
+
+var changedEmail = template.Must(template.New("changed").Parse(`Hello {{.Name}},
+
+The email address of your account was changed to {{.NewEmail}}.
+You will receive our emails at this address from now on.
+
+If you didn't make this change, please contact an administrator.
+`))
+
+// Service encapsulates usecase logic for changes of email address.
+type Service interface {
+	Request(ctx context.Context, req ChangeEmailRequest) (entity.EmailChange, error)
+	Confirm(ctx context.Context, token string) (Confirmation, error)
+}
+
+// ChangeEmailRequest represents a request to change one's own email address.
+type ChangeEmailRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	NewEmail           string `json:"new_email"`
+}
+
+// Confirmation represents the result of confirming an email change from one of the addresses.
+type Confirmation struct {
+	Change entity.EmailChange `json:"change"`
+	// whether the email address changed, which it does once both addresses confirmed
+	Done bool `json:"done"`
+	// the user whose email address changed, when it did
+	User *user.User `json:"user,omitempty"`
+}
+
+type service struct {
+	repo        Repository
+	userService user.UserService
+	mailer      notification.Mailer
+	transaction dbcontext.TransactionFunc
+	expiration  time.Duration
+	publicURL   string
+	logger      log.Logger
+}
+
+// NewService creates a new email change service. Confirmation links expire after the given duration, and
+// point to the given public URL of the API.
+func NewService(repo Repository, userService user.UserService, mailer notification.Mailer, transaction dbcontext.TransactionFunc,
+	expiration time.Duration, publicURL string, logger log.Logger) Service {
+	return service{repo, userService, mailer, transaction, expiration, strings.TrimRight(publicURL, "/"), logger}
+}
+
+// Request emails a confirmation link to both the current and the new email address of the requester. The email
+// address only changes once both links are confirmed, so that whoever claims to be the requester cannot take over
+// their account. A previous request of the same user is replaced.
+func (s service) Request(ctx context.Context, req ChangeEmailRequest) (entity.EmailChange, error) {
+	requester, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return entity.EmailChange{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	email := strings.TrimSpace(req.NewEmail)
+	if !strings.Contains(email, "@") || strings.ContainsAny(email, " \t\r\n/") {
+		return entity.EmailChange{}, errors.BadRequest("This email address is invalid : " + email)
+	}
+	if email == requester.Email {
+		return entity.EmailChange{}, errors.BadRequest("This is already the email address of the user")
+	}
+	if _, err := s.userService.GetUser(ctx, email); err == nil {
+		return entity.EmailChange{}, errors.BadRequest("A user with this email address already exists : " + email)
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return entity.EmailChange{}, err
+	}
+	currentToken, err := generateToken()
+	if err != nil {
+		return entity.EmailChange{}, err
+	}
+	now := time.Now()
+	change := entity.EmailChange{
+		UserID:           requester.ID,
+		NewEmail:         email,
+		TokenHash:        hashToken(token),
+		CurrentTokenHash: hashToken(currentToken),
+		ExpiresAt:        now.Add(s.expiration),
+		CreatedAt:        now,
+	}
+	// the emails are sent last so that the change is not saved if they cannot be sent
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Save(ctx, change); err != nil {
+			return err
+		}
+		data := struct {
+			Name      string
+			NewEmail  string
+			ExpiresAt time.Time
+			Link      string
+		}{requester.Name, email, change.ExpiresAt, s.link(currentToken)}
+		var body bytes.Buffer
+		if err := approvalEmail.Execute(&body, data); err != nil {
+			return err
+		}
+		if err := s.mailer.Send(ctx, requester.Email, "Please approve the change of your email address", body.String()); err != nil {
+			return err
+		}
+		data.Link = s.link(token)
+		body.Reset()
+		if err := confirmationEmail.Execute(&body, data); err != nil {
+			return err
+		}
+		return s.mailer.Send(ctx, email, "Please confirm your new email address", body.String())
+	})
+	if err != nil {
+		return entity.EmailChange{}, err
+	}
+	return change, nil
+}
+
+// Confirm confirms the email change of the given token, from whichever address it was sent to. Once both
+// addresses confirmed, the email address of the user changes and the previous address is told about it.
+func (s service) Confirm(ctx context.Context, token string) (Confirmation, error) {
+	var confirmation Confirmation
+	var previous user.User
+	err := s.transaction(ctx, func(ctx context.Context) error {
+		tokenHash := hashToken(token)
+		change, err := s.repo.GetByTokenHash(ctx, tokenHash)
+		if err == sql.ErrNoRows {
+			return errors.NotFound("The email change doesn't exist")
+		} else if err != nil {
+			return err
+		}
+		now := time.Now()
+		if !change.ExpiresAt.After(now) {
+			return errors.BadRequest("The email change has expired")
+		}
+		if tokenHash == change.CurrentTokenHash {
+			change.CurrentConfirmedAt = &now
+		} else {
+			change.NewConfirmedAt = &now
+		}
+		confirmation.Change = change
+		if change.CurrentConfirmedAt == nil || change.NewConfirmedAt == nil {
+			return s.repo.Update(ctx, change)
+		}
+
+		if previous, err = s.userService.GetUserByID(ctx, change.UserID); err != nil {
+			return err
+		}
+		updated, err := s.userService.SetEmail(ctx, change.UserID, change.NewEmail)
+		if err != nil {
+			return err
+		}
+		confirmation.Done, confirmation.User = true, &updated
+		return s.repo.Delete(ctx, change.UserID)
+	})
+	if err != nil || !confirmation.Done {
+		return confirmation, err
+	}
+
+	var body bytes.Buffer
+	err = changedEmail.Execute(&body, struct {
+		Name     string
+		NewEmail string
+	}{confirmation.User.Name, confirmation.User.Email})
+	if err == nil {
+		err = s.mailer.Send(ctx, previous.Email, "Your email address was changed", body.String())
+	}
+	if err != nil {
+		s.logger.With(ctx, "user", confirmation.User.ID).Errorf("failed to tell the previous email address about the change: %v", err)
+	}
+	return confirmation, nil
+}
+
+// link returns the confirmation link of the given token.
+func (s service) link(token string) string {
+	return s.publicURL + "/v1/me/email/confirm/" + token
+}
+
+// generateToken returns a random token for a confirmation link.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hash under which the token of a confirmation link is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,168 @@
+package emailchange
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockUserService struct {
+	user.UserService
+	users map[string]entity.Users
+}
+
+func (m mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	for _, u := range m.users {
+		if u.Email == email {
+			return user.User{Users: u}, nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+func (m mockUserService) GetUserByID(ctx context.Context, id string) (user.User, error) {
+	if u, ok := m.users[id]; ok {
+		return user.User{Users: u}, nil
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+func (m mockUserService) SetEmail(ctx context.Context, id string, email string) (user.User, error) {
+	u := m.users[id]
+	u.Email = email
+	m.users[id] = u
+	return user.User{Users: u}, nil
+}
+
+type mockRepository struct {
+	changes map[string]entity.EmailChange
+}
+
+func (m mockRepository) GetByTokenHash(ctx context.Context, tokenHash string) (entity.EmailChange, error) {
+	for _, change := range m.changes {
+		if change.TokenHash == tokenHash || change.CurrentTokenHash == tokenHash {
+			return change, nil
+		}
+	}
+	return entity.EmailChange{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Save(ctx context.Context, change entity.EmailChange) error {
+	m.changes[change.UserID] = change
+	return nil
+}
+
+func (m mockRepository) Update(ctx context.Context, change entity.EmailChange) error {
+	m.changes[change.UserID] = change
+	return nil
+}
+
+func (m mockRepository) Delete(ctx context.Context, userID string) error {
+	delete(m.changes, userID)
+	return nil
+}
+
+type mockMailer struct {
+	sent map[string]string
+}
+
+func (m mockMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.sent[to] = body
+	return nil
+}
+
+// token returns the token of the link in the last email sent to the given address.
+func (m mockMailer) token(to string) string {
+	body := m.sent[to]
+	start := strings.Index(body, "/v1/me/email/confirm/") + len("/v1/me/email/confirm/")
+	return strings.Fields(body[start:])[0]
+}
+
+func newMockService() (Service, mockUserService, mockRepository, mockMailer) {
+	users := mockUserService{users: map[string]entity.Users{
+		"1": {ID: "1", Email: "ann@example.com", Name: "Ann"},
+		"2": {ID: "2", Email: "bob@example.com", Name: "Bob"},
+	}}
+	repo := mockRepository{map[string]entity.EmailChange{}}
+	mailer := mockMailer{map[string]string{}}
+	logger, _ := log.NewForTest()
+	transaction := func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	return NewService(repo, users, mailer, transaction, time.Hour, "http://localhost/", logger), users, repo, mailer
+}
+
+func TestService_Request(t *testing.T) {
+	s, _, repo, mailer := newMockService()
+	ctx := context.Background()
+
+	_, err := s.Request(ctx, ChangeEmailRequest{RequesterUserEmail: "ann@example.com", NewEmail: "bob@example.com"})
+	assert.EqualError(t, err, "A user with this email address already exists : bob@example.com")
+	_, err = s.Request(ctx, ChangeEmailRequest{RequesterUserEmail: "ann@example.com", NewEmail: "ann@example.com"})
+	assert.NotNil(t, err)
+	_, err = s.Request(ctx, ChangeEmailRequest{RequesterUserEmail: "ann@example.com", NewEmail: "not an email"})
+	assert.NotNil(t, err)
+	assert.Empty(t, mailer.sent)
+
+	change, err := s.Request(ctx, ChangeEmailRequest{RequesterUserEmail: "ann@example.com", NewEmail: " ann@example.org "})
+	assert.Nil(t, err)
+	assert.Equal(t, "ann@example.org", change.NewEmail)
+	assert.Equal(t, change, repo.changes["1"])
+	// both the current and the new address receive a link of their own
+	assert.Contains(t, mailer.sent["ann@example.com"], "http://localhost/v1/me/email/confirm/")
+	assert.Contains(t, mailer.sent["ann@example.org"], "http://localhost/v1/me/email/confirm/")
+	assert.NotEqual(t, mailer.token("ann@example.com"), mailer.token("ann@example.org"))
+	assert.Equal(t, hashToken(mailer.token("ann@example.com")), change.CurrentTokenHash)
+	assert.Equal(t, hashToken(mailer.token("ann@example.org")), change.TokenHash)
+}
+
+func TestService_Confirm(t *testing.T) {
+	s, users, repo, mailer := newMockService()
+	ctx := context.Background()
+	_, err := s.Request(ctx, ChangeEmailRequest{RequesterUserEmail: "ann@example.com", NewEmail: "ann@example.org"})
+	assert.Nil(t, err)
+	current, next := mailer.token("ann@example.com"), mailer.token("ann@example.org")
+
+	_, err = s.Confirm(ctx, "unknown")
+	assert.EqualError(t, err, "The email change doesn't exist")
+
+	// the new address alone doesn't change the email address
+	confirmation, err := s.Confirm(ctx, next)
+	assert.Nil(t, err)
+	assert.False(t, confirmation.Done)
+	assert.NotNil(t, confirmation.Change.NewConfirmedAt)
+	assert.Nil(t, confirmation.Change.CurrentConfirmedAt)
+	assert.Equal(t, "ann@example.com", users.users["1"].Email)
+
+	confirmation, err = s.Confirm(ctx, current)
+	assert.Nil(t, err)
+	assert.True(t, confirmation.Done)
+	if assert.NotNil(t, confirmation.User) {
+		assert.Equal(t, "ann@example.org", confirmation.User.Email)
+	}
+	assert.Equal(t, "ann@example.org", users.users["1"].Email)
+	assert.Empty(t, repo.changes)
+	assert.Contains(t, mailer.sent["ann@example.com"], "was changed to ann@example.org")
+
+	// the links can't be used again
+	_, err = s.Confirm(ctx, next)
+	assert.NotNil(t, err)
+}
+
+func TestService_Confirm_expired(t *testing.T) {
+	s, users, repo, mailer := newMockService()
+	ctx := context.Background()
+	_, err := s.Request(ctx, ChangeEmailRequest{RequesterUserEmail: "ann@example.com", NewEmail: "ann@example.org"})
+	assert.Nil(t, err)
+	change := repo.changes["1"]
+	change.ExpiresAt = time.Now().Add(-time.Second)
+	repo.changes["1"] = change
+
+	_, err = s.Confirm(ctx, mailer.token("ann@example.com"))
+	assert.EqualError(t, err, "The email change has expired")
+	assert.Equal(t, "ann@example.com", users.users["1"].Email)
+}
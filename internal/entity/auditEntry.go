@@ -0,0 +1,23 @@
+package entity
+
+import "time"
+
+// AuditEntry records a security-relevant or administrative action. Entries are never changed nor deleted.
+type AuditEntry struct {
+	ID string `json:"id"`
+	// the ID of the user who took the action, or empty if unknown, e.g. on a failed login
+	ActorID string `json:"actor_id"`
+	// e.g. "user.role_changed"
+	Action string `json:"action"`
+	// the kind of the target, e.g. "user" or "idea"
+	TargetType string `json:"target_type"`
+	TargetID   string `json:"target_id"`
+	// the JSON encoded values of the target before and after the action, empty if not applicable
+	Before string `json:"before"`
+	After  string `json:"after"`
+	// the IP address of the client
+	IP string `json:"ip"`
+	// the ID of the request the action was taken in, which is found in the logs too
+	RequestID string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,10 @@
+package entity
+
+import "time"
+
+// UserBadge records that a user earned a badge.
+type UserBadge struct {
+	UserID    string    `json:"user_id"`
+	Badge     string    `json:"badge"`
+	AwardedAt time.Time `json:"awarded_at"`
+}
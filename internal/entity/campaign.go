@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+// Campaign represents a themed challenge that ideas are submitted to during a submission window.
+type Campaign struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	OpensAt     time.Time `json:"opens_at"`
+	ClosesAt    time.Time `json:"closes_at"`
+	// the roles allowed to submit ideas. Everyone may submit if empty.
+	SubmitRoles pq.StringArray `json:"submit_roles"`
+	// the roles allowed to vote on ideas. Everyone may vote if empty.
+	VoteRoles pq.StringArray `json:"vote_roles"`
+	CreatedBy string         `json:"created_by"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// IsOpen returns whether ideas can be submitted to and voted on in the campaign at the given time.
+func (c Campaign) IsOpen(t time.Time) bool {
+	return !t.Before(c.OpensAt) && t.Before(c.ClosesAt)
+}
@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// EmailChange represents a pending change of the email address of a user, awaiting confirmation from both the
+// current and the new address.
+type EmailChange struct {
+	UserID   string `json:"user_id" db:"pk"`
+	NewEmail string `json:"new_email"`
+	// the SHA-256 hash of the token of the link sent to the new address; the token itself is only sent by email
+	TokenHash string `json:"-"`
+	// the SHA-256 hash of the token of the link sent to the current address
+	CurrentTokenHash string `json:"-"`
+	// when each address confirmed the change, nil until it does
+	CurrentConfirmedAt *time.Time `json:"current_confirmed_at"`
+	NewConfirmedAt     *time.Time `json:"new_confirmed_at"`
+	ExpiresAt          time.Time  `json:"expires_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
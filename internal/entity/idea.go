@@ -8,18 +8,25 @@ import (
 // Idea represents an idea record.
 type Idea struct {
 	ID           string    `json:"id"`
-	AuthorEmail string    `json:"author_email"`
+	AuthorID     string    `json:"author_id"`
 	Tags         pq.StringArray    `json:"tags"`
 	Summary      string    `json:"summary"`
 	Content      string    `json:"content"`
 	Media        pq.StringArray    `json:"media"`
 	MediaTypes   pq.StringArray    `json:"media_types"`
+	MediaIds     pq.StringArray    `json:"media_ids"`
 	BadFlag      bool    `json:"bad_flag"`
 	Enabled      bool    `json:"enabled"`
 	Issues       pq.StringArray   `json:"issues"`
 	IssuesIPs    pq.StringArray    `json:"issues_ips"`
 	Votes        int    `json:"votes"`
 	VotersIds    pq.StringArray    `json:"voters_ids"`
+	HotScore     float64    `json:"hot_score"`
+	RisingScore  float64    `json:"rising_score"`
+	Status       string    `json:"status"`
+	StatusChangedAt time.Time `json:"status_changed_at"`
+	CampaignID   string    `json:"campaign_id"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
\ No newline at end of file
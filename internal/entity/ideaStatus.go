@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// IdeaStatusChange represents a single transition in the lifecycle of an idea.
+type IdeaStatusChange struct {
+	ID         string    `json:"id"`
+	IdeaID     string    `json:"idea_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	ChangedBy  string    `json:"changed_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,10 @@
+package entity
+
+import "time"
+
+// IdeaVote records when a user voted on an idea.
+type IdeaVote struct {
+	IdeaID    string    `json:"idea_id"`
+	VoterID   string    `json:"voter_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
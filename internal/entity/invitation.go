@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// Invitation represents an invitation of a person to join the application with a given role.
+type Invitation struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	// the SHA-256 hash of the token of the invitation link; the token itself is only sent to the invitee
+	TokenHash  string     `json:"-"`
+	InvitedBy  string     `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
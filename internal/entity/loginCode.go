@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// LoginCode represents a single-use code which signs a user in, emailed to their address.
+type LoginCode struct {
+	UserID string `db:"pk"`
+	// the SHA-256 hash of the code; the code itself is only sent to the user
+	CodeHash  string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
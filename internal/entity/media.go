@@ -0,0 +1,31 @@
+package entity
+
+import "time"
+
+// Media represents an uploaded file that can be attached to ideas.
+type Media struct {
+	ID          string `json:"id"`
+	OwnerID     string `json:"owner_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	StorageKey  string `json:"-"`
+	// the processing status of the variants: "pending", "processing", "ready" or "failed"
+	Status    string    `json:"status"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MediaVariant represents a resized copy of an uploaded image, such as a thumbnail.
+type MediaVariant struct {
+	MediaID     string    `json:"media_id"`
+	Name        string    `json:"name"`
+	StorageKey  string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
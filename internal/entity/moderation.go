@@ -0,0 +1,13 @@
+package entity
+
+import "time"
+
+// ModerationAction represents a moderation decision or note recorded against an idea.
+type ModerationAction struct {
+	ID          string    `json:"id"`
+	IdeaID      string    `json:"idea_id"`
+	ModeratorID string    `json:"moderator_id"`
+	Action      string    `json:"action"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// IdeaFollower records that a user follows an idea.
+type IdeaFollower struct {
+	IdeaID    string    `json:"idea_id"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Notification represents something that happened which a user is told about.
+type Notification struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	// the kind of event, e.g. "idea.updated"
+	Type      string     `json:"type"`
+	IdeaID    string     `json:"idea_id,omitempty"`
+	ActorID   string     `json:"actor_id,omitempty"`
+	Message   string     `json:"message"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	// when the notification was emailed to the user, on its own or in a digest
+	EmailedAt *time.Time `json:"-"`
+}
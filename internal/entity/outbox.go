@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// OutboxEvent represents a domain event saved in the same transaction as the change it describes,
+// waiting to be dispatched to its subscribers.
+type OutboxEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// the JSON encoded data of the event
+	Payload  string `json:"payload"`
+	Attempts int    `json:"attempts"`
+	// the error of the last failed dispatch
+	Error string `json:"error"`
+	// nil once the event is dispatched or has failed too many times
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	DispatchedAt  *time.Time `json:"dispatched_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
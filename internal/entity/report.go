@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// IdeaReport represents an issue reported by a user against an idea.
+type IdeaReport struct {
+	ID             string     `json:"id"`
+	IdeaID         string     `json:"idea_id"`
+	ReporterID     string     `json:"reporter_id"`
+	Reason         string     `json:"reason"`
+	Details        string     `json:"details"`
+	Status         string     `json:"status"`
+	ResolvedBy     string     `json:"resolved_by"`
+	ResolutionNote string     `json:"resolution_note"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
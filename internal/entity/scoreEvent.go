@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// ScoreEvent records points earned by a user. The score of a user is the sum of its score events.
+type ScoreEvent struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	// the domain event that earned the points
+	EventID string `json:"event_id"`
+	// the contribution that earned the points, e.g. "vote_received"
+	Kind      string    `json:"kind"`
+	Points    int       `json:"points"`
+	CreatedAt time.Time `json:"created_at"`
+}
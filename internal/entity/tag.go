@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// Tag represents a canonical tag in the tag catalogue. The ID is the tag slug.
+type Tag struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TagAlias represents an alternative slug that resolves to a canonical tag.
+type TagAlias struct {
+	Alias     string    `json:"alias" db:"pk"`
+	TagID     string    `json:"tag_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
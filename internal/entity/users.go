@@ -5,14 +5,25 @@ import "time"
 // Users represents a user.
 type Users struct {
 	ID        string    `json:"id"`
+	// the email address the user signs in with. Unlike the ID, it can change.
+	Email     string    `json:"email"`
 	Role      string    `json:"role"`
 	Name      string    `json:"name"`
 	Country   string    `json:"country"`
+	// the URL of the picture of the user
+	Avatar    string    `json:"avatar"`
+	Bio       string    `json:"bio"`
+	// the preferred language of the user, as a BCP 47 tag such as "en" or "pt-BR"
+	Locale    string    `json:"locale"`
 	Score     int       `json:"score"`
 	IsAuth    bool      `json:"is_auth"`
-	AuthCode    string      `json:"auth_code"`
+	// the code confirming the email address; it is only sent to the user by email
+	AuthCode    string      `json:"-"`
+	// whether the user signed up on their own, in which case they must confirm their email address before contributing
+	SelfRegistered bool     `json:"self_registered"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 func (u Users) GetID() string {
@@ -43,3 +54,12 @@ func (u Users) GetScore() int {
 func (u Users) GetIsAuth() bool {
 	return u.IsAuth
 }
+
+// NotificationPreference represents how a user wants to be emailed about one type of notification.
+type NotificationPreference struct {
+	UserID string `json:"user_id"`
+	Type   string `json:"type"`
+	// one of "instant", "daily", "weekly" or "off"
+	Delivery  string    `json:"delivery"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,42 @@
+package entity
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+// Webhook represents a subscription of an external URL to events of the application.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// the key the payloads sent to the URL are signed with. It is only shown once, when the webhook is created.
+	Secret     string         `json:"-"`
+	EventTypes pq.StringArray `json:"event_types"`
+	Enabled    bool           `json:"enabled"`
+	CreatedBy  string         `json:"created_by"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// WebhookDelivery represents the delivery of one event to a webhook, including its retries.
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	// the ID of the event, shared by the deliveries of the event to every webhook
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	// the JSON document posted to the webhook
+	Payload string `json:"payload"`
+	// one of "pending", "succeeded" or "failed"
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// the HTTP status code of the last attempt, or 0 if no response was received
+	ResponseCode int    `json:"response_code"`
+	Error        string `json:"error"`
+	// the ID of the delivery this one replays, if any
+	ReplayOf      string     `json:"replay_of,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,177 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAttempts is the number of dispatches after which an event is given up on.
+	maxAttempts = 10
+	// baseBackoff is the delay before the first retry of a dispatch. Each retry waits twice as long as the previous one.
+	baseBackoff = 5 * time.Second
+	// maxBackoff is the longest delay between two dispatches of an event.
+	maxBackoff = 30 * time.Minute
+	// dispatchLease is how long a claimed event is kept from other dispatchers while it is being dispatched.
+	dispatchLease = 5 * time.Minute
+)
+
+// Handler handles an event. It runs in a transaction which also records that the event was handled,
+// so the changes it makes in the database happen once even if the event is dispatched again.
+type Handler func(ctx context.Context, e Event) error
+
+// Publisher publishes domain events.
+type Publisher interface {
+	// Publish saves an event of the given type carrying the given data, which is encoded as JSON, in the outbox.
+	// If the context stores a transaction, the event is only dispatched if the transaction is committed.
+	Publish(ctx context.Context, eventType string, data interface{}) error
+}
+
+// Bus publishes domain events and dispatches them to the subscribers.
+type Bus interface {
+	Publisher
+	// Subscribe registers a handler of the events of the given type. The name identifies the subscriber
+	// and must be unique among the subscribers of the type.
+	Subscribe(eventType, name string, handler Handler)
+	// Dispatch delivers the due events to their subscribers and returns the number of events dispatched.
+	Dispatch(ctx context.Context, limit int) (int, error)
+	// Purge deletes the events dispatched, or given up on, before the given time.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+type bus struct {
+	repo        Repository
+	transaction dbcontext.TransactionFunc
+	logger      log.Logger
+
+	mu          sync.RWMutex
+	subscribers map[string][]subscriber
+}
+
+// NewBus creates a new event bus storing its outbox in the given database.
+func NewBus(db *dbcontext.DB, logger log.Logger) Bus {
+	return newBus(NewRepository(db, logger), db.Transactional, logger)
+}
+
+func newBus(repo Repository, transaction dbcontext.TransactionFunc, logger log.Logger) *bus {
+	return &bus{repo: repo, transaction: transaction, logger: logger, subscribers: map[string][]subscriber{}}
+}
+
+// Publish saves an event in the outbox.
+func (b *bus) Publish(ctx context.Context, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return b.repo.Create(ctx, entity.OutboxEvent{
+		ID:            entity.GenerateID(),
+		Type:          eventType,
+		Payload:       string(payload),
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	})
+}
+
+// Subscribe registers a handler of the events of the given type.
+func (b *bus) Subscribe(eventType, name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[eventType] = append(b.subscribers[eventType], subscriber{name, handler})
+}
+
+// Dispatch delivers the due events to their subscribers. An event is dispatched again later, with
+// exponential backoff, to the subscribers which failed to handle it.
+func (b *bus) Dispatch(ctx context.Context, limit int) (int, error) {
+	now := time.Now()
+	events, err := b.repo.ClaimDue(ctx, now, now.Add(dispatchLease), limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range events {
+		if err := b.dispatch(ctx, e); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), nil
+}
+
+// dispatch delivers an event to the subscribers which haven't handled it yet and records the outcome.
+func (b *bus) dispatch(ctx context.Context, e entity.OutboxEvent) error {
+	handled, err := b.repo.Handled(ctx, e.ID)
+	if err != nil {
+		return err
+	}
+	done := map[string]bool{}
+	for _, name := range handled {
+		done[name] = true
+	}
+
+	event := Event{ID: e.ID, Type: e.Type, Data: json.RawMessage(e.Payload), CreatedAt: e.CreatedAt}
+	var failure error
+	for _, s := range b.subscribersOf(e.Type) {
+		if done[s.name] {
+			continue
+		}
+		s := s
+		err := b.transaction(ctx, func(ctx context.Context) error {
+			if err := s.handler(ctx, event); err != nil {
+				return err
+			}
+			return b.repo.MarkHandled(ctx, e.ID, s.name, time.Now())
+		})
+		if err != nil {
+			b.logger.With(ctx, "event", e.ID, "subscriber", s.name).Errorf("failed to handle %s: %v", e.Type, err)
+			if failure == nil {
+				failure = err
+			}
+		}
+	}
+
+	now := time.Now()
+	e.Attempts++
+	if failure == nil {
+		e.Error = ""
+		e.DispatchedAt = &now
+		e.NextAttemptAt = nil
+	} else if e.Error = failure.Error(); e.Attempts >= maxAttempts {
+		e.NextAttemptAt = nil
+	} else {
+		next := now.Add(backoff(e.Attempts))
+		e.NextAttemptAt = &next
+	}
+	return b.repo.Update(ctx, e)
+}
+
+// Purge deletes the events dispatched, or given up on, before the given time.
+func (b *bus) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return b.repo.Purge(ctx, before)
+}
+
+func (b *bus) subscribersOf(eventType string) []subscriber {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.subscribers[eventType]
+}
+
+// backoff returns the delay before the next dispatch of an event after the given number of failed dispatches.
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
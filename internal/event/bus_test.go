@@ -0,0 +1,148 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// mockRepository keeps the outbox in memory. Every event is due when claimed.
+type mockRepository struct {
+	events  map[string]entity.OutboxEvent
+	handled map[string][]string
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{events: map[string]entity.OutboxEvent{}, handled: map[string][]string{}}
+}
+
+func (m *mockRepository) Create(ctx context.Context, event entity.OutboxEvent) error {
+	m.events[event.ID] = event
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, event entity.OutboxEvent) error {
+	m.events[event.ID] = event
+	return nil
+}
+
+func (m *mockRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]entity.OutboxEvent, error) {
+	var events []entity.OutboxEvent
+	for id, e := range m.events {
+		if e.DispatchedAt == nil && e.NextAttemptAt != nil && len(events) < limit {
+			e.NextAttemptAt = &leaseUntil
+			m.events[id] = e
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockRepository) Handled(ctx context.Context, eventID string) ([]string, error) {
+	return m.handled[eventID], nil
+}
+
+func (m *mockRepository) MarkHandled(ctx context.Context, eventID, subscriber string, at time.Time) error {
+	m.handled[eventID] = append(m.handled[eventID], subscriber)
+	return nil
+}
+
+func (m *mockRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func newMockBus() (*bus, *mockRepository) {
+	repo := newMockRepository()
+	logger, _ := log.NewForTest()
+	transaction := func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	return newBus(repo, transaction, logger), repo
+}
+
+func TestBus_Dispatch(t *testing.T) {
+	b, repo := newMockBus()
+	ctx := context.Background()
+
+	calls := map[string]int{}
+	fail := true
+	b.Subscribe(IdeaCreated, "stable", func(ctx context.Context, e Event) error {
+		calls["stable"]++
+		var data IdeaData
+		assert.Nil(t, e.Decode(&data))
+		assert.Equal(t, "idea1", data.Idea.ID)
+		return nil
+	})
+	b.Subscribe(IdeaCreated, "flaky", func(ctx context.Context, e Event) error {
+		calls["flaky"]++
+		if fail {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	assert.Nil(t, b.Publish(ctx, IdeaCreated, IdeaData{Idea: entity.Idea{ID: "idea1"}}))
+
+	// the failing subscriber is retried later, with backoff
+	n, err := b.Dispatch(ctx, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	var e entity.OutboxEvent
+	for _, e = range repo.events {
+	}
+	assert.Equal(t, 1, e.Attempts)
+	assert.Equal(t, "unavailable", e.Error)
+	assert.Nil(t, e.DispatchedAt)
+	if assert.NotNil(t, e.NextAttemptAt) {
+		assert.True(t, e.NextAttemptAt.After(time.Now().Add(baseBackoff-time.Second)))
+	}
+	assert.Equal(t, []string{"stable"}, repo.handled[e.ID])
+
+	// the subscriber which handled the event doesn't handle it again
+	fail = false
+	n, err = b.Dispatch(ctx, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, map[string]int{"stable": 1, "flaky": 2}, calls)
+	e = repo.events[e.ID]
+	assert.Equal(t, 2, e.Attempts)
+	assert.Equal(t, "", e.Error)
+	assert.NotNil(t, e.DispatchedAt)
+	assert.Nil(t, e.NextAttemptAt)
+
+	// nothing is left to dispatch
+	n, err = b.Dispatch(ctx, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestBus_Dispatch_exhausted(t *testing.T) {
+	b, repo := newMockBus()
+	ctx := context.Background()
+	b.Subscribe(UserCreated, "broken", func(ctx context.Context, e Event) error {
+		return errors.New("broken")
+	})
+	assert.Nil(t, b.Publish(ctx, UserCreated, UserData{ID: "1"}))
+
+	for i := 0; i < maxAttempts; i++ {
+		n, err := b.Dispatch(ctx, 10)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+	}
+	for _, e := range repo.events {
+		assert.Equal(t, maxAttempts, e.Attempts)
+		assert.Nil(t, e.NextAttemptAt)
+		assert.Nil(t, e.DispatchedAt)
+	}
+	n, err := b.Dispatch(ctx, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func Test_backoff(t *testing.T) {
+	assert.Equal(t, baseBackoff, backoff(1))
+	assert.Equal(t, 2*baseBackoff, backoff(2))
+	assert.Equal(t, 4*baseBackoff, backoff(3))
+	assert.Equal(t, maxBackoff, backoff(20))
+}
@@ -0,0 +1,83 @@
+// Package event provides domain events. Services publish events in the same database transaction as the changes
+// they describe, by saving them in an outbox table, and a dispatcher delivers them to in-process subscribers.
+package event
+
+import (
+	"encoding/json"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"time"
+)
+
+// Types of domain events.
+const (
+	IdeaCreated       = "idea.created"
+	IdeaUpdated       = "idea.updated"
+	IdeaDeleted       = "idea.deleted"
+	IdeaVoted         = "idea.voted"
+	IdeaStatusChanged = "idea.status_changed"
+	IdeaModerated     = "idea.moderated"
+	UserCreated       = "user.created"
+	UserRoleChanged   = "user.role_changed"
+)
+
+// Event represents a domain event delivered to subscribers.
+type Event struct {
+	ID        string
+	Type      string
+	Data      json.RawMessage
+	CreatedAt time.Time
+}
+
+// Decode decodes the data of the event into v, which should be a pointer to the data type of the event.
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// IdeaData is the data of the idea.created, idea.updated and idea.deleted events.
+type IdeaData struct {
+	Idea entity.Idea `json:"idea"`
+	// the user who made the change, if known
+	ActorID string `json:"actor_id"`
+}
+
+// VoteData is the data of the idea.voted event.
+type VoteData struct {
+	// the idea after the vote
+	Idea      entity.Idea `json:"idea"`
+	VoterID   string      `json:"voter_id"`
+	VoterName string      `json:"voter_name"`
+}
+
+// StatusChangeData is the data of the idea.status_changed event.
+type StatusChangeData struct {
+	Idea   entity.Idea             `json:"idea"`
+	Change entity.IdeaStatusChange `json:"change"`
+}
+
+// ModerationData is the data of the idea.moderated event.
+type ModerationData struct {
+	Idea        entity.Idea `json:"idea"`
+	ModeratorID string      `json:"moderator_id"`
+	Action      string      `json:"action"`
+	Note        string      `json:"note"`
+	// the users whose reports on the idea were closed by the moderation
+	ReporterIDs []string `json:"reporter_ids"`
+}
+
+// UserData is the data of the user.created event.
+type UserData struct {
+	ID      string `json:"id"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Name    string `json:"name"`
+	Country string `json:"country"`
+}
+
+// RoleChangeData is the data of the user.role_changed event.
+type RoleChangeData struct {
+	UserID  string `json:"user_id"`
+	OldRole string `json:"old_role"`
+	NewRole string `json:"new_role"`
+	// the user who changed the role
+	ChangedBy string `json:"changed_by"`
+}
@@ -0,0 +1,102 @@
+package event
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Repository encapsulates the logic to access the outbox from the data source.
+type Repository interface {
+	// Create saves a new event in the outbox.
+	Create(ctx context.Context, event entity.OutboxEvent) error
+
+	// Update saves the outcome of a dispatch of an event.
+	Update(ctx context.Context, event entity.OutboxEvent) error
+
+	// ClaimDue returns up to limit events whose dispatch is due, oldest first, and postpones
+	// their next dispatch to leaseUntil so that they are not claimed again while being dispatched.
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]entity.OutboxEvent, error)
+
+	// Handled returns the names of the subscribers which have handled the event with the specified ID.
+	Handled(ctx context.Context, eventID string) ([]string, error)
+
+	// MarkHandled records that a subscriber has handled an event.
+	MarkHandled(ctx context.Context, eventID, subscriber string, at time.Time) error
+
+	// Purge deletes the events dispatched before the given time, and the events created before it which were
+	// given up on, and returns how many were deleted.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// repository persists the outbox in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new outbox repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Create saves a new event record in the database.
+func (r repository) Create(ctx context.Context, event entity.OutboxEvent) error {
+	return r.db.With(ctx).Model(&event).Insert()
+}
+
+// Update saves the changes to an event in the database.
+func (r repository) Update(ctx context.Context, event entity.OutboxEvent) error {
+	return r.db.With(ctx).Model(&event).Update()
+}
+
+// ClaimDue claims the events whose dispatch is due. Rows locked by another instance
+// of the application are skipped so that every event is dispatched by one instance at a time.
+func (r repository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]entity.OutboxEvent, error) {
+	var events []entity.OutboxEvent
+	err := r.db.With(ctx).NewQuery(`UPDATE outbox_event SET next_attempt_at = {:lease}
+		WHERE id IN (SELECT id FROM outbox_event
+			WHERE dispatched_at IS NULL AND next_attempt_at <= {:now}
+			ORDER BY created_at, id LIMIT {:limit} FOR UPDATE SKIP LOCKED)
+		RETURNING *`).
+		Bind(dbx.Params{"now": now, "lease": leaseUntil, "limit": limit}).
+		All(&events)
+	return events, err
+}
+
+// Handled returns the subscribers which have handled an event.
+func (r repository) Handled(ctx context.Context, eventID string) ([]string, error) {
+	var subscribers []string
+	err := r.db.With(ctx).
+		Select("subscriber").
+		From("outbox_handled").
+		Where(dbx.HashExp{"event_id": eventID}).
+		Column(&subscribers)
+	return subscribers, err
+}
+
+// MarkHandled records that a subscriber has handled an event.
+func (r repository) MarkHandled(ctx context.Context, eventID, subscriber string, at time.Time) error {
+	_, err := r.db.With(ctx).Insert("outbox_handled", dbx.Params{
+		"event_id":   eventID,
+		"subscriber": subscriber,
+		"handled_at": at,
+	}).Execute()
+	return err
+}
+
+// Purge deletes the events dispatched before the given time, and the events created before it which failed
+// too many times to be dispatched again, together with their handled records.
+func (r repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.With(ctx).
+		Delete("outbox_event", dbx.NewExp("dispatched_at < {:before} OR "+
+			"(dispatched_at IS NULL AND next_attempt_at IS NULL AND created_at < {:before})", dbx.Params{"before": before})).
+		Execute()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -4,7 +4,9 @@ import (
 	"github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/qiangxue/go-rest-api/internal/errors"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
 	"net/http"
+	"strconv"
 )
 
 // RegisterHandlers sets up the routing of the HTTP handlers.
@@ -17,6 +19,10 @@ func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger)
 	r.Delete("/idea/<id>", res.delete)
 	r.Post("/getIdeas", res.query)
 	r.Post("/voteAnIdea", res.vote)
+	r.Post("/idea/<id>/status", res.changeStatus)
+	r.Get("/idea/<id>/history", res.history)
+	r.Get("/admin/trash/ideas", res.trash)
+	r.Post("/admin/trash/ideas/<id>/restore", res.restore)
 }
 
 type resource struct {
@@ -107,3 +113,54 @@ func (r resource) delete(c *routing.Context) error {
 
 	return c.Write(idea)
 }
+
+func (r resource) changeStatus(c *routing.Context) error {
+	var input ChangeStatusRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	idea, err := r.service.ChangeStatus(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(idea)
+}
+
+func (r resource) history(c *routing.Context) error {
+	changes, err := r.service.StatusHistory(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(changes)
+}
+
+func (r resource) trash(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Trash(c.Request.Context(), c.Query("requester_user_email"), page, perPage)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(pages)
+}
+
+func (r resource) restore(c *routing.Context) error {
+	var input RestoreIdeaRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	idea, err := r.service.Restore(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(idea)
+}
@@ -0,0 +1,33 @@
+package idea
+
+import (
+	"context"
+	"time"
+)
+
+// Sort modes of the idea listing.
+const (
+	// SortNew lists the newest ideas first.
+	SortNew = "new"
+	// SortTop lists the ideas with the most votes of all time first.
+	SortTop = "top"
+	// SortHot lists the ideas with the most recent votes first; older votes count less and less.
+	SortHot = "hot"
+	// SortRising lists the ideas receiving the most votes per hour right now first.
+	SortRising = "rising"
+)
+
+// sortOrders maps the sort modes to the ORDER BY clause of the listing.
+var sortOrders = map[string]string{
+	SortNew:    "created_at DESC, id",
+	SortTop:    "votes DESC, created_at DESC, id",
+	SortHot:    "hot_score DESC, created_at DESC, id",
+	SortRising: "rising_score DESC, hot_score DESC, created_at DESC, id",
+}
+
+// RefreshRanking recomputes the scores used by the hot and rising sort modes.
+// A vote loses half of its weight in the hot score every halfLife, and the rising score counts
+// the votes per hour received during the last window. It returns the number of ideas whose scores changed.
+func (s service) RefreshRanking(ctx context.Context, halfLife, window time.Duration) (int64, error) {
+	return s.repo.RefreshRanking(ctx, halfLife, window, time.Now())
+}
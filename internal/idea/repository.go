@@ -2,10 +2,15 @@ package idea
 
 import (
 	"context"
+	"database/sql"
+	"github.com/go-ozzo/ozzo-dbx"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/tag"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Repository encapsulates the logic to access ideas from the data source.
@@ -27,8 +32,37 @@ type Repository interface {
 	Delete(ctx context.Context, id string) error
 
 	Query(ctx context.Context, getIdeaRequest GetIdeaRequest) ([]entity.Idea, error)
+
+	// UpdateStatus saves the new status of an idea and records the transition.
+	UpdateStatus(ctx context.Context, idea entity.Idea, change entity.IdeaStatusChange) error
+
+	// StatusHistory returns the status transitions of the idea with given ID.
+	StatusHistory(ctx context.Context, ideaID string) ([]entity.IdeaStatusChange, error)
+
+	// CountDeleted returns the number of ideas in the trash.
+	CountDeleted(ctx context.Context) (int, error)
+
+	// QueryDeleted returns the ideas in the trash.
+	QueryDeleted(ctx context.Context, offset, limit int) ([]entity.Idea, error)
+
+	// Restore moves the idea with given ID out of the trash.
+	Restore(ctx context.Context, id string) error
+
+	// Purge permanently removes the ideas deleted before the given time.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+
+	// AddVote saves the new vote count of an idea and records the vote.
+	AddVote(ctx context.Context, idea entity.Idea, vote entity.IdeaVote) error
+
+	// RefreshRanking recomputes the hot and rising scores of all ideas.
+	RefreshRanking(ctx context.Context, halfLife, window time.Duration, now time.Time) (int64, error)
 }
 
+var (
+	notDeleted = dbx.NewExp("deleted_at IS NULL")
+	deleted    = dbx.NewExp("deleted_at IS NOT NULL")
+)
+
 // repository persists ideas in database
 type repository struct {
 	db     *dbcontext.DB
@@ -41,9 +75,10 @@ func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 }
 
 // Get reads the idea with the specified ID from the database.
+// Deleted ideas are not returned.
 func (r repository) Get(ctx context.Context, id string) (entity.Idea, error) {
 	var idea entity.Idea
-	err := r.db.With(ctx).Select().Model(id, &idea)
+	err := r.db.With(ctx).Select().Where(notDeleted).Model(id, &idea)
 	return idea, err
 }
 
@@ -58,22 +93,72 @@ func (r repository) Update(ctx context.Context, idea entity.Idea) error {
 	return r.db.With(ctx).Model(&idea).Update()
 }
 
-// Delete deletes an idea with the specified ID from the database.
+// Delete moves an idea with the specified ID to the trash.
 func (r repository) Delete(ctx context.Context, id string) error {
 	idea, err := r.Get(ctx, id)
 	if err != nil {
 		return err
 	}
-	return r.db.With(ctx).Model(&idea).Delete()
+	now := time.Now()
+	idea.DeletedAt = &now
+	return r.db.With(ctx).Model(&idea).Update("DeletedAt")
 }
 
 // Count returns the number of the idea records in the database.
 func (r repository) Count(ctx context.Context) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("idea").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("idea").Where(notDeleted).Row(&count)
+	return count, err
+}
+
+// CountDeleted returns the number of the idea records in the trash.
+func (r repository) CountDeleted(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("idea").Where(deleted).Row(&count)
 	return count, err
 }
 
+// QueryDeleted returns the idea records in the trash, most recently deleted first.
+func (r repository) QueryDeleted(ctx context.Context, offset, limit int) ([]entity.Idea, error) {
+	var ideas []entity.Idea
+	err := r.db.With(ctx).
+		Select().
+		Where(deleted).
+		OrderBy("deleted_at DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&ideas)
+	return ideas, err
+}
+
+// Restore moves an idea with the specified ID out of the trash.
+func (r repository) Restore(ctx context.Context, id string) error {
+	result, err := r.db.With(ctx).
+		Update("idea", dbx.Params{"deleted_at": nil}, dbx.And(dbx.HashExp{"id": id}, deleted)).
+		Execute()
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Purge permanently deletes the idea records moved to the trash before the given time.
+func (r repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.With(ctx).
+		Delete("idea", dbx.NewExp("deleted_at < {:before}", dbx.Params{"before": before})).
+		Execute()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Query returns the ideas matching the given listing request.
 func (r repository) Query(ctx context.Context, getIdeaRequest GetIdeaRequest) ([]entity.Idea, error) {
 	var ideas []entity.Idea
 
@@ -87,12 +172,51 @@ func (r repository) Query(ctx context.Context, getIdeaRequest GetIdeaRequest) ([
 	}
 	pageOffset = getIdeaRequest.PageNumber * pageSize
 
+	// deleted ideas and ideas hidden by moderation are never listed
+	conditions := []string{"deleted_at is null", "bad_flag is not true"}
+	params := dbx.Params{}
+
+	if getIdeaRequest.IdeaId != "" {
+		conditions = append(conditions, "id = {:id}")
+		params["id"] = getIdeaRequest.IdeaId
+	}
+	if getIdeaRequest.MediaType != "" {
+		conditions = append(conditions, "{:media_type} = any(media_types)")
+		params["media_type"] = getIdeaRequest.MediaType
+	}
+	if getIdeaRequest.MinPopularity != 0 {
+		conditions = append(conditions, "votes >= {:min_popularity}")
+		params["min_popularity"] = getIdeaRequest.MinPopularity
+	}
+	if getIdeaRequest.MaxPopularity != 0 {
+		conditions = append(conditions, "votes <= {:max_popularity}")
+		params["max_popularity"] = getIdeaRequest.MaxPopularity
+	}
+	if getIdeaRequest.Tag != "" {
+		conditions = append(conditions, "{:tag} = any(tags)")
+		params["tag"] = tag.Slugify(getIdeaRequest.Tag)
+	}
+	if getIdeaRequest.Status != "" {
+		conditions = append(conditions, "status = {:status}")
+		params["status"] = getIdeaRequest.Status
+	}
+	if getIdeaRequest.CampaignID != "" {
+		conditions = append(conditions, "campaign_id = {:campaign_id}")
+		params["campaign_id"] = getIdeaRequest.CampaignID
+	}
+
+	where := " where " + strings.Join(conditions, " and ")
+
 	var queryString string
 
 	if getIdeaRequest.TopPopularNumber != 0 {
-		queryString = "select * from idea order by votes DESC LIMIT "+ strconv.Itoa(getIdeaRequest.TopPopularNumber)
+		sort := getIdeaRequest.Sort
+		if sort == "" {
+			sort = SortTop
+		}
+		queryString = "select * from idea" + where + " order by " + sortOrders[sort] + " LIMIT "+ strconv.Itoa(getIdeaRequest.TopPopularNumber)
 	}else {
-		queryString = "select id, author_email,tags,bad_flag,enabled,issues,votes,created_at,updated_at "
+		queryString = "select id, author_id,tags,bad_flag,enabled,issues,votes,hot_score,rising_score,status,status_changed_at,campaign_id,created_at,updated_at "
 		if getIdeaRequest.IncludeSummary {
 			queryString = queryString + ", summary"
 		}
@@ -100,47 +224,80 @@ func (r repository) Query(ctx context.Context, getIdeaRequest GetIdeaRequest) ([
 			queryString = queryString + ", content"
 		}
 		if getIdeaRequest.IncludeMedia {
-			queryString = queryString + ", media, media_types"
+			queryString = queryString + ", media, media_types, media_ids"
 		}
-		queryString = queryString + " from idea "
-
-		if getIdeaRequest.IdeaId != "" || getIdeaRequest.MediaType != "" || getIdeaRequest.MinPopularity != 0 || getIdeaRequest.MaxPopularity != 0 {
-			queryString = queryString + " where "
-			var andReqd bool
-			andReqd = false
-			if getIdeaRequest.IdeaId != "" {
-				queryString = queryString + " id = '" + getIdeaRequest.IdeaId + "'"
-				andReqd = true
-			}
-			if getIdeaRequest.MediaType != "" {
-				if andReqd {
-					queryString = queryString + " and "
-				}
-				queryString = queryString + " '" + getIdeaRequest.MediaType + "' = any(media_types)"
-				andReqd = true
-			}
-			if getIdeaRequest.MinPopularity != 0 {
-				if andReqd {
-					queryString = queryString + " and "
-				}
-				queryString = queryString + " votes >=" + strconv.Itoa(getIdeaRequest.MinPopularity)
-				andReqd = true
-			}
-			if getIdeaRequest.MaxPopularity != 0 {
-				if andReqd {
-					queryString = queryString + " and "
-				}
-				queryString = queryString + " votes <=" + strconv.Itoa(getIdeaRequest.MaxPopularity)
-			}
+		queryString = queryString + " from idea" + where
+		if getIdeaRequest.Sort != "" {
+			queryString = queryString + " order by " + sortOrders[getIdeaRequest.Sort]
 		}
 
-		queryString = queryString + "limit " + strconv.Itoa(pageSize) + " offset " +
+		queryString = queryString + " limit " + strconv.Itoa(pageSize) + " offset " +
 			strconv.Itoa(pageOffset)
 	}
 
 	err := r.db.With(ctx).
 		NewQuery(queryString).
+		Bind(params).
 		All(&ideas)
 
 	return ideas, err
 }
+
+// UpdateStatus saves the new status of an idea together with the record of the transition.
+func (r repository) UpdateStatus(ctx context.Context, idea entity.Idea, change entity.IdeaStatusChange) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if err := r.db.With(ctx).Model(&idea).Update("Status", "StatusChangedAt", "UpdatedAt"); err != nil {
+			return err
+		}
+		return r.db.With(ctx).Model(&change).Insert()
+	})
+}
+
+// StatusHistory returns the recorded status transitions of an idea, oldest first.
+func (r repository) StatusHistory(ctx context.Context, ideaID string) ([]entity.IdeaStatusChange, error) {
+	var changes []entity.IdeaStatusChange
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"idea_id": ideaID}).
+		OrderBy("created_at").
+		All(&changes)
+	return changes, err
+}
+
+// AddVote saves the new vote count of an idea together with the record of the vote.
+// The record is unique per idea and voter, so concurrent duplicate votes fail.
+func (r repository) AddVote(ctx context.Context, idea entity.Idea, vote entity.IdeaVote) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if err := r.db.With(ctx).Model(&vote).Insert(); err != nil {
+			return err
+		}
+		return r.db.With(ctx).Model(&idea).Update("Votes", "VotersIds")
+	})
+}
+
+// RefreshRanking recomputes the hot and rising scores of the ideas not in the trash.
+// The hot score is the sum of the votes of an idea, each vote losing half of its weight every halfLife.
+// The rising score is the number of votes per hour received during the last window.
+// Only the ideas whose scores changed are written. Votes older than 1000 half-lives weigh as much as if they
+// were 1000 half-lives old, which is next to nothing, as raising 0.5 to a greater power underflows in PostgreSQL.
+func (r repository) RefreshRanking(ctx context.Context, halfLife, window time.Duration, now time.Time) (int64, error) {
+	result, err := r.db.With(ctx).NewQuery(`UPDATE idea SET hot_score = s.hot, rising_score = s.rising
+		FROM (SELECT i.id,
+				COALESCE(SUM(power(0.5, LEAST(extract(epoch FROM {:now}::timestamp - v.created_at) / {:half_life}::float8, 1000))), 0) AS hot,
+				COUNT(v.idea_id) FILTER (WHERE v.created_at > {:since}::timestamp) / {:window_hours}::float8 AS rising
+			FROM idea i LEFT JOIN idea_vote v ON v.idea_id = i.id
+			WHERE i.deleted_at IS NULL
+			GROUP BY i.id) s
+		WHERE idea.id = s.id AND (idea.hot_score <> s.hot OR idea.rising_score <> s.rising)`).
+		Bind(dbx.Params{
+			"now":          now,
+			"since":        now.Add(-window),
+			"half_life":    halfLife.Seconds(),
+			"window_hours": window.Hours(),
+		}).
+		Execute()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -2,10 +2,19 @@ package idea
 
 import (
 	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/campaign"
 	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/event"
 	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/media"
+	"github.com/qiangxue/go-rest-api/internal/reputation"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/internal/tag"
 	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"strings"
 	"time"
 )
 
@@ -18,11 +27,19 @@ type Service interface {
 	Count(ctx context.Context) (int, error)
 	Query(ctx context.Context, getIdeaRequest GetIdeaRequest) ([]Idea, error)
 	Vote(ctx context.Context, voteIdeaRequest VoteIdeaRequest) (Idea, error)
+	ChangeStatus(ctx context.Context, id string, req ChangeStatusRequest) (Idea, error)
+	StatusHistory(ctx context.Context, id string) ([]entity.IdeaStatusChange, error)
+	Trash(ctx context.Context, requesterEmail string, page, perPage int) (*pagination.Pages, error)
+	Restore(ctx context.Context, id string, req RestoreIdeaRequest) (Idea, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	RefreshRanking(ctx context.Context, halfLife, window time.Duration) (int64, error)
 }
 
 // idea represents the data about an idea.
 type Idea struct {
 	entity.Idea
+	// the attached media with the URLs of their variants, in the order of MediaIds
+	MediaItems []media.Media `json:"media_items,omitempty"`
 }
 
 // CreateIdeaRequest represents an idea creation request.
@@ -30,24 +47,26 @@ type CreateIdeaRequest struct {
 	AuthorEmail string `json:"author_email"`
 	Summary     string `json:"summary"`
 	Content     string `json:"content"`
-	Media       []string `json:"media"`
-	MediaTypes  []string `json:"media_types"`
+	// IDs of media uploaded by the author
+	MediaIDs    []string `json:"media_ids"`
 	Tags        []string `json:"tags"`
 	Issues      []string `json:"issues"`
+	// either "draft" or "submitted". Defaults to "submitted"
+	Status      string   `json:"status"`
+	// the campaign the idea is submitted to (optional)
+	CampaignID  string   `json:"campaign_id"`
 }
 
-// UpdateIdeaRequest represents an idea update request.
+// UpdateIdeaRequest represents an idea update request. Whether an idea is flagged or hidden is only
+// decided by moderation.
 type UpdateIdeaRequest struct {
 	RequesterUserEmail string   `json:"requester_user_email"`
-	IP          string          `json:"ip"`
 	Summary     string          `json:"summary"`
 	Content     string          `json:"content"`
-	Media       []string        `json:"media"`
-	MediaTypes  []string        `json:"media_types"`
+	// IDs of media uploaded by the author or the requester
+	MediaIDs    []string        `json:"media_ids"`
 	Tags        []string        `json:"tags"`
 	Issues      []string        `json:"issues"`
-	BadFlag     bool            `json:"bad_flag"`
-	Enabled     bool            `json:"enabled"`
 }
 
 type GetIdeaRequest struct {
@@ -59,6 +78,11 @@ type GetIdeaRequest struct {
 	IncludeMedia     bool      `json:"include_media"`
 	IncludeSummary   bool      `json:"include_summary"`
 	IncludeContent  bool       `json:"include_content"`
+	Status           string    `json:"status"`
+	Tag              string    `json:"tag"`
+	// one of "new", "top", "hot" or "rising"
+	Sort             string    `json:"sort"`
+	CampaignID       string    `json:"campaign_id"`
 	PageSize         int       `json:"page_size"`
 	PageNumber       int       `json:"page_number"`
 }
@@ -68,16 +92,36 @@ type VoteIdeaRequest struct {
 	RequesterUserEmail string     `json:"requester_user_email"`
 }
 
+// ChangeStatusRequest represents a request to move an idea to another lifecycle status.
+type ChangeStatusRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	Status             string `json:"status"`
+	// required when rejecting an idea
+	Reason             string `json:"reason"`
+}
+
+// RestoreIdeaRequest represents a request to restore an idea from the trash.
+type RestoreIdeaRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
 
 type service struct {
 	repo   Repository
 	logger log.Logger
 	userService user.UserService
+	tagService  tag.Service
+	mediaService media.Service
+	campaignService campaign.Service
+	events event.Publisher
+	transaction dbcontext.TransactionFunc
+	reputation reputation.Policy
 }
 
 // NewService creates a new idea service.
-func NewService(repo Repository, logger log.Logger, user user.UserService) Service {
-	return service{repo, logger, user}
+// Users who aren't admins may create ideas once the reputation policy gives them the capability.
+func NewService(repo Repository, logger log.Logger, user user.UserService, tagService tag.Service, mediaService media.Service,
+	campaignService campaign.Service, events event.Publisher, transaction dbcontext.TransactionFunc, reputation reputation.Policy) Service {
+	return service{repo, logger, user, tagService, mediaService, campaignService, events, transaction, reputation}
 }
 
 // Get returns the idea with the specified the idea ID.
@@ -86,7 +130,7 @@ func (s service) Get(ctx context.Context, id string) (Idea, error) {
 	if err != nil {
 		return Idea{}, err
 	}
-	return Idea{idea}, nil
+	return s.withMedia(ctx, idea)
 }
 
 // Create creates a new idea.
@@ -98,21 +142,63 @@ func (s service) Create(ctx context.Context, req CreateIdeaRequest) (Idea, error
 	if err2 !=nil{
 		return Idea{}, err2
 	}
-	if !(author.Role == "admin" ||  author.Role == "super_admin"){
-		return Idea{}, errors.InternalServerError("Requester User doesn't have permission to create ideas")
+	if err := s.reputation.Check(author, reputation.CapabilityCreateIdea); err != nil {
+		return Idea{}, err
+	}
+	if err := user.CheckVerified(author); err != nil {
+		return Idea{}, err
+	}
+
+	status := req.Status
+	if status == "" {
+		status = StatusSubmitted
+	}
+	if status != StatusDraft && status != StatusSubmitted {
+		return Idea{}, errors.BadRequest("A new idea must be either draft or submitted")
+	}
+	if req.CampaignID != "" {
+		var err error
+		// drafts may be prepared at any time; the submission window applies when they are submitted
+		if status == StatusSubmitted {
+			err = s.campaignService.CheckSubmit(ctx, req.CampaignID, author.Role)
+		} else if _, err = s.campaignService.Get(ctx, req.CampaignID); err == sql.ErrNoRows {
+			err = errors.BadRequest("This campaign doesn't exists in the system : " + req.CampaignID)
+		}
+		if err != nil {
+			return Idea{}, err
+		}
 	}
 
-	err := s.repo.Create(ctx, entity.Idea{
+	tags, err := s.tagService.Canonicalize(ctx, req.Tags)
+	if err != nil {
+		return Idea{}, err
+	}
+	attached, err := s.attachMedia(ctx, req.MediaIDs, author.ID)
+	if err != nil {
+		return Idea{}, err
+	}
+
+	created := entity.Idea{
 		ID:       		  id,
-		AuthorEmail:      req.AuthorEmail,
+		AuthorID:         author.ID,
 		Summary:          req.Summary,
-		Media:            req.Media,
-		Tags:             req.Tags,
+		Media:            attached.Media,
+		Tags:             tags,
 		Issues:           req.Issues,
 		Content:		  req.Content,
-		MediaTypes: 	  req.MediaTypes,
+		MediaTypes: 	  attached.MediaTypes,
+		MediaIds:         attached.MediaIds,
+		Status:           status,
+		StatusChangedAt:  now,
+		CampaignID:       req.CampaignID,
 		CreatedAt:        now,
 		UpdatedAt:        now,
+	}
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, created); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.IdeaCreated, event.IdeaData{Idea: created, ActorID: author.ID})
 	})
 	if err != nil {
 		return Idea{}, err
@@ -133,39 +219,37 @@ func (s service) Update(ctx context.Context, id string, req UpdateIdeaRequest) (
 	if err2 !=nil{
 		return Idea{}, errors.InternalServerError("Requester User doesn't exist")
 	}
-	if !(author.Role == "admin" ||  author.Role == "super_admin" || idea.AuthorEmail == author.ID){
+	if !(author.Role == "admin" ||  author.Role == "super_admin" || idea.AuthorID == author.ID){
 		return Idea{}, errors.InternalServerError("Requester User doesn't have permission to edit ideas")
 	}
 
+	tags, err := s.tagService.Canonicalize(ctx, req.Tags)
+	if err != nil {
+		return Idea{}, err
+	}
+	attached, err := s.attachMedia(ctx, req.MediaIDs, idea.AuthorID, author.ID)
+	if err != nil {
+		return Idea{}, err
+	}
+
 	idea.Issues = req.Issues
-	idea.Tags = req.Tags
-	idea.Media = req.Media
+	idea.Tags = tags
+	idea.Media = attached.Media
+	idea.MediaTypes = attached.MediaTypes
+	idea.MediaIds = attached.MediaIds
 	idea.Summary = req.Summary
-	idea.BadFlag = req.BadFlag
-	idea.Enabled = req.Enabled
 	idea.UpdatedAt = time.Now()
 
-	var IPExists bool
-	IPExists = false
-	for i := range idea.IssuesIPs  {
-		if idea.VotersIds[i] == req.IP {
-			IPExists = true
-			break
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, idea.Idea); err != nil {
+			return err
 		}
-	}
-
-	if !IPExists{
-		idea.IssuesIPs = append(idea.IssuesIPs, req.IP)
-	}
-
-	if len(idea.IssuesIPs) >= 3 {
-		idea.BadFlag = true
-	}
-
-	if err := s.repo.Update(ctx, idea.Idea); err != nil {
+		return s.events.Publish(ctx, event.IdeaUpdated, event.IdeaData{Idea: idea.Idea, ActorID: author.ID})
+	})
+	if err != nil {
 		return idea, err
 	}
-	return idea, nil
+	return s.withMedia(ctx, idea.Idea)
 }
 
 
@@ -175,7 +259,13 @@ func (s service) Delete(ctx context.Context, id string) (Idea, error) {
 	if err != nil {
 		return Idea{}, err
 	}
-	if err = s.repo.Delete(ctx, id); err != nil {
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.IdeaDeleted, event.IdeaData{Idea: idea.Idea})
+	})
+	if err != nil {
 		return Idea{}, err
 	}
 	return idea, nil
@@ -188,15 +278,23 @@ func (s service) Count(ctx context.Context) (int, error) {
 
 
 func (s service) Query(ctx context.Context, getIdeaRequest GetIdeaRequest) ([]Idea, error) {
+	if _, ok := sortOrders[getIdeaRequest.Sort]; getIdeaRequest.Sort != "" && !ok {
+		return nil, errors.BadRequest("Unknown sort mode : " + getIdeaRequest.Sort)
+	}
+	if getIdeaRequest.Tag != "" {
+		// ideas only hold canonical tags, so an alias is replaced with the tag it resolves to
+		t, err := s.tagService.Get(ctx, getIdeaRequest.Tag)
+		if err == nil {
+			getIdeaRequest.Tag = t.ID
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
 	items, err := s.repo.Query(ctx, getIdeaRequest)
 	if err != nil {
 		return nil, err
 	}
-	result := []Idea{}
-	for _, item := range items {
-		result = append(result, Idea{item})
-	}
-	return result, nil
+	return s.withMediaAll(ctx, items)
 }
 
 func (s service) Vote(ctx context.Context, voteIdeaRequest VoteIdeaRequest) (Idea, error) {
@@ -206,19 +304,27 @@ func (s service) Vote(ctx context.Context, voteIdeaRequest VoteIdeaRequest) (Ide
 		return Idea{}, errors.InternalServerError("Idea doesn't exist")
 	}
 
-	_, err2 := s.userService.GetUser(ctx, voteIdeaRequest.RequesterUserEmail)
+	voter, err2 := s.userService.GetUser(ctx, voteIdeaRequest.RequesterUserEmail)
 	if err2 !=nil{
 		return Idea{}, errors.InternalServerError("Requester User doesn't exist")
 	}
+	if err := user.CheckVerified(voter); err != nil {
+		return Idea{}, err
+	}
+	if idea.CampaignID != "" {
+		if err := s.campaignService.CheckVote(ctx, idea.CampaignID, voter.Role); err != nil {
+			return Idea{}, err
+		}
+	}
 
-	if voteIdeaRequest.RequesterUserEmail == idea.AuthorEmail  {
+	if voter.ID == idea.AuthorID  {
 		return Idea{}, errors.InternalServerError("User cannot vote on it's own idea")
 	}
 
 	var voterExists bool
 	voterExists = false
 	for i := range idea.VotersIds  {
-		if idea.VotersIds[i] == voteIdeaRequest.RequesterUserEmail {
+		if idea.VotersIds[i] == voter.ID {
 			voterExists = true
 			break
 		}
@@ -229,16 +335,192 @@ func (s service) Vote(ctx context.Context, voteIdeaRequest VoteIdeaRequest) (Ide
 	}
 
 	idea.Votes++
-	idea.VotersIds = append(idea.VotersIds,  voteIdeaRequest.RequesterUserEmail )
+	idea.VotersIds = append(idea.VotersIds,  voter.ID )
+	vote := entity.IdeaVote{
+		IdeaID:    idea.ID,
+		VoterID:   voter.ID,
+		CreatedAt: time.Now(),
+	}
+
+	// the score of the voter, the notifications and the webhooks are handled by the subscribers of the event
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.AddVote(ctx, idea.Idea, vote); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.IdeaVoted, event.VoteData{Idea: idea.Idea, VoterID: voter.ID, VoterName: voter.Name})
+	})
+	if err != nil {
+		return idea, err
+	}
+	return idea, nil
+}
+
+
+// ChangeStatus moves the idea with the specified ID to a new lifecycle status and records the transition.
+func (s service) ChangeStatus(ctx context.Context, id string, req ChangeStatusRequest) (Idea, error) {
+	idea, err := s.Get(ctx, id)
+	if err != nil {
+		return Idea{}, err
+	}
+
+	requester, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return Idea{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+
+	actors := []string{requester.Role}
+	if idea.AuthorID == requester.ID {
+		actors = append(actors, actorAuthor)
+	}
+	if err := checkTransition(idea.Status, req.Status, actors); err != nil {
+		return Idea{}, err
+	}
+	if req.Status == StatusRejected && strings.TrimSpace(req.Reason) == "" {
+		return Idea{}, errors.BadRequest("A reason is required when rejecting an idea")
+	}
+	if req.Status == StatusSubmitted && idea.CampaignID != "" {
+		if err := s.campaignService.CheckSubmit(ctx, idea.CampaignID, requester.Role); err != nil {
+			return Idea{}, err
+		}
+	}
+
+	now := time.Now()
+	change := entity.IdeaStatusChange{
+		ID:         entity.GenerateID(),
+		IdeaID:     idea.ID,
+		FromStatus: idea.Status,
+		ToStatus:   req.Status,
+		Reason:     req.Reason,
+		ChangedBy:  requester.ID,
+		CreatedAt:  now,
+	}
+	idea.Status = req.Status
+	idea.StatusChangedAt = now
+	idea.UpdatedAt = now
+
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdateStatus(ctx, idea.Idea, change); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.IdeaStatusChanged, event.StatusChangeData{Idea: idea.Idea, Change: change})
+	})
+	if err != nil {
+		return Idea{}, err
+	}
+	return idea, nil
+}
+
+// StatusHistory returns the status transitions of the idea with the specified ID, oldest first.
+func (s service) StatusHistory(ctx context.Context, id string) ([]entity.IdeaStatusChange, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.StatusHistory(ctx, id)
+}
+
+// Trash returns a page of the deleted ideas. Only admins may view the trash.
+func (s service) Trash(ctx context.Context, requesterEmail string, page, perPage int) (*pagination.Pages, error) {
+	if err := s.checkAdmin(ctx, requesterEmail); err != nil {
+		return nil, err
+	}
+	count, err := s.repo.CountDeleted(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	items, err := s.repo.QueryDeleted(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	result := []Idea{}
+	for _, item := range items {
+		result = append(result, Idea{Idea: item})
+	}
+	pages.Items = result
+	return pages, nil
+}
+
+// Restore moves the idea with the specified ID out of the trash.
+func (s service) Restore(ctx context.Context, id string, req RestoreIdeaRequest) (Idea, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return Idea{}, err
+	}
+	if err := s.repo.Restore(ctx, id); err != nil {
+		return Idea{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+// PurgeDeleted permanently removes the ideas deleted before the given time.
+func (s service) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return s.repo.Purge(ctx, before)
+}
 
-	var input user.UpdateUserRequest
-	input.RequesterUserEmail = voteIdeaRequest.RequesterUserEmail
-	input.IncreaseScore = true
-	s.userService.UpdateUser(ctx,voteIdeaRequest.RequesterUserEmail, input, true)
+func (s service) checkAdmin(ctx context.Context, requesterEmail string) error {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return errors.InternalServerError("Requester User doesn't exist")
+	}
+	if !user.IsAdmin(requester.Role) {
+		return errors.Forbidden("Requester User doesn't have permission to manage deleted ideas")
+	}
+	return nil
+}
 
-	if err := s.repo.Update(ctx, idea.Idea); err != nil {
+// attachMedia resolves the media with the given IDs into the URLs and content types stored with an idea.
+// Only media uploaded by one of the owners can be attached.
+func (s service) attachMedia(ctx context.Context, ids []string, owners ...string) (entity.Idea, error) {
+	idea := entity.Idea{}
+	items, err := s.mediaService.Resolve(ctx, ids)
+	if err != nil {
 		return idea, err
 	}
+	for _, item := range items {
+		owned := false
+		for _, owner := range owners {
+			if item.OwnerID == owner {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			return idea, errors.Forbidden("Media can only be attached by the user who uploaded it : " + item.ID)
+		}
+		idea.MediaIds = append(idea.MediaIds, item.ID)
+		idea.Media = append(idea.Media, item.URL)
+		idea.MediaTypes = append(idea.MediaTypes, item.ContentType)
+	}
 	return idea, nil
 }
 
+// withMedia adds the attached media to an idea.
+func (s service) withMedia(ctx context.Context, idea entity.Idea) (Idea, error) {
+	result, err := s.withMediaAll(ctx, []entity.Idea{idea})
+	if err != nil {
+		return Idea{}, err
+	}
+	return result[0], nil
+}
+
+// withMediaAll adds the attached media to ideas, looking up the media of all the ideas at once.
+func (s service) withMediaAll(ctx context.Context, items []entity.Idea) ([]Idea, error) {
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, item.MediaIds...)
+	}
+	byID, err := s.mediaService.Lookup(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	result := []Idea{}
+	for _, item := range items {
+		idea := Idea{Idea: item}
+		for _, id := range item.MediaIds {
+			if m, ok := byID[id]; ok {
+				idea.MediaItems = append(idea.MediaItems, m)
+			}
+		}
+		result = append(result, idea)
+	}
+	return result, nil
+}
@@ -0,0 +1,42 @@
+package idea
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/media"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type mockMediaService struct {
+	media.Service
+}
+
+func (m mockMediaService) Resolve(ctx context.Context, ids []string) ([]media.Media, error) {
+	var items []media.Media
+	for _, id := range ids {
+		items = append(items, media.Media{
+			Media: entity.Media{ID: id, OwnerID: "owner-" + id, ContentType: "image/png"},
+			URL:   "/v1/media/" + id + "/content",
+		})
+	}
+	return items, nil
+}
+
+func Test_attachMedia(t *testing.T) {
+	s := service{mediaService: mockMediaService{}}
+	ctx := context.Background()
+
+	attached, err := s.attachMedia(ctx, []string{"m1", "m2"}, "owner-m1", "owner-m2")
+	assert.Nil(t, err)
+	assert.Equal(t, pq.StringArray{"m1", "m2"}, attached.MediaIds)
+	assert.Equal(t, pq.StringArray{"/v1/media/m1/content", "/v1/media/m2/content"}, attached.Media)
+	assert.Equal(t, pq.StringArray{"image/png", "image/png"}, attached.MediaTypes)
+
+	// media uploaded by somebody else cannot be attached
+	_, err = s.attachMedia(ctx, []string{"m1", "m2"}, "owner-m1")
+	assert.NotNil(t, err)
+	_, err = s.attachMedia(ctx, []string{"m1"})
+	assert.NotNil(t, err)
+}
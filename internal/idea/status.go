@@ -0,0 +1,91 @@
+package idea
+
+import (
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+)
+
+// The statuses an idea moves through during its lifecycle.
+const (
+	StatusDraft       = "draft"
+	StatusSubmitted   = "submitted"
+	StatusUnderReview = "under_review"
+	StatusAccepted    = "accepted"
+	StatusInProgress  = "in_progress"
+	StatusImplemented = "implemented"
+	StatusRejected    = "rejected"
+	StatusArchived    = "archived"
+)
+
+// actorAuthor is a pseudo role granted to the author of the idea being transitioned.
+const actorAuthor = "author"
+
+var statuses = []string{
+	StatusDraft, StatusSubmitted, StatusUnderReview, StatusAccepted,
+	StatusInProgress, StatusImplemented, StatusRejected, StatusArchived,
+}
+
+// transitions lists, for every status, the statuses it may move to and the actors allowed to perform each move.
+var transitions = map[string]map[string][]string{
+	StatusDraft: {
+		StatusSubmitted: {actorAuthor},
+		StatusArchived:  {actorAuthor, user.ADMIN, user.SUPER_ADMIN},
+	},
+	StatusSubmitted: {
+		StatusDraft:       {actorAuthor},
+		StatusUnderReview: {user.ADMIN, user.SUPER_ADMIN},
+		StatusRejected:    {user.ADMIN, user.SUPER_ADMIN},
+		StatusArchived:    {user.ADMIN, user.SUPER_ADMIN},
+	},
+	StatusUnderReview: {
+		StatusAccepted: {user.ADMIN, user.SUPER_ADMIN},
+		StatusRejected: {user.ADMIN, user.SUPER_ADMIN},
+		StatusArchived: {user.ADMIN, user.SUPER_ADMIN},
+	},
+	StatusAccepted: {
+		StatusInProgress: {user.ADMIN, user.SUPER_ADMIN},
+		StatusArchived:   {user.ADMIN, user.SUPER_ADMIN},
+	},
+	StatusInProgress: {
+		StatusImplemented: {user.ADMIN, user.SUPER_ADMIN},
+		StatusAccepted:    {user.ADMIN, user.SUPER_ADMIN},
+		StatusArchived:    {user.ADMIN, user.SUPER_ADMIN},
+	},
+	StatusImplemented: {
+		StatusArchived: {user.ADMIN, user.SUPER_ADMIN},
+	},
+	StatusRejected: {
+		StatusUnderReview: {user.ADMIN, user.SUPER_ADMIN},
+		StatusArchived:    {user.ADMIN, user.SUPER_ADMIN},
+	},
+	StatusArchived: {},
+}
+
+// isValidStatus reports whether the given status is a known idea status.
+func isValidStatus(status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTransition verifies that any of the given actors may move an idea from one status to another.
+func checkTransition(from, to string, actors []string) error {
+	if !isValidStatus(to) {
+		return errors.BadRequest("This status doesn't exists in the system : " + to)
+	}
+	allowed, ok := transitions[from][to]
+	if !ok {
+		return errors.BadRequest("An idea cannot move from " + from + " to " + to)
+	}
+	for _, a := range allowed {
+		for _, actor := range actors {
+			if a == actor {
+				return nil
+			}
+		}
+	}
+	return errors.Forbidden("Requester User doesn't have permission to move the idea to " + to)
+}
@@ -0,0 +1,39 @@
+package idea
+
+import (
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func Test_checkTransition(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   string
+		to     string
+		actors []string
+		status int
+	}{
+		{"author submits draft", StatusDraft, StatusSubmitted, []string{user.VISITOR, actorAuthor}, 0},
+		{"visitor cannot submit others draft", StatusDraft, StatusSubmitted, []string{user.VISITOR}, http.StatusForbidden},
+		{"admin reviews submission", StatusSubmitted, StatusUnderReview, []string{user.ADMIN}, 0},
+		{"author cannot accept own idea", StatusUnderReview, StatusAccepted, []string{user.VISITOR, actorAuthor}, http.StatusForbidden},
+		{"skipping review is not allowed", StatusSubmitted, StatusAccepted, []string{user.SUPER_ADMIN}, http.StatusBadRequest},
+		{"archived is final", StatusArchived, StatusDraft, []string{user.SUPER_ADMIN}, http.StatusBadRequest},
+		{"unknown status", StatusDraft, "done", []string{user.SUPER_ADMIN}, http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkTransition(tc.from, tc.to, tc.actors)
+			if tc.status == 0 {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.Equal(t, tc.status, err.(errors.ErrorResponse).StatusCode())
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package invitation
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"net/http"
+	"strconv"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/admin/invitations", res.query)
+	r.Post("/admin/invitations", res.invite)
+	r.Delete("/admin/invitations/<id>", res.revoke)
+	r.Get("/invitations/<token>", res.get)
+	r.Post("/invitations/<token>/accept", res.accept)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) query(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Query(c.Request.Context(), c.Query("requester_user_email"), c.Query("status"), page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
+
+func (r resource) invite(c *routing.Context) error {
+	var input InviteRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	invitation, err := r.service.Invite(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(invitation, http.StatusCreated)
+}
+
+func (r resource) revoke(c *routing.Context) error {
+	var input RevokeRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	invitation, err := r.service.Revoke(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(invitation)
+}
+
+func (r resource) get(c *routing.Context) error {
+	invitation, err := r.service.Get(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		return err
+	}
+	return c.Write(invitation)
+}
+
+func (r resource) accept(c *routing.Context) error {
+	var input AcceptRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	user, err := r.service.Accept(c.Request.Context(), c.Param("token"), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(user, http.StatusCreated)
+}
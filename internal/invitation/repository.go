@@ -0,0 +1,114 @@
+package invitation
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Repository encapsulates the logic to access invitations from the data source.
+type Repository interface {
+	// Get returns the invitation with the specified ID.
+	Get(ctx context.Context, id string) (entity.Invitation, error)
+
+	// GetByTokenHash returns the invitation whose token has the given hash.
+	GetByTokenHash(ctx context.Context, tokenHash string) (entity.Invitation, error)
+
+	// Create saves a new invitation in the storage.
+	Create(ctx context.Context, invitation entity.Invitation) error
+
+	// Update saves the changes to an invitation in the storage.
+	Update(ctx context.Context, invitation entity.Invitation) error
+
+	// RevokePending revokes the pending invitations of an email address at the given time.
+	RevokePending(ctx context.Context, email string, now time.Time) error
+
+	// Count returns the number of invitations with the given status at the given time, or of every invitation if it is empty.
+	Count(ctx context.Context, status string, now time.Time) (int, error)
+
+	// Query returns the invitations with the given status at the given time, or every invitation if it is empty, newest first.
+	Query(ctx context.Context, status string, now time.Time, offset, limit int) ([]entity.Invitation, error)
+}
+
+// repository persists invitations in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new invitation repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the invitation with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Invitation, error) {
+	var invitation entity.Invitation
+	err := r.db.With(ctx).Select().Model(id, &invitation)
+	return invitation, err
+}
+
+// GetByTokenHash reads the invitation whose token has the given hash from the database.
+func (r repository) GetByTokenHash(ctx context.Context, tokenHash string) (entity.Invitation, error) {
+	var invitation entity.Invitation
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"token_hash": tokenHash}).One(&invitation)
+	return invitation, err
+}
+
+// Create saves a new invitation record in the database.
+func (r repository) Create(ctx context.Context, invitation entity.Invitation) error {
+	return r.db.With(ctx).Model(&invitation).Insert()
+}
+
+// Update saves the changes to an invitation in the database.
+func (r repository) Update(ctx context.Context, invitation entity.Invitation) error {
+	return r.db.With(ctx).Model(&invitation).Update()
+}
+
+// RevokePending revokes the pending invitations of an email address.
+func (r repository) RevokePending(ctx context.Context, email string, now time.Time) error {
+	_, err := r.db.With(ctx).Update("invitation",
+		dbx.Params{"revoked_at": now},
+		dbx.And(dbx.HashExp{"email": email}, statusExp(StatusPending, now)),
+	).Execute()
+	return err
+}
+
+// Count returns the number of invitations with the given status.
+func (r repository) Count(ctx context.Context, status string, now time.Time) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("invitation").Where(statusExp(status, now)).Row(&count)
+	return count, err
+}
+
+// Query retrieves the invitations with the given status from the database.
+func (r repository) Query(ctx context.Context, status string, now time.Time, offset, limit int) ([]entity.Invitation, error) {
+	var invitations []entity.Invitation
+	err := r.db.With(ctx).
+		Select().
+		Where(statusExp(status, now)).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&invitations)
+	return invitations, err
+}
+
+// statusExp returns the condition of the invitations having the given status at the given time.
+func statusExp(status string, now time.Time) dbx.Expression {
+	params := dbx.Params{"now": now}
+	switch status {
+	case StatusPending:
+		return dbx.NewExp("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > {:now}", params)
+	case StatusAccepted:
+		return dbx.NewExp("accepted_at IS NOT NULL")
+	case StatusRevoked:
+		return dbx.NewExp("revoked_at IS NOT NULL")
+	case StatusExpired:
+		return dbx.NewExp("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= {:now}", params)
+	}
+	return nil
+}
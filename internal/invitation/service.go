@@ -0,0 +1,303 @@
+package invitation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/notification"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Statuses of an invitation.
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRevoked  = "revoked"
+	StatusExpired  = "expired"
+)
+
+var invitationEmail = template.Must(template.New("invitation").Parse(`Hello,
+
+{{.Inviter}} invited you to join as {{.Role}}.
+
+Complete your registration before {{.ExpiresAt.Format "January 2, 2006 15:04 MST"}}:
+{{.Link}}
+
+If you weren't expecting this invitation, you can ignore this email.
+`))
+
+// Service encapsulates usecase logic for invitations.
+type Service interface {
+	Invite(ctx context.Context, req InviteRequest) (Invitation, error)
+	Query(ctx context.Context, requesterEmail, status string, page, perPage int) (*pagination.Pages, error)
+	Revoke(ctx context.Context, id string, req RevokeRequest) (Invitation, error)
+	Get(ctx context.Context, token string) (Invitation, error)
+	Accept(ctx context.Context, token string, req AcceptRequest) (user.User, error)
+}
+
+// Invitation represents the data about an invitation.
+type Invitation struct {
+	entity.Invitation
+	Status string `json:"status"`
+}
+
+// InviteRequest represents a request to invite a person.
+type InviteRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	Email              string `json:"email"`
+	Role               string `json:"role"`
+}
+
+// RevokeRequest represents a request to revoke an invitation.
+type RevokeRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
+
+// AcceptRequest represents the registration details an invitee completes.
+type AcceptRequest struct {
+	Name    string `json:"name"`
+	Country string `json:"country"`
+}
+
+type service struct {
+	repo        Repository
+	userService user.UserService
+	mailer      notification.Mailer
+	transaction dbcontext.TransactionFunc
+	expiration  time.Duration
+	publicURL   string
+	logger      log.Logger
+}
+
+// NewService creates a new invitation service. Invitations expire after the given duration, and their links
+// point to the given public URL of the API.
+func NewService(repo Repository, userService user.UserService, mailer notification.Mailer, transaction dbcontext.TransactionFunc,
+	expiration time.Duration, publicURL string, logger log.Logger) Service {
+	return service{repo, userService, mailer, transaction, expiration, strings.TrimRight(publicURL, "/"), logger}
+}
+
+// Invite invites a person to join with the given role and emails them the invitation link. The requester needs
+// the permission to create users with the role. A pending invitation of the same email address is revoked.
+func (s service) Invite(ctx context.Context, req InviteRequest) (Invitation, error) {
+	email := strings.TrimSpace(req.Email)
+	if !strings.Contains(email, "@") || strings.ContainsAny(email, " \t\r\n") {
+		return Invitation{}, errors.BadRequest("This email address is invalid : " + email)
+	}
+	if isPermitted, errMsg := s.userService.CheckPermission(ctx, req.RequesterUserEmail, req.Role); !isPermitted {
+		return Invitation{}, errMsg
+	}
+	inviter, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return Invitation{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	if _, err := s.userService.GetUser(ctx, email); err == nil {
+		return Invitation{}, errors.BadRequest("A user with this email address already exists : " + email)
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return Invitation{}, err
+	}
+	now := time.Now()
+	invitation := entity.Invitation{
+		ID:        entity.GenerateID(),
+		Email:     email,
+		Role:      req.Role,
+		TokenHash: hashToken(token),
+		InvitedBy: inviter.ID,
+		ExpiresAt: now.Add(s.expiration),
+		CreatedAt: now,
+	}
+	// the email is sent last so that the invitation is not saved if it cannot be sent
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.RevokePending(ctx, email, now); err != nil {
+			return err
+		}
+		if err := s.repo.Create(ctx, invitation); err != nil {
+			return err
+		}
+		return s.send(ctx, invitation, inviter, token)
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+	return withStatus(invitation, now), nil
+}
+
+// Query returns a page of the invitations with the given status, or of every invitation if it is empty.
+// Only admins may list invitations.
+func (s service) Query(ctx context.Context, requesterEmail, status string, page, perPage int) (*pagination.Pages, error) {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return nil, errors.InternalServerError("Requester User doesn't exist")
+	}
+	if !user.IsAdmin(requester.Role) {
+		return nil, errors.Forbidden("Requester User doesn't have permission to manage invitations")
+	}
+	if status != "" && status != StatusPending && status != StatusAccepted && status != StatusRevoked && status != StatusExpired {
+		return nil, errors.BadRequest("This invitation status doesn't exists in the system : " + status)
+	}
+
+	now := time.Now()
+	count, err := s.repo.Count(ctx, status, now)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	items, err := s.repo.Query(ctx, status, now, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	invitations := []Invitation{}
+	for _, item := range items {
+		invitations = append(invitations, withStatus(item, now))
+	}
+	pages.Items = invitations
+	return pages, nil
+}
+
+// Revoke revokes a pending invitation. The requester needs the permission to create users with its role.
+func (s service) Revoke(ctx context.Context, id string, req RevokeRequest) (Invitation, error) {
+	invitation, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if isPermitted, errMsg := s.userService.CheckPermission(ctx, req.RequesterUserEmail, invitation.Role); !isPermitted {
+		return Invitation{}, errMsg
+	}
+	now := time.Now()
+	if status := Status(invitation, now); status != StatusPending {
+		return Invitation{}, errors.BadRequest("The invitation is " + status)
+	}
+	invitation.RevokedAt = &now
+	if err := s.repo.Update(ctx, invitation); err != nil {
+		return Invitation{}, err
+	}
+	return withStatus(invitation, now), nil
+}
+
+// Get returns the pending invitation with the given token, so that the invitee can review it.
+func (s service) Get(ctx context.Context, token string) (Invitation, error) {
+	invitation, err := s.pending(ctx, token, time.Now())
+	if err != nil {
+		return Invitation{}, err
+	}
+	return withStatus(invitation, time.Now()), nil
+}
+
+// Accept creates the user of a pending invitation with the given details. The email address of the user is
+// confirmed, as the invitee received the token by email. The inviter must still have the permission to create
+// users with the role of the invitation.
+func (s service) Accept(ctx context.Context, token string, req AcceptRequest) (user.User, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return user.User{}, errors.BadRequest("The name is required")
+	}
+	var created user.User
+	err := s.transaction(ctx, func(ctx context.Context) error {
+		now := time.Now()
+		invitation, err := s.pending(ctx, token, now)
+		if err != nil {
+			return err
+		}
+		inviter, err := s.userService.GetUserByID(ctx, invitation.InvitedBy)
+		if err != nil {
+			return errors.BadRequest("The user who sent the invitation doesn't exist anymore")
+		}
+		_, err = s.userService.CreateUser(ctx, user.CreateUserRequest{
+			RequesterUserEmail: inviter.Email,
+			EmailAddress:       invitation.Email,
+			Role:               invitation.Role,
+			Name:               name,
+			Country:            strings.TrimSpace(req.Country),
+		})
+		if err != nil {
+			return err
+		}
+		if created, err = s.userService.UpdateUser(ctx, invitation.Email, user.UpdateUserRequest{Authenticate: true}, true); err != nil {
+			return err
+		}
+		invitation.AcceptedAt = &now
+		return s.repo.Update(ctx, invitation)
+	})
+	if err != nil {
+		return user.User{}, err
+	}
+	return created, nil
+}
+
+// pending returns the invitation with the given token, or an error unless it is pending.
+func (s service) pending(ctx context.Context, token string, now time.Time) (entity.Invitation, error) {
+	invitation, err := s.repo.GetByTokenHash(ctx, hashToken(token))
+	if err == sql.ErrNoRows {
+		return entity.Invitation{}, errors.NotFound("The invitation doesn't exist")
+	} else if err != nil {
+		return entity.Invitation{}, err
+	}
+	if status := Status(invitation, now); status != StatusPending {
+		return entity.Invitation{}, errors.BadRequest("The invitation is " + status)
+	}
+	return invitation, nil
+}
+
+// send emails the invitation link to the invitee.
+func (s service) send(ctx context.Context, invitation entity.Invitation, inviter user.User, token string) error {
+	name := inviter.Name
+	if name == "" {
+		name = inviter.Email
+	}
+	var body bytes.Buffer
+	err := invitationEmail.Execute(&body, struct {
+		entity.Invitation
+		Inviter string
+		Link    string
+	}{invitation, name, s.publicURL + "/v1/invitations/" + token})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, invitation.Email, "You are invited to join", body.String())
+}
+
+// Status returns the status of an invitation at the given time.
+func Status(invitation entity.Invitation, now time.Time) string {
+	switch {
+	case invitation.AcceptedAt != nil:
+		return StatusAccepted
+	case invitation.RevokedAt != nil:
+		return StatusRevoked
+	case !invitation.ExpiresAt.After(now):
+		return StatusExpired
+	}
+	return StatusPending
+}
+
+func withStatus(invitation entity.Invitation, now time.Time) Invitation {
+	return Invitation{invitation, Status(invitation, now)}
+}
+
+// generateToken returns a random token for an invitation link.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hash under which the token of an invitation is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,264 @@
+package invitation
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type mockRepository struct {
+	Repository
+	invitations []entity.Invitation
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.Invitation, error) {
+	for _, invitation := range m.invitations {
+		if invitation.ID == id {
+			return invitation, nil
+		}
+	}
+	return entity.Invitation{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetByTokenHash(ctx context.Context, tokenHash string) (entity.Invitation, error) {
+	for _, invitation := range m.invitations {
+		if invitation.TokenHash == tokenHash {
+			return invitation, nil
+		}
+	}
+	return entity.Invitation{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Create(ctx context.Context, invitation entity.Invitation) error {
+	m.invitations = append(m.invitations, invitation)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, invitation entity.Invitation) error {
+	for i := range m.invitations {
+		if m.invitations[i].ID == invitation.ID {
+			m.invitations[i] = invitation
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) RevokePending(ctx context.Context, email string, now time.Time) error {
+	for i, invitation := range m.invitations {
+		if invitation.Email == email && Status(invitation, now) == StatusPending {
+			m.invitations[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type mockUserService struct {
+	user.UserService
+	users []entity.Users
+}
+
+func (m *mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	for _, u := range m.users {
+		if u.Email == email {
+			return user.User{Users: u}, nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+func (m *mockUserService) GetUserByID(ctx context.Context, id string) (user.User, error) {
+	for _, u := range m.users {
+		if u.ID == id {
+			return user.User{Users: u}, nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+// CheckPermission lets super admins manage every role, and admins only visitors.
+func (m *mockUserService) CheckPermission(ctx context.Context, requesterEmail string, role string) (bool, error) {
+	requester, err := m.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return false, err
+	}
+	if requester.Role == user.SUPER_ADMIN || requester.Role == user.ADMIN && role == user.VISITOR {
+		return true, nil
+	}
+	return false, user.ErrPermissionDenied
+}
+
+func (m *mockUserService) CreateUser(ctx context.Context, req user.CreateUserRequest) (user.User, error) {
+	u := entity.Users{ID: entity.GenerateID(), Email: req.EmailAddress, Role: req.Role, Name: req.Name, Country: req.Country}
+	m.users = append(m.users, u)
+	return user.User{Users: u}, nil
+}
+
+func (m *mockUserService) UpdateUser(ctx context.Context, email string, input user.UpdateUserRequest, bypassAuth bool) (user.User, error) {
+	for i, u := range m.users {
+		if u.Email == email {
+			if input.Authenticate {
+				m.users[i].IsAuth = true
+			}
+			return user.User{Users: m.users[i]}, nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+type mockMailer struct {
+	// the bodies of the emails sent, by recipient
+	emails map[string]string
+}
+
+func (m *mockMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.emails[to] = body
+	return nil
+}
+
+func newTestService() (Service, *mockRepository, *mockUserService, *mockMailer) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	users := &mockUserService{users: []entity.Users{
+		{ID: "u1", Email: "super@example.com", Role: user.SUPER_ADMIN, Name: "Sue"},
+		{ID: "u2", Email: "admin@example.com", Role: user.ADMIN},
+		{ID: "u3", Email: "ann@example.com", Role: user.VISITOR},
+	}}
+	mailer := &mockMailer{emails: map[string]string{}}
+	transaction := func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	return NewService(repo, users, mailer, transaction, time.Hour, "https://ideas.example.com", logger), repo, users, mailer
+}
+
+// addInvitation saves an invitation with the given token, sent by the admin.
+func addInvitation(repo *mockRepository, id, email, token string, expiresAt time.Time) entity.Invitation {
+	invitation := entity.Invitation{ID: id, Email: email, Role: user.VISITOR, TokenHash: hashToken(token),
+		InvitedBy: "u2", ExpiresAt: expiresAt, CreatedAt: time.Now()}
+	repo.invitations = append(repo.invitations, invitation)
+	return invitation
+}
+
+func TestService_Invite(t *testing.T) {
+	s, repo, _, mailer := newTestService()
+	ctx := context.Background()
+
+	invitation, err := s.Invite(ctx, InviteRequest{RequesterUserEmail: "super@example.com", Email: " bob@example.com ", Role: user.ADMIN})
+	assert.Nil(t, err)
+	assert.Equal(t, "bob@example.com", invitation.Email)
+	assert.Equal(t, user.ADMIN, invitation.Role)
+	assert.Equal(t, "u1", invitation.InvitedBy)
+	assert.Equal(t, StatusPending, invitation.Status)
+	assert.Len(t, repo.invitations, 1)
+	// the invitee is emailed the token, which is only stored hashed
+	assert.Contains(t, mailer.emails["bob@example.com"], "Sue invited you to join as admin")
+	assert.Contains(t, mailer.emails["bob@example.com"], "https://ideas.example.com/v1/invitations/")
+	assert.NotContains(t, mailer.emails["bob@example.com"], invitation.TokenHash)
+
+	link := regexp.MustCompile(`/v1/invitations/(\S+)`)
+	first := link.FindStringSubmatch(mailer.emails["bob@example.com"])
+	assert.Len(t, first, 2)
+
+	// inviting the same address again revokes the pending invitation
+	again, err := s.Invite(ctx, InviteRequest{RequesterUserEmail: "admin@example.com", Email: "bob@example.com", Role: user.VISITOR})
+	assert.Nil(t, err)
+	if assert.Len(t, repo.invitations, 2) {
+		assert.Equal(t, StatusRevoked, Status(repo.invitations[0], time.Now()))
+		assert.Equal(t, again.ID, repo.invitations[1].ID)
+		assert.Equal(t, StatusPending, Status(repo.invitations[1], time.Now()))
+	}
+	// and only the last link works
+	if len(first) == 2 {
+		_, err = s.Get(ctx, first[1])
+		assert.NotNil(t, err)
+	}
+	if last := link.FindStringSubmatch(mailer.emails["bob@example.com"]); assert.Len(t, last, 2) {
+		found, err := s.Get(ctx, last[1])
+		assert.Nil(t, err)
+		assert.Equal(t, again.ID, found.ID)
+	}
+}
+
+func TestService_Invite_permission(t *testing.T) {
+	s, repo, _, mailer := newTestService()
+	ctx := context.Background()
+
+	// the requester needs the permission to create users with the role
+	_, err := s.Invite(ctx, InviteRequest{RequesterUserEmail: "admin@example.com", Email: "bob@example.com", Role: user.ADMIN})
+	assert.Equal(t, user.ErrPermissionDenied, err)
+	_, err = s.Invite(ctx, InviteRequest{RequesterUserEmail: "ann@example.com", Email: "bob@example.com", Role: user.VISITOR})
+	assert.Equal(t, user.ErrPermissionDenied, err)
+	_, err = s.Invite(ctx, InviteRequest{RequesterUserEmail: "unknown@example.com", Email: "bob@example.com", Role: user.VISITOR})
+	assert.NotNil(t, err)
+
+	_, err = s.Invite(ctx, InviteRequest{RequesterUserEmail: "admin@example.com", Email: "bob", Role: user.VISITOR})
+	assert.NotNil(t, err)
+	_, err = s.Invite(ctx, InviteRequest{RequesterUserEmail: "admin@example.com", Email: "ann@example.com", Role: user.VISITOR})
+	assert.NotNil(t, err)
+	assert.Empty(t, repo.invitations)
+	assert.Empty(t, mailer.emails)
+}
+
+func TestService_Accept(t *testing.T) {
+	s, repo, users, _ := newTestService()
+	ctx := context.Background()
+	addInvitation(repo, "i1", "bob@example.com", "token", time.Now().Add(time.Hour))
+
+	_, err := s.Accept(ctx, "token", AcceptRequest{Name: " "})
+	assert.NotNil(t, err)
+
+	created, err := s.Accept(ctx, "token", AcceptRequest{Name: " Bob ", Country: "FR"})
+	assert.Nil(t, err)
+	assert.Equal(t, "bob@example.com", created.Email)
+	assert.Equal(t, "Bob", created.Name)
+	assert.Equal(t, user.VISITOR, created.Role)
+	// the email address is confirmed, as the invitee received the token by email
+	assert.True(t, created.IsAuth)
+	assert.Len(t, users.users, 4)
+	assert.Equal(t, StatusAccepted, Status(repo.invitations[0], time.Now()))
+
+	// an invitation can only be accepted once
+	_, err = s.Accept(ctx, "token", AcceptRequest{Name: "Bob"})
+	assert.NotNil(t, err)
+	assert.Len(t, users.users, 4)
+}
+
+func TestService_Accept_notPending(t *testing.T) {
+	s, repo, users, _ := newTestService()
+	ctx := context.Background()
+	addInvitation(repo, "i1", "bob@example.com", "expired", time.Now().Add(-time.Minute))
+	addInvitation(repo, "i2", "cid@example.com", "revoked", time.Now().Add(time.Hour))
+	revoked, err := s.Revoke(ctx, "i2", RevokeRequest{RequesterUserEmail: "admin@example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, StatusRevoked, revoked.Status)
+
+	for _, token := range []string{"expired", "revoked", "unknown"} {
+		_, err := s.Accept(ctx, token, AcceptRequest{Name: "Bob"})
+		assert.NotNil(t, err, token)
+		_, err = s.Get(ctx, token)
+		assert.NotNil(t, err, token)
+	}
+	assert.Len(t, users.users, 3)
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+
+	assert.Equal(t, StatusPending, Status(entity.Invitation{ExpiresAt: later}, now))
+	assert.Equal(t, StatusExpired, Status(entity.Invitation{ExpiresAt: earlier}, now))
+	assert.Equal(t, StatusExpired, Status(entity.Invitation{ExpiresAt: now}, now))
+	assert.Equal(t, StatusAccepted, Status(entity.Invitation{ExpiresAt: earlier, AcceptedAt: &earlier}, now))
+	assert.Equal(t, StatusRevoked, Status(entity.Invitation{ExpiresAt: later, RevokedAt: &earlier}, now))
+}
+
+func TestHashToken(t *testing.T) {
+	token, err := generateToken()
+	assert.Nil(t, err)
+	assert.Len(t, token, 43)
+	assert.Equal(t, hashToken(token), hashToken(token))
+	assert.NotEqual(t, token, hashToken(token))
+}
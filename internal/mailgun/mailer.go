@@ -0,0 +1,23 @@
+package mailgun
+
+import (
+	"context"
+	"github.com/mailgun/mailgun-go/v3"
+)
+
+// Mailer sends emails through Mailgun.
+type Mailer struct {
+	mg   *mailgun.MailgunImpl
+	from string
+}
+
+// NewMailer creates a Mailer that sends emails from the given address using a Mailgun domain.
+func NewMailer(domain, apiKey, from string) Mailer {
+	return Mailer{mailgun.NewMailgun(domain, apiKey), from}
+}
+
+// Send sends a plain text email.
+func (m Mailer) Send(ctx context.Context, to, subject, body string) error {
+	_, _, err := m.mg.Send(ctx, m.mg.NewMessage(m.from, subject, body, to))
+	return err
+}
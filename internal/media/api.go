@@ -0,0 +1,99 @@
+package media
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// multipartOverhead is the room left for the multipart envelope and the other form fields of an upload.
+const multipartOverhead = 1 << 20
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+// Request bodies of uploads are limited to maxSize bytes plus the multipart envelope.
+func RegisterHandlers(r *routing.RouteGroup, service Service, maxSize int64, logger log.Logger) {
+	res := resource{service, maxSize, logger}
+
+	r.Post("/media", res.upload)
+	r.Get("/media/<id>", res.get)
+	r.Get("/media/<id>/content", res.content)
+	r.Get("/media/<id>/variants/<name>", res.variant)
+}
+
+type resource struct {
+	service Service
+	maxSize int64
+	logger  log.Logger
+}
+
+func (r resource) upload(c *routing.Context) error {
+	c.Request.Body = http.MaxBytesReader(c.Response, c.Request.Body, r.maxSize+multipartOverhead)
+	if err := c.Request.ParseMultipartForm(multipartOverhead); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("The upload must be a multipart form no larger than the allowed size")
+	}
+	defer c.Request.MultipartForm.RemoveAll()
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("A file is required")
+	}
+	defer file.Close()
+
+	media, err := r.service.Upload(c.Request.Context(), c.Request.FormValue("requester_user_email"),
+		header.Filename, header.Size, file)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(media, http.StatusCreated)
+}
+
+func (r resource) get(c *routing.Context) error {
+	media, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(media)
+}
+
+func (r resource) content(c *routing.Context) error {
+	media, content, err := r.service.Open(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	r.serve(c, media.ContentType, media.Filename, content)
+	return nil
+}
+
+func (r resource) variant(c *routing.Context) error {
+	variant, content, err := r.service.OpenVariant(c.Request.Context(), c.Param("id"), c.Param("name"))
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	r.serve(c, variant.ContentType, "", content)
+	return nil
+}
+
+// serve streams stored content to the client. Stored objects never change, so they can be cached forever.
+func (r resource) serve(c *routing.Context, contentType, filename string, content io.Reader) {
+	header := c.Response.Header()
+	header.Set("Content-Type", contentType)
+	if filename != "" {
+		header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	}
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	if _, err := io.Copy(c.Response, content); err != nil {
+		r.logger.With(c.Request.Context(), "media", c.Param("id")).Errorf("failed streaming media: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/imaging"
+	"image"
+	_ "image/gif" // register the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	// maxPixels is the largest image (in pixels) that is decoded, to protect against decompression bombs.
+	maxPixels = 50 * 1000 * 1000
+	// processingTimeout is how long a media can stay in processing before it is claimed again.
+	processingTimeout = 10 * time.Minute
+	// jpegQuality is the quality of the JPEG variants.
+	jpegQuality = 82
+)
+
+// resizable lists the content types of the images that variants are generated for.
+var resizable = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// variantSpec describes a variant generated for every resizable image.
+type variantSpec struct {
+	name   string
+	width  int
+	height int
+	// crop the image to exactly width x height instead of fitting it within width x height
+	crop bool
+}
+
+var variantSpecs = []variantSpec{
+	{"thumb", 320, 320, true},
+	{"web", 1280, 1280, false},
+}
+
+// ProcessPending generates the variants of up to limit media waiting for processing.
+// It returns the number of media processed. A media that cannot be processed is marked as failed.
+func (s service) ProcessPending(ctx context.Context, limit int) (int, error) {
+	items, err := s.repo.ClaimPending(ctx, limit, time.Now().Add(-processingTimeout))
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		item.Status = StatusReady
+		if err := s.process(ctx, &item); err != nil {
+			s.logger.With(ctx, "media", item.ID).Errorf("failed to process media: %v", err)
+			item.Status = StatusFailed
+		}
+		item.UpdatedAt = time.Now()
+		if err := s.repo.Update(ctx, item); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+// process strips the metadata of the original image, in case it was stored before metadata was removed
+// on upload, and stores the variants of the image.
+func (s service) process(ctx context.Context, media *entity.Media) error {
+	r, err := s.storage.Get(ctx, media.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, s.maxSize+1))
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	stripped, err := imaging.StripMetadata(data, media.ContentType)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stripped, data) {
+		if err := s.storage.Put(ctx, media.StorageKey, bytes.NewReader(stripped), int64(len(stripped)), media.ContentType); err != nil {
+			return err
+		}
+		media.Size = int64(len(stripped))
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > maxPixels {
+		return fmt.Errorf("image too large: %dx%d", config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return err
+	}
+	img = imaging.Orient(img, imaging.Orientation(stripped))
+	media.Width, media.Height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	var variants []entity.MediaVariant
+	for _, spec := range variantSpecs {
+		variant, err := s.storeVariant(ctx, media.ID, img, format, spec)
+		if err != nil {
+			return err
+		}
+		variants = append(variants, variant)
+	}
+	return s.repo.SaveVariants(ctx, media.ID, variants)
+}
+
+// storeVariant resizes the image according to the spec, encodes and stores it. Variants are JPEG images,
+// except for PNG and GIF images with transparency which stay PNG. Re-encoding drops all metadata.
+func (s service) storeVariant(ctx context.Context, id string, img image.Image, format string, spec variantSpec) (entity.MediaVariant, error) {
+	var resized *image.RGBA
+	if spec.crop {
+		resized = imaging.Fill(img, spec.width, spec.height)
+	} else {
+		resized = imaging.Fit(img, spec.width, spec.height)
+	}
+
+	var buf bytes.Buffer
+	contentType, ext := "image/jpeg", ".jpg"
+	if format != "jpeg" && !resized.Opaque() {
+		contentType, ext = "image/png", ".png"
+		if err := png.Encode(&buf, resized); err != nil {
+			return entity.MediaVariant{}, err
+		}
+	} else if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return entity.MediaVariant{}, err
+	}
+
+	variant := entity.MediaVariant{
+		MediaID:     id,
+		Name:        spec.name,
+		StorageKey:  "media/" + id + "/" + spec.name + ext,
+		ContentType: contentType,
+		Width:       resized.Rect.Dx(),
+		Height:      resized.Rect.Dy(),
+		Size:        int64(buf.Len()),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.storage.Put(ctx, variant.StorageKey, &buf, variant.Size, contentType); err != nil {
+		return entity.MediaVariant{}, err
+	}
+	return variant, nil
+}
@@ -0,0 +1,136 @@
+package media
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Repository encapsulates the logic to access media records from the data source.
+type Repository interface {
+	// Get returns the media with the specified ID.
+	Get(ctx context.Context, id string) (entity.Media, error)
+
+	// GetMany returns the media with the specified IDs. Unknown IDs are ignored.
+	GetMany(ctx context.Context, ids []string) ([]entity.Media, error)
+
+	// Create saves a new media record in the storage.
+	Create(ctx context.Context, media entity.Media) error
+
+	// Update saves the changes to a media record in the storage.
+	Update(ctx context.Context, media entity.Media) error
+
+	// ClaimPending marks up to limit media waiting for processing as being processed and returns them.
+	// Media whose processing started before staleBefore are considered abandoned and claimed again.
+	ClaimPending(ctx context.Context, limit int, staleBefore time.Time) ([]entity.Media, error)
+
+	// GetVariant returns the variant with the specified name of a media.
+	GetVariant(ctx context.Context, mediaID, name string) (entity.MediaVariant, error)
+
+	// GetVariants returns the variants of the media with the specified IDs.
+	GetVariants(ctx context.Context, mediaIDs []string) ([]entity.MediaVariant, error)
+
+	// SaveVariants replaces the variants of a media.
+	SaveVariants(ctx context.Context, mediaID string, variants []entity.MediaVariant) error
+}
+
+// repository persists media records in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new media repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the media with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Media, error) {
+	var media entity.Media
+	err := r.db.With(ctx).Select().Model(id, &media)
+	return media, err
+}
+
+// GetMany reads the media with the specified IDs from the database.
+func (r repository) GetMany(ctx context.Context, ids []string) ([]entity.Media, error) {
+	var media []entity.Media
+	if len(ids) == 0 {
+		return media, nil
+	}
+	err := r.db.With(ctx).Select().Where(dbx.In("id", values(ids)...)).All(&media)
+	return media, err
+}
+
+// Create saves a new media record in the database.
+func (r repository) Create(ctx context.Context, media entity.Media) error {
+	return r.db.With(ctx).Model(&media).Insert()
+}
+
+// Update saves the changes to a media record in the database.
+func (r repository) Update(ctx context.Context, media entity.Media) error {
+	return r.db.With(ctx).Model(&media).Update()
+}
+
+// ClaimPending marks media waiting for processing as being processed. Rows locked by another
+// instance of the application are skipped so that every media is processed only once.
+func (r repository) ClaimPending(ctx context.Context, limit int, staleBefore time.Time) ([]entity.Media, error) {
+	var media []entity.Media
+	err := r.db.With(ctx).NewQuery(`UPDATE media SET status = {:processing}, updated_at = {:now}
+		WHERE id IN (SELECT id FROM media
+			WHERE status = {:pending} OR (status = {:processing} AND updated_at < {:stale})
+			ORDER BY created_at LIMIT {:limit} FOR UPDATE SKIP LOCKED)
+		RETURNING *`).
+		Bind(dbx.Params{
+			"pending":    StatusPending,
+			"processing": StatusProcessing,
+			"now":        time.Now(),
+			"stale":      staleBefore,
+			"limit":      limit,
+		}).
+		All(&media)
+	return media, err
+}
+
+// GetVariant reads the variant with the specified name of a media from the database.
+func (r repository) GetVariant(ctx context.Context, mediaID, name string) (entity.MediaVariant, error) {
+	var variant entity.MediaVariant
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"media_id": mediaID, "name": name}).One(&variant)
+	return variant, err
+}
+
+// GetVariants reads the variants of the media with the specified IDs from the database.
+func (r repository) GetVariants(ctx context.Context, mediaIDs []string) ([]entity.MediaVariant, error) {
+	var variants []entity.MediaVariant
+	if len(mediaIDs) == 0 {
+		return variants, nil
+	}
+	err := r.db.With(ctx).Select().Where(dbx.In("media_id", values(mediaIDs)...)).OrderBy("name").All(&variants)
+	return variants, err
+}
+
+// SaveVariants replaces the variants of a media in the database.
+func (r repository) SaveVariants(ctx context.Context, mediaID string, variants []entity.MediaVariant) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if _, err := r.db.With(ctx).Delete("media_variant", dbx.HashExp{"media_id": mediaID}).Execute(); err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			if err := r.db.With(ctx).Model(&variant).Insert(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func values(ids []string) []interface{} {
+	result := make([]interface{}, len(ids))
+	for i, id := range ids {
+		result[i] = id
+	}
+	return result
+}
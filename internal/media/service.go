@@ -0,0 +1,250 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/blob"
+	"github.com/qiangxue/go-rest-api/pkg/imaging"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sniffLen is the number of bytes used to detect the content type of an upload.
+const sniffLen = 512
+
+// Processing statuses of media.
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusFailed     = "failed"
+)
+
+// contentTypes maps the content types accepted for upload to the file extensions they are stored with.
+var contentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"application/pdf": ".pdf",
+}
+
+// Service encapsulates usecase logic for uploaded media.
+type Service interface {
+	Upload(ctx context.Context, requesterEmail, filename string, size int64, r io.Reader) (Media, error)
+	Get(ctx context.Context, id string) (Media, error)
+	Open(ctx context.Context, id string) (Media, io.ReadCloser, error)
+	Resolve(ctx context.Context, ids []string) ([]Media, error)
+	Lookup(ctx context.Context, ids []string) (map[string]Media, error)
+	OpenVariant(ctx context.Context, id, name string) (entity.MediaVariant, io.ReadCloser, error)
+	ProcessPending(ctx context.Context, limit int) (int, error)
+}
+
+// Media represents an uploaded file together with the URLs it and its variants can be downloaded from.
+type Media struct {
+	entity.Media
+	URL string `json:"url"`
+	// the URLs of the variants (e.g. "thumb", "web") by name
+	Variants map[string]string `json:"variants,omitempty"`
+}
+
+type service struct {
+	repo        Repository
+	storage     blob.Storage
+	userService user.UserService
+	maxSize     int64
+	baseURL     string
+	logger      log.Logger
+}
+
+// NewService creates a new media service.
+// Uploads larger than maxSize bytes are rejected. If baseURL is not empty, media URLs point to the stored
+// objects under baseURL (e.g. a CDN in front of the storage); otherwise they point to the media API.
+func NewService(repo Repository, storage blob.Storage, userService user.UserService, maxSize int64, baseURL string, logger log.Logger) Service {
+	return service{repo, storage, userService, maxSize, strings.TrimRight(baseURL, "/"), logger}
+}
+
+// Upload stores an uploaded file. The content type is detected from the content itself,
+// and only the types listed in contentTypes are accepted. Metadata is removed from images before they
+// are stored, and the variants of the images that can be resized are generated in the background.
+func (s service) Upload(ctx context.Context, requesterEmail, filename string, size int64, r io.Reader) (Media, error) {
+	owner, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return Media{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	if err := user.CheckVerified(owner); err != nil {
+		return Media{}, err
+	}
+	if size <= 0 {
+		return Media{}, errors.BadRequest("The uploaded file is empty")
+	}
+	if size > s.maxSize {
+		return Media{}, errors.BadRequest("The uploaded file is larger than " + strconv.FormatInt(s.maxSize, 10) + " bytes")
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return Media{}, err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	ext, ok := contentTypes[contentType]
+	if !ok {
+		return Media{}, errors.BadRequest("This file type is not supported : " + contentType)
+	}
+
+	var content io.Reader = io.LimitReader(io.MultiReader(bytes.NewReader(head), r), size)
+	if strings.HasPrefix(contentType, "image/") {
+		data, err := ioutil.ReadAll(content)
+		if err != nil {
+			return Media{}, err
+		}
+		if data, err = imaging.StripMetadata(data, contentType); err != nil {
+			return Media{}, errors.BadRequest("The uploaded image is corrupt")
+		}
+		content, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	id := entity.GenerateID()
+	now := time.Now()
+	status := StatusReady
+	if resizable[contentType] {
+		status = StatusPending
+	}
+	media := entity.Media{
+		ID:          id,
+		OwnerID:     owner.ID,
+		Filename:    path.Base(filename),
+		ContentType: contentType,
+		Size:        size,
+		StorageKey:  "media/" + id + ext,
+		Status:      status,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.storage.Put(ctx, media.StorageKey, content, size, contentType); err != nil {
+		return Media{}, err
+	}
+	if err := s.repo.Create(ctx, media); err != nil {
+		if err := s.storage.Delete(ctx, media.StorageKey); err != nil {
+			s.logger.With(ctx, "media", id).Errorf("failed to remove orphaned upload: %v", err)
+		}
+		return Media{}, err
+	}
+	return s.build(media, nil), nil
+}
+
+// Get returns the media with the specified ID.
+func (s service) Get(ctx context.Context, id string) (Media, error) {
+	media, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Media{}, err
+	}
+	variants, err := s.repo.GetVariants(ctx, []string{id})
+	if err != nil {
+		return Media{}, err
+	}
+	return s.build(media, variants), nil
+}
+
+// Open returns the media with the specified ID and a reader of its content. The caller must close the reader.
+func (s service) Open(ctx context.Context, id string) (Media, io.ReadCloser, error) {
+	media, err := s.Get(ctx, id)
+	if err != nil {
+		return Media{}, nil, err
+	}
+	r, err := s.storage.Get(ctx, media.StorageKey)
+	if err == blob.ErrNotFound {
+		return Media{}, nil, errors.NotFound("")
+	} else if err != nil {
+		return Media{}, nil, err
+	}
+	return media, r, nil
+}
+
+// OpenVariant returns the variant with the specified name of a media and a reader of its content.
+// The caller must close the reader.
+func (s service) OpenVariant(ctx context.Context, id, name string) (entity.MediaVariant, io.ReadCloser, error) {
+	variant, err := s.repo.GetVariant(ctx, id, name)
+	if err != nil {
+		return entity.MediaVariant{}, nil, err
+	}
+	r, err := s.storage.Get(ctx, variant.StorageKey)
+	if err == blob.ErrNotFound {
+		return entity.MediaVariant{}, nil, errors.NotFound("")
+	} else if err != nil {
+		return entity.MediaVariant{}, nil, err
+	}
+	return variant, r, nil
+}
+
+// Resolve returns the media with the specified IDs in the given order.
+// It fails if any of the IDs is unknown.
+func (s service) Resolve(ctx context.Context, ids []string) ([]Media, error) {
+	byID, err := s.Lookup(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	result := []Media{}
+	for _, id := range ids {
+		item, ok := byID[id]
+		if !ok {
+			return nil, errors.BadRequest("This media doesn't exists in the system : " + id)
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// Lookup returns the media with the specified IDs by ID. Unknown IDs are ignored.
+func (s service) Lookup(ctx context.Context, ids []string) (map[string]Media, error) {
+	items, err := s.repo.GetMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := s.repo.GetVariants(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byMedia := map[string][]entity.MediaVariant{}
+	for _, variant := range variants {
+		byMedia[variant.MediaID] = append(byMedia[variant.MediaID], variant)
+	}
+	result := map[string]Media{}
+	for _, item := range items {
+		result[item.ID] = s.build(item, byMedia[item.ID])
+	}
+	return result, nil
+}
+
+// build adds the download URLs to a media.
+func (s service) build(media entity.Media, variants []entity.MediaVariant) Media {
+	result := Media{Media: media, URL: s.url(media.StorageKey, "/v1/media/"+media.ID+"/content")}
+	if len(variants) > 0 {
+		result.Variants = map[string]string{}
+		for _, variant := range variants {
+			result.Variants[variant.Name] = s.url(variant.StorageKey, "/v1/media/"+media.ID+"/variants/"+variant.Name)
+		}
+	}
+	return result
+}
+
+// url returns the URL of a stored object: under the public base URL if there is one, otherwise the given API path.
+func (s service) url(key, apiPath string) string {
+	if s.baseURL != "" {
+		return s.baseURL + "/" + key
+	}
+	return apiPath
+}
@@ -0,0 +1,146 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/blob"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type mockRepository struct {
+	Repository
+	items []entity.Media
+}
+
+func (m *mockRepository) Create(ctx context.Context, media entity.Media) error {
+	m.items = append(m.items, media)
+	return nil
+}
+
+type mockStorage struct {
+	blob.Storage
+	objects map[string][]byte
+}
+
+func (m *mockStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.objects[key] = data
+	return nil
+}
+
+type mockUserService struct {
+	user.UserService
+}
+
+func (m mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	switch email {
+	case "ann@example.com":
+		return user.User{Users: entity.Users{ID: "u1", Email: email, Role: user.VISITOR}}, nil
+	case "unverified@example.com":
+		return user.User{Users: entity.Users{ID: "u2", Email: email, Role: user.VISITOR, SelfRegistered: true}}, nil
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+func newTestService(maxSize int64) (Service, *mockRepository, *mockStorage) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	storage := &mockStorage{objects: map[string][]byte{}}
+	return NewService(repo, storage, mockUserService{}, maxSize, "", logger), repo, storage
+}
+
+func encodePNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	return buf.Bytes()
+}
+
+func TestService_Upload(t *testing.T) {
+	s, repo, storage := newTestService(1 << 20)
+	ctx := context.Background()
+
+	// the content type is detected from the content, whatever the file is named
+	data := encodePNG(t)
+	media, err := s.Upload(ctx, "ann@example.com", "../../photo.jpg", int64(len(data)), bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, "image/png", media.ContentType)
+	assert.Equal(t, "photo.jpg", media.Filename)
+	assert.Equal(t, "u1", media.OwnerID)
+	assert.Equal(t, "media/"+media.ID+".png", media.StorageKey)
+	assert.Equal(t, StatusPending, media.Status)
+	assert.Equal(t, "/v1/media/"+media.ID+"/content", media.URL)
+	assert.Contains(t, storage.objects, media.StorageKey)
+	assert.Len(t, repo.items, 1)
+
+	// files which aren't images are stored as they are, and have no variants to generate
+	pdf := "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\n"
+	media, err = s.Upload(ctx, "ann@example.com", "report.pdf", int64(len(pdf)), strings.NewReader(pdf))
+	assert.Nil(t, err)
+	assert.Equal(t, "application/pdf", media.ContentType)
+	assert.Equal(t, StatusReady, media.Status)
+	assert.Equal(t, []byte(pdf), storage.objects[media.StorageKey])
+}
+
+func TestService_Upload_contentType(t *testing.T) {
+	s, repo, storage := newTestService(1 << 20)
+	ctx := context.Background()
+
+	for _, content := range []string{
+		"just some text",
+		"<html><script>alert(1)</script></html>",
+		"\x00\x01\x02\x03 binary",
+	} {
+		// the extension of the file name doesn't matter
+		_, err := s.Upload(ctx, "ann@example.com", "image.png", int64(len(content)), strings.NewReader(content))
+		assert.NotNil(t, err, content)
+	}
+
+	// content sniffed as an image which cannot be decoded is rejected
+	corrupt := "\x89PNG\r\n\x1a\n" + strings.Repeat("x", 32)
+	_, err := s.Upload(ctx, "ann@example.com", "image.png", int64(len(corrupt)), strings.NewReader(corrupt))
+	assert.NotNil(t, err)
+
+	assert.Empty(t, repo.items)
+	assert.Empty(t, storage.objects)
+}
+
+func TestService_Upload_size(t *testing.T) {
+	pdf := "%PDF-1.4\n" + strings.Repeat("0", 100)
+	s, repo, _ := newTestService(int64(len(pdf)))
+	ctx := context.Background()
+
+	_, err := s.Upload(ctx, "ann@example.com", "report.pdf", 0, strings.NewReader(""))
+	assert.NotNil(t, err)
+	_, err = s.Upload(ctx, "ann@example.com", "report.pdf", int64(len(pdf)+1), strings.NewReader(pdf+"0"))
+	assert.NotNil(t, err)
+	assert.Empty(t, repo.items)
+
+	_, err = s.Upload(ctx, "ann@example.com", "report.pdf", int64(len(pdf)), strings.NewReader(pdf))
+	assert.Nil(t, err)
+}
+
+func TestService_Upload_owner(t *testing.T) {
+	s, repo, _ := newTestService(1 << 20)
+	ctx := context.Background()
+	pdf := "%PDF-1.4\n"
+
+	// only known users who confirmed their email address may upload
+	_, err := s.Upload(ctx, "unknown@example.com", "report.pdf", int64(len(pdf)), strings.NewReader(pdf))
+	assert.NotNil(t, err)
+	_, err = s.Upload(ctx, "unverified@example.com", "report.pdf", int64(len(pdf)), strings.NewReader(pdf))
+	assert.NotNil(t, err)
+	assert.Empty(t, repo.items)
+}
@@ -0,0 +1,76 @@
+package moderation
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"net/http"
+	"strconv"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/admin/moderation", res.queue)
+	r.Post("/admin/moderation/actions", res.apply)
+	r.Post("/admin/moderation/<id>/notes", res.addNote)
+	r.Get("/admin/moderation/<id>/history", res.history)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) queue(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Queue(c.Request.Context(), c.Query("requester_user_email"), c.Query("filter"), page, perPage)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(pages)
+}
+
+func (r resource) apply(c *routing.Context) error {
+	var input ApplyActionRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	results, err := r.service.Apply(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(results)
+}
+
+func (r resource) addNote(c *routing.Context) error {
+	var input NoteRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	note, err := r.service.AddNote(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(note, http.StatusCreated)
+}
+
+func (r resource) history(c *routing.Context) error {
+	actions, err := r.service.History(c.Request.Context(), c.Query("requester_user_email"), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(actions)
+}
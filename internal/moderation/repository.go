@@ -0,0 +1,96 @@
+package moderation
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/idea"
+	"github.com/qiangxue/go-rest-api/internal/report"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access moderation data from the data source.
+type Repository interface {
+	// CountQueue returns the number of ideas in the moderation queue matching the given filter.
+	CountQueue(ctx context.Context, filter string) (int, error)
+
+	// QueryQueue returns the ideas in the moderation queue matching the given filter.
+	QueryQueue(ctx context.Context, filter string, offset, limit int) ([]entity.Idea, error)
+
+	// CreateAction saves a moderation action in the storage.
+	CreateAction(ctx context.Context, action entity.ModerationAction) error
+
+	// ListActions returns the moderation actions recorded against the given idea.
+	ListActions(ctx context.Context, ideaID string) ([]entity.ModerationAction, error)
+}
+
+// repository persists moderation data in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new moderation repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// CountQueue returns the number of ideas in the moderation queue matching the given filter.
+func (r repository) CountQueue(ctx context.Context, filter string) (int, error) {
+	var count int
+	err := r.db.With(ctx).
+		Select("COUNT(*)").
+		From("idea").
+		Where(queueCondition(filter)).
+		Row(&count)
+	return count, err
+}
+
+// QueryQueue returns the ideas in the moderation queue matching the given filter, most recently updated first.
+func (r repository) QueryQueue(ctx context.Context, filter string, offset, limit int) ([]entity.Idea, error) {
+	var ideas []entity.Idea
+	err := r.db.With(ctx).
+		Select().
+		From("idea").
+		Where(queueCondition(filter)).
+		OrderBy("updated_at DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&ideas)
+	return ideas, err
+}
+
+// CreateAction saves a new moderation action record in the database.
+func (r repository) CreateAction(ctx context.Context, action entity.ModerationAction) error {
+	return r.db.With(ctx).Model(&action).Insert()
+}
+
+// ListActions returns the moderation actions recorded against the given idea, oldest first.
+func (r repository) ListActions(ctx context.Context, ideaID string) ([]entity.ModerationAction, error) {
+	var actions []entity.ModerationAction
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"idea_id": ideaID}).
+		OrderBy("created_at").
+		All(&actions)
+	return actions, err
+}
+
+// queueCondition builds the condition selecting the ideas that need a moderator's attention.
+func queueCondition(filter string) dbx.Expression {
+	pending := dbx.In("status", idea.StatusSubmitted, idea.StatusUnderReview)
+	flagged := dbx.Or(
+		dbx.NewExp("bad_flag IS TRUE"),
+		dbx.NewExp("EXISTS (SELECT 1 FROM idea_report WHERE idea_report.idea_id = idea.id AND idea_report.status = {:report_status})",
+			dbx.Params{"report_status": report.StatusOpen}),
+	)
+	notDeleted := dbx.NewExp("deleted_at IS NULL")
+	switch filter {
+	case FilterPending:
+		return dbx.And(notDeleted, pending)
+	case FilterFlagged:
+		return dbx.And(notDeleted, flagged)
+	}
+	return dbx.And(notDeleted, dbx.Or(pending, flagged))
+}
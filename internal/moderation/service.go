@@ -0,0 +1,246 @@
+package moderation
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/idea"
+	"github.com/qiangxue/go-rest-api/internal/report"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"time"
+)
+
+// The filters of the moderation queue.
+const (
+	FilterPending = "pending"
+	FilterFlagged = "flagged"
+)
+
+// The actions a moderator may take.
+const (
+	ActionApprove = "approve"
+	ActionHide    = "hide"
+	ActionDelete  = "delete"
+	ActionNote    = "note"
+)
+
+// Service encapsulates usecase logic for moderating ideas.
+type Service interface {
+	Queue(ctx context.Context, requesterEmail, filter string, page, perPage int) (*pagination.Pages, error)
+	Apply(ctx context.Context, req ApplyActionRequest) ([]ActionResult, error)
+	AddNote(ctx context.Context, ideaID string, req NoteRequest) (entity.ModerationAction, error)
+	History(ctx context.Context, requesterEmail, ideaID string) ([]entity.ModerationAction, error)
+	Record(ctx context.Context, ideaID, moderatorID, action, note string) error
+}
+
+// ApplyActionRequest represents a moderation action applied to one or more ideas.
+type ApplyActionRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	// one of approve, hide, delete
+	Action  string   `json:"action"`
+	IdeaIDs []string `json:"idea_ids"`
+	Note    string   `json:"note"`
+}
+
+// ActionResult represents the outcome of a moderation action on a single idea.
+type ActionResult struct {
+	IdeaID  string `json:"idea_id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NoteRequest represents a moderator note on an idea.
+type NoteRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	Note               string `json:"note"`
+}
+
+// QueueItem represents an idea waiting for a moderator's attention.
+type QueueItem struct {
+	entity.Idea
+	OpenReports int `json:"open_reports"`
+}
+
+type service struct {
+	repo        Repository
+	ideaRepo    idea.Repository
+	reportRepo  report.Repository
+	userService user.UserService
+	events      event.Publisher
+	transaction dbcontext.TransactionFunc
+	logger      log.Logger
+}
+
+// NewService creates a new moderation service.
+func NewService(repo Repository, ideaRepo idea.Repository, reportRepo report.Repository, userService user.UserService,
+	events event.Publisher, transaction dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, ideaRepo, reportRepo, userService, events, transaction, logger}
+}
+
+// Queue returns a page of the ideas pending review or flagged.
+func (s service) Queue(ctx context.Context, requesterEmail, filter string, page, perPage int) (*pagination.Pages, error) {
+	if _, err := s.moderator(ctx, requesterEmail); err != nil {
+		return nil, err
+	}
+	if filter != "" && filter != FilterPending && filter != FilterFlagged {
+		return nil, errors.BadRequest("This moderation filter doesn't exists in the system : " + filter)
+	}
+
+	count, err := s.repo.CountQueue(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	ideas, err := s.repo.QueryQueue(ctx, filter, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+
+	items := []QueueItem{}
+	for _, item := range ideas {
+		reports, err := s.reportRepo.CountOpen(ctx, item.ID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, QueueItem{item, reports})
+	}
+	pages.Items = items
+	return pages, nil
+}
+
+// Apply applies a moderation action to each of the given ideas.
+// Each idea is handled in its own transaction, and the outcome is reported per idea.
+func (s service) Apply(ctx context.Context, req ApplyActionRequest) ([]ActionResult, error) {
+	moderator, err := s.moderator(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return nil, err
+	}
+	if req.Action != ActionApprove && req.Action != ActionHide && req.Action != ActionDelete {
+		return nil, errors.BadRequest("This moderation action doesn't exists in the system : " + req.Action)
+	}
+	if len(req.IdeaIDs) == 0 {
+		return nil, errors.BadRequest("At least one idea is required")
+	}
+
+	results := []ActionResult{}
+	for _, id := range req.IdeaIDs {
+		err := s.transaction(ctx, func(ctx context.Context) error {
+			return s.apply(ctx, moderator.ID, req.Action, id, req.Note)
+		})
+		result := ActionResult{IdeaID: id, Success: err == nil}
+		if err != nil {
+			s.logger.With(ctx, "idea", id).Infof("moderation action %s failed: %v", req.Action, err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// apply applies a moderation action to an idea and publishes the decision, so that the author
+// of the idea and the users whose reports were closed are notified.
+func (s service) apply(ctx context.Context, moderatorID, action, ideaID, note string) error {
+	target, err := s.ideaRepo.Get(ctx, ideaID)
+	if err != nil {
+		return err
+	}
+	reports, err := s.reportRepo.ListByIdea(ctx, ideaID, report.StatusOpen)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	switch action {
+	case ActionApprove:
+		if err := s.reportRepo.Close(ctx, ideaID, report.StatusDismissed, moderatorID, note, now); err != nil {
+			return err
+		}
+		target.BadFlag = false
+		target.Enabled = true
+		target.UpdatedAt = now
+		err = s.ideaRepo.Update(ctx, target)
+	case ActionHide:
+		if err := s.reportRepo.Close(ctx, ideaID, report.StatusResolved, moderatorID, note, now); err != nil {
+			return err
+		}
+		target.BadFlag = true
+		target.Enabled = false
+		target.UpdatedAt = now
+		err = s.ideaRepo.Update(ctx, target)
+	case ActionDelete:
+		// reports on deleted ideas are left open
+		reports = nil
+		err = s.ideaRepo.Delete(ctx, ideaID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.Record(ctx, ideaID, moderatorID, action, note); err != nil {
+		return err
+	}
+	data := event.ModerationData{Idea: target, ModeratorID: moderatorID, Action: action, Note: note, ReporterIDs: []string{}}
+	for _, r := range reports {
+		data.ReporterIDs = append(data.ReporterIDs, r.ReporterID)
+	}
+	return s.events.Publish(ctx, event.IdeaModerated, data)
+}
+
+// AddNote records a moderator note against the idea with the specified ID.
+func (s service) AddNote(ctx context.Context, ideaID string, req NoteRequest) (entity.ModerationAction, error) {
+	moderator, err := s.moderator(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return entity.ModerationAction{}, err
+	}
+	if req.Note == "" {
+		return entity.ModerationAction{}, errors.BadRequest("A note is required")
+	}
+	if _, err := s.ideaRepo.Get(ctx, ideaID); err != nil {
+		return entity.ModerationAction{}, err
+	}
+
+	action := newAction(ideaID, moderator.ID, ActionNote, req.Note)
+	if err := s.repo.CreateAction(ctx, action); err != nil {
+		return entity.ModerationAction{}, err
+	}
+	return action, nil
+}
+
+// History returns every moderation action and note recorded against the idea with the specified ID.
+func (s service) History(ctx context.Context, requesterEmail, ideaID string) ([]entity.ModerationAction, error) {
+	if _, err := s.moderator(ctx, requesterEmail); err != nil {
+		return nil, err
+	}
+	return s.repo.ListActions(ctx, ideaID)
+}
+
+// Record saves a moderation decision made on an idea.
+func (s service) Record(ctx context.Context, ideaID, moderatorID, action, note string) error {
+	return s.repo.CreateAction(ctx, newAction(ideaID, moderatorID, action, note))
+}
+
+// moderator returns the requester if they are allowed to moderate ideas.
+func (s service) moderator(ctx context.Context, requesterEmail string) (user.User, error) {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return user.User{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	if !user.IsAdmin(requester.Role) {
+		return user.User{}, errors.Forbidden("Requester User doesn't have permission to moderate ideas")
+	}
+	return requester, nil
+}
+
+func newAction(ideaID, moderatorID, action, note string) entity.ModerationAction {
+	return entity.ModerationAction{
+		ID:          entity.GenerateID(),
+		IdeaID:      ideaID,
+		ModeratorID: moderatorID,
+		Action:      action,
+		Note:        note,
+		CreatedAt:   time.Now(),
+	}
+}
@@ -0,0 +1,217 @@
+package moderation
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/internal/idea"
+	"github.com/qiangxue/go-rest-api/internal/report"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type mockRepository struct {
+	Repository
+	actions []entity.ModerationAction
+}
+
+func (m *mockRepository) CreateAction(ctx context.Context, action entity.ModerationAction) error {
+	m.actions = append(m.actions, action)
+	return nil
+}
+
+type mockIdeaRepository struct {
+	idea.Repository
+	ideas map[string]entity.Idea
+}
+
+func (m *mockIdeaRepository) Get(ctx context.Context, id string) (entity.Idea, error) {
+	if item, ok := m.ideas[id]; ok {
+		return item, nil
+	}
+	return entity.Idea{}, sql.ErrNoRows
+}
+
+func (m *mockIdeaRepository) Update(ctx context.Context, item entity.Idea) error {
+	m.ideas[item.ID] = item
+	return nil
+}
+
+func (m *mockIdeaRepository) Delete(ctx context.Context, id string) error {
+	delete(m.ideas, id)
+	return nil
+}
+
+type mockReportRepository struct {
+	report.Repository
+	reports []entity.IdeaReport
+}
+
+func (m *mockReportRepository) ListByIdea(ctx context.Context, ideaID, status string) ([]entity.IdeaReport, error) {
+	var reports []entity.IdeaReport
+	for _, r := range m.reports {
+		if r.IdeaID == ideaID && r.Status == status {
+			reports = append(reports, r)
+		}
+	}
+	return reports, nil
+}
+
+func (m *mockReportRepository) Close(ctx context.Context, ideaID, status, resolvedBy, note string, resolvedAt time.Time) error {
+	for i, r := range m.reports {
+		if r.IdeaID == ideaID && r.Status == report.StatusOpen {
+			m.reports[i].Status = status
+		}
+	}
+	return nil
+}
+
+type mockUserService struct {
+	user.UserService
+}
+
+func (m mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	if email == "admin@example.com" {
+		return user.User{Users: entity.Users{ID: "admin-1", Email: email, Role: user.ADMIN}}, nil
+	}
+	return user.User{Users: entity.Users{ID: "visitor-1", Email: email, Role: user.VISITOR}}, nil
+}
+
+type mockPublisher struct {
+	events []event.ModerationData
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, eventType string, data interface{}) error {
+	m.events = append(m.events, data.(event.ModerationData))
+	return nil
+}
+
+type testService struct {
+	Service
+	repo       *mockRepository
+	ideaRepo   *mockIdeaRepository
+	reportRepo *mockReportRepository
+	events     *mockPublisher
+}
+
+func newTestService() testService {
+	logger, _ := log.NewForTest()
+	s := testService{
+		repo: &mockRepository{},
+		ideaRepo: &mockIdeaRepository{ideas: map[string]entity.Idea{
+			"i1": {ID: "i1", Enabled: true, BadFlag: true},
+			"i2": {ID: "i2", Enabled: true},
+		}},
+		reportRepo: &mockReportRepository{reports: []entity.IdeaReport{
+			{ID: "r1", IdeaID: "i1", ReporterID: "u1", Status: report.StatusOpen},
+			{ID: "r2", IdeaID: "i1", ReporterID: "u2", Status: report.StatusOpen},
+			{ID: "r3", IdeaID: "i2", ReporterID: "u1", Status: report.StatusDismissed},
+		}},
+		events: &mockPublisher{},
+	}
+	transaction := func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	s.Service = NewService(s.repo, s.ideaRepo, s.reportRepo, mockUserService{}, s.events, transaction, logger)
+	return s
+}
+
+func TestService_Apply_approve(t *testing.T) {
+	s := newTestService()
+
+	results, err := s.Apply(context.Background(), ApplyActionRequest{
+		RequesterUserEmail: "admin@example.com",
+		Action:             ActionApprove,
+		IdeaIDs:            []string{"i1", "unknown", "i2"},
+		Note:               "fine",
+	})
+	assert.Nil(t, err)
+	// every idea gets a result, and the failures don't stop the others
+	assert.Equal(t, []ActionResult{
+		{IdeaID: "i1", Success: true},
+		{IdeaID: "unknown", Success: false, Error: sql.ErrNoRows.Error()},
+		{IdeaID: "i2", Success: true},
+	}, results)
+
+	assert.False(t, s.ideaRepo.ideas["i1"].BadFlag)
+	assert.True(t, s.ideaRepo.ideas["i1"].Enabled)
+	assert.Equal(t, report.StatusDismissed, s.reportRepo.reports[0].Status)
+	assert.Equal(t, report.StatusDismissed, s.reportRepo.reports[1].Status)
+
+	if assert.Len(t, s.repo.actions, 2) {
+		assert.Equal(t, "i1", s.repo.actions[0].IdeaID)
+		assert.Equal(t, "admin-1", s.repo.actions[0].ModeratorID)
+		assert.Equal(t, ActionApprove, s.repo.actions[0].Action)
+		assert.Equal(t, "fine", s.repo.actions[0].Note)
+		assert.Equal(t, "i2", s.repo.actions[1].IdeaID)
+	}
+	// the reporters whose reports were closed are told
+	if assert.Len(t, s.events.events, 2) {
+		assert.Equal(t, []string{"u1", "u2"}, s.events.events[0].ReporterIDs)
+		assert.Equal(t, []string{}, s.events.events[1].ReporterIDs)
+	}
+}
+
+func TestService_Apply_hide(t *testing.T) {
+	s := newTestService()
+
+	results, err := s.Apply(context.Background(), ApplyActionRequest{
+		RequesterUserEmail: "admin@example.com",
+		Action:             ActionHide,
+		IdeaIDs:            []string{"i1", "i2"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []ActionResult{{IdeaID: "i1", Success: true}, {IdeaID: "i2", Success: true}}, results)
+
+	for _, id := range []string{"i1", "i2"} {
+		assert.True(t, s.ideaRepo.ideas[id].BadFlag)
+		assert.False(t, s.ideaRepo.ideas[id].Enabled)
+	}
+	assert.Equal(t, report.StatusResolved, s.reportRepo.reports[0].Status)
+	assert.Equal(t, report.StatusResolved, s.reportRepo.reports[1].Status)
+	// the reports closed before are left as they are
+	assert.Equal(t, report.StatusDismissed, s.reportRepo.reports[2].Status)
+	if assert.Len(t, s.repo.actions, 2) {
+		assert.Equal(t, ActionHide, s.repo.actions[0].Action)
+		assert.Equal(t, ActionHide, s.repo.actions[1].Action)
+	}
+}
+
+func TestService_Apply_delete(t *testing.T) {
+	s := newTestService()
+
+	results, err := s.Apply(context.Background(), ApplyActionRequest{
+		RequesterUserEmail: "admin@example.com",
+		Action:             ActionDelete,
+		IdeaIDs:            []string{"i1"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []ActionResult{{IdeaID: "i1", Success: true}}, results)
+
+	assert.NotContains(t, s.ideaRepo.ideas, "i1")
+	// the reports on deleted ideas are left open, and their reporters aren't told
+	assert.Equal(t, report.StatusOpen, s.reportRepo.reports[0].Status)
+	if assert.Len(t, s.repo.actions, 1) {
+		assert.Equal(t, ActionDelete, s.repo.actions[0].Action)
+	}
+	if assert.Len(t, s.events.events, 1) {
+		assert.Equal(t, []string{}, s.events.events[0].ReporterIDs)
+	}
+}
+
+func TestService_Apply_invalid(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+
+	_, err := s.Apply(ctx, ApplyActionRequest{RequesterUserEmail: "ann@example.com", Action: ActionHide, IdeaIDs: []string{"i1"}})
+	assert.NotNil(t, err)
+	_, err = s.Apply(ctx, ApplyActionRequest{RequesterUserEmail: "admin@example.com", Action: "ban", IdeaIDs: []string{"i1"}})
+	assert.NotNil(t, err)
+	_, err = s.Apply(ctx, ApplyActionRequest{RequesterUserEmail: "admin@example.com", Action: ActionHide})
+	assert.NotNil(t, err)
+
+	assert.Empty(t, s.repo.actions)
+	assert.True(t, s.ideaRepo.ideas["i1"].BadFlag)
+}
@@ -0,0 +1,177 @@
+package notification
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"net/http"
+	"strconv"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Post("/idea/<id>/follow", res.follow)
+	r.Delete("/idea/<id>/follow", res.unfollow)
+	r.Get("/following", res.following)
+	r.Get("/notifications", res.inbox)
+	r.Get("/notifications/unread_count", res.unreadCount)
+	r.Post("/notifications/read_all", res.markAllRead)
+	r.Post("/notifications/<id>/read", res.markRead)
+	r.Get("/notifications/preferences", res.preferences)
+	r.Put("/notifications/preferences", res.updatePreferences)
+	r.Get("/notifications/unsubscribe", res.confirmUnsubscribe)
+	r.Post("/notifications/unsubscribe", res.unsubscribe)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) follow(c *routing.Context) error {
+	var input FollowRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	status, err := r.service.Follow(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(status)
+}
+
+func (r resource) unfollow(c *routing.Context) error {
+	var input FollowRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	status, err := r.service.Unfollow(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(status)
+}
+
+func (r resource) following(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Following(c.Request.Context(), c.Query("requester_user_email"), page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
+
+func (r resource) inbox(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+	unreadOnly, _ := strconv.ParseBool(c.Query("unread"))
+
+	pages, err := r.service.Inbox(c.Request.Context(), c.Query("requester_user_email"), unreadOnly, page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
+
+func (r resource) unreadCount(c *routing.Context) error {
+	count, err := r.service.UnreadCount(c.Request.Context(), c.Query("requester_user_email"))
+	if err != nil {
+		return err
+	}
+	return c.Write(count)
+}
+
+func (r resource) markRead(c *routing.Context) error {
+	var input ReadRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	notification, err := r.service.MarkRead(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(notification)
+}
+
+func (r resource) markAllRead(c *routing.Context) error {
+	var input ReadRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	count, err := r.service.MarkAllRead(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(count)
+}
+
+func (r resource) preferences(c *routing.Context) error {
+	preferences, err := r.service.Preferences(c.Request.Context(), c.Query("requester_user_email"))
+	if err != nil {
+		return err
+	}
+	return c.Write(preferences)
+}
+
+func (r resource) updatePreferences(c *routing.Context) error {
+	var input UpdatePreferencesRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	preferences, err := r.service.UpdatePreferences(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(preferences)
+}
+
+// confirmUnsubscribe serves the page an unsubscribe link opens, which asks the user to confirm. Following the link
+// changes nothing, as mail scanners and link previews open it too.
+func (r resource) confirmUnsubscribe(c *routing.Context) error {
+	return writePage(c, http.StatusOK, unsubscribePage{
+		Title:     "Unsubscribe",
+		Message:   unsubscribeMessage(c.Query("type")),
+		UserID:    c.Query("user"),
+		Type:      c.Query("type"),
+		Signature: c.Query("signature"),
+	})
+}
+
+// unsubscribe applies an unsubscribe link, whose parameters are posted from the confirmation page or kept
+// in the query string when posting to the link itself.
+func (r resource) unsubscribe(c *routing.Context) error {
+	typ := c.Request.FormValue("type")
+	_, err := r.service.Unsubscribe(c.Request.Context(), UnsubscribeRequest{
+		UserID:    c.Request.FormValue("user"),
+		Type:      typ,
+		Signature: c.Request.FormValue("signature"),
+	})
+	if err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		status := http.StatusInternalServerError
+		if e, ok := err.(errors.ErrorResponse); ok {
+			status = e.StatusCode()
+		}
+		return writePage(c, status, unsubscribePage{Title: "Unsubscribe", Message: "This unsubscribe link is not valid."})
+	}
+	message := "You will no longer receive notification emails."
+	if typ != "" {
+		message = "You will no longer receive emails about " + typ + " notifications."
+	}
+	return writePage(c, http.StatusOK, unsubscribePage{Title: "Unsubscribed", Message: message, Done: true})
+}
@@ -0,0 +1,176 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// instantWindow is how old a notification may be and still be emailed on its own,
+	// e.g. after its user switched its type to instant delivery.
+	instantWindow = 24 * time.Hour
+	// digestIdeas is the number of top new ideas included in a digest.
+	digestIdeas = 5
+	// digestNotifications is the largest number of notifications included in a digest.
+	digestNotifications = 50
+)
+
+// digestPeriods maps the frequencies of digests to the time between two digests.
+var digestPeriods = map[string]time.Duration{
+	DeliveryDaily:  24 * time.Hour,
+	DeliveryWeekly: 7 * 24 * time.Hour,
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`Hello {{.Name}},
+
+Here is your {{.Frequency}} digest.
+{{if .Ideas}}
+Top new ideas:
+{{range .Ideas}}- {{.Summary}} ({{.Votes}} votes)
+  {{.URL}}
+{{end}}{{end}}{{if .Notifications}}
+Activity on your ideas and the ideas you follow:
+{{range .Notifications}}- {{.Message}}
+{{end}}{{end}}
+To stop all notification emails, open {{.Unsubscribe}}
+`))
+
+type digestIdea struct {
+	Summary string
+	Votes   int
+	URL     string
+}
+
+type digest struct {
+	Name          string
+	Frequency     string
+	Ideas         []digestIdea
+	Notifications []entity.Notification
+	Unsubscribe   string
+}
+
+// SendInstant emails the recent notifications which their users want to receive as they happen.
+// It returns the number of emails sent.
+func (s service) SendInstant(ctx context.Context, limit int) (int, error) {
+	now := time.Now()
+	notifications, err := s.repo.QueryUnemailed(ctx, "", DeliveryInstant, now.Add(-instantWindow), limit)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, n := range notifications {
+		// the notifications of users who were deleted since are marked as emailed without being sent
+		if recipient, err := s.userService.GetUserByID(ctx, n.UserID); err == nil {
+			body := n.Message + "\n\nTo stop emails about this kind of activity, open " + s.signer.Link(n.UserID, n.Type) + "\n"
+			if err := s.mailer.Send(ctx, recipient.Email, n.Message, body); err != nil {
+				return sent, err
+			}
+		} else if err != sql.ErrNoRows {
+			return sent, err
+		}
+		if err := s.repo.MarkEmailed(ctx, []string{n.ID}, now); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// SendDigests emails a digest of the given frequency to the users who are due one. A digest contains
+// the top new ideas since the previous digest and the notifications not emailed yet, according to the preferences
+// of the user. A user whose digest cannot be sent stays due, and is sent it on the next run.
+// It returns the number of users whose digest was sent, including those who had nothing to be told about, so that
+// the users whose digest fails are not tried again in the same run.
+func (s service) SendDigests(ctx context.Context, frequency string, now time.Time, limit int) (int, error) {
+	period, ok := digestPeriods[frequency]
+	if !ok {
+		return 0, fmt.Errorf("unknown digest frequency %q", frequency)
+	}
+	// digests are scheduled on the hour so that they don't drift with the time the job runs at
+	slot := now.Truncate(time.Hour)
+	states, err := s.repo.DueDigests(ctx, frequency, slot.Add(-period), limit)
+	if err != nil {
+		return 0, err
+	}
+	done := 0
+	for _, state := range states {
+		since := slot.Add(-period)
+		if state.SentAt != nil {
+			since = *state.SentAt
+		}
+		if err := s.sendDigest(ctx, state.UserID, frequency, since, now); err != nil {
+			// the other users are still sent their digest
+			s.logger.With(ctx, "user", state.UserID).Errorf("failed to send the %s digest: %v", frequency, err)
+			continue
+		}
+		if err := s.repo.SaveDigest(ctx, state.UserID, frequency, slot); err != nil {
+			return done, err
+		}
+		done++
+	}
+	return done, nil
+}
+
+// sendDigest emails a user the digest of the given frequency covering the top ideas since the given time and the
+// notifications not emailed yet, even older ones left out of a previous digest for being too many.
+// Nothing is sent if there is nothing to tell the user about.
+func (s service) sendDigest(ctx context.Context, userID, frequency string, since, now time.Time) error {
+	deliveries, err := s.deliveries(ctx, userID)
+	if err != nil {
+		return err
+	}
+	notifications, err := s.repo.QueryUnemailed(ctx, userID, frequency, time.Time{}, digestNotifications)
+	if err != nil {
+		return err
+	}
+	var ideas []entity.Idea
+	if deliveries[TypeTopIdeas] == frequency {
+		if ideas, err = s.repo.TopNewIdeas(ctx, since, digestIdeas); err != nil {
+			return err
+		}
+	}
+	if len(notifications) == 0 && len(ideas) == 0 {
+		return nil
+	}
+
+	recipient, err := s.userService.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	data := digest{
+		Name:          recipient.Name,
+		Frequency:     frequency,
+		Notifications: notifications,
+		Unsubscribe:   s.signer.Link(userID, ""),
+	}
+	if data.Name == "" {
+		data.Name = recipient.Email
+	}
+	for _, idea := range ideas {
+		data.Ideas = append(data.Ideas, digestIdea{
+			Summary: idea.Summary,
+			Votes:   idea.Votes,
+			URL:     strings.TrimRight(s.signer.baseURL, "/") + "/v1/idea/" + idea.ID,
+		})
+	}
+	var body bytes.Buffer
+	if err := digestTemplate.Execute(&body, data); err != nil {
+		return err
+	}
+	subject := "Your " + frequency + " digest"
+	if err := s.mailer.Send(ctx, recipient.Email, subject, body.String()); err != nil {
+		return err
+	}
+
+	ids := make([]string, len(notifications))
+	for i, n := range notifications {
+		ids[i] = n.ID
+	}
+	return s.repo.MarkEmailed(ctx, ids, now)
+}
@@ -0,0 +1,132 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockRepository keeps the notifications and the digests sent in memory. Every user has the default preferences.
+type mockRepository struct {
+	Repository
+	notifications []entity.Notification
+	digests       map[string]time.Time
+}
+
+func (m *mockRepository) GetPreferences(ctx context.Context, userID string) ([]entity.NotificationPreference, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) QueryUnemailed(ctx context.Context, userID, delivery string, since time.Time, limit int) ([]entity.Notification, error) {
+	var notifications []entity.Notification
+	for _, n := range m.notifications {
+		if n.EmailedAt == nil && n.UserID == userID && (since.IsZero() || n.CreatedAt.After(since)) && len(notifications) < limit {
+			notifications = append(notifications, n)
+		}
+	}
+	return notifications, nil
+}
+
+func (m *mockRepository) MarkEmailed(ctx context.Context, ids []string, at time.Time) error {
+	for _, id := range ids {
+		for i := range m.notifications {
+			if m.notifications[i].ID == id {
+				m.notifications[i].EmailedAt = &at
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) DueDigests(ctx context.Context, frequency string, due time.Time, limit int) ([]DigestState, error) {
+	state := DigestState{UserID: "u1"}
+	if sentAt, ok := m.digests["u1"]; ok {
+		if sentAt.After(due) {
+			return nil, nil
+		}
+		state.SentAt = &sentAt
+	}
+	return []DigestState{state}, nil
+}
+
+func (m *mockRepository) SaveDigest(ctx context.Context, userID, frequency string, at time.Time) error {
+	m.digests[userID] = at
+	return nil
+}
+
+func (m *mockRepository) TopNewIdeas(ctx context.Context, since time.Time, limit int) ([]entity.Idea, error) {
+	return nil, nil
+}
+
+type mockUserService struct {
+	user.UserService
+}
+
+func (m mockUserService) GetUserByID(ctx context.Context, id string) (user.User, error) {
+	return user.User{Users: entity.Users{ID: id, Email: id + "@example.com", Name: "Ann"}}, nil
+}
+
+type mockMailer struct {
+	bodies []string
+	err    error
+}
+
+func (m *mockMailer) Send(ctx context.Context, to, subject, body string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+func TestService_SendDigests_retry(t *testing.T) {
+	start := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	repo := &mockRepository{digests: map[string]time.Time{}}
+	for i := 0; i < digestNotifications+1; i++ {
+		repo.notifications = append(repo.notifications, entity.Notification{
+			ID:        fmt.Sprintf("n%d", i),
+			UserID:    "u1",
+			Type:      TypeIdeaVoted,
+			Message:   "Somebody voted",
+			CreatedAt: start.Add(-time.Duration(digestNotifications-i) * time.Minute),
+		})
+	}
+	mailer := &mockMailer{err: errors.New("unavailable")}
+	logger, _ := log.NewForTest()
+	s := NewService(repo, mockUserService{}, mailer, "key", "http://localhost", logger)
+	ctx := context.Background()
+
+	// the digest which cannot be sent leaves the user due, and the notifications unemailed
+	n, err := s.SendDigests(ctx, DeliveryDaily, start, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Empty(t, repo.digests)
+	assert.Nil(t, repo.notifications[0].EmailedAt)
+
+	// the next run sends it, including the notifications older than the failed run
+	mailer.err = nil
+	now := start.Add(time.Hour)
+	_, err = s.SendDigests(ctx, DeliveryDaily, now, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, mailer.bodies, 1) {
+		assert.Equal(t, digestNotifications, strings.Count(mailer.bodies[0], "Somebody voted"))
+	}
+	assert.Equal(t, now, repo.digests["u1"])
+
+	// the notifications beyond the limit are sent in the next digest
+	_, err = s.SendDigests(ctx, DeliveryDaily, now.Add(24*time.Hour), 10)
+	assert.Nil(t, err)
+	if assert.Len(t, mailer.bodies, 2) {
+		assert.Equal(t, 1, strings.Count(mailer.bodies[1], "Somebody voted"))
+	}
+	for _, n := range repo.notifications {
+		assert.NotNil(t, n.EmailedAt)
+	}
+}
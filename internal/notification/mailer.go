@@ -0,0 +1,26 @@
+package notification
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Mailer sends plain text emails.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+type logMailer struct {
+	logger log.Logger
+}
+
+// NewLogMailer creates a Mailer that only logs the emails. It is used when no mail service is configured.
+func NewLogMailer(logger log.Logger) Mailer {
+	return logMailer{logger}
+}
+
+// Send logs the recipient and the subject of the email.
+func (m logMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.logger.With(ctx, "to", to).Infof("email not sent, no mail service is configured: %s", subject)
+	return nil
+}
@@ -0,0 +1,36 @@
+package notification
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"time"
+)
+
+// Notifier records notifications for individual users.
+type Notifier interface {
+	// Notify records a notification. Its ID and creation time are filled in if they are empty.
+	Notify(ctx context.Context, notification entity.Notification) error
+}
+
+type notifier struct {
+	repo Repository
+}
+
+// NewNotifier creates a Notifier that saves notifications with the given repository.
+func NewNotifier(repo Repository) Notifier {
+	return notifier{repo}
+}
+
+// Notify records a notification unless it is about the user's own action.
+func (n notifier) Notify(ctx context.Context, notification entity.Notification) error {
+	if notification.UserID == "" || notification.UserID == notification.ActorID {
+		return nil
+	}
+	if notification.ID == "" {
+		notification.ID = entity.GenerateID()
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+	return n.repo.Create(ctx, notification)
+}
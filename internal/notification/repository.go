@@ -0,0 +1,314 @@
+package notification
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Repository encapsulates the logic to access followers and notifications from the data source.
+type Repository interface {
+	// IdeaExists returns whether an idea that is not in the trash has the specified ID.
+	IdeaExists(ctx context.Context, ideaID string) (bool, error)
+
+	// Follow records that a user follows an idea. Following an idea twice has no effect.
+	Follow(ctx context.Context, follower entity.IdeaFollower) error
+
+	// Unfollow removes the record that a user follows an idea.
+	Unfollow(ctx context.Context, ideaID, userID string) error
+
+	// Followers returns the IDs of the users following an idea.
+	Followers(ctx context.Context, ideaID string) ([]string, error)
+
+	// CountFollowing returns the number of ideas not in the trash that a user follows.
+	CountFollowing(ctx context.Context, userID string) (int, error)
+
+	// QueryFollowing returns the ideas not in the trash that a user follows, most recently followed first.
+	QueryFollowing(ctx context.Context, userID string, offset, limit int) ([]entity.Idea, error)
+
+	// Create saves a new notification in the storage.
+	Create(ctx context.Context, notification entity.Notification) error
+
+	// Get returns the notification with the specified ID.
+	Get(ctx context.Context, id string) (entity.Notification, error)
+
+	// CountInbox returns the number of notifications of a user, or of their unread notifications.
+	CountInbox(ctx context.Context, userID string, unreadOnly bool) (int, error)
+
+	// QueryInbox returns the notifications of a user, or their unread notifications, newest first.
+	QueryInbox(ctx context.Context, userID string, unreadOnly bool, offset, limit int) ([]entity.Notification, error)
+
+	// MarkRead marks the notification with the specified ID as read at the given time, unless it was read already.
+	MarkRead(ctx context.Context, id string, at time.Time) error
+
+	// MarkAllRead marks every unread notification of a user as read and returns how many were marked.
+	MarkAllRead(ctx context.Context, userID string, at time.Time) (int64, error)
+
+	// GetPreferences returns the notification preferences a user has saved.
+	GetPreferences(ctx context.Context, userID string) ([]entity.NotificationPreference, error)
+
+	// SavePreference creates or replaces a notification preference of a user.
+	SavePreference(ctx context.Context, preference entity.NotificationPreference) error
+
+	// QueryUnemailed returns the notifications created after the given time, or at any time if it is zero, which
+	// have not been emailed yet and which their user wants delivered in the given way, oldest first. All users are
+	// included if userID is empty.
+	QueryUnemailed(ctx context.Context, userID, delivery string, since time.Time, limit int) ([]entity.Notification, error)
+
+	// MarkEmailed records that the notifications with the specified IDs were emailed at the given time.
+	MarkEmailed(ctx context.Context, ids []string, at time.Time) error
+
+	// DueDigests returns the users who were not sent a digest of the given frequency since the given time.
+	DueDigests(ctx context.Context, frequency string, due time.Time, limit int) ([]DigestState, error)
+
+	// SaveDigest records that a user was sent a digest of the given frequency at the given time.
+	SaveDigest(ctx context.Context, userID, frequency string, at time.Time) error
+
+	// TopNewIdeas returns the visible ideas created after the given time with the most votes.
+	TopNewIdeas(ctx context.Context, since time.Time, limit int) ([]entity.Idea, error)
+}
+
+// DigestState represents when a user was last sent a digest of some frequency.
+type DigestState struct {
+	UserID string
+	// nil if the user was never sent such a digest
+	SentAt *time.Time
+}
+
+// repository persists followers and notifications in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new notification repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// IdeaExists returns whether an idea that is not in the trash has the specified ID.
+func (r repository) IdeaExists(ctx context.Context, ideaID string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).
+		Select("COUNT(*)").
+		From("idea").
+		Where(dbx.And(dbx.HashExp{"id": ideaID}, dbx.NewExp("deleted_at IS NULL"))).
+		Row(&count)
+	return count > 0, err
+}
+
+// Follow records that a user follows an idea.
+func (r repository) Follow(ctx context.Context, follower entity.IdeaFollower) error {
+	_, err := r.db.With(ctx).
+		NewQuery("INSERT INTO idea_follower (idea_id, user_id, created_at) VALUES ({:idea_id}, {:user_id}, {:created_at}) " +
+			"ON CONFLICT DO NOTHING").
+		Bind(dbx.Params{"idea_id": follower.IdeaID, "user_id": follower.UserID, "created_at": follower.CreatedAt}).
+		Execute()
+	return err
+}
+
+// Unfollow removes the record that a user follows an idea.
+func (r repository) Unfollow(ctx context.Context, ideaID, userID string) error {
+	_, err := r.db.With(ctx).Delete("idea_follower", dbx.HashExp{"idea_id": ideaID, "user_id": userID}).Execute()
+	return err
+}
+
+// Followers returns the IDs of the users following an idea.
+func (r repository) Followers(ctx context.Context, ideaID string) ([]string, error) {
+	var ids []string
+	err := r.db.With(ctx).
+		Select("user_id").
+		From("idea_follower").
+		Where(dbx.HashExp{"idea_id": ideaID}).
+		OrderBy("user_id").
+		Column(&ids)
+	return ids, err
+}
+
+// CountFollowing returns the number of ideas not in the trash that a user follows.
+func (r repository) CountFollowing(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).
+		NewQuery("SELECT COUNT(*) FROM idea_follower f JOIN idea ON idea.id = f.idea_id " +
+			"WHERE f.user_id = {:user_id} AND idea.deleted_at IS NULL").
+		Bind(dbx.Params{"user_id": userID}).
+		Row(&count)
+	return count, err
+}
+
+// QueryFollowing returns the ideas not in the trash that a user follows.
+func (r repository) QueryFollowing(ctx context.Context, userID string, offset, limit int) ([]entity.Idea, error) {
+	var ideas []entity.Idea
+	err := r.db.With(ctx).
+		NewQuery("SELECT idea.* FROM idea_follower f JOIN idea ON idea.id = f.idea_id " +
+			"WHERE f.user_id = {:user_id} AND idea.deleted_at IS NULL " +
+			"ORDER BY f.created_at DESC, idea.id LIMIT {:limit} OFFSET {:offset}").
+		Bind(dbx.Params{"user_id": userID, "limit": limit, "offset": offset}).
+		All(&ideas)
+	return ideas, err
+}
+
+// Create saves a new notification record in the database.
+func (r repository) Create(ctx context.Context, notification entity.Notification) error {
+	return r.db.With(ctx).Model(&notification).Insert()
+}
+
+// Get reads the notification with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Notification, error) {
+	var notification entity.Notification
+	err := r.db.With(ctx).Select().Model(id, &notification)
+	return notification, err
+}
+
+// CountInbox returns the number of notifications of a user.
+func (r repository) CountInbox(ctx context.Context, userID string, unreadOnly bool) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("notification").Where(inboxExp(userID, unreadOnly)).Row(&count)
+	return count, err
+}
+
+// QueryInbox retrieves the notifications of a user from the database.
+func (r repository) QueryInbox(ctx context.Context, userID string, unreadOnly bool, offset, limit int) ([]entity.Notification, error) {
+	var notifications []entity.Notification
+	err := r.db.With(ctx).
+		Select().
+		Where(inboxExp(userID, unreadOnly)).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&notifications)
+	return notifications, err
+}
+
+// MarkRead marks the notification with the specified ID as read.
+func (r repository) MarkRead(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.With(ctx).
+		Update("notification", dbx.Params{"read_at": at}, dbx.And(dbx.HashExp{"id": id}, unread)).
+		Execute()
+	return err
+}
+
+// MarkAllRead marks every unread notification of a user as read.
+func (r repository) MarkAllRead(ctx context.Context, userID string, at time.Time) (int64, error) {
+	result, err := r.db.With(ctx).
+		Update("notification", dbx.Params{"read_at": at}, inboxExp(userID, true)).
+		Execute()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+var unread = dbx.NewExp("read_at IS NULL")
+
+func inboxExp(userID string, unreadOnly bool) dbx.Expression {
+	if unreadOnly {
+		return dbx.And(dbx.HashExp{"user_id": userID}, unread)
+	}
+	return dbx.HashExp{"user_id": userID}
+}
+
+// GetPreferences reads the notification preferences of a user from the database.
+func (r repository) GetPreferences(ctx context.Context, userID string) ([]entity.NotificationPreference, error) {
+	var preferences []entity.NotificationPreference
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"user_id": userID}).
+		OrderBy("type").
+		All(&preferences)
+	return preferences, err
+}
+
+// SavePreference creates or replaces a notification preference in the database.
+func (r repository) SavePreference(ctx context.Context, preference entity.NotificationPreference) error {
+	_, err := r.db.With(ctx).
+		NewQuery("INSERT INTO notification_preference (user_id, type, delivery, updated_at) " +
+			"VALUES ({:user_id}, {:type}, {:delivery}, {:updated_at}) " +
+			"ON CONFLICT (user_id, type) DO UPDATE SET delivery = EXCLUDED.delivery, updated_at = EXCLUDED.updated_at").
+		Bind(dbx.Params{
+			"user_id":    preference.UserID,
+			"type":       preference.Type,
+			"delivery":   preference.Delivery,
+			"updated_at": preference.UpdatedAt,
+		}).
+		Execute()
+	return err
+}
+
+// QueryUnemailed returns the notifications which have not been emailed yet. Notifications of users
+// without a preference for their type are delivered in the default way.
+func (r repository) QueryUnemailed(ctx context.Context, userID, delivery string, since time.Time, limit int) ([]entity.Notification, error) {
+	sql := "SELECT n.* FROM notification n " +
+		"JOIN users u ON u.id = n.user_id AND u.deleted_at IS NULL " +
+		"LEFT JOIN notification_preference p ON p.user_id = n.user_id AND p.type = n.type " +
+		"WHERE n.emailed_at IS NULL AND COALESCE(p.delivery, {:default}) = {:delivery} "
+	params := dbx.Params{"default": DefaultDelivery, "delivery": delivery, "limit": limit}
+	if !since.IsZero() {
+		sql += "AND n.created_at > {:since} "
+		params["since"] = since
+	}
+	if userID != "" {
+		sql += "AND n.user_id = {:user_id} "
+		params["user_id"] = userID
+	}
+	var notifications []entity.Notification
+	err := r.db.With(ctx).
+		NewQuery(sql + "ORDER BY n.created_at, n.id LIMIT {:limit}").
+		Bind(params).
+		All(&notifications)
+	return notifications, err
+}
+
+// MarkEmailed records when the notifications were emailed.
+func (r repository) MarkEmailed(ctx context.Context, ids []string, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	_, err := r.db.With(ctx).Update("notification", dbx.Params{"emailed_at": at}, dbx.In("id", values...)).Execute()
+	return err
+}
+
+// DueDigests returns the users not in the trash who are due a digest of the given frequency.
+func (r repository) DueDigests(ctx context.Context, frequency string, due time.Time, limit int) ([]DigestState, error) {
+	var states []DigestState
+	err := r.db.With(ctx).
+		NewQuery("SELECT u.id AS user_id, d.sent_at FROM users u " +
+			"LEFT JOIN notification_digest d ON d.user_id = u.id AND d.frequency = {:frequency} " +
+			"WHERE u.deleted_at IS NULL AND (d.sent_at IS NULL OR d.sent_at <= {:due}) " +
+			"ORDER BY u.id LIMIT {:limit}").
+		Bind(dbx.Params{"frequency": frequency, "due": due, "limit": limit}).
+		All(&states)
+	return states, err
+}
+
+// SaveDigest records when a user was last sent a digest of the given frequency.
+func (r repository) SaveDigest(ctx context.Context, userID, frequency string, at time.Time) error {
+	_, err := r.db.With(ctx).
+		NewQuery("INSERT INTO notification_digest (user_id, frequency, sent_at) VALUES ({:user_id}, {:frequency}, {:sent_at}) " +
+			"ON CONFLICT (user_id, frequency) DO UPDATE SET sent_at = EXCLUDED.sent_at").
+		Bind(dbx.Params{"user_id": userID, "frequency": frequency, "sent_at": at}).
+		Execute()
+	return err
+}
+
+// TopNewIdeas returns the submitted ideas created after the given time which are neither in the trash
+// nor hidden by moderation, with the most votes first.
+func (r repository) TopNewIdeas(ctx context.Context, since time.Time, limit int) ([]entity.Idea, error) {
+	var ideas []entity.Idea
+	err := r.db.With(ctx).
+		Select().
+		From("idea").
+		Where(dbx.NewExp("created_at > {:since} AND status <> 'draft' AND deleted_at IS NULL AND bad_flag IS NOT TRUE",
+			dbx.Params{"since": since})).
+		OrderBy("votes DESC", "created_at", "id").
+		Limit(int64(limit)).
+		All(&ideas)
+	return ideas, err
+}
@@ -0,0 +1,410 @@
+package notification
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"time"
+)
+
+// Types of notifications.
+const (
+	// the followers of an idea are told about these changes
+	TypeIdeaUpdated       = "idea.updated"
+	TypeIdeaStatusChanged = "idea.status_changed"
+	TypeIdeaDeleted       = "idea.deleted"
+	// someone voted on the user's idea
+	TypeIdeaVoted = "idea.voted"
+	// a moderator approved, hid or deleted the user's idea, or closed the user's report
+	TypeIdeaModerated = "idea.moderated"
+	// an admin changed the user's role
+	TypeRoleChanged = "user.role_changed"
+	// the top new ideas included in digests. There are no notifications of this type, only preferences.
+	TypeTopIdeas = "ideas.top_new"
+)
+
+// PreferenceTypes lists the types of notifications users can choose how to be emailed about.
+var PreferenceTypes = []string{
+	TypeIdeaUpdated, TypeIdeaStatusChanged, TypeIdeaDeleted, TypeIdeaVoted, TypeIdeaModerated, TypeRoleChanged,
+	TypeTopIdeas,
+}
+
+// Ways of emailing notifications to users.
+const (
+	DeliveryInstant = "instant"
+	DeliveryDaily   = "daily"
+	DeliveryWeekly  = "weekly"
+	DeliveryOff     = "off"
+	// DefaultDelivery is how notifications are emailed when a user has no preference for their type.
+	DefaultDelivery = DeliveryDaily
+	// defaultTopIdeasDelivery is how often the top new ideas are emailed when a user has no preference for them.
+	defaultTopIdeasDelivery = DeliveryWeekly
+)
+
+// Service encapsulates usecase logic for following ideas and notifying users.
+type Service interface {
+	Follow(ctx context.Context, ideaID string, req FollowRequest) (FollowStatus, error)
+	Unfollow(ctx context.Context, ideaID string, req FollowRequest) (FollowStatus, error)
+	Following(ctx context.Context, requesterEmail string, page, perPage int) (*pagination.Pages, error)
+	AddFollower(ctx context.Context, ideaID, userID string) error
+	NotifyFollowers(ctx context.Context, event IdeaEvent) error
+	Notify(ctx context.Context, notification entity.Notification) error
+	Inbox(ctx context.Context, requesterEmail string, unreadOnly bool, page, perPage int) (*pagination.Pages, error)
+	UnreadCount(ctx context.Context, requesterEmail string) (UnreadCount, error)
+	MarkRead(ctx context.Context, id string, req ReadRequest) (entity.Notification, error)
+	MarkAllRead(ctx context.Context, req ReadRequest) (UnreadCount, error)
+	Preferences(ctx context.Context, requesterEmail string) ([]Preference, error)
+	UpdatePreferences(ctx context.Context, req UpdatePreferencesRequest) ([]Preference, error)
+	Unsubscribe(ctx context.Context, req UnsubscribeRequest) ([]Preference, error)
+	SendInstant(ctx context.Context, limit int) (int, error)
+	SendDigests(ctx context.Context, frequency string, now time.Time, limit int) (int, error)
+}
+
+// FollowRequest represents a request to follow or unfollow an idea.
+type FollowRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
+
+// FollowStatus represents whether the requester follows an idea.
+type FollowStatus struct {
+	IdeaID    string `json:"idea_id"`
+	Following bool   `json:"following"`
+	// the number of users following the idea
+	Followers int `json:"followers"`
+}
+
+// ReadRequest represents a request to mark notifications as read.
+type ReadRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
+
+// UnreadCount represents the number of unread notifications of a user.
+type UnreadCount struct {
+	Unread int `json:"unread"`
+}
+
+// Preference represents how a user wants to be emailed about one type of notification.
+type Preference struct {
+	Type string `json:"type"`
+	// one of "instant", "daily", "weekly" or "off"
+	Delivery string `json:"delivery"`
+}
+
+// UpdatePreferencesRequest represents a request to change how the requester is emailed about notifications.
+type UpdatePreferencesRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	// the delivery of each notification type to change, e.g. {"idea.voted": "instant"}
+	Preferences map[string]string `json:"preferences"`
+}
+
+// UnsubscribeRequest represents a request made by following an unsubscribe link.
+type UnsubscribeRequest struct {
+	UserID string
+	// the type of notifications to stop emailing, or every type if empty
+	Type      string
+	Signature string
+}
+
+// IdeaEvent represents a change to an idea that its followers are told about.
+type IdeaEvent struct {
+	Type   string
+	IdeaID string
+	// the user who made the change. They are not notified of their own changes.
+	ActorID string
+	Message string
+}
+
+type service struct {
+	Notifier
+	repo        Repository
+	userService user.UserService
+	mailer      Mailer
+	signer      unsubscribeSigner
+	logger      log.Logger
+}
+
+// NewService creates a new notification service. The signing key protects the unsubscribe links,
+// and the public URL is the base URL of the API used in the links of emails.
+func NewService(repo Repository, userService user.UserService, mailer Mailer, signingKey, publicURL string,
+	logger log.Logger) Service {
+	return service{NewNotifier(repo), repo, userService, mailer, unsubscribeSigner{[]byte(signingKey), publicURL}, logger}
+}
+
+// Follow makes the requester follow the idea with the specified ID.
+func (s service) Follow(ctx context.Context, ideaID string, req FollowRequest) (FollowStatus, error) {
+	requester, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return FollowStatus{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	exists, err := s.repo.IdeaExists(ctx, ideaID)
+	if err != nil {
+		return FollowStatus{}, err
+	}
+	if !exists {
+		return FollowStatus{}, errors.NotFound("")
+	}
+	if err := s.AddFollower(ctx, ideaID, requester.ID); err != nil {
+		return FollowStatus{}, err
+	}
+	return s.status(ctx, ideaID, requester.ID)
+}
+
+// Unfollow makes the requester stop following the idea with the specified ID.
+func (s service) Unfollow(ctx context.Context, ideaID string, req FollowRequest) (FollowStatus, error) {
+	requester, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return FollowStatus{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	if err := s.repo.Unfollow(ctx, ideaID, requester.ID); err != nil {
+		return FollowStatus{}, err
+	}
+	return s.status(ctx, ideaID, requester.ID)
+}
+
+func (s service) status(ctx context.Context, ideaID, userID string) (FollowStatus, error) {
+	followers, err := s.repo.Followers(ctx, ideaID)
+	if err != nil {
+		return FollowStatus{}, err
+	}
+	status := FollowStatus{IdeaID: ideaID, Followers: len(followers)}
+	for _, follower := range followers {
+		if follower == userID {
+			status.Following = true
+		}
+	}
+	return status, nil
+}
+
+// Following returns a page of the ideas the requester follows.
+func (s service) Following(ctx context.Context, requesterEmail string, page, perPage int) (*pagination.Pages, error) {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return nil, errors.InternalServerError("Requester User doesn't exist")
+	}
+	count, err := s.repo.CountFollowing(ctx, requester.ID)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	items, err := s.repo.QueryFollowing(ctx, requester.ID, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []entity.Idea{}
+	}
+	pages.Items = items
+	return pages, nil
+}
+
+// AddFollower makes a user follow an idea, e.g. when they author or vote on it.
+func (s service) AddFollower(ctx context.Context, ideaID, userID string) error {
+	return s.repo.Follow(ctx, entity.IdeaFollower{IdeaID: ideaID, UserID: userID, CreatedAt: time.Now()})
+}
+
+// NotifyFollowers records a notification for every follower of the idea, except the user who made the change.
+func (s service) NotifyFollowers(ctx context.Context, event IdeaEvent) error {
+	followers, err := s.repo.Followers(ctx, event.IdeaID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, follower := range followers {
+		err := s.Notify(ctx, entity.Notification{
+			UserID:    follower,
+			Type:      event.Type,
+			IdeaID:    event.IdeaID,
+			ActorID:   event.ActorID,
+			Message:   event.Message,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Inbox returns a page of the notifications of the requester, newest first.
+func (s service) Inbox(ctx context.Context, requesterEmail string, unreadOnly bool, page, perPage int) (*pagination.Pages, error) {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return nil, errors.InternalServerError("Requester User doesn't exist")
+	}
+	count, err := s.repo.CountInbox(ctx, requester.ID, unreadOnly)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	items, err := s.repo.QueryInbox(ctx, requester.ID, unreadOnly, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []entity.Notification{}
+	}
+	pages.Items = items
+	return pages, nil
+}
+
+// UnreadCount returns the number of unread notifications of the requester.
+func (s service) UnreadCount(ctx context.Context, requesterEmail string) (UnreadCount, error) {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return UnreadCount{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	count, err := s.repo.CountInbox(ctx, requester.ID, true)
+	return UnreadCount{count}, err
+}
+
+// MarkRead marks a notification of the requester as read.
+func (s service) MarkRead(ctx context.Context, id string, req ReadRequest) (entity.Notification, error) {
+	requester, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return entity.Notification{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	notification, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return entity.Notification{}, err
+	}
+	if notification.UserID != requester.ID {
+		// don't reveal that the notification exists
+		return entity.Notification{}, errors.NotFound("")
+	}
+	if err := s.repo.MarkRead(ctx, id, time.Now()); err != nil {
+		return entity.Notification{}, err
+	}
+	return s.repo.Get(ctx, id)
+}
+
+// MarkAllRead marks every notification of the requester as read.
+func (s service) MarkAllRead(ctx context.Context, req ReadRequest) (UnreadCount, error) {
+	requester, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return UnreadCount{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	if _, err := s.repo.MarkAllRead(ctx, requester.ID, time.Now()); err != nil {
+		return UnreadCount{}, err
+	}
+	return UnreadCount{0}, nil
+}
+
+// Preferences returns how the requester is emailed about each type of notification.
+func (s service) Preferences(ctx context.Context, requesterEmail string) ([]Preference, error) {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return nil, errors.InternalServerError("Requester User doesn't exist")
+	}
+	return s.preferences(ctx, requester.ID)
+}
+
+// UpdatePreferences changes how the requester is emailed about the given types of notifications.
+func (s service) UpdatePreferences(ctx context.Context, req UpdatePreferencesRequest) ([]Preference, error) {
+	requester, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return nil, errors.InternalServerError("Requester User doesn't exist")
+	}
+	for typ, delivery := range req.Preferences {
+		if err := validatePreference(typ, delivery); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.savePreferences(ctx, requester.ID, req.Preferences); err != nil {
+		return nil, err
+	}
+	return s.preferences(ctx, requester.ID)
+}
+
+// Unsubscribe stops emailing a user about one type of notifications, or about every type,
+// provided the request carries the signature of an unsubscribe link.
+func (s service) Unsubscribe(ctx context.Context, req UnsubscribeRequest) ([]Preference, error) {
+	if req.UserID == "" || !s.signer.Verify(req.UserID, req.Type, req.Signature) {
+		return nil, errors.Forbidden("The unsubscribe link is not valid")
+	}
+	preferences := map[string]string{}
+	if req.Type == "" {
+		for _, typ := range PreferenceTypes {
+			preferences[typ] = DeliveryOff
+		}
+	} else {
+		if err := validatePreference(req.Type, DeliveryOff); err != nil {
+			return nil, err
+		}
+		preferences[req.Type] = DeliveryOff
+	}
+	if err := s.savePreferences(ctx, req.UserID, preferences); err != nil {
+		return nil, err
+	}
+	return s.preferences(ctx, req.UserID)
+}
+
+// deliveries returns how a user is emailed about each type of notification, including the defaults.
+func (s service) deliveries(ctx context.Context, userID string) (map[string]string, error) {
+	saved, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := map[string]string{}
+	for _, typ := range PreferenceTypes {
+		deliveries[typ] = DefaultDelivery
+	}
+	deliveries[TypeTopIdeas] = defaultTopIdeasDelivery
+	for _, preference := range saved {
+		deliveries[preference.Type] = preference.Delivery
+	}
+	return deliveries, nil
+}
+
+func (s service) preferences(ctx context.Context, userID string) ([]Preference, error) {
+	deliveries, err := s.deliveries(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	preferences := []Preference{}
+	for _, typ := range PreferenceTypes {
+		preferences = append(preferences, Preference{typ, deliveries[typ]})
+	}
+	return preferences, nil
+}
+
+func (s service) savePreferences(ctx context.Context, userID string, preferences map[string]string) error {
+	now := time.Now()
+	for typ, delivery := range preferences {
+		err := s.repo.SavePreference(ctx, entity.NotificationPreference{
+			UserID:    userID,
+			Type:      typ,
+			Delivery:  delivery,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePreference checks that a notification type can be delivered in the given way.
+func validatePreference(typ, delivery string) error {
+	known := false
+	for _, t := range PreferenceTypes {
+		if t == typ {
+			known = true
+		}
+	}
+	if !known {
+		return errors.BadRequest("This notification type doesn't exists in the system : " + typ)
+	}
+	switch delivery {
+	case DeliveryDaily, DeliveryWeekly, DeliveryOff:
+		return nil
+	case DeliveryInstant:
+		if typ == TypeTopIdeas {
+			return errors.BadRequest("The top new ideas can only be emailed in a digest")
+		}
+		return nil
+	}
+	return errors.BadRequest("This delivery doesn't exists in the system : " + delivery)
+}
@@ -0,0 +1,118 @@
+package notification
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+)
+
+// subscriberName identifies the notification service among the subscribers of domain events.
+const subscriberName = "notification"
+
+// RegisterSubscribers subscribes the notification service to the domain events it reacts to.
+// Authors and voters follow their ideas, and users are notified of the changes that concern them.
+func RegisterSubscribers(bus event.Bus, service Service) {
+	bus.Subscribe(event.IdeaCreated, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.IdeaData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return service.AddFollower(ctx, data.Idea.ID, data.Idea.AuthorID)
+	})
+
+	bus.Subscribe(event.IdeaVoted, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.VoteData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		if err := service.AddFollower(ctx, data.Idea.ID, data.VoterID); err != nil {
+			return err
+		}
+		return service.Notify(ctx, entity.Notification{
+			UserID:    data.Idea.AuthorID,
+			Type:      TypeIdeaVoted,
+			IdeaID:    data.Idea.ID,
+			ActorID:   data.VoterID,
+			Message:   data.VoterName + " voted on your idea \"" + data.Idea.Summary + "\"",
+			CreatedAt: e.CreatedAt,
+		})
+	})
+
+	bus.Subscribe(event.IdeaUpdated, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.IdeaData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return service.NotifyFollowers(ctx, IdeaEvent{
+			Type:    TypeIdeaUpdated,
+			IdeaID:  data.Idea.ID,
+			ActorID: data.ActorID,
+			Message: "The idea \"" + data.Idea.Summary + "\" was edited",
+		})
+	})
+
+	bus.Subscribe(event.IdeaDeleted, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.IdeaData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return service.NotifyFollowers(ctx, IdeaEvent{
+			Type:    TypeIdeaDeleted,
+			IdeaID:  data.Idea.ID,
+			ActorID: data.ActorID,
+			Message: "The idea \"" + data.Idea.Summary + "\" was deleted",
+		})
+	})
+
+	bus.Subscribe(event.IdeaStatusChanged, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.StatusChangeData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return service.NotifyFollowers(ctx, IdeaEvent{
+			Type:    TypeIdeaStatusChanged,
+			IdeaID:  data.Idea.ID,
+			ActorID: data.Change.ChangedBy,
+			Message: "The idea \"" + data.Idea.Summary + "\" moved from " + data.Change.FromStatus + " to " + data.Change.ToStatus,
+		})
+	})
+
+	bus.Subscribe(event.IdeaModerated, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.ModerationData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		message := "A moderator applied the action " + data.Action + " to the idea \"" + data.Idea.Summary + "\""
+		if data.Note != "" {
+			message += ": " + data.Note
+		}
+		for _, recipient := range append([]string{data.Idea.AuthorID}, data.ReporterIDs...) {
+			err := service.Notify(ctx, entity.Notification{
+				UserID:    recipient,
+				Type:      TypeIdeaModerated,
+				IdeaID:    data.Idea.ID,
+				ActorID:   data.ModeratorID,
+				Message:   message,
+				CreatedAt: e.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	bus.Subscribe(event.UserRoleChanged, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.RoleChangeData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return service.Notify(ctx, entity.Notification{
+			UserID:    data.UserID,
+			Type:      TypeRoleChanged,
+			ActorID:   data.ChangedBy,
+			Message:   "Your role was changed from " + data.OldRole + " to " + data.NewRole,
+			CreatedAt: e.CreatedAt,
+		})
+	})
+}
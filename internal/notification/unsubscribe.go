@@ -0,0 +1,95 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+var unsubscribeTemplate = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if and .Signature (not .Done)}}<form method="post" action="unsubscribe">
+<input type="hidden" name="user" value="{{.UserID}}">
+<input type="hidden" name="type" value="{{.Type}}">
+<input type="hidden" name="signature" value="{{.Signature}}">
+<button type="submit">Unsubscribe</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// unsubscribePage represents the page of an unsubscribe link.
+type unsubscribePage struct {
+	Title   string
+	Message string
+	// the parameters of the link, posted to unsubscribe
+	UserID    string
+	Type      string
+	Signature string
+	// whether the user is unsubscribed
+	Done bool
+}
+
+// unsubscribeMessage returns the question asked before stopping the emails of the given type, or of every type.
+func unsubscribeMessage(typ string) string {
+	if typ == "" {
+		return "Do you want to stop receiving every notification email?"
+	}
+	return "Do you want to stop receiving emails about " + typ + " notifications?"
+}
+
+// writePage writes an HTML page in the response.
+func writePage(c *routing.Context, status int, page unsubscribePage) error {
+	c.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Response.WriteHeader(status)
+	return unsubscribeTemplate.Execute(c.Response, page)
+}
+
+// unsubscribeSigner signs unsubscribe links so they can be used without logging in.
+type unsubscribeSigner struct {
+	key     []byte
+	baseURL string
+}
+
+// Sign returns the signature allowing a user to stop the emails of the given type, or of every type if it is empty.
+func (s unsubscribeSigner) Sign(userID, typ string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte("unsubscribe\n" + userID + "\n" + typ))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of an unsubscribe link.
+func (s unsubscribeSigner) Verify(userID, typ, signature string) bool {
+	expected, err := hex.DecodeString(s.Sign(userID, typ))
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
+
+// Link returns the signed unsubscribe link of a user.
+func (s unsubscribeSigner) Link(userID, typ string) string {
+	query := url.Values{}
+	query.Set("user", userID)
+	if typ != "" {
+		query.Set("type", typ)
+	}
+	query.Set("signature", s.Sign(userID, typ))
+	return strings.TrimRight(s.baseURL, "/") + "/v1/notifications/unsubscribe?" + query.Encode()
+}
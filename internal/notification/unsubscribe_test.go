@@ -0,0 +1,63 @@
+package notification
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func Test_unsubscribeSigner(t *testing.T) {
+	signer := unsubscribeSigner{[]byte("secret"), "https://example.com/"}
+
+	link, err := url.Parse(signer.Link("jane@example.com", TypeIdeaVoted))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "/v1/notifications/unsubscribe", link.Path)
+		query := link.Query()
+		assert.Equal(t, "jane@example.com", query.Get("user"))
+		assert.Equal(t, TypeIdeaVoted, query.Get("type"))
+		assert.True(t, signer.Verify("jane@example.com", TypeIdeaVoted, query.Get("signature")))
+	}
+
+	signature := signer.Sign("jane@example.com", TypeIdeaVoted)
+	tests := []struct {
+		name      string
+		userID    string
+		typ       string
+		signature string
+	}{
+		{"other user", "john@example.com", TypeIdeaVoted, signature},
+		{"other type", "jane@example.com", "", signature},
+		{"other key", "jane@example.com", TypeIdeaVoted, unsubscribeSigner{key: []byte("other")}.Sign("jane@example.com", TypeIdeaVoted)},
+		{"malformed", "jane@example.com", TypeIdeaVoted, "not hex"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.False(t, signer.Verify(tc.userID, tc.typ, tc.signature))
+		})
+	}
+}
+
+func Test_writePage(t *testing.T) {
+	res := httptest.NewRecorder()
+	c := routing.NewContext(res, httptest.NewRequest("GET", "/v1/notifications/unsubscribe", nil))
+	assert.Nil(t, writePage(c, http.StatusOK, unsubscribePage{
+		Title:     "Unsubscribe",
+		Message:   unsubscribeMessage(TypeIdeaVoted),
+		UserID:    "1",
+		Type:      TypeIdeaVoted,
+		Signature: `"><script>`,
+	}))
+	assert.Equal(t, "text/html; charset=utf-8", res.Header().Get("Content-Type"))
+	body := res.Body.String()
+	assert.Contains(t, body, `<form method="post" action="unsubscribe">`)
+	assert.Contains(t, body, `name="type" value="idea.voted"`)
+	assert.NotContains(t, body, "<script>")
+
+	res = httptest.NewRecorder()
+	c = routing.NewContext(res, httptest.NewRequest("POST", "/v1/notifications/unsubscribe", nil))
+	assert.Nil(t, writePage(c, http.StatusOK, unsubscribePage{Title: "Unsubscribed", Message: "Done", Done: true}))
+	assert.NotContains(t, res.Body.String(), "<form")
+}
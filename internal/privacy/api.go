@@ -0,0 +1,57 @@
+package privacy
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"mime"
+	"strings"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/user/<email>/export", res.export)
+	r.Post("/user/<email>/erase", res.erase)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) export(c *routing.Context) error {
+	format := c.Query("format", "json")
+	if format != "json" && format != "zip" {
+		return errors.BadRequest("format must be json or zip")
+	}
+	export, err := r.service.Export(c.Request.Context(), c.Query("requester_user_email"), c.Param("email"))
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		return c.Write(export)
+	}
+
+	filename := "export-" + strings.ReplaceAll(export.Profile.ID, "/", "_") + ".zip"
+	header := c.Response.Header()
+	header.Set("Content-Type", "application/zip")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	return WriteZip(c.Response, export)
+}
+
+func (r resource) erase(c *routing.Context) error {
+	var input EraseRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	if _, err := r.service.Erase(c.Request.Context(), c.Param("email"), input); err != nil {
+		return err
+	}
+	return c.Write(struct {
+		Message string `json:"message"`
+	}{"The personal data of the user was erased"})
+}
@@ -0,0 +1,47 @@
+package privacy
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+)
+
+// WriteZip writes the export as a ZIP archive holding one JSON file per kind of data.
+func WriteZip(w io.Writer, export Export) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", struct {
+			ExportedAt interface{} `json:"exported_at"`
+			Profile    interface{} `json:"profile"`
+		}{export.ExportedAt, export.Profile}},
+		{"ideas.json", export.Ideas},
+		{"votes.json", export.Votes},
+		{"reports.json", export.Reports},
+		{"status_changes.json", export.StatusChanges},
+		{"moderation_actions.json", export.ModerationActions},
+		{"media.json", export.Media},
+		{"following.json", export.Following},
+		{"notifications.json", export.Notifications},
+		{"notification_preferences.json", export.NotificationPreferences},
+		{"invitations_sent.json", export.InvitationsSent},
+		{"invitations_received.json", export.InvitationsReceived},
+		{"badges.json", export.Badges},
+		{"score_events.json", export.ScoreEvents},
+		{"audit_entries.json", export.AuditEntries},
+	}
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,66 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWriteZip(t *testing.T) {
+	export := Export{
+		ExportedAt: time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC),
+		Profile:    entity.Users{ID: "u1", Email: "ana@example.com", Name: "Ana"},
+		Records: Records{
+			Votes:        []entity.IdeaVote{{IdeaID: "i1", VoterID: "u1"}},
+			AuditEntries: []entity.AuditEntry{{ID: "a1", ActorID: "u1", Action: "auth.login"}},
+		},
+	}
+	var buf bytes.Buffer
+	if !assert.Nil(t, WriteZip(&buf, export)) {
+		return
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !assert.Nil(t, err) {
+		return
+	}
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	assert.Len(t, files, 15)
+
+	var votes []entity.IdeaVote
+	readJSON(t, files["votes.json"], &votes)
+	assert.Equal(t, export.Votes, votes)
+
+	var entries []entity.AuditEntry
+	readJSON(t, files["audit_entries.json"], &entries)
+	assert.Equal(t, export.AuditEntries, entries)
+
+	var profile struct {
+		Profile entity.Users `json:"profile"`
+	}
+	readJSON(t, files["profile.json"], &profile)
+	assert.Equal(t, "ana@example.com", profile.Profile.Email)
+
+	var ideas []entity.Idea
+	readJSON(t, files["ideas.json"], &ideas)
+	assert.Empty(t, ideas)
+}
+
+func readJSON(t *testing.T, f *zip.File, v interface{}) {
+	if !assert.NotNil(t, f) {
+		return
+	}
+	r, err := f.Open()
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer r.Close()
+	assert.Nil(t, json.NewDecoder(r).Decode(v))
+}
@@ -0,0 +1,155 @@
+package privacy
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access the personal data of users from the data source.
+type Repository interface {
+	// GetUser returns the user with the specified email address, including the users in the trash.
+	GetUser(ctx context.Context, email string) (entity.Users, error)
+
+	// Collect returns everything stored about the user with the specified ID, apart from its profile.
+	Collect(ctx context.Context, userID, email string) (Records, error)
+
+	// Erase removes the personal data of the user with the specified ID and email address. The ideas the user
+	// authored and their votes are kept, but can no longer be linked to them, and the text they wrote is blanked.
+	// It returns the storage keys of the files the user uploaded, which are no longer referenced.
+	Erase(ctx context.Context, userID, email string) ([]string, error)
+}
+
+// repository reads and erases personal data in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new privacy repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetUser reads the user with the specified email address from the database, including the users in the trash.
+func (r repository) GetUser(ctx context.Context, email string) (entity.Users, error) {
+	var user entity.Users
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"email": email}).One(&user)
+	return user, err
+}
+
+// Collect reads everything stored about the user with the specified ID from the database, apart from its profile.
+func (r repository) Collect(ctx context.Context, userID, email string) (Records, error) {
+	records := Records{
+		Ideas:                   []entity.Idea{},
+		Votes:                   []entity.IdeaVote{},
+		Reports:                 []entity.IdeaReport{},
+		StatusChanges:           []entity.IdeaStatusChange{},
+		ModerationActions:       []entity.ModerationAction{},
+		Media:                   []entity.Media{},
+		Following:               []entity.IdeaFollower{},
+		Notifications:           []entity.Notification{},
+		NotificationPreferences: []entity.NotificationPreference{},
+		InvitationsSent:         []entity.Invitation{},
+		InvitationsReceived:     []entity.Invitation{},
+		Badges:                  []entity.UserBadge{},
+		ScoreEvents:             []entity.ScoreEvent{},
+		AuditEntries:            []entity.AuditEntry{},
+	}
+	db := r.db.With(ctx)
+	queries := []struct {
+		exp     dbx.Expression
+		orderBy string
+		target  interface{}
+	}{
+		{dbx.HashExp{"author_id": userID}, "created_at", &records.Ideas},
+		{dbx.HashExp{"voter_id": userID}, "created_at", &records.Votes},
+		{dbx.HashExp{"reporter_id": userID}, "created_at", &records.Reports},
+		{dbx.HashExp{"changed_by": userID}, "created_at", &records.StatusChanges},
+		{dbx.HashExp{"moderator_id": userID}, "created_at", &records.ModerationActions},
+		{dbx.HashExp{"owner_id": userID}, "created_at", &records.Media},
+		{dbx.HashExp{"user_id": userID}, "created_at", &records.Following},
+		{dbx.HashExp{"user_id": userID}, "created_at", &records.Notifications},
+		{dbx.HashExp{"user_id": userID}, "type", &records.NotificationPreferences},
+		{dbx.HashExp{"invited_by": userID}, "created_at", &records.InvitationsSent},
+		{dbx.HashExp{"email": email}, "created_at", &records.InvitationsReceived},
+		{dbx.HashExp{"user_id": userID}, "awarded_at", &records.Badges},
+		{dbx.HashExp{"user_id": userID}, "created_at", &records.ScoreEvents},
+		{dbx.Or(dbx.HashExp{"actor_id": userID}, dbx.HashExp{"target_type": "user", "target_id": userID}), "created_at",
+			&records.AuditEntries},
+	}
+	for _, q := range queries {
+		if err := db.Select().Where(q.exp).OrderBy(q.orderBy).All(q.target); err != nil {
+			return Records{}, err
+		}
+	}
+	return records, nil
+}
+
+// erasedSummary replaces the summary of the ideas of an erased user, which cannot be empty.
+const erasedSummary = "[erased]"
+
+// Erase removes the personal data of the user with the specified ID and email address from the database.
+// The user row goes last, so that the ID left on ideas, votes, reports and moderation records no longer resolves
+// to anybody. The text the user wrote on these records is blanked, and the media they uploaded are removed along
+// with the references of their ideas to them. The notifications of other users about the activity of the user
+// are removed too, as they may mention their name, and so are the domain events and the webhook deliveries
+// whose payload refers to the user.
+func (r repository) Erase(ctx context.Context, userID, email string) ([]string, error) {
+	db := r.db.With(ctx)
+	var keys []string
+	err := db.NewQuery(`SELECT storage_key FROM media WHERE owner_id = {:user}
+		UNION ALL SELECT v.storage_key FROM media_variant v JOIN media m ON m.id = v.media_id WHERE m.owner_id = {:user}`).
+		Bind(dbx.Params{"user": userID}).Column(&keys)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := []struct {
+		table string
+		cols  dbx.Params
+		exp   dbx.Expression
+	}{
+		{"idea", dbx.Params{"summary": erasedSummary, "content": "", "media": "{}", "media_types": "{}", "media_ids": "{}"},
+			dbx.HashExp{"author_id": userID}},
+		{"idea_report", dbx.Params{"details": ""}, dbx.HashExp{"reporter_id": userID}},
+		{"idea_report", dbx.Params{"resolution_note": ""}, dbx.HashExp{"resolved_by": userID}},
+		{"idea_status_change", dbx.Params{"reason": ""}, dbx.HashExp{"changed_by": userID}},
+		{"moderation_action", dbx.Params{"note": ""}, dbx.HashExp{"moderator_id": userID}},
+	}
+	for _, u := range updates {
+		if _, err := db.Update(u.table, u.cols, u.exp).Execute(); err != nil {
+			return nil, err
+		}
+	}
+
+	// the payloads are JSON documents, which refer to users by ID, and by email address for user events
+	mentions := dbx.NewExp("position({:id} IN payload) > 0 OR position({:email} IN payload) > 0",
+		dbx.Params{"id": `"` + userID + `"`, "email": `"` + email + `"`})
+	deletes := []struct {
+		table string
+		exp   dbx.Expression
+	}{
+		{"notification", dbx.Or(dbx.HashExp{"user_id": userID}, dbx.HashExp{"actor_id": userID})},
+		{"notification_preference", dbx.HashExp{"user_id": userID}},
+		{"notification_digest", dbx.HashExp{"user_id": userID}},
+		{"idea_follower", dbx.HashExp{"user_id": userID}},
+		{"email_change", dbx.HashExp{"user_id": userID}},
+		{"login_code", dbx.HashExp{"user_id": userID}},
+		{"user_badge", dbx.HashExp{"user_id": userID}},
+		{"score_event", dbx.HashExp{"user_id": userID}},
+		{"invitation", dbx.HashExp{"email": email}},
+		{"media", dbx.HashExp{"owner_id": userID}},
+		{"outbox_event", mentions},
+		{"webhook_delivery", mentions},
+		{"users", dbx.HashExp{"id": userID}},
+	}
+	for _, d := range deletes {
+		if _, err := db.Delete(d.table, d.exp).Execute(); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,130 @@
+// Package privacy answers the requests of users about their personal data: exporting everything stored about them,
+// and erasing it.
+package privacy
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/blob"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Service encapsulates usecase logic for the personal data of users.
+type Service interface {
+	Export(ctx context.Context, requesterEmail, email string) (Export, error)
+	Erase(ctx context.Context, email string, req EraseRequest) (entity.Users, error)
+}
+
+// Records represents everything stored about a user apart from its profile.
+type Records struct {
+	Ideas             []entity.Idea             `json:"ideas"`
+	Votes             []entity.IdeaVote         `json:"votes"`
+	Reports           []entity.IdeaReport       `json:"reports"`
+	StatusChanges     []entity.IdeaStatusChange `json:"status_changes"`
+	ModerationActions []entity.ModerationAction `json:"moderation_actions"`
+	Media             []entity.Media            `json:"media"`
+	Following         []entity.IdeaFollower     `json:"following"`
+	Notifications     []entity.Notification     `json:"notifications"`
+	// the notification preferences of the user
+	NotificationPreferences []entity.NotificationPreference `json:"notification_preferences"`
+	InvitationsSent         []entity.Invitation             `json:"invitations_sent"`
+	InvitationsReceived     []entity.Invitation             `json:"invitations_received"`
+	Badges                  []entity.UserBadge              `json:"badges"`
+	ScoreEvents             []entity.ScoreEvent             `json:"score_events"`
+	// the entries of the audit log about the actions taken by or on the user
+	AuditEntries []entity.AuditEntry `json:"audit_entries"`
+}
+
+// Export represents the data export of a user.
+type Export struct {
+	ExportedAt time.Time    `json:"exported_at"`
+	Profile    entity.Users `json:"profile"`
+	Records
+}
+
+// EraseRequest represents a request to erase the personal data of a user.
+type EraseRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
+
+type service struct {
+	repo        Repository
+	userService user.UserService
+	storage     blob.Storage
+	transaction dbcontext.TransactionFunc
+	logger      log.Logger
+}
+
+// NewService creates a new privacy service. The files users upload are erased from the given storage.
+func NewService(repo Repository, userService user.UserService, storage blob.Storage, transaction dbcontext.TransactionFunc,
+	logger log.Logger) Service {
+	return service{repo, userService, storage, transaction, logger}
+}
+
+// Export returns everything stored about the user with the specified email address, including a user in the trash.
+// Users may export their own data, and the requester needs the permission to delete the user otherwise.
+func (s service) Export(ctx context.Context, requesterEmail, email string) (Export, error) {
+	u, err := s.subject(ctx, requesterEmail, email)
+	if err != nil {
+		return Export{}, err
+	}
+	records, err := s.repo.Collect(ctx, u.ID, u.Email)
+	if err != nil {
+		return Export{}, err
+	}
+	return Export{ExportedAt: time.Now(), Profile: u, Records: records}, nil
+}
+
+// Erase removes the personal data of the user with the specified email address, including a user in the trash.
+// The ideas they authored and their votes are kept, so that the vote counts don't change, but nothing links
+// them to the user anymore and the text of their ideas is blanked. The files they uploaded are deleted last,
+// so that the erasure is rolled back, and can be tried again, if they cannot be. Users may erase their own data,
+// and the requester needs the permission to delete the user otherwise. It returns the profile of the user as it
+// was before the erasure.
+func (s service) Erase(ctx context.Context, email string, req EraseRequest) (entity.Users, error) {
+	u, err := s.subject(ctx, req.RequesterUserEmail, email)
+	if err != nil {
+		return entity.Users{}, err
+	}
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		keys, err := s.repo.Erase(ctx, u.ID, u.Email)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := s.storage.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.Users{}, err
+	}
+	s.logger.With(ctx, "user", u.ID).Infof("erased the personal data of a user")
+	return u, nil
+}
+
+// subject returns the user whose data the requester asks for, after checking they may access it.
+func (s service) subject(ctx context.Context, requesterEmail, email string) (entity.Users, error) {
+	u, err := s.repo.GetUser(ctx, email)
+	if err == sql.ErrNoRows {
+		return entity.Users{}, errors.NotFound("This user doesn't exists in the system : " + email)
+	} else if err != nil {
+		return entity.Users{}, err
+	}
+	if requesterEmail != email {
+		if isPermitted, errMsg := s.userService.CheckPermission(ctx, requesterEmail, u.Role); !isPermitted {
+			return entity.Users{}, errMsg
+		}
+	} else if _, err := s.userService.GetUser(ctx, requesterEmail); err != nil {
+		// users in the trash can no longer act on their own
+		return entity.Users{}, errors.InternalServerError("Requester User doesn't exists")
+	}
+	return u, nil
+}
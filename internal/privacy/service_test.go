@@ -0,0 +1,123 @@
+package privacy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	apperrors "github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/blob"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type mockUserService struct {
+	user.UserService
+	users []entity.Users
+}
+
+func (m mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	for _, u := range m.users {
+		if u.Email == email {
+			return user.User{Users: u}, nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+func (m mockUserService) CheckPermission(ctx context.Context, requesterEmail string, role string) (bool, error) {
+	requester, err := m.GetUser(ctx, requesterEmail)
+	if err != nil || !user.IsAdmin(requester.Role) {
+		return false, apperrors.Forbidden("")
+	}
+	return true, nil
+}
+
+// mockRepository erases users from memory, along with the storage keys of the files they uploaded.
+type mockRepository struct {
+	users  []entity.Users
+	keys   map[string][]string
+	erased []string
+}
+
+func (m *mockRepository) GetUser(ctx context.Context, email string) (entity.Users, error) {
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return entity.Users{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Collect(ctx context.Context, userID, email string) (Records, error) {
+	return Records{}, nil
+}
+
+func (m *mockRepository) Erase(ctx context.Context, userID, email string) ([]string, error) {
+	m.erased = append(m.erased, userID)
+	return m.keys[userID], nil
+}
+
+type mockStorage struct {
+	blob.Storage
+	deleted []string
+	err     error
+}
+
+func (m *mockStorage) Delete(ctx context.Context, key string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.deleted = append(m.deleted, key)
+	return nil
+}
+
+func newMockService() (Service, *mockRepository, *mockStorage) {
+	users := []entity.Users{
+		{ID: "1", Email: "admin@example.com", Role: user.ADMIN},
+		{ID: "2", Email: "ann@example.com", Role: user.VISITOR},
+		{ID: "3", Email: "bob@example.com", Role: user.VISITOR},
+	}
+	repo := &mockRepository{users: users, keys: map[string][]string{"2": {"media/a", "media/a-thumb"}}}
+	storage := &mockStorage{}
+	logger, _ := log.NewForTest()
+	transaction := func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	return NewService(repo, mockUserService{users: users}, storage, transaction, logger), repo, storage
+}
+
+func TestService_Erase(t *testing.T) {
+	s, repo, storage := newMockService()
+	ctx := context.Background()
+
+	// users cannot erase somebody else
+	_, err := s.Erase(ctx, "ann@example.com", EraseRequest{RequesterUserEmail: "bob@example.com"})
+	assert.NotNil(t, err)
+	assert.Empty(t, repo.erased)
+
+	u, err := s.Erase(ctx, "ann@example.com", EraseRequest{RequesterUserEmail: "ann@example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "2", u.ID)
+	assert.Equal(t, []string{"2"}, repo.erased)
+	// the files the user uploaded are deleted from the storage
+	assert.Equal(t, []string{"media/a", "media/a-thumb"}, storage.deleted)
+
+	// admins may erase users, who have no files here
+	_, err = s.Erase(ctx, "bob@example.com", EraseRequest{RequesterUserEmail: "admin@example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2", "3"}, repo.erased)
+	assert.Len(t, storage.deleted, 2)
+
+	_, err = s.Erase(ctx, "nobody@example.com", EraseRequest{RequesterUserEmail: "admin@example.com"})
+	assert.NotNil(t, err)
+}
+
+func TestService_Erase_storageFailure(t *testing.T) {
+	s, _, storage := newMockService()
+	storage.err = errors.New("unavailable")
+
+	// the erasure fails, and is rolled back, when the files cannot be deleted
+	_, err := s.Erase(context.Background(), "ann@example.com", EraseRequest{RequesterUserEmail: "ann@example.com"})
+	assert.EqualError(t, err, "unavailable")
+}
@@ -0,0 +1,51 @@
+package registration
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"net/http"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Post("/register", res.register)
+	r.Post("/register/resend", res.resend)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) register(c *routing.Context) error {
+	var input RegisterRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	if err := r.service.Register(c.Request.Context(), input); err != nil {
+		return err
+	}
+	return c.WriteWithStatus(struct {
+		Message string `json:"message"`
+	}{"Check the inbox of this email address to continue"}, http.StatusAccepted)
+}
+
+func (r resource) resend(c *routing.Context) error {
+	var input ResendRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	if err := r.service.ResendVerification(c.Request.Context(), input); err != nil {
+		return err
+	}
+	return c.WriteWithStatus(struct {
+		Message string `json:"message"`
+	}{"If this email address is waiting for confirmation, a new link was sent to it"}, http.StatusAccepted)
+}
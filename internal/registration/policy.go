@@ -0,0 +1,41 @@
+package registration
+
+import "strings"
+
+// Policy decides who may sign up on their own.
+type Policy struct {
+	// whether people may sign up on their own
+	Enabled bool
+	// the email domains allowed to sign up. Every domain is allowed if empty.
+	AllowedDomains []string
+	// the email domains never allowed to sign up, even if they are in AllowedDomains
+	DeniedDomains []string
+}
+
+// Allows reports whether the policy allows the given email address to sign up. A domain of the lists
+// also matches its subdomains, so "example.com" matches "eng.example.com".
+func (p Policy) Allows(email string) bool {
+	if !p.Enabled {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	if matchDomain(domain, p.DeniedDomains) {
+		return false
+	}
+	return len(p.AllowedDomains) == 0 || matchDomain(domain, p.AllowedDomains)
+}
+
+// matchDomain reports whether a domain is one of the given domains or one of their subdomains.
+func matchDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d != "" && (domain == d || strings.HasSuffix(domain, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package registration
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicy_Allows(t *testing.T) {
+	open := Policy{Enabled: true, DeniedDomains: []string{"mailinator.com"}}
+	assert.True(t, open.Allows("ana@example.com"))
+	assert.False(t, open.Allows("ana@mailinator.com"))
+	assert.False(t, open.Allows("ana@eu.Mailinator.com"))
+	assert.False(t, open.Allows("ana"))
+
+	restricted := Policy{Enabled: true, AllowedDomains: []string{"@Example.com"}, DeniedDomains: []string{"contractors.example.com"}}
+	assert.True(t, restricted.Allows("ana@example.com"))
+	assert.True(t, restricted.Allows("ana@eng.example.com"))
+	assert.False(t, restricted.Allows("ana@notexample.com"))
+	assert.False(t, restricted.Allows("ana@contractors.example.com"))
+
+	assert.False(t, Policy{}.Allows("ana@example.com"))
+}
@@ -0,0 +1,163 @@
+// Package registration lets people sign up on their own as visitors, subject to an email domain policy.
+package registration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/notification"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+var verificationEmail = template.Must(template.New("verification").Parse(`Hello {{.Name}},
+
+Please confirm your email address by opening the link below:
+{{.Link}}
+
+You can vote and contribute ideas once your email address is confirmed.
+If you didn't sign up, you can ignore this email.
+`))
+
+var existingAccountEmail = template.Must(template.New("existing").Parse(`Hello {{.Name}},
+
+Somebody tried to sign up with your email address, which already has an account.
+You can log in with it as usual. If you didn't try to sign up, you can ignore this email.
+`))
+
+// Service encapsulates usecase logic for self-registration.
+type Service interface {
+	Register(ctx context.Context, req RegisterRequest) error
+	ResendVerification(ctx context.Context, req ResendRequest) error
+}
+
+// RegisterRequest represents a sign-up request.
+type RegisterRequest struct {
+	EmailAddress string `json:"email_address"`
+	Name         string `json:"name"`
+	Country      string `json:"country"`
+}
+
+// ResendRequest represents a request to send the verification email again.
+type ResendRequest struct {
+	EmailAddress string `json:"email_address"`
+}
+
+type service struct {
+	policy      Policy
+	userService user.UserService
+	mailer      notification.Mailer
+	publicURL   string
+	logger      log.Logger
+}
+
+// NewService creates a new registration service. The verification links point to the given public URL of the API.
+func NewService(policy Policy, userService user.UserService, mailer notification.Mailer, publicURL string, logger log.Logger) Service {
+	return service{policy, userService, mailer, strings.TrimRight(publicURL, "/"), logger}
+}
+
+// Register creates a visitor and emails them the link confirming their email address.
+// It succeeds for an address which already belongs to a user too, so that it doesn't reveal who has an account:
+// the user is told about the attempt by email instead, and nothing is created.
+func (s service) Register(ctx context.Context, req RegisterRequest) error {
+	if !s.policy.Enabled {
+		return errors.Forbidden("Self-registration is disabled")
+	}
+	email := strings.TrimSpace(req.EmailAddress)
+	if !strings.Contains(email, "@") || strings.ContainsAny(email, " \t\r\n/") {
+		return errors.BadRequest("This email address is invalid : " + email)
+	}
+	if !s.policy.Allows(email) {
+		return errors.Forbidden("This email domain is not allowed to sign up")
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return errors.BadRequest("The name is required")
+	}
+	if existing, err := s.userService.GetUser(ctx, email); err == nil {
+		if err := s.sendExisting(ctx, existing); err != nil {
+			s.logger.With(ctx, "user", existing.ID).Errorf("failed to tell about a sign-up attempt: %v", err)
+		}
+		return nil
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return err
+	}
+	created, err := s.userService.RegisterUser(ctx, user.RegisterUserRequest{
+		EmailAddress: email,
+		Name:         name,
+		Country:      strings.TrimSpace(req.Country),
+		AuthCode:     code,
+	})
+	if e, ok := err.(errors.ErrorResponse); ok && e.StatusCode() == http.StatusBadRequest {
+		// the only request RegisterUser rejects is one for the address of a user in the trash
+		s.logger.With(ctx).Info("sign-up attempted with the email address of a deleted user")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// the user can ask for the email again if it could not be sent
+	if err := s.send(ctx, created, code); err != nil {
+		s.logger.With(ctx, "user", created.ID).Errorf("failed to send the verification email: %v", err)
+	}
+	return nil
+}
+
+// ResendVerification sends a new verification link to a self-registered user who hasn't confirmed their
+// email address yet. It succeeds for any other address too, so that it doesn't reveal who signed up.
+func (s service) ResendVerification(ctx context.Context, req ResendRequest) error {
+	u, err := s.userService.GetUser(ctx, strings.TrimSpace(req.EmailAddress))
+	if err != nil || !u.SelfRegistered || u.IsAuth {
+		return nil
+	}
+	code, err := generateCode()
+	if err != nil {
+		return err
+	}
+	if u, err = s.userService.UpdateUser(ctx, u.Email, user.UpdateUserRequest{ResetAuth: true, AuthCode: code}, true); err != nil {
+		return err
+	}
+	return s.send(ctx, u, code)
+}
+
+// send emails the link confirming the email address of a user.
+func (s service) send(ctx context.Context, u user.User, code string) error {
+	var body bytes.Buffer
+	err := verificationEmail.Execute(&body, struct {
+		Name string
+		Link string
+	}{u.Name, s.publicURL + "/v1/userEmailConfirm/" + url.PathEscape(u.Email) + "/" + code})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, u.Email, "Please confirm your email address", body.String())
+}
+
+// sendExisting tells a user that somebody tried to sign up with their email address.
+func (s service) sendExisting(ctx context.Context, u user.User) error {
+	var body bytes.Buffer
+	if err := existingAccountEmail.Execute(&body, struct{ Name string }{u.Name}); err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, u.Email, "You already have an account", body.String())
+}
+
+// generateCode returns a random code confirming an email address.
+func generateCode() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,129 @@
+package registration
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+type mockUserService struct {
+	user.UserService
+	users   map[string]entity.Users
+	deleted map[string]bool
+}
+
+func (m *mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	if u, ok := m.users[email]; ok {
+		return user.User{Users: u}, nil
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+func (m *mockUserService) RegisterUser(ctx context.Context, req user.RegisterUserRequest) (user.User, error) {
+	if m.deleted[req.EmailAddress] {
+		return user.User{}, errors.BadRequest("A user with this email address is in the trash")
+	}
+	u := entity.Users{ID: entity.GenerateID(), Email: req.EmailAddress, Name: req.Name, Country: req.Country,
+		Role: user.VISITOR, AuthCode: req.AuthCode, SelfRegistered: true}
+	m.users[u.Email] = u
+	return user.User{Users: u}, nil
+}
+
+type email struct {
+	to, subject, body string
+}
+
+type mockMailer struct {
+	emails []email
+}
+
+func (m *mockMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.emails = append(m.emails, email{to, subject, body})
+	return nil
+}
+
+func newTestService(policy Policy) (Service, *mockUserService, *mockMailer) {
+	logger, _ := log.NewForTest()
+	users := &mockUserService{
+		users:   map[string]entity.Users{"ann@example.com": {ID: "u1", Email: "ann@example.com", Name: "Ann", IsAuth: true}},
+		deleted: map[string]bool{"bob@example.com": true},
+	}
+	mailer := &mockMailer{}
+	return NewService(policy, users, mailer, "https://ideas.example.com/", logger), users, mailer
+}
+
+func TestService_Register(t *testing.T) {
+	s, users, mailer := newTestService(Policy{Enabled: true})
+	ctx := context.Background()
+
+	err := s.Register(ctx, RegisterRequest{EmailAddress: " cid@example.com ", Name: " Cid ", Country: "FR"})
+	assert.Nil(t, err)
+	if assert.Contains(t, users.users, "cid@example.com") {
+		created := users.users["cid@example.com"]
+		assert.Equal(t, "Cid", created.Name)
+		assert.True(t, created.SelfRegistered)
+		assert.NotEmpty(t, created.AuthCode)
+		// the new user is sent the link confirming their email address
+		if assert.Len(t, mailer.emails, 1) {
+			assert.Equal(t, "cid@example.com", mailer.emails[0].to)
+			assert.Contains(t, mailer.emails[0].body,
+				"https://ideas.example.com/v1/userEmailConfirm/cid@example.com/"+created.AuthCode)
+		}
+	}
+}
+
+func TestService_Register_existing(t *testing.T) {
+	s, users, mailer := newTestService(Policy{Enabled: true})
+	ctx := context.Background()
+
+	// an address which belongs to a user succeeds like any other, and the user is told instead
+	err := s.Register(ctx, RegisterRequest{EmailAddress: "ann@example.com", Name: "Someone"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Ann", users.users["ann@example.com"].Name)
+	if assert.Len(t, mailer.emails, 1) {
+		assert.Equal(t, "ann@example.com", mailer.emails[0].to)
+		assert.NotContains(t, mailer.emails[0].body, "userEmailConfirm")
+	}
+
+	// so does the address of a user in the trash, which nobody is told about
+	err = s.Register(ctx, RegisterRequest{EmailAddress: "bob@example.com", Name: "Bob"})
+	assert.Nil(t, err)
+	assert.NotContains(t, users.users, "bob@example.com")
+	assert.Len(t, mailer.emails, 1)
+}
+
+func TestService_Register_invalid(t *testing.T) {
+	s, users, mailer := newTestService(Policy{Enabled: true, DeniedDomains: []string{"spam.example"}})
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		req    RegisterRequest
+		status int
+	}{
+		{"invalid email", RegisterRequest{EmailAddress: "cid", Name: "Cid"}, http.StatusBadRequest},
+		{"email with spaces", RegisterRequest{EmailAddress: "cid @example.com", Name: "Cid"}, http.StatusBadRequest},
+		{"denied domain", RegisterRequest{EmailAddress: "cid@spam.example", Name: "Cid"}, http.StatusForbidden},
+		{"missing name", RegisterRequest{EmailAddress: "cid@example.com", Name: "  "}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		err := s.Register(ctx, tt.req)
+		if assert.NotNil(t, err, tt.name) {
+			assert.Equal(t, tt.status, err.(errors.ErrorResponse).StatusCode(), tt.name)
+		}
+	}
+	assert.Len(t, users.users, 1)
+	assert.Empty(t, mailer.emails)
+
+	s, _, _ = newTestService(Policy{})
+	err := s.Register(ctx, RegisterRequest{EmailAddress: "cid@example.com", Name: "Cid"})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusForbidden, err.(errors.ErrorResponse).StatusCode())
+	}
+}
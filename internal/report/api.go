@@ -0,0 +1,82 @@
+package report
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"net/http"
+	"strconv"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Post("/idea/<id>/report", res.report)
+	r.Get("/reports", res.queue)
+	r.Post("/reports/<id>/resolve", res.resolve)
+	r.Post("/reports/<id>/dismiss", res.dismiss)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) report(c *routing.Context) error {
+	var input CreateReportRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	report, err := r.service.Report(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(report, http.StatusCreated)
+}
+
+func (r resource) queue(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Queue(c.Request.Context(), c.Query("requester_user_email"), c.Query("status"), page, perPage)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(pages)
+}
+
+func (r resource) resolve(c *routing.Context) error {
+	var input CloseReportsRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	item, err := r.service.Resolve(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(item)
+}
+
+func (r resource) dismiss(c *routing.Context) error {
+	var input CloseReportsRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	item, err := r.service.Dismiss(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(item)
+}
@@ -0,0 +1,123 @@
+package report
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Repository encapsulates the logic to access idea reports from the data source.
+type Repository interface {
+	// Create saves a new report in the storage.
+	Create(ctx context.Context, report entity.IdeaReport) error
+
+	// GetByReporter returns the report filed by the given reporter against the given idea.
+	GetByReporter(ctx context.Context, ideaID, reporterID string) (entity.IdeaReport, error)
+
+	// CountOpen returns the number of open reports against the given idea.
+	CountOpen(ctx context.Context, ideaID string) (int, error)
+
+	// ListByIdea returns the reports against the given idea having the given status.
+	ListByIdea(ctx context.Context, ideaID, status string) ([]entity.IdeaReport, error)
+
+	// CountReportedIdeas returns the number of ideas having reports with the given status.
+	CountReportedIdeas(ctx context.Context, status string) (int, error)
+
+	// QueryReportedIdeas returns the IDs of the ideas having reports with the given status, most reported first.
+	QueryReportedIdeas(ctx context.Context, status string, offset, limit int) ([]string, error)
+
+	// Close changes the status of all open reports against the given idea.
+	Close(ctx context.Context, ideaID, status, resolvedBy, note string, resolvedAt time.Time) error
+}
+
+// ideaNotDeleted excludes the reports against ideas in the trash.
+var ideaNotDeleted = dbx.NewExp("idea_id IN (SELECT id FROM idea WHERE deleted_at IS NULL)")
+
+// repository persists idea reports in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new report repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Create saves a new report record in the database.
+func (r repository) Create(ctx context.Context, report entity.IdeaReport) error {
+	return r.db.With(ctx).Model(&report).Insert()
+}
+
+// GetByReporter reads the report filed by the given reporter against the given idea from the database.
+func (r repository) GetByReporter(ctx context.Context, ideaID, reporterID string) (entity.IdeaReport, error) {
+	var report entity.IdeaReport
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"idea_id": ideaID, "reporter_id": reporterID}).
+		One(&report)
+	return report, err
+}
+
+// CountOpen returns the number of open reports against the given idea.
+func (r repository) CountOpen(ctx context.Context, ideaID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).
+		Select("COUNT(*)").
+		From("idea_report").
+		Where(dbx.HashExp{"idea_id": ideaID, "status": StatusOpen}).
+		Row(&count)
+	return count, err
+}
+
+// ListByIdea returns the reports against the given idea having the given status, newest first.
+func (r repository) ListByIdea(ctx context.Context, ideaID, status string) ([]entity.IdeaReport, error) {
+	var reports []entity.IdeaReport
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"idea_id": ideaID, "status": status}).
+		OrderBy("created_at DESC").
+		All(&reports)
+	return reports, err
+}
+
+// CountReportedIdeas returns the number of distinct ideas having reports with the given status.
+func (r repository) CountReportedIdeas(ctx context.Context, status string) (int, error) {
+	var count int
+	err := r.db.With(ctx).
+		Select("COUNT(DISTINCT idea_id)").
+		From("idea_report").
+		Where(dbx.And(dbx.HashExp{"status": status}, ideaNotDeleted)).
+		Row(&count)
+	return count, err
+}
+
+// QueryReportedIdeas returns the IDs of the ideas having reports with the given status.
+// Ideas with more reports come first.
+func (r repository) QueryReportedIdeas(ctx context.Context, status string, offset, limit int) ([]string, error) {
+	var ids []string
+	err := r.db.With(ctx).
+		Select("idea_id").
+		From("idea_report").
+		Where(dbx.And(dbx.HashExp{"status": status}, ideaNotDeleted)).
+		GroupBy("idea_id").
+		OrderBy("COUNT(*) DESC", "MAX(created_at) DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		Column(&ids)
+	return ids, err
+}
+
+// Close changes the status of all open reports against the given idea.
+func (r repository) Close(ctx context.Context, ideaID, status, resolvedBy, note string, resolvedAt time.Time) error {
+	_, err := r.db.With(ctx).Update("idea_report", dbx.Params{
+		"status":          status,
+		"resolved_by":     resolvedBy,
+		"resolution_note": note,
+		"resolved_at":     resolvedAt,
+	}, dbx.HashExp{"idea_id": ideaID, "status": StatusOpen}).Execute()
+	return err
+}
@@ -0,0 +1,256 @@
+package report
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/idea"
+	"github.com/qiangxue/go-rest-api/internal/reputation"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"time"
+)
+
+// The statuses of a report.
+const (
+	StatusOpen      = "open"
+	StatusResolved  = "resolved"
+	StatusDismissed = "dismissed"
+)
+
+// The moderation decisions recorded when reports are closed.
+const (
+	decisionResolve  = "resolve_reports"
+	decisionDismiss  = "dismiss_reports"
+	decisionAutoHide = "auto_hide"
+)
+
+// reasons lists the categories a report may be filed under.
+var reasons = []string{"spam", "offensive", "duplicate", "off_topic", "other"}
+
+// Service encapsulates usecase logic for idea reports.
+type Service interface {
+	Report(ctx context.Context, ideaID string, req CreateReportRequest) (entity.IdeaReport, error)
+	Queue(ctx context.Context, requesterEmail, status string, page, perPage int) (*pagination.Pages, error)
+	Resolve(ctx context.Context, ideaID string, req CloseReportsRequest) (ReportedIdea, error)
+	Dismiss(ctx context.Context, ideaID string, req CloseReportsRequest) (ReportedIdea, error)
+}
+
+// CreateReportRequest represents a request to report an idea.
+type CreateReportRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	// one of spam, offensive, duplicate, off_topic, other
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+// CloseReportsRequest represents a moderator's decision on the open reports against an idea.
+type CloseReportsRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	Note               string `json:"note"`
+}
+
+// DecisionRecorder records the moderation decisions made on reported ideas.
+type DecisionRecorder interface {
+	Record(ctx context.Context, ideaID, moderatorID, action, note string) error
+}
+
+// ReportedIdea represents an idea in the moderation queue together with the reports filed against it.
+type ReportedIdea struct {
+	entity.Idea
+	Reports []entity.IdeaReport `json:"reports"`
+}
+
+type service struct {
+	repo              Repository
+	ideaRepo          idea.Repository
+	userService       user.UserService
+	autoHideThreshold int
+	recorder          DecisionRecorder
+	reputation        reputation.Policy
+	transaction       dbcontext.TransactionFunc
+	logger            log.Logger
+}
+
+// NewService creates a new report service.
+// An idea is hidden once it has autoHideThreshold open reports against it.
+// Every decision made on the reports, including hiding an idea automatically, is passed to the recorder,
+// in the same transaction as the decision.
+// Users may report ideas once the reputation policy gives them the capability.
+func NewService(repo Repository, ideaRepo idea.Repository, userService user.UserService, autoHideThreshold int,
+	recorder DecisionRecorder, reputation reputation.Policy, transaction dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, ideaRepo, userService, autoHideThreshold, recorder, reputation, transaction, logger}
+}
+
+// Report files a report against the idea with the specified ID.
+// A user may only report the same idea once.
+func (s service) Report(ctx context.Context, ideaID string, req CreateReportRequest) (entity.IdeaReport, error) {
+	reporter, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return entity.IdeaReport{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	if err := user.CheckVerified(reporter); err != nil {
+		return entity.IdeaReport{}, err
+	}
+	if err := s.reputation.Check(reporter, reputation.CapabilityReport); err != nil {
+		return entity.IdeaReport{}, err
+	}
+	if !isValidReason(req.Reason) {
+		return entity.IdeaReport{}, errors.BadRequest("This report reason doesn't exists in the system : " + req.Reason)
+	}
+
+	target, err := s.ideaRepo.Get(ctx, ideaID)
+	if err != nil {
+		return entity.IdeaReport{}, err
+	}
+
+	if _, err := s.repo.GetByReporter(ctx, ideaID, reporter.ID); err == nil {
+		return entity.IdeaReport{}, errors.BadRequest("User has already reported this idea")
+	} else if err != sql.ErrNoRows {
+		return entity.IdeaReport{}, err
+	}
+
+	report := entity.IdeaReport{
+		ID:         entity.GenerateID(),
+		IdeaID:     ideaID,
+		ReporterID: reporter.ID,
+		Reason:     req.Reason,
+		Details:    req.Details,
+		Status:     StatusOpen,
+		CreatedAt:  time.Now(),
+	}
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, report); err != nil {
+			return err
+		}
+		if target.BadFlag || s.autoHideThreshold <= 0 {
+			return nil
+		}
+		count, err := s.repo.CountOpen(ctx, ideaID)
+		if err != nil || count < s.autoHideThreshold {
+			return err
+		}
+		s.logger.With(ctx, "idea", ideaID).Infof("hiding idea after %d reports", count)
+		target.BadFlag = true
+		target.UpdatedAt = time.Now()
+		if err := s.ideaRepo.Update(ctx, target); err != nil {
+			return err
+		}
+		// nobody decided to hide the idea, so no moderator is recorded
+		return s.recorder.Record(ctx, ideaID, "", decisionAutoHide, "")
+	})
+	if err != nil {
+		return entity.IdeaReport{}, err
+	}
+	return report, nil
+}
+
+// Queue returns a page of the ideas having reports with the given status. Only admins may view the queue.
+func (s service) Queue(ctx context.Context, requesterEmail, status string, page, perPage int) (*pagination.Pages, error) {
+	if err := s.checkAdmin(ctx, requesterEmail); err != nil {
+		return nil, err
+	}
+	if status == "" {
+		status = StatusOpen
+	}
+
+	count, err := s.repo.CountReportedIdeas(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	ids, err := s.repo.QueryReportedIdeas(ctx, status, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+
+	items := []ReportedIdea{}
+	for _, id := range ids {
+		item, err := s.reportedIdea(ctx, id, status)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	pages.Items = items
+	return pages, nil
+}
+
+// Resolve upholds the open reports against an idea and keeps the idea hidden.
+func (s service) Resolve(ctx context.Context, ideaID string, req CloseReportsRequest) (ReportedIdea, error) {
+	return s.close(ctx, ideaID, req, StatusResolved, decisionResolve, true)
+}
+
+// Dismiss rejects the open reports against an idea and makes the idea visible again.
+func (s service) Dismiss(ctx context.Context, ideaID string, req CloseReportsRequest) (ReportedIdea, error) {
+	return s.close(ctx, ideaID, req, StatusDismissed, decisionDismiss, false)
+}
+
+func (s service) close(ctx context.Context, ideaID string, req CloseReportsRequest, status, decision string, hide bool) (ReportedIdea, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return ReportedIdea{}, err
+	}
+	moderator, err := s.userService.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return ReportedIdea{}, err
+	}
+
+	target, err := s.ideaRepo.Get(ctx, ideaID)
+	if err != nil {
+		return ReportedIdea{}, err
+	}
+
+	now := time.Now()
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Close(ctx, ideaID, status, moderator.ID, req.Note, now); err != nil {
+			return err
+		}
+		if target.BadFlag != hide {
+			target.BadFlag = hide
+			target.UpdatedAt = now
+			if err := s.ideaRepo.Update(ctx, target); err != nil {
+				return err
+			}
+		}
+		return s.recorder.Record(ctx, ideaID, moderator.ID, decision, req.Note)
+	})
+	if err != nil {
+		return ReportedIdea{}, err
+	}
+	return s.reportedIdea(ctx, ideaID, status)
+}
+
+func (s service) reportedIdea(ctx context.Context, ideaID, status string) (ReportedIdea, error) {
+	target, err := s.ideaRepo.Get(ctx, ideaID)
+	if err != nil {
+		return ReportedIdea{}, err
+	}
+	reports, err := s.repo.ListByIdea(ctx, ideaID, status)
+	if err != nil {
+		return ReportedIdea{}, err
+	}
+	return ReportedIdea{target, reports}, nil
+}
+
+func (s service) checkAdmin(ctx context.Context, requesterEmail string) error {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return errors.InternalServerError("Requester User doesn't exist")
+	}
+	if !user.IsAdmin(requester.Role) {
+		return errors.Forbidden("Requester User doesn't have permission to moderate ideas")
+	}
+	return nil
+}
+
+func isValidReason(reason string) bool {
+	for _, r := range reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package report
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/idea"
+	"github.com/qiangxue/go-rest-api/internal/reputation"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type mockRepository struct {
+	Repository
+	reports []entity.IdeaReport
+}
+
+func (m *mockRepository) Create(ctx context.Context, report entity.IdeaReport) error {
+	m.reports = append(m.reports, report)
+	return nil
+}
+
+func (m *mockRepository) GetByReporter(ctx context.Context, ideaID, reporterID string) (entity.IdeaReport, error) {
+	for _, report := range m.reports {
+		if report.IdeaID == ideaID && report.ReporterID == reporterID {
+			return report, nil
+		}
+	}
+	return entity.IdeaReport{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CountOpen(ctx context.Context, ideaID string) (int, error) {
+	count := 0
+	for _, report := range m.reports {
+		if report.IdeaID == ideaID && report.Status == StatusOpen {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type mockIdeaRepository struct {
+	idea.Repository
+	ideas map[string]entity.Idea
+}
+
+func (m *mockIdeaRepository) Get(ctx context.Context, id string) (entity.Idea, error) {
+	if item, ok := m.ideas[id]; ok {
+		return item, nil
+	}
+	return entity.Idea{}, sql.ErrNoRows
+}
+
+func (m *mockIdeaRepository) Update(ctx context.Context, item entity.Idea) error {
+	m.ideas[item.ID] = item
+	return nil
+}
+
+type mockUserService struct {
+	user.UserService
+	users []entity.Users
+}
+
+func (m mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	for _, u := range m.users {
+		if u.Email == email {
+			return user.User{Users: u}, nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+type decision struct {
+	ideaID, moderatorID, action string
+}
+
+type mockRecorder struct {
+	decisions []decision
+}
+
+func (m *mockRecorder) Record(ctx context.Context, ideaID, moderatorID, action, note string) error {
+	m.decisions = append(m.decisions, decision{ideaID, moderatorID, action})
+	return nil
+}
+
+func newTestService(autoHideThreshold int) (Service, *mockRepository, *mockIdeaRepository, *mockRecorder) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	ideaRepo := &mockIdeaRepository{ideas: map[string]entity.Idea{"i1": {ID: "i1", CreatedAt: time.Now()}}}
+	users := mockUserService{users: []entity.Users{
+		{ID: "u1", Email: "ann@example.com", Role: user.VISITOR, Score: 10},
+		{ID: "u2", Email: "bob@example.com", Role: user.VISITOR, Score: 10},
+		{ID: "u3", Email: "cid@example.com", Role: user.VISITOR, Score: 10},
+		{ID: "u4", Email: "new@example.com", Role: user.VISITOR},
+		{ID: "u5", Email: "unverified@example.com", Role: user.VISITOR, Score: 10, SelfRegistered: true},
+	}}
+	recorder := &mockRecorder{}
+	transaction := func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	s := NewService(repo, ideaRepo, users, autoHideThreshold, recorder, reputation.NewPolicy(reputation.Points{}, nil),
+		transaction, logger)
+	return s, repo, ideaRepo, recorder
+}
+
+func TestService_Report(t *testing.T) {
+	s, repo, _, _ := newTestService(3)
+	ctx := context.Background()
+
+	report, err := s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: "ann@example.com", Reason: "spam", Details: "ads"})
+	assert.Nil(t, err)
+	assert.Equal(t, "i1", report.IdeaID)
+	assert.Equal(t, "u1", report.ReporterID)
+	assert.Equal(t, StatusOpen, report.Status)
+	assert.Len(t, repo.reports, 1)
+
+	// a user may only report an idea once
+	_, err = s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: "ann@example.com", Reason: "offensive"})
+	assert.NotNil(t, err)
+
+	// the reason must be known
+	_, err = s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: "bob@example.com", Reason: "boring"})
+	assert.NotNil(t, err)
+	_, err = s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: "bob@example.com"})
+	assert.NotNil(t, err)
+
+	// the reporter must be verified and have the reputation to report
+	_, err = s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: "unverified@example.com", Reason: "spam"})
+	assert.NotNil(t, err)
+	_, err = s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: "new@example.com", Reason: "spam"})
+	assert.NotNil(t, err)
+
+	_, err = s.Report(ctx, "unknown", CreateReportRequest{RequesterUserEmail: "bob@example.com", Reason: "spam"})
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Len(t, repo.reports, 1)
+}
+
+func TestService_Report_autoHide(t *testing.T) {
+	s, _, ideaRepo, recorder := newTestService(2)
+	ctx := context.Background()
+
+	_, err := s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: "ann@example.com", Reason: "spam"})
+	assert.Nil(t, err)
+	assert.False(t, ideaRepo.ideas["i1"].BadFlag)
+	assert.Empty(t, recorder.decisions)
+
+	// the idea is hidden once it has as many open reports as the threshold, without a moderator
+	_, err = s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: "bob@example.com", Reason: "off_topic"})
+	assert.Nil(t, err)
+	assert.True(t, ideaRepo.ideas["i1"].BadFlag)
+	assert.Equal(t, []decision{{"i1", "", decisionAutoHide}}, recorder.decisions)
+
+	// an idea already hidden isn't hidden again
+	_, err = s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: "cid@example.com", Reason: "spam"})
+	assert.Nil(t, err)
+	assert.Len(t, recorder.decisions, 1)
+}
+
+func TestService_Report_autoHideDisabled(t *testing.T) {
+	s, _, ideaRepo, recorder := newTestService(0)
+	ctx := context.Background()
+
+	for _, email := range []string{"ann@example.com", "bob@example.com", "cid@example.com"} {
+		_, err := s.Report(ctx, "i1", CreateReportRequest{RequesterUserEmail: email, Reason: "spam"})
+		assert.Nil(t, err)
+	}
+	assert.False(t, ideaRepo.ideas["i1"].BadFlag)
+	assert.Empty(t, recorder.decisions)
+}
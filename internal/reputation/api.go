@@ -0,0 +1,64 @@
+package reputation
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"strconv"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/me/reputation", res.getOwn)
+	r.Get("/user/<email>/reputation", res.get)
+	r.Get("/leaderboard", res.leaderboard)
+	r.Get("/leaderboard/countries", res.countries)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) getOwn(c *routing.Context) error {
+	reputation, err := r.service.Get(c.Request.Context(), c.Query("requester_user_email"))
+	if err != nil {
+		return err
+	}
+	return c.Write(reputation)
+}
+
+func (r resource) get(c *routing.Context) error {
+	reputation, err := r.service.Get(c.Request.Context(), c.Param("email"))
+	if err != nil {
+		return err
+	}
+	return c.Write(reputation)
+}
+
+func (r resource) leaderboard(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Leaderboard(c.Request.Context(), LeaderboardRequest{
+		Period:  c.Query("period"),
+		Country: c.Query("country"),
+	}, page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
+
+func (r resource) countries(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Countries(c.Request.Context(), c.Query("period"), page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
@@ -0,0 +1,49 @@
+package reputation
+
+// Stats represents the contributions of a user that badges are awarded for.
+type Stats struct {
+	IdeasCreated  int
+	VotesReceived int
+	IdeasAccepted int
+	VotesCast     int
+}
+
+// Badge represents a badge awarded to users who reach a milestone.
+type Badge struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	earned      func(Stats) bool
+}
+
+// Badges lists the badges users can earn.
+var Badges = []Badge{
+	{"first_vote", "Voter", "Voted on an idea", func(s Stats) bool { return s.VotesCast >= 1 }},
+	{"engaged", "Engaged", "Voted on 50 ideas", func(s Stats) bool { return s.VotesCast >= 50 }},
+	{"first_idea", "Ideator", "Submitted an idea", func(s Stats) bool { return s.IdeasCreated >= 1 }},
+	{"prolific", "Prolific", "Submitted 10 ideas", func(s Stats) bool { return s.IdeasCreated >= 10 }},
+	{"popular", "Popular", "Received 50 votes", func(s Stats) bool { return s.VotesReceived >= 50 }},
+	{"accepted", "Accepted", "Had an idea accepted", func(s Stats) bool { return s.IdeasAccepted >= 1 }},
+	{"visionary", "Visionary", "Had 5 ideas accepted", func(s Stats) bool { return s.IdeasAccepted >= 5 }},
+}
+
+// findBadge returns the badge with the given ID.
+func findBadge(id string) (Badge, bool) {
+	for _, badge := range Badges {
+		if badge.ID == id {
+			return badge, true
+		}
+	}
+	return Badge{}, false
+}
+
+// earnedBadges returns the IDs of the badges earned with the given stats.
+func earnedBadges(stats Stats) []string {
+	var ids []string
+	for _, badge := range Badges {
+		if badge.earned(stats) {
+			ids = append(ids, badge.ID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,108 @@
+package reputation
+
+import (
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"sort"
+)
+
+// Capabilities unlocked by reputation levels. Admins have every capability whatever their score.
+const (
+	// CapabilityReport lets users report ideas to the moderators.
+	CapabilityReport = "report"
+	// CapabilityCreateIdea lets users who aren't admins create ideas.
+	CapabilityCreateIdea = "create_idea"
+)
+
+// Capabilities are all the capabilities reputation levels can unlock.
+var Capabilities = []string{CapabilityReport, CapabilityCreateIdea}
+
+// Points are the points a user earns for each kind of contribution.
+type Points struct {
+	// for each idea submitted by the user
+	IdeaCreated int
+	// for each vote the ideas of the user receive
+	VoteReceived int
+	// for each idea of the user that is accepted
+	IdeaAccepted int
+	// for each vote the user casts
+	VoteCast int
+}
+
+// Level represents a reputation level, reached at a minimum score, and the capabilities it unlocks.
+type Level struct {
+	Name         string   `json:"name"`
+	MinScore     int      `json:"min_score"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// DefaultLevels are the reputation levels used unless others are configured.
+var DefaultLevels = []Level{
+	{Name: "Newcomer", MinScore: 0, Capabilities: []string{}},
+	{Name: "Member", MinScore: 5, Capabilities: []string{CapabilityReport}},
+	{Name: "Contributor", MinScore: 25, Capabilities: []string{CapabilityCreateIdea}},
+	{Name: "Champion", MinScore: 100, Capabilities: []string{}},
+}
+
+// Policy decides the points users earn and the capabilities their score unlocks.
+type Policy struct {
+	Points Points
+	// the levels, lowest first. A level keeps the capabilities of the levels below it.
+	Levels []Level
+}
+
+// NewPolicy creates a reputation policy. The default levels are used if levels is empty.
+func NewPolicy(points Points, levels []Level) Policy {
+	if len(levels) == 0 {
+		levels = DefaultLevels
+	}
+	sorted := append([]Level(nil), levels...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].MinScore < sorted[j].MinScore })
+	return Policy{points, sorted}
+}
+
+// Level returns the level reached with the given score, and the next level if any. A score below every level
+// gets an unnamed level without capabilities.
+func (p Policy) Level(score int) (Level, *Level) {
+	current := Level{Capabilities: []string{}}
+	for i, level := range p.Levels {
+		if score < level.MinScore {
+			next := p.Levels[i]
+			return current, &next
+		}
+		current = level
+	}
+	return current, nil
+}
+
+// Capabilities returns the capabilities unlocked with the given score, in the order of the levels.
+func (p Policy) Capabilities(score int) []string {
+	capabilities := []string{}
+	for _, level := range p.Levels {
+		if score < level.MinScore {
+			break
+		}
+		capabilities = append(capabilities, level.Capabilities...)
+	}
+	return capabilities
+}
+
+// Check returns an error unless the user has the given capability.
+func (p Policy) Check(u user.User, capability string) error {
+	if user.IsAdmin(u.Role) {
+		return nil
+	}
+	for _, c := range p.Capabilities(u.Score) {
+		if c == capability {
+			return nil
+		}
+	}
+	for _, level := range p.Levels {
+		for _, c := range level.Capabilities {
+			if c == capability {
+				return errors.Forbidden("Requester User must reach the reputation level " + level.Name + " to do this")
+			}
+		}
+	}
+	return errors.Forbidden("Requester User doesn't have required permission")
+}
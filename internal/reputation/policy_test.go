@@ -0,0 +1,49 @@
+package reputation
+
+import (
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicy_Level(t *testing.T) {
+	policy := NewPolicy(Points{}, []Level{
+		{Name: "Expert", MinScore: 50, Capabilities: []string{CapabilityCreateIdea}},
+		{Name: "Member", MinScore: 10, Capabilities: []string{CapabilityReport}},
+	})
+
+	level, next := policy.Level(5)
+	assert.Equal(t, "", level.Name)
+	assert.Equal(t, "Member", next.Name)
+
+	level, next = policy.Level(10)
+	assert.Equal(t, "Member", level.Name)
+	assert.Equal(t, "Expert", next.Name)
+
+	level, next = policy.Level(80)
+	assert.Equal(t, "Expert", level.Name)
+	assert.Nil(t, next)
+
+	assert.Equal(t, []string{}, policy.Capabilities(5))
+	assert.Equal(t, []string{CapabilityReport, CapabilityCreateIdea}, policy.Capabilities(50))
+}
+
+func TestPolicy_Check(t *testing.T) {
+	policy := NewPolicy(Points{}, nil)
+	visitor := func(score int) user.User {
+		return user.User{Users: entity.Users{Role: user.VISITOR, Score: score}}
+	}
+
+	assert.NotNil(t, policy.Check(visitor(0), CapabilityReport))
+	assert.Nil(t, policy.Check(visitor(5), CapabilityReport))
+	assert.NotNil(t, policy.Check(visitor(5), CapabilityCreateIdea))
+	assert.Nil(t, policy.Check(visitor(25), CapabilityCreateIdea))
+	assert.Nil(t, policy.Check(user.User{Users: entity.Users{Role: user.ADMIN}}, CapabilityCreateIdea))
+	assert.NotNil(t, policy.Check(visitor(1000), "unknown"))
+}
+
+func TestEarnedBadges(t *testing.T) {
+	assert.Empty(t, earnedBadges(Stats{}))
+	assert.Equal(t, []string{"first_vote", "first_idea", "accepted"}, earnedBadges(Stats{VotesCast: 1, IdeasCreated: 3, IdeasAccepted: 1}))
+}
@@ -0,0 +1,193 @@
+package reputation
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"strings"
+	"time"
+)
+
+// Repository encapsulates the logic to access reputation data from the data source.
+type Repository interface {
+	// RecordEvent saves a score event and adds its points to the score of its user, unless the same event
+	// already earned the user points of the same kind. It reports whether the event was recorded.
+	RecordEvent(ctx context.Context, e entity.ScoreEvent) (bool, error)
+
+	// Stats returns the contributions of the specified user that badges are awarded for.
+	Stats(ctx context.Context, userID string) (Stats, error)
+
+	// Badges returns the badges of the specified user, oldest first.
+	Badges(ctx context.Context, userID string) ([]entity.UserBadge, error)
+
+	// AwardBadge saves a badge of a user, unless the user already has it.
+	AwardBadge(ctx context.Context, badge entity.UserBadge) error
+
+	// CountStandings returns the number of users who earned points matching the filter.
+	CountStandings(ctx context.Context, filter Filter) (int, error)
+
+	// QueryStandings returns the users who earned the most points matching the filter, most points first.
+	QueryStandings(ctx context.Context, filter Filter, offset, limit int) ([]Standing, error)
+
+	// CountCountries returns the number of countries whose users earned points matching the filter.
+	CountCountries(ctx context.Context, filter Filter) (int, error)
+
+	// QueryCountries returns the countries whose users earned the most points matching the filter, most points first.
+	QueryCountries(ctx context.Context, filter Filter, offset, limit int) ([]CountryStanding, error)
+}
+
+// Filter represents the score events a leaderboard is computed from. Empty conditions are ignored.
+type Filter struct {
+	// the events earned at or after this time
+	Since *time.Time
+	// the events earned by the users of this country
+	Country string
+}
+
+// repository persists reputation data in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new reputation repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// RecordEvent saves a score event in the database and adds its points to the score of its user,
+// unless the same event already earned the user points of the same kind.
+func (r repository) RecordEvent(ctx context.Context, e entity.ScoreEvent) (bool, error) {
+	result, err := r.db.With(ctx).
+		NewQuery("INSERT INTO score_event (id, user_id, event_id, kind, points, created_at) " +
+			"VALUES ({:id}, {:user_id}, {:event_id}, {:kind}, {:points}, {:created_at}) " +
+			"ON CONFLICT (event_id, user_id, kind) DO NOTHING").
+		Bind(dbx.Params{"id": e.ID, "user_id": e.UserID, "event_id": e.EventID, "kind": e.Kind, "points": e.Points,
+			"created_at": e.CreatedAt}).
+		Execute()
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	_, err = r.db.With(ctx).
+		NewQuery("UPDATE users SET score = score + {:points} WHERE id = {:id}").
+		Bind(dbx.Params{"points": e.Points, "id": e.UserID}).
+		Execute()
+	return err == nil, err
+}
+
+// Stats counts the contributions of the specified user in the database. Drafts and the ideas in the trash are not counted.
+func (r repository) Stats(ctx context.Context, userID string) (Stats, error) {
+	var stats Stats
+	err := r.db.With(ctx).
+		NewQuery("SELECT " +
+			"(SELECT COUNT(*) FROM idea WHERE author_id = {:id} AND status <> 'draft' AND deleted_at IS NULL) AS ideas_created, " +
+			"(SELECT COUNT(*) FROM idea_vote v JOIN idea i ON i.id = v.idea_id WHERE i.author_id = {:id} AND i.deleted_at IS NULL) AS votes_received, " +
+			"(SELECT COUNT(DISTINCT c.idea_id) FROM idea_status_change c JOIN idea i ON i.id = c.idea_id " +
+			"WHERE i.author_id = {:id} AND c.to_status = 'accepted' AND i.deleted_at IS NULL) AS ideas_accepted, " +
+			"(SELECT COUNT(*) FROM idea_vote WHERE voter_id = {:id}) AS votes_cast").
+		Bind(dbx.Params{"id": userID}).
+		One(&stats)
+	return stats, err
+}
+
+// Badges reads the badges of the specified user from the database, oldest first.
+func (r repository) Badges(ctx context.Context, userID string) ([]entity.UserBadge, error) {
+	var badges []entity.UserBadge
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"user_id": userID}).
+		OrderBy("awarded_at", "badge").
+		All(&badges)
+	return badges, err
+}
+
+// AwardBadge saves a badge of a user in the database, unless the user already has it.
+func (r repository) AwardBadge(ctx context.Context, badge entity.UserBadge) error {
+	_, err := r.db.With(ctx).
+		NewQuery("INSERT INTO user_badge (user_id, badge, awarded_at) VALUES ({:user_id}, {:badge}, {:awarded_at}) " +
+			"ON CONFLICT (user_id, badge) DO NOTHING").
+		Bind(dbx.Params{"user_id": badge.UserID, "badge": badge.Badge, "awarded_at": badge.AwardedAt}).
+		Execute()
+	return err
+}
+
+// CountStandings returns the number of users outside the trash who earned points matching the filter.
+func (r repository) CountStandings(ctx context.Context, filter Filter) (int, error) {
+	where, params := filterSQL(filter)
+	var count int
+	err := r.db.With(ctx).
+		NewQuery("SELECT COUNT(*) FROM (SELECT e.user_id FROM score_event e " +
+			"JOIN users u ON u.id = e.user_id AND u.deleted_at IS NULL" + where +
+			" GROUP BY e.user_id HAVING SUM(e.points) > 0) t").
+		Bind(params).
+		Row(&count)
+	return count, err
+}
+
+// QueryStandings returns the users outside the trash who earned the most points matching the filter.
+// Users with the same points share the same rank.
+func (r repository) QueryStandings(ctx context.Context, filter Filter, offset, limit int) ([]Standing, error) {
+	where, params := filterSQL(filter)
+	params["offset"], params["limit"] = offset, limit
+	var standings []Standing
+	err := r.db.With(ctx).
+		NewQuery("SELECT RANK() OVER (ORDER BY SUM(e.points) DESC) AS rank, u.id AS user_id, u.name, u.country, " +
+			"u.score, SUM(e.points) AS points FROM score_event e " +
+			"JOIN users u ON u.id = e.user_id AND u.deleted_at IS NULL" + where +
+			" GROUP BY u.id HAVING SUM(e.points) > 0 ORDER BY points DESC, u.id OFFSET {:offset} LIMIT {:limit}").
+		Bind(params).
+		All(&standings)
+	return standings, err
+}
+
+// CountCountries returns the number of countries whose users outside the trash earned points matching the filter.
+func (r repository) CountCountries(ctx context.Context, filter Filter) (int, error) {
+	where, params := filterSQL(filter)
+	var count int
+	err := r.db.With(ctx).
+		NewQuery("SELECT COUNT(*) FROM (SELECT u.country FROM score_event e " +
+			"JOIN users u ON u.id = e.user_id AND u.deleted_at IS NULL AND u.country <> ''" + where +
+			" GROUP BY u.country HAVING SUM(e.points) > 0) t").
+		Bind(params).
+		Row(&count)
+	return count, err
+}
+
+// QueryCountries returns the countries whose users outside the trash earned the most points matching the filter.
+// Countries with the same points share the same rank.
+func (r repository) QueryCountries(ctx context.Context, filter Filter, offset, limit int) ([]CountryStanding, error) {
+	where, params := filterSQL(filter)
+	params["offset"], params["limit"] = offset, limit
+	var standings []CountryStanding
+	err := r.db.With(ctx).
+		NewQuery("SELECT RANK() OVER (ORDER BY SUM(e.points) DESC) AS rank, u.country, SUM(e.points) AS points, " +
+			"COUNT(DISTINCT e.user_id) AS users FROM score_event e " +
+			"JOIN users u ON u.id = e.user_id AND u.deleted_at IS NULL AND u.country <> ''" + where +
+			" GROUP BY u.country HAVING SUM(e.points) > 0 ORDER BY points DESC, u.country OFFSET {:offset} LIMIT {:limit}").
+		Bind(params).
+		All(&standings)
+	return standings, err
+}
+
+// filterSQL returns the WHERE clause matching the score events of the filter, and its parameters.
+func filterSQL(filter Filter) (string, dbx.Params) {
+	var conditions []string
+	params := dbx.Params{}
+	if filter.Since != nil {
+		conditions = append(conditions, "e.created_at >= {:since}")
+		params["since"] = *filter.Since
+	}
+	if filter.Country != "" {
+		conditions = append(conditions, "u.country = {:country}")
+		params["country"] = filter.Country
+	}
+	if len(conditions) == 0 {
+		return "", params
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), params
+}
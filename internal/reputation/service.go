@@ -0,0 +1,225 @@
+// Package reputation rewards contributions with points, reputation levels that unlock capabilities, and badges.
+package reputation
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"time"
+)
+
+// Service encapsulates usecase logic for reputation.
+type Service interface {
+	Get(ctx context.Context, email string) (Reputation, error)
+	Leaderboard(ctx context.Context, req LeaderboardRequest, page, perPage int) (*pagination.Pages, error)
+	Countries(ctx context.Context, period string, page, perPage int) (*pagination.Pages, error)
+	Award(ctx context.Context, e entity.ScoreEvent) error
+}
+
+// Kinds of contributions that earn points.
+const (
+	KindIdeaCreated  = "idea_created"
+	KindVoteReceived = "vote_received"
+	KindIdeaAccepted = "idea_accepted"
+	KindVoteCast     = "vote_cast"
+)
+
+// Periods of the leaderboards. Weeks start on Monday and periods start at midnight UTC.
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodAll   = "all"
+)
+
+// LeaderboardRequest represents a request for the leaderboard of users.
+type LeaderboardRequest struct {
+	// one of "week", "month" or "all". Defaults to "all".
+	Period string
+	// only the users of this country are ranked if not empty
+	Country string
+}
+
+// Reputation represents the reputation of a user.
+type Reputation struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Score  int    `json:"score"`
+	Level  Level  `json:"level"`
+	// the next level to reach, if any
+	NextLevel    *Level        `json:"next_level,omitempty"`
+	Capabilities []string      `json:"capabilities"`
+	Badges       []EarnedBadge `json:"badges"`
+}
+
+// EarnedBadge represents a badge earned by a user.
+type EarnedBadge struct {
+	Badge
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+// Standing represents the position of a user on the leaderboard. Users with the same points share the same rank.
+type Standing struct {
+	Rank    int    `json:"rank"`
+	UserID  string `json:"user_id"`
+	Name    string `json:"name"`
+	Country string `json:"country"`
+	// the points earned during the period of the leaderboard
+	Points int `json:"points"`
+	// the points earned so far, which decide the level
+	Score int    `json:"score"`
+	Level string `json:"level"`
+}
+
+// CountryStanding represents the position of a country on the leaderboard of countries.
+type CountryStanding struct {
+	Rank    int    `json:"rank"`
+	Country string `json:"country"`
+	// the points earned by the users of the country during the period of the leaderboard
+	Points int `json:"points"`
+	// the number of users of the country who earned points during the period
+	Users int `json:"users"`
+}
+
+type service struct {
+	repo        Repository
+	userService user.UserService
+	policy      Policy
+	transaction dbcontext.TransactionFunc
+	logger      log.Logger
+}
+
+// NewService creates a new reputation service.
+func NewService(repo Repository, userService user.UserService, policy Policy, transaction dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, userService, policy, transaction, logger}
+}
+
+// Get returns the reputation of the user with the specified email address.
+func (s service) Get(ctx context.Context, email string) (Reputation, error) {
+	u, err := s.userService.GetUser(ctx, email)
+	if err != nil {
+		return Reputation{}, errors.NotFound("user doesn't exists")
+	}
+	badges, err := s.repo.Badges(ctx, u.ID)
+	if err != nil {
+		return Reputation{}, err
+	}
+	level, next := s.policy.Level(u.Score)
+	reputation := Reputation{
+		UserID:       u.ID,
+		Name:         u.Name,
+		Score:        u.Score,
+		Level:        level,
+		NextLevel:    next,
+		Capabilities: s.policy.Capabilities(u.Score),
+		Badges:       []EarnedBadge{},
+	}
+	for _, b := range badges {
+		// badges which are no longer defined are not shown
+		if badge, ok := findBadge(b.Badge); ok {
+			reputation.Badges = append(reputation.Badges, EarnedBadge{badge, b.AwardedAt})
+		}
+	}
+	return reputation, nil
+}
+
+// Leaderboard returns a page of the users who earned the most points during the period of the request.
+func (s service) Leaderboard(ctx context.Context, req LeaderboardRequest, page, perPage int) (*pagination.Pages, error) {
+	since, err := periodStart(req.Period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	filter := Filter{Since: since, Country: req.Country}
+	count, err := s.repo.CountStandings(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	standings, err := s.repo.QueryStandings(ctx, filter, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	for i := range standings {
+		level, _ := s.policy.Level(standings[i].Score)
+		standings[i].Level = level.Name
+	}
+	if standings == nil {
+		standings = []Standing{}
+	}
+	pages.Items = standings
+	return pages, nil
+}
+
+// Countries returns a page of the countries whose users earned the most points during the given period.
+func (s service) Countries(ctx context.Context, period string, page, perPage int) (*pagination.Pages, error) {
+	since, err := periodStart(period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	filter := Filter{Since: since}
+	count, err := s.repo.CountCountries(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	standings, err := s.repo.QueryCountries(ctx, filter, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	if standings == nil {
+		standings = []CountryStanding{}
+	}
+	pages.Items = standings
+	return pages, nil
+}
+
+// Award records the points earned by a user and awards the badges they have just earned. The points of
+// an event that was already recorded are not added again. Nothing happens if the user was deleted or erased since.
+func (s service) Award(ctx context.Context, e entity.ScoreEvent) error {
+	if _, err := s.userService.GetUserByID(ctx, e.UserID); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return s.transaction(ctx, func(ctx context.Context) error {
+		if e.Points != 0 {
+			e.ID = entity.GenerateID()
+			if _, err := s.repo.RecordEvent(ctx, e); err != nil {
+				return err
+			}
+		}
+		stats, err := s.repo.Stats(ctx, e.UserID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, id := range earnedBadges(stats) {
+			if err := s.repo.AwardBadge(ctx, entity.UserBadge{UserID: e.UserID, Badge: id, AwardedAt: now}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// periodStart returns the start of the current period of the given name at the given time, or nil for all time.
+func periodStart(period string, now time.Time) (*time.Time, error) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var start time.Time
+	switch period {
+	case "", PeriodAll:
+		return nil, nil
+	case PeriodWeek:
+		start = today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	case PeriodMonth:
+		start = today.AddDate(0, 0, 1-today.Day())
+	default:
+		return nil, errors.BadRequest("This period doesn't exists in the system : " + period)
+	}
+	return &start, nil
+}
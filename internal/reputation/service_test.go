@@ -0,0 +1,27 @@
+package reputation
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_periodStart(t *testing.T) {
+	// a Sunday
+	now := time.Date(2026, 10, 18, 15, 30, 0, 0, time.UTC)
+
+	start, err := periodStart(PeriodWeek, now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), *start)
+
+	start, err = periodStart(PeriodMonth, now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), *start)
+
+	start, err = periodStart(PeriodAll, now)
+	assert.Nil(t, err)
+	assert.Nil(t, start)
+
+	_, err = periodStart("year", now)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,62 @@
+package reputation
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+)
+
+// subscriberName identifies the reputation service among the subscribers of domain events.
+const subscriberName = "reputation"
+
+// the statuses of ideas that earn points; they mirror the statuses of the idea package
+const (
+	statusDraft     = "draft"
+	statusSubmitted = "submitted"
+	statusAccepted  = "accepted"
+)
+
+// RegisterSubscribers subscribes the reputation service to the domain events that earn points.
+func RegisterSubscribers(bus event.Bus, service Service, policy Policy) {
+	// ideas earn points once they are submitted, so that drafts don't count
+	bus.Subscribe(event.IdeaCreated, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.IdeaData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		if data.Idea.Status == statusDraft {
+			return nil
+		}
+		return service.Award(ctx, earned(e, data.Idea.AuthorID, KindIdeaCreated, policy.Points.IdeaCreated))
+	})
+
+	bus.Subscribe(event.IdeaStatusChanged, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.StatusChangeData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		switch {
+		case data.Change.FromStatus == statusDraft && data.Change.ToStatus == statusSubmitted:
+			return service.Award(ctx, earned(e, data.Idea.AuthorID, KindIdeaCreated, policy.Points.IdeaCreated))
+		case data.Change.ToStatus == statusAccepted:
+			return service.Award(ctx, earned(e, data.Idea.AuthorID, KindIdeaAccepted, policy.Points.IdeaAccepted))
+		}
+		return nil
+	})
+
+	bus.Subscribe(event.IdeaVoted, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.VoteData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		if err := service.Award(ctx, earned(e, data.Idea.AuthorID, KindVoteReceived, policy.Points.VoteReceived)); err != nil {
+			return err
+		}
+		return service.Award(ctx, earned(e, data.VoterID, KindVoteCast, policy.Points.VoteCast))
+	})
+}
+
+// earned returns the score event of the points a domain event earned a user.
+func earned(e event.Event, userID, kind string, points int) entity.ScoreEvent {
+	return entity.ScoreEvent{UserID: userID, EventID: e.ID, Kind: kind, Points: points, CreatedAt: e.CreatedAt}
+}
@@ -0,0 +1,120 @@
+package stream
+
+import (
+	"fmt"
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/access"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/idea"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"net/http"
+	"time"
+)
+
+const (
+	// heartbeatInterval is how often a comment is sent on idle streams so that proxies keep them open.
+	heartbeatInterval = 15 * time.Second
+	// retryMillis is the delay before browsers reconnect a dropped stream.
+	retryMillis = 3000
+	// eventReset tells a client that it may have missed updates and should reload the ideas it shows.
+	eventReset = "reset"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers. The streams require a valid JWT.
+func RegisterHandlers(r *routing.RouteGroup, hub *Hub, ideaService idea.Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{hub, ideaService, logger}
+
+	r.Get("/stream/ideas", tokenFromQuery, authHandler, res.feed)
+	r.Get("/stream/ideas/<id>", tokenFromQuery, authHandler, res.idea)
+}
+
+type resource struct {
+	hub         *Hub
+	ideaService idea.Service
+	logger      log.Logger
+}
+
+// feed streams the updates of every idea.
+func (r resource) feed(c *routing.Context) error {
+	return r.serve(c, "")
+}
+
+// idea streams the updates of a single idea.
+func (r resource) idea(c *routing.Context) error {
+	if _, err := r.ideaService.Get(c.Request.Context(), c.Param("id")); err != nil {
+		return err
+	}
+	return r.serve(c, c.Param("id"))
+}
+
+// serve sends the messages of the hub to the client as Server-Sent Events until either side disconnects.
+func (r resource) serve(c *routing.Context, ideaID string) error {
+	flusher, ok := responseFlusher(c.Response)
+	if !ok {
+		return errors.InternalServerError("Streaming is not supported")
+	}
+	lastEventID := c.Request.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	client, missed, ok := r.hub.Subscribe(ideaID, lastEventID)
+	defer r.hub.Unsubscribe(client)
+
+	w := c.Response
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// disable the response buffering of nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", retryMillis)
+	if !ok {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventReset)
+	}
+	for _, m := range missed {
+		writeMessage(w, m)
+	}
+	flusher.Flush()
+
+	ctx := c.Request.Context()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, open := <-client.Messages():
+			if !open {
+				// the client lagged behind or the hub was reset; the client reconnects with its last event ID
+				return nil
+			}
+			writeMessage(w, m)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// writeMessage writes a message in the Server-Sent Events format.
+func writeMessage(w http.ResponseWriter, m Message) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", m.ID, m.Type, m.Data)
+}
+
+// tokenFromQuery lets browsers, whose EventSource cannot send headers, pass the JWT in the access_token query parameter.
+func tokenFromQuery(c *routing.Context) error {
+	if token := c.Query("access_token"); token != "" && c.Request.Header.Get("Authorization") == "" {
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// responseFlusher returns the flusher of the response, looking through the writer of the access log.
+func responseFlusher(w http.ResponseWriter) (http.Flusher, bool) {
+	if lw, ok := w.(*access.LogResponseWriter); ok {
+		w = lw.ResponseWriter
+	}
+	flusher, ok := w.(http.Flusher)
+	return flusher, ok
+}
@@ -0,0 +1,123 @@
+// Package stream pushes real-time updates of ideas to clients over Server-Sent Events.
+// Updates are published by a subscriber of the domain events through PostgreSQL notifications,
+// so that every instance of the application receives them, and fanned out by an in-memory hub.
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// clientBuffer is the number of messages a client may lag behind before it is disconnected.
+const clientBuffer = 64
+
+// Message is an update sent to the clients of the stream.
+type Message struct {
+	// the ID of the domain event the update comes from. Clients send it back in the Last-Event-ID header to resume.
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	IdeaID string          `json:"idea_id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Client receives the messages of the global feed, or of a single idea, from a hub.
+type Client struct {
+	ideaID   string
+	messages chan Message
+}
+
+// Messages returns the channel of the messages sent to the client. It is closed when the client is
+// disconnected by the hub, in which case the client should reconnect.
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Hub fans the messages out to the connected clients and keeps the latest ones so that reconnecting
+// clients can catch up on the messages they missed.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[*Client]bool
+	history []Message
+	size    int
+}
+
+// NewHub creates a hub which keeps the given number of messages for reconnecting clients.
+func NewHub(historySize int) *Hub {
+	return &Hub{clients: map[*Client]bool{}, size: historySize}
+}
+
+// Subscribe connects a client to the messages of the given idea, or to every message if the ID is empty.
+// If lastEventID is not empty, the messages sent after it are returned, and ok is false if the hub
+// doesn't remember it, in which case the client may have missed messages and should reload its data.
+func (h *Hub) Subscribe(ideaID, lastEventID string) (c *Client, missed []Message, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c = &Client{ideaID: ideaID, messages: make(chan Message, clientBuffer)}
+	h.clients[c] = true
+	if lastEventID == "" {
+		return c, nil, true
+	}
+	for i := len(h.history) - 1; i >= 0; i-- {
+		if h.history[i].ID != lastEventID {
+			continue
+		}
+		for _, m := range h.history[i+1:] {
+			if c.wants(m) {
+				missed = append(missed, m)
+			}
+		}
+		return c, missed, true
+	}
+	return c, nil, false
+}
+
+// Unsubscribe disconnects a client.
+func (h *Hub) Unsubscribe(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(c)
+}
+
+// Broadcast sends a message to the clients subscribed to it. Clients which lag too far behind are
+// disconnected rather than slowing down the others; they catch up when they reconnect.
+func (h *Hub) Broadcast(m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.history = append(h.history, m)
+	if len(h.history) > h.size {
+		h.history = append(h.history[:0], h.history[len(h.history)-h.size:]...)
+	}
+	for c := range h.clients {
+		if !c.wants(m) {
+			continue
+		}
+		select {
+		case c.messages <- m:
+		default:
+			h.remove(c)
+		}
+	}
+}
+
+// Reset forgets the history and disconnects every client. It is used when messages may have been
+// lost, so that reconnecting clients are told to reload their data.
+func (h *Hub) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.history = nil
+	for c := range h.clients {
+		h.remove(c)
+	}
+}
+
+func (h *Hub) remove(c *Client) {
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.messages)
+	}
+}
+
+// wants tells whether a message belongs to the feed the client is subscribed to.
+func (c *Client) wants(m Message) bool {
+	return c.ideaID == "" || c.ideaID == m.IdeaID
+}
@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub(3)
+	feed, _, ok := hub.Subscribe("", "")
+	assert.True(t, ok)
+	single, _, _ := hub.Subscribe("1", "")
+
+	hub.Broadcast(Message{ID: "a", IdeaID: "1"})
+	hub.Broadcast(Message{ID: "b", IdeaID: "2"})
+	assert.Equal(t, "a", (<-feed.Messages()).ID)
+	assert.Equal(t, "b", (<-feed.Messages()).ID)
+	assert.Equal(t, "a", (<-single.Messages()).ID)
+	assert.Len(t, single.Messages(), 0)
+
+	// a reconnecting client receives the messages it missed
+	hub.Broadcast(Message{ID: "c", IdeaID: "1"})
+	_, missed, ok := hub.Subscribe("1", "a")
+	assert.True(t, ok)
+	assert.Equal(t, []Message{{ID: "c", IdeaID: "1"}}, missed)
+
+	// unless the hub doesn't remember its last message
+	hub.Broadcast(Message{ID: "d", IdeaID: "1"})
+	_, missed, ok = hub.Subscribe("", "a")
+	assert.False(t, ok)
+	assert.Empty(t, missed)
+
+	// a reset disconnects the clients once they received the pending messages
+	hub.Reset()
+	var ids []string
+	for m := range feed.Messages() {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []string{"c", "d"}, ids)
+	_, _, ok = hub.Subscribe("", "d")
+	assert.False(t, ok)
+}
+
+func TestHub_SlowClient(t *testing.T) {
+	hub := NewHub(10)
+	client, _, _ := hub.Subscribe("", "")
+	for i := 0; i <= clientBuffer; i++ {
+		hub.Broadcast(Message{ID: "x"})
+	}
+	n := 0
+	for range client.Messages() {
+		n++
+	}
+	assert.Equal(t, clientBuffer, n)
+	// unsubscribing a disconnected client is harmless
+	hub.Unsubscribe(client)
+}
@@ -0,0 +1,143 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/lib/pq"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+const (
+	// channel is the PostgreSQL notification channel the messages are published on.
+	channel = "idea_stream"
+	// subscriberName identifies the stream among the subscribers of domain events.
+	subscriberName = "stream"
+	// maxPayload is the size under which a notification payload must stay; PostgreSQL rejects 8000 bytes and more.
+	maxPayload = 7900
+	// listenerPing is how often the listener checks that its connection is alive when no notification arrives.
+	listenerPing = 90 * time.Second
+)
+
+// IdeaUpdate is the data of the messages of the stream.
+type IdeaUpdate struct {
+	IdeaID     string `json:"idea_id"`
+	Summary    string `json:"summary,omitempty"`
+	AuthorID   string `json:"author_id"`
+	CampaignID string `json:"campaign_id,omitempty"`
+	Status     string `json:"status"`
+	// the previous status of the idea, for status changes
+	FromStatus string    `json:"from_status,omitempty"`
+	Votes      int       `json:"votes"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// RegisterSubscribers publishes the creation of ideas, their votes and their status changes to the stream.
+// Notifications are sent when the transaction of the subscriber is committed. Ideas hidden by moderation
+// or deleted are left out.
+func RegisterSubscribers(bus event.Bus, db *dbcontext.DB) {
+	publish := func(ctx context.Context, e event.Event, idea entity.Idea, fromStatus string) error {
+		if idea.BadFlag || idea.DeletedAt != nil {
+			return nil
+		}
+		update := IdeaUpdate{
+			IdeaID:     idea.ID,
+			Summary:    idea.Summary,
+			AuthorID:   idea.AuthorID,
+			CampaignID: idea.CampaignID,
+			Status:     idea.Status,
+			FromStatus: fromStatus,
+			Votes:      idea.Votes,
+			UpdatedAt:  e.CreatedAt,
+		}
+		payload, err := encode(e, update)
+		if err != nil {
+			return err
+		}
+		if len(payload) > maxPayload {
+			// clients can fetch the summary of the idea if they need it
+			update.Summary = ""
+			if payload, err = encode(e, update); err != nil {
+				return err
+			}
+		}
+		_, err = db.With(ctx).NewQuery("SELECT pg_notify({:channel}, {:payload})").
+			Bind(dbx.Params{"channel": channel, "payload": string(payload)}).
+			Execute()
+		return err
+	}
+
+	bus.Subscribe(event.IdeaCreated, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.IdeaData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return publish(ctx, e, data.Idea, "")
+	})
+
+	bus.Subscribe(event.IdeaVoted, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.VoteData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return publish(ctx, e, data.Idea, "")
+	})
+
+	bus.Subscribe(event.IdeaStatusChanged, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.StatusChangeData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return publish(ctx, e, data.Idea, data.Change.FromStatus)
+	})
+}
+
+// encode returns the JSON message of an update.
+func encode(e event.Event, update IdeaUpdate) ([]byte, error) {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Message{ID: e.ID, Type: e.Type, IdeaID: update.IdeaID, Data: data})
+}
+
+// Listen forwards the messages notified through the database to the hub until the context is cancelled.
+// The hub is reset whenever the connection to the database is re-established, as notifications may have
+// been lost in the meantime.
+func Listen(ctx context.Context, dsn string, hub *Hub, logger log.Logger) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.With(ctx).Errorf("stream listener: %v", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(channel); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(listenerPing)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				hub.Reset()
+				continue
+			}
+			var m Message
+			if err := json.Unmarshal([]byte(n.Extra), &m); err != nil {
+				logger.With(ctx).Errorf("invalid stream message: %v", err)
+				continue
+			}
+			hub.Broadcast(m)
+		case <-ticker.C:
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package tag
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"net/http"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/tags", res.list)
+	r.Get("/tags/<slug>", res.get)
+	r.Post("/tags", res.create)
+	r.Put("/tags/<slug>", res.rename)
+	r.Delete("/tags/<slug>", res.delete)
+	r.Post("/tags/<slug>/merge", res.merge)
+	r.Post("/tags/<slug>/aliases", res.addAlias)
+	r.Delete("/tags/<slug>/aliases", res.removeAlias)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) list(c *routing.Context) error {
+	tags, err := r.service.List(c.Request.Context())
+	if err != nil {
+		return err
+	}
+	return c.Write(tags)
+}
+
+func (r resource) get(c *routing.Context) error {
+	tag, err := r.service.Get(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		return err
+	}
+	return c.Write(tag)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateTagRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	tag, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(tag, http.StatusCreated)
+}
+
+func (r resource) rename(c *routing.Context) error {
+	var input RenameTagRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	tag, err := r.service.Rename(c.Request.Context(), c.Param("slug"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(tag)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	var input DeleteTagRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	tag, err := r.service.Delete(c.Request.Context(), c.Param("slug"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(tag)
+}
+
+func (r resource) merge(c *routing.Context) error {
+	var input MergeTagRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	tag, err := r.service.Merge(c.Request.Context(), c.Param("slug"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(tag)
+}
+
+func (r resource) addAlias(c *routing.Context) error {
+	var input AliasRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	tag, err := r.service.AddAlias(c.Request.Context(), c.Param("slug"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(tag)
+}
+
+func (r resource) removeAlias(c *routing.Context) error {
+	var input AliasRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	tag, err := r.service.RemoveAlias(c.Request.Context(), c.Param("slug"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(tag)
+}
@@ -0,0 +1,172 @@
+package tag
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Repository encapsulates the logic to access tags from the data source.
+type Repository interface {
+	// Get returns the tag with the specified slug.
+	Get(ctx context.Context, id string) (entity.Tag, error)
+
+	// GetAlias returns the alias with the specified slug.
+	GetAlias(ctx context.Context, alias string) (entity.TagAlias, error)
+
+	// Create saves a new tag in the storage.
+	Create(ctx context.Context, tag entity.Tag) error
+
+	// Update saves the changes to a tag in the storage.
+	Update(ctx context.Context, tag entity.Tag) error
+
+	// ListWithCounts returns all tags with the number of visible ideas using each of them.
+	ListWithCounts(ctx context.Context) ([]TagCount, error)
+
+	// ListAliases returns the aliases of the given tag.
+	ListAliases(ctx context.Context, tagID string) ([]entity.TagAlias, error)
+
+	// CreateAlias saves a new alias in the storage.
+	CreateAlias(ctx context.Context, alias entity.TagAlias) error
+
+	// DeleteAlias removes the alias with the specified slug from the storage.
+	DeleteAlias(ctx context.Context, alias string) error
+
+	// Rename gives the tag with the specified slug a new slug, keeping the old slug as an alias.
+	Rename(ctx context.Context, id string, renamed entity.Tag) error
+
+	// Merge replaces the source tag with the target tag on every idea, moves the aliases of the source tag
+	// to the target tag and keeps the source slug as an alias of the target.
+	Merge(ctx context.Context, sourceID, targetID string) error
+
+	// Delete removes the tag with the specified slug from every idea and from the storage.
+	Delete(ctx context.Context, id string) error
+}
+
+// TagCount represents a tag together with the number of ideas using it.
+type TagCount struct {
+	entity.Tag
+	IdeaCount int `json:"idea_count"`
+}
+
+// repository persists tags in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new tag repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the tag with the specified slug from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Tag, error) {
+	var tag entity.Tag
+	err := r.db.With(ctx).Select().Model(id, &tag)
+	return tag, err
+}
+
+// GetAlias reads the alias with the specified slug from the database.
+func (r repository) GetAlias(ctx context.Context, alias string) (entity.TagAlias, error) {
+	var tagAlias entity.TagAlias
+	err := r.db.With(ctx).Select().Model(alias, &tagAlias)
+	return tagAlias, err
+}
+
+// Create saves a new tag record in the database.
+func (r repository) Create(ctx context.Context, tag entity.Tag) error {
+	return r.db.With(ctx).Model(&tag).Insert()
+}
+
+// Update saves the changes to a tag in the database.
+func (r repository) Update(ctx context.Context, tag entity.Tag) error {
+	return r.db.With(ctx).Model(&tag).Update()
+}
+
+// ListWithCounts returns all tag records with the number of visible ideas using each of them, most used first.
+func (r repository) ListWithCounts(ctx context.Context) ([]TagCount, error) {
+	var tags []TagCount
+	err := r.db.With(ctx).
+		NewQuery("SELECT tag.id, tag.name, tag.created_at, tag.updated_at, COUNT(idea.id) AS idea_count " +
+			"FROM tag LEFT JOIN idea ON tag.id = ANY(idea.tags) AND idea.deleted_at IS NULL AND idea.bad_flag IS NOT TRUE " +
+			"GROUP BY tag.id ORDER BY idea_count DESC, tag.id").
+		All(&tags)
+	return tags, err
+}
+
+// ListAliases returns the aliases of the given tag.
+func (r repository) ListAliases(ctx context.Context, tagID string) ([]entity.TagAlias, error) {
+	var aliases []entity.TagAlias
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"tag_id": tagID}).
+		OrderBy("alias").
+		All(&aliases)
+	return aliases, err
+}
+
+// CreateAlias saves a new alias record in the database.
+func (r repository) CreateAlias(ctx context.Context, alias entity.TagAlias) error {
+	return r.db.With(ctx).Model(&alias).Insert()
+}
+
+// DeleteAlias deletes the alias with the specified slug from the database.
+func (r repository) DeleteAlias(ctx context.Context, alias string) error {
+	_, err := r.db.With(ctx).Delete("tag_alias", dbx.HashExp{"alias": alias}).Execute()
+	return err
+}
+
+// Rename creates the renamed tag and merges the tag with the specified slug into it.
+func (r repository) Rename(ctx context.Context, id string, renamed entity.Tag) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		// the new slug may have been an alias of the tag being renamed
+		if err := r.DeleteAlias(ctx, renamed.ID); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, renamed); err != nil {
+			return err
+		}
+		return r.Merge(ctx, id, renamed.ID)
+	})
+}
+
+// Merge rewrites every idea using the source tag to use the target tag instead, keeping the order of the tags
+// and dropping duplicates. The source tag is removed and its slug and aliases now resolve to the target tag.
+func (r repository) Merge(ctx context.Context, sourceID, targetID string) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		params := dbx.Params{"source": sourceID, "target": targetID}
+		_, err := r.db.With(ctx).NewQuery("UPDATE idea SET tags = ARRAY(" +
+			"SELECT t FROM unnest(array_replace(tags, {:source}, {:target})) WITH ORDINALITY AS u(t, n) " +
+			"GROUP BY t ORDER BY MIN(n)) " +
+			"WHERE {:source} = ANY(tags)").Bind(params).Execute()
+		if err != nil {
+			return err
+		}
+		if _, err = r.db.With(ctx).Update("tag_alias", dbx.Params{"tag_id": targetID}, dbx.HashExp{"tag_id": sourceID}).Execute(); err != nil {
+			return err
+		}
+		if _, err = r.db.With(ctx).Delete("tag", dbx.HashExp{"id": sourceID}).Execute(); err != nil {
+			return err
+		}
+		return r.CreateAlias(ctx, entity.TagAlias{Alias: sourceID, TagID: targetID, CreatedAt: time.Now()})
+	})
+}
+
+// Delete removes the tag with the specified slug from every idea, then deletes the tag and its aliases.
+func (r repository) Delete(ctx context.Context, id string) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		_, err := r.db.With(ctx).
+			NewQuery("UPDATE idea SET tags = array_remove(tags, {:tag}) WHERE {:tag} = ANY(tags)").
+			Bind(dbx.Params{"tag": id}).
+			Execute()
+		if err != nil {
+			return err
+		}
+		_, err = r.db.With(ctx).Delete("tag", dbx.HashExp{"id": id}).Execute()
+		return err
+	})
+}
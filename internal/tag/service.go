@@ -0,0 +1,336 @@
+package tag
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Service encapsulates usecase logic for the tag catalogue.
+type Service interface {
+	Canonicalize(ctx context.Context, names []string) ([]string, error)
+	Get(ctx context.Context, slug string) (Tag, error)
+	List(ctx context.Context) ([]TagCount, error)
+	Create(ctx context.Context, req CreateTagRequest) (Tag, error)
+	Rename(ctx context.Context, slug string, req RenameTagRequest) (Tag, error)
+	Merge(ctx context.Context, slug string, req MergeTagRequest) (Tag, error)
+	Delete(ctx context.Context, slug string, req DeleteTagRequest) (Tag, error)
+	AddAlias(ctx context.Context, slug string, req AliasRequest) (Tag, error)
+	RemoveAlias(ctx context.Context, slug string, req AliasRequest) (Tag, error)
+}
+
+// Tag represents a canonical tag together with its aliases.
+type Tag struct {
+	entity.Tag
+	Aliases []string `json:"aliases"`
+}
+
+// CreateTagRequest represents a tag creation request.
+type CreateTagRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	Name               string `json:"name"`
+}
+
+// RenameTagRequest represents a tag rename request.
+type RenameTagRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	// the new display name of the tag. Its slug becomes the new canonical slug.
+	Name string `json:"name"`
+}
+
+// MergeTagRequest represents a request to merge a tag into another one.
+type MergeTagRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	// the slug of the tag that remains after the merge
+	Into string `json:"into"`
+}
+
+// DeleteTagRequest represents a tag deletion request.
+type DeleteTagRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
+
+// AliasRequest represents a request to add or remove an alias of a tag.
+type AliasRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	Alias              string `json:"alias"`
+}
+
+type service struct {
+	repo        Repository
+	userService user.UserService
+	logger      log.Logger
+}
+
+// NewService creates a new tag service.
+func NewService(repo Repository, userService user.UserService, logger log.Logger) Service {
+	return service{repo, userService, logger}
+}
+
+// nonSlugChars matches what separates the words of a tag: anything but letters, their accents and digits,
+// in any script.
+var nonSlugChars = regexp.MustCompile(`[^\p{L}\p{M}\p{N}]+`)
+
+// Slugify turns a tag name into its slug, e.g. "User Experience" becomes "user-experience" and "Café Crème"
+// becomes "café-crème". Letters other than Latin ones are kept as they are.
+func Slugify(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// Canonicalize resolves the given tag names to the slugs of their canonical tags.
+// Aliases are replaced with the tags they resolve to, unknown tags are added to the catalogue,
+// and duplicates are dropped while keeping the original order.
+func (s service) Canonicalize(ctx context.Context, names []string) ([]string, error) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		slug := Slugify(name)
+		if slug == "" {
+			continue
+		}
+		tag, err := s.resolve(ctx, slug)
+		if err == sql.ErrNoRows {
+			now := time.Now()
+			tag = entity.Tag{ID: slug, Name: strings.TrimSpace(name), CreatedAt: now, UpdatedAt: now}
+			err = s.repo.Create(ctx, tag)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag.ID] {
+			seen[tag.ID] = true
+			result = append(result, tag.ID)
+		}
+	}
+	return result, nil
+}
+
+// Get returns the tag with the specified slug or alias.
+func (s service) Get(ctx context.Context, slug string) (Tag, error) {
+	tag, err := s.resolve(ctx, Slugify(slug))
+	if err != nil {
+		return Tag{}, err
+	}
+	return s.withAliases(ctx, tag)
+}
+
+// List returns all tags with the number of ideas using each of them, most used first.
+func (s service) List(ctx context.Context) ([]TagCount, error) {
+	tags, err := s.repo.ListWithCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		tags = []TagCount{}
+	}
+	return tags, nil
+}
+
+// Create adds a new tag to the catalogue.
+func (s service) Create(ctx context.Context, req CreateTagRequest) (Tag, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return Tag{}, err
+	}
+	slug := Slugify(req.Name)
+	if slug == "" {
+		return Tag{}, errors.BadRequest("A tag name is required")
+	}
+	if err := s.checkSlugFree(ctx, slug); err != nil {
+		return Tag{}, err
+	}
+
+	now := time.Now()
+	tag := entity.Tag{ID: slug, Name: strings.TrimSpace(req.Name), CreatedAt: now, UpdatedAt: now}
+	if err := s.repo.Create(ctx, tag); err != nil {
+		return Tag{}, err
+	}
+	return s.withAliases(ctx, tag)
+}
+
+// Rename changes the name of a tag. If the slug of the new name differs, every idea is rewritten to use the
+// new slug and the old slug is kept as an alias.
+func (s service) Rename(ctx context.Context, slug string, req RenameTagRequest) (Tag, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return Tag{}, err
+	}
+	tag, err := s.repo.Get(ctx, slug)
+	if err != nil {
+		return Tag{}, err
+	}
+	newSlug := Slugify(req.Name)
+	if newSlug == "" {
+		return Tag{}, errors.BadRequest("A tag name is required")
+	}
+
+	now := time.Now()
+	if newSlug == tag.ID {
+		tag.Name = strings.TrimSpace(req.Name)
+		tag.UpdatedAt = now
+		if err := s.repo.Update(ctx, tag); err != nil {
+			return Tag{}, err
+		}
+		return s.withAliases(ctx, tag)
+	}
+
+	if alias, err := s.repo.GetAlias(ctx, newSlug); err == nil {
+		if alias.TagID != tag.ID {
+			return Tag{}, errors.BadRequest("The slug " + newSlug + " is an alias of the tag " + alias.TagID)
+		}
+	} else if err != sql.ErrNoRows {
+		return Tag{}, err
+	}
+	if _, err := s.repo.Get(ctx, newSlug); err == nil {
+		return Tag{}, errors.BadRequest("The tag " + newSlug + " already exists, merge the tags instead")
+	} else if err != sql.ErrNoRows {
+		return Tag{}, err
+	}
+
+	renamed := entity.Tag{ID: newSlug, Name: strings.TrimSpace(req.Name), CreatedAt: tag.CreatedAt, UpdatedAt: now}
+	if err := s.repo.Rename(ctx, tag.ID, renamed); err != nil {
+		return Tag{}, err
+	}
+	return s.withAliases(ctx, renamed)
+}
+
+// Merge merges the tag with the specified slug into another tag. Every idea using the merged tag is rewritten,
+// and the merged slug and its aliases become aliases of the remaining tag.
+func (s service) Merge(ctx context.Context, slug string, req MergeTagRequest) (Tag, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return Tag{}, err
+	}
+	source, err := s.repo.Get(ctx, slug)
+	if err != nil {
+		return Tag{}, err
+	}
+	target, err := s.resolve(ctx, Slugify(req.Into))
+	if err == sql.ErrNoRows {
+		return Tag{}, errors.BadRequest("The tag to merge into doesn't exist : " + req.Into)
+	} else if err != nil {
+		return Tag{}, err
+	}
+	if source.ID == target.ID {
+		return Tag{}, errors.BadRequest("A tag cannot be merged into itself")
+	}
+
+	if err := s.repo.Merge(ctx, source.ID, target.ID); err != nil {
+		return Tag{}, err
+	}
+	return s.withAliases(ctx, target)
+}
+
+// Delete removes a tag and its aliases from the catalogue and from every idea.
+func (s service) Delete(ctx context.Context, slug string, req DeleteTagRequest) (Tag, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return Tag{}, err
+	}
+	tag, err := s.repo.Get(ctx, slug)
+	if err != nil {
+		return Tag{}, err
+	}
+	result, err := s.withAliases(ctx, tag)
+	if err != nil {
+		return Tag{}, err
+	}
+	if err := s.repo.Delete(ctx, tag.ID); err != nil {
+		return Tag{}, err
+	}
+	return result, nil
+}
+
+// AddAlias makes the given alias resolve to the tag with the specified slug.
+func (s service) AddAlias(ctx context.Context, slug string, req AliasRequest) (Tag, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return Tag{}, err
+	}
+	tag, err := s.repo.Get(ctx, slug)
+	if err != nil {
+		return Tag{}, err
+	}
+	alias := Slugify(req.Alias)
+	if alias == "" {
+		return Tag{}, errors.BadRequest("An alias is required")
+	}
+	if err := s.checkSlugFree(ctx, alias); err != nil {
+		return Tag{}, err
+	}
+
+	if err := s.repo.CreateAlias(ctx, entity.TagAlias{Alias: alias, TagID: tag.ID, CreatedAt: time.Now()}); err != nil {
+		return Tag{}, err
+	}
+	return s.withAliases(ctx, tag)
+}
+
+// RemoveAlias removes an alias of the tag with the specified slug.
+func (s service) RemoveAlias(ctx context.Context, slug string, req AliasRequest) (Tag, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return Tag{}, err
+	}
+	tag, err := s.repo.Get(ctx, slug)
+	if err != nil {
+		return Tag{}, err
+	}
+	alias, err := s.repo.GetAlias(ctx, Slugify(req.Alias))
+	if err != nil {
+		return Tag{}, err
+	}
+	if alias.TagID != tag.ID {
+		return Tag{}, errors.NotFound("The alias doesn't belong to this tag")
+	}
+
+	if err := s.repo.DeleteAlias(ctx, alias.Alias); err != nil {
+		return Tag{}, err
+	}
+	return s.withAliases(ctx, tag)
+}
+
+// resolve returns the canonical tag for the given slug, which may be the slug of a tag or an alias.
+func (s service) resolve(ctx context.Context, slug string) (entity.Tag, error) {
+	tag, err := s.repo.Get(ctx, slug)
+	if err != sql.ErrNoRows {
+		return tag, err
+	}
+	alias, err := s.repo.GetAlias(ctx, slug)
+	if err != nil {
+		return entity.Tag{}, err
+	}
+	return s.repo.Get(ctx, alias.TagID)
+}
+
+// checkSlugFree ensures the given slug is used neither by a tag nor by an alias.
+func (s service) checkSlugFree(ctx context.Context, slug string) error {
+	if tag, err := s.resolve(ctx, slug); err == nil {
+		return errors.BadRequest("The slug " + slug + " is already used by the tag " + tag.ID)
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+	return nil
+}
+
+func (s service) withAliases(ctx context.Context, tag entity.Tag) (Tag, error) {
+	aliases, err := s.repo.ListAliases(ctx, tag.ID)
+	if err != nil {
+		return Tag{}, err
+	}
+	result := Tag{tag, []string{}}
+	for _, alias := range aliases {
+		result.Aliases = append(result.Aliases, alias.Alias)
+	}
+	return result, nil
+}
+
+func (s service) checkAdmin(ctx context.Context, requesterEmail string) error {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return errors.InternalServerError("Requester User doesn't exist")
+	}
+	if !user.IsAdmin(requester.Role) {
+		return errors.Forbidden("Requester User doesn't have permission to manage tags")
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package tag
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// mockRepository keeps the tags, their aliases and the tags of every idea in memory, and rewrites the ideas
+// on rename and merge the way the database repository does.
+type mockRepository struct {
+	Repository
+	tags    map[string]entity.Tag
+	aliases map[string]entity.TagAlias
+	ideas   map[string][]string
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		tags:    map[string]entity.Tag{},
+		aliases: map[string]entity.TagAlias{},
+		ideas:   map[string][]string{},
+	}
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.Tag, error) {
+	if tag, ok := m.tags[id]; ok {
+		return tag, nil
+	}
+	return entity.Tag{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetAlias(ctx context.Context, alias string) (entity.TagAlias, error) {
+	if tagAlias, ok := m.aliases[alias]; ok {
+		return tagAlias, nil
+	}
+	return entity.TagAlias{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Create(ctx context.Context, tag entity.Tag) error {
+	m.tags[tag.ID] = tag
+	return nil
+}
+
+func (m *mockRepository) ListAliases(ctx context.Context, tagID string) ([]entity.TagAlias, error) {
+	var aliases []entity.TagAlias
+	for _, alias := range m.aliases {
+		if alias.TagID == tagID {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases, nil
+}
+
+func (m *mockRepository) CreateAlias(ctx context.Context, alias entity.TagAlias) error {
+	m.aliases[alias.Alias] = alias
+	return nil
+}
+
+func (m *mockRepository) Rename(ctx context.Context, id string, renamed entity.Tag) error {
+	delete(m.aliases, renamed.ID)
+	m.tags[renamed.ID] = renamed
+	return m.Merge(ctx, id, renamed.ID)
+}
+
+func (m *mockRepository) Merge(ctx context.Context, sourceID, targetID string) error {
+	for id, tags := range m.ideas {
+		merged := []string{}
+		for _, tag := range tags {
+			if tag == sourceID {
+				tag = targetID
+			}
+			if !contains(merged, tag) {
+				merged = append(merged, tag)
+			}
+		}
+		m.ideas[id] = merged
+	}
+	for alias, tagAlias := range m.aliases {
+		if tagAlias.TagID == sourceID {
+			tagAlias.TagID = targetID
+			m.aliases[alias] = tagAlias
+		}
+	}
+	delete(m.tags, sourceID)
+	return m.CreateAlias(ctx, entity.TagAlias{Alias: sourceID, TagID: targetID})
+}
+
+func contains(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type mockUserService struct {
+	user.UserService
+}
+
+func (m mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	if email == "admin@example.com" {
+		return user.User{Users: entity.Users{ID: "1", Email: email, Role: user.ADMIN}}, nil
+	}
+	return user.User{Users: entity.Users{ID: "2", Email: email, Role: user.VISITOR}}, nil
+}
+
+func newTestService() (Service, *mockRepository) {
+	repo := newMockRepository()
+	now := time.Now()
+	for _, tag := range []entity.Tag{{ID: "ux", Name: "UX"}, {ID: "design", Name: "Design"}, {ID: "mobile", Name: "Mobile"}} {
+		tag.CreatedAt, tag.UpdatedAt = now, now
+		repo.tags[tag.ID] = tag
+	}
+	repo.aliases["user-experience"] = entity.TagAlias{Alias: "user-experience", TagID: "ux"}
+	repo.ideas["1"] = []string{"ux", "mobile"}
+	repo.ideas["2"] = []string{"design", "ux"}
+	repo.ideas["3"] = []string{"mobile"}
+	return NewService(repo, mockUserService{}, log.New()), repo
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"User Experience", "user-experience"},
+		{"  Dark   mode! ", "dark-mode"},
+		{"Web 3.0", "web-3-0"},
+		{"Café Crème", "café-crème"},
+		{"Ärger über Öl", "ärger-über-öl"},
+		{"日本語 タグ", "日本語-タグ"},
+		{"Привет мир", "привет-мир"},
+		{" -- ! ", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Slugify(tt.name), tt.name)
+	}
+	// a slug is its own slug
+	assert.Equal(t, "café-crème", Slugify(Slugify("Café Crème")))
+}
+
+func TestService_Canonicalize(t *testing.T) {
+	s, repo := newTestService()
+	ctx := context.Background()
+
+	// aliases resolve to their tag, duplicates and empty names are dropped and unknown tags are created
+	slugs, err := s.Canonicalize(ctx, []string{"User Experience", "UX", " ", "Mobile", "Café Crème", "ux"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ux", "mobile", "café-crème"}, slugs)
+	if assert.Contains(t, repo.tags, "café-crème") {
+		assert.Equal(t, "Café Crème", repo.tags["café-crème"].Name)
+	}
+
+	slugs, err = s.Canonicalize(ctx, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, slugs)
+}
+
+func TestService_Rename(t *testing.T) {
+	s, repo := newTestService()
+	ctx := context.Background()
+
+	_, err := s.Rename(ctx, "ux", RenameTagRequest{RequesterUserEmail: "ann@example.com", Name: "Usability"})
+	assert.NotNil(t, err)
+
+	tag, err := s.Rename(ctx, "ux", RenameTagRequest{RequesterUserEmail: "admin@example.com", Name: "Usability"})
+	assert.Nil(t, err)
+	assert.Equal(t, "usability", tag.ID)
+	assert.ElementsMatch(t, []string{"ux", "user-experience"}, tag.Aliases)
+	assert.NotContains(t, repo.tags, "ux")
+
+	// every idea now uses the new slug, and the old slug still resolves to the tag
+	assert.Equal(t, []string{"usability", "mobile"}, repo.ideas["1"])
+	assert.Equal(t, []string{"design", "usability"}, repo.ideas["2"])
+	slugs, err := s.Canonicalize(ctx, []string{"UX", "User Experience"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"usability"}, slugs)
+
+	// a rename cannot take the slug of another tag
+	_, err = s.Rename(ctx, "usability", RenameTagRequest{RequesterUserEmail: "admin@example.com", Name: "Design"})
+	assert.NotNil(t, err)
+}
+
+func TestService_Merge(t *testing.T) {
+	s, repo := newTestService()
+	ctx := context.Background()
+
+	tag, err := s.Merge(ctx, "ux", MergeTagRequest{RequesterUserEmail: "admin@example.com", Into: "Design"})
+	assert.Nil(t, err)
+	assert.Equal(t, "design", tag.ID)
+	assert.ElementsMatch(t, []string{"ux", "user-experience"}, tag.Aliases)
+	assert.NotContains(t, repo.tags, "ux")
+
+	// the merged tag is replaced on every idea without creating duplicates
+	assert.Equal(t, []string{"design", "mobile"}, repo.ideas["1"])
+	assert.Equal(t, []string{"design"}, repo.ideas["2"])
+	assert.Equal(t, []string{"mobile"}, repo.ideas["3"])
+
+	// the merged slug and its aliases resolve to the remaining tag
+	found, err := s.Get(ctx, "user-experience")
+	assert.Nil(t, err)
+	assert.Equal(t, "design", found.ID)
+
+	_, err = s.Merge(ctx, "design", MergeTagRequest{RequesterUserEmail: "admin@example.com", Into: "ux"})
+	assert.NotNil(t, err)
+	_, err = s.Merge(ctx, "mobile", MergeTagRequest{RequesterUserEmail: "admin@example.com", Into: "unknown"})
+	assert.NotNil(t, err)
+}
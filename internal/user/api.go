@@ -4,19 +4,29 @@ import (
 	"github.com/go-ozzo/ozzo-routing/v2"
 	"github.com/qiangxue/go-rest-api/internal/errors"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // RegisterHandlers sets up the routing of the HTTP handlers.
 func RegisterHandlers(r *routing.RouteGroup, service UserService, logger log.Logger) {
 	res := resource{service, logger}
 
+	r.Get("/users", res.query)
+	r.Get("/me", res.getProfile)
+	r.Patch("/me", res.updateProfile)
+	r.Put("/admin/users/<email>/role", res.changeRole)
 	r.Get("/user/<email>", res.get)
 	r.Post("/user", res.create)
 	r.Put("/user/<email>", res.update)
 	r.Delete("/user/<email>", res.delete)
 	r.Post("/userSignup/<email>/<code>", res.UserSignUp)
 	r.Get("/userEmailConfirm/<email>/<code>", res.AuthenticateUser)
+	r.Get("/admin/trash/users", res.trash)
+	r.Post("/admin/trash/users/<email>/restore", res.restore)
 }
 
 type resource struct {
@@ -32,6 +42,91 @@ func (r resource) get(c *routing.Context) error {
 	return c.Write(user)
 }
 
+func (r resource) query(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	req := QueryUsersRequest{
+		RequesterUserEmail: c.Query("requester_user_email"),
+		UserFilter: UserFilter{
+			Role:    c.Query("role"),
+			Country: c.Query("country"),
+			Search:  strings.TrimSpace(c.Query("q")),
+		},
+		Sort: c.Query("sort"),
+	}
+	if v := c.Query("is_auth"); v != "" {
+		isAuth, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.BadRequest("is_auth must be true or false")
+		}
+		req.IsAuth = &isAuth
+	}
+	var err error
+	if req.CreatedAfter, err = parseDate(c.Query("created_after")); err != nil {
+		return errors.BadRequest("created_after must be a date (YYYY-MM-DD) or an RFC 3339 time")
+	}
+	if req.CreatedBefore, err = parseDate(c.Query("created_before")); err != nil {
+		return errors.BadRequest("created_before must be a date (YYYY-MM-DD) or an RFC 3339 time")
+	}
+
+	pages, err := r.service.QueryUsers(c.Request.Context(), req, page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
+
+// parseDate parses a query parameter holding either a date or an RFC 3339 time. It returns nil if the value is empty.
+func parseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02", value); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+func (r resource) getProfile(c *routing.Context) error {
+	user, err := r.service.GetProfile(c.Request.Context(), c.Query("requester_user_email"))
+	if err != nil {
+		return err
+	}
+	return c.Write(user)
+}
+
+func (r resource) updateProfile(c *routing.Context) error {
+	var input UpdateProfileRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	user, err := r.service.UpdateProfile(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(user)
+}
+
+func (r resource) changeRole(c *routing.Context) error {
+	var input ChangeRoleRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	user, err := r.service.ChangeRole(c.Request.Context(), c.Param("email"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(user)
+}
+
 func (r resource) create(c *routing.Context) error {
 	var input CreateUserRequest
 	if err := c.Read(&input); err != nil {
@@ -94,3 +189,28 @@ func (r resource) AuthenticateUser(c *routing.Context) error {
 	}
 	return c.Write(user)
 }
+
+func (r resource) trash(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Trash(c.Request.Context(), c.Query("requester_user_email"), page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
+
+func (r resource) restore(c *routing.Context) error {
+	var input RestoreUserRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	user, err := r.service.RestoreUser(c.Request.Context(), c.Param("email"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(user)
+}
@@ -0,0 +1,146 @@
+package user
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// localePattern matches BCP 47 language tags such as "en", "pt-BR" or "zh-Hant-TW".
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// UpdateProfileRequest represents a partial update of one's own profile. Omitted fields are kept.
+type UpdateProfileRequest struct {
+	RequesterUserEmail string  `json:"requester_user_email"`
+	Name               *string `json:"name"`
+	Country            *string `json:"country"`
+	// an absolute http or https URL, or an empty string to remove the picture
+	Avatar *string `json:"avatar"`
+	Bio    *string `json:"bio"`
+	Locale *string `json:"locale"`
+}
+
+// Validate validates the UpdateProfileRequest fields. The name is validated as it is saved, trimmed.
+func (m UpdateProfileRequest) Validate() error {
+	if m.Name != nil {
+		name := strings.TrimSpace(*m.Name)
+		m.Name = &name
+	}
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.NilOrNotEmpty, validation.Length(0, 128)),
+		validation.Field(&m.Country, validation.Length(0, 128)),
+		validation.Field(&m.Avatar, validation.Length(0, 2048), validation.By(isWebURL)),
+		validation.Field(&m.Bio, validation.Length(0, 1000)),
+		validation.Field(&m.Locale, validation.Match(localePattern)),
+	)
+}
+
+// ChangeRoleRequest represents a request to change the role of a user.
+type ChangeRoleRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+	Role               string `json:"role"`
+}
+
+// GetProfile returns the profile of the requester.
+func (s userService) GetProfile(ctx context.Context, requesterEmail string) (User, error) {
+	user, err := s.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return User{}, errors.InternalServerError("Requester User doesn't exists")
+	}
+	return user, nil
+}
+
+// UpdateProfile changes the given fields of the profile of the requester. Users may always edit their own
+// profile, whatever their role, but never their role.
+func (s userService) UpdateProfile(ctx context.Context, req UpdateProfileRequest) (User, error) {
+	if err := req.Validate(); err != nil {
+		return User{}, err
+	}
+	user, err := s.GetProfile(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return User{}, err
+	}
+	if req.Name != nil {
+		user.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Country != nil {
+		user.Country = strings.TrimSpace(*req.Country)
+	}
+	if req.Avatar != nil {
+		user.Avatar = strings.TrimSpace(*req.Avatar)
+	}
+	if req.Bio != nil {
+		user.Bio = strings.TrimSpace(*req.Bio)
+	}
+	if req.Locale != nil {
+		user.Locale = *req.Locale
+	}
+	user.UpdatedAt = time.Now()
+	if err := s.repo.UpdateUser(ctx, user.Users); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// ChangeRole changes the role of a user. The requester needs the permission over both the current
+// and the new role of the user, and may not change their own role.
+func (s userService) ChangeRole(ctx context.Context, email string, req ChangeRoleRequest) (User, error) {
+	user, err := s.GetUser(ctx, email)
+	if err != nil {
+		return User{}, errors.InternalServerError("User to be updated doesn't exists")
+	}
+	if email == req.RequesterUserEmail {
+		return User{}, errors.Forbidden("Users cannot change their own role")
+	}
+	if isPermitted, errMsg := s.CheckPermission(ctx, req.RequesterUserEmail, user.Role); !isPermitted {
+		return User{}, errMsg
+	}
+	requester, err := s.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return User{}, errors.InternalServerError("Requester User doesn't exists")
+	}
+	if isPermitted, errMsg := s.CheckPermission(ctx, req.RequesterUserEmail, req.Role); !isPermitted {
+		return User{}, errMsg
+	}
+	if user.Role == req.Role {
+		return user, nil
+	}
+
+	oldRole := user.Role
+	user.Role = req.Role
+	user.UpdatedAt = time.Now()
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdateUser(ctx, user.Users); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.UserRoleChanged, event.RoleChangeData{
+			UserID:    user.ID,
+			OldRole:   oldRole,
+			NewRole:   user.Role,
+			ChangedBy: requester.ID,
+		})
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// isWebURL checks that a value is empty or an absolute http or https URL.
+func isWebURL(value interface{}) error {
+	v, _ := validation.Indirect(value)
+	s, _ := v.(string)
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validation.NewError("validation_is_web_url", "must be an absolute http or https URL")
+	}
+	return nil
+}
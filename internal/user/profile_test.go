@@ -0,0 +1,72 @@
+package user
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUpdateProfileRequest_Validate(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name  string
+		req   UpdateProfileRequest
+		valid bool
+	}{
+		{"empty", UpdateProfileRequest{}, true},
+		{"full", UpdateProfileRequest{Name: str("Ana"), Avatar: str("https://cdn.example.com/a.png"), Locale: str("pt-BR")}, true},
+		{"avatar removed", UpdateProfileRequest{Avatar: str("")}, true},
+		{"blank name", UpdateProfileRequest{Name: str("")}, false},
+		{"whitespace name", UpdateProfileRequest{Name: str(" \t ")}, false},
+		{"padded name", UpdateProfileRequest{Name: str(" Ana ")}, true},
+		{"relative avatar", UpdateProfileRequest{Avatar: str("/a.png")}, false},
+		{"avatar scheme", UpdateProfileRequest{Avatar: str("javascript:alert(1)")}, false},
+		{"locale", UpdateProfileRequest{Locale: str("english")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.valid, tt.req.Validate() == nil)
+		})
+	}
+}
+
+func TestUserService_ChangeRole(t *testing.T) {
+	s, repo := newMockService(
+		entity.Users{ID: "1", Email: "super@example.com", Role: SUPER_ADMIN},
+		entity.Users{ID: "2", Email: "admin@example.com", Role: ADMIN},
+		entity.Users{ID: "3", Email: "other-admin@example.com", Role: ADMIN},
+		entity.Users{ID: "4", Email: "ann@example.com", Role: VISITOR},
+	)
+	ctx := context.Background()
+
+	u, err := s.ChangeRole(ctx, "ann@example.com", ChangeRoleRequest{RequesterUserEmail: "super@example.com", Role: ADMIN})
+	assert.Nil(t, err)
+	assert.Equal(t, ADMIN, u.Role)
+	assert.Equal(t, ADMIN, repo.items[3].Role)
+
+	// users cannot change their own role, even when they could change it for others
+	_, err = s.ChangeRole(ctx, "super@example.com", ChangeRoleRequest{RequesterUserEmail: "super@example.com", Role: ADMIN})
+	assert.NotNil(t, err)
+	assert.Equal(t, SUPER_ADMIN, repo.items[0].Role)
+}
+
+func TestUserService_ChangeRole_permission(t *testing.T) {
+	s, repo := newMockService(
+		entity.Users{ID: "1", Email: "admin@example.com", Role: ADMIN},
+		entity.Users{ID: "2", Email: "other-admin@example.com", Role: ADMIN},
+		entity.Users{ID: "3", Email: "ann@example.com", Role: VISITOR},
+	)
+	ctx := context.Background()
+
+	// admins may only manage visitors, so they can neither promote a visitor to admin, which checks the new role,
+	// nor demote another admin to visitor, which checks the current one
+	_, err := s.ChangeRole(ctx, "ann@example.com", ChangeRoleRequest{RequesterUserEmail: "admin@example.com", Role: ADMIN})
+	assert.Equal(t, ErrPermissionDenied, err)
+	_, err = s.ChangeRole(ctx, "other-admin@example.com", ChangeRoleRequest{RequesterUserEmail: "admin@example.com", Role: VISITOR})
+	assert.Equal(t, ErrPermissionDenied, err)
+	_, err = s.ChangeRole(ctx, "ann@example.com", ChangeRoleRequest{RequesterUserEmail: "admin@example.com", Role: "owner"})
+	assert.NotNil(t, err)
+	assert.Equal(t, ADMIN, repo.items[1].Role)
+	assert.Equal(t, VISITOR, repo.items[2].Role)
+}
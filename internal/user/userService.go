@@ -2,10 +2,14 @@ package user
 
 import (
 	"context"
+	"database/sql"
 	"github.com/mailgun/mailgun-go/v3"
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/event"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
 	"time"
 )
 
@@ -13,11 +17,21 @@ import (
 type UserService interface {
 	CreateUser(ctx context.Context, input CreateUserRequest) (User, error)
 	GetUser(ctx context.Context, email string) (User, error)
+	GetUserByID(ctx context.Context, id string) (User, error)
+	SetEmail(ctx context.Context, id string, email string) (User, error)
 	UpdateUser(ctx context.Context, email string, input UpdateUserRequest, bypassAuth bool) (User, error)
 	DeleteUser(ctx context.Context, email string, input DeleteUserRequest) (User, error)
 	CheckPermission(ctx context.Context, requesterEmail string, role string) (bool, error)
 	UserSignUp(ctx context.Context, email string, code string) (mes string, id string, err error)
 	AuthenticateUser(ctx context.Context, email string, code string) (User, error)
+	Trash(ctx context.Context, requesterEmail string, page, perPage int) (*pagination.Pages, error)
+	RestoreUser(ctx context.Context, email string, input RestoreUserRequest) (User, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	QueryUsers(ctx context.Context, req QueryUsersRequest, page, perPage int) (*pagination.Pages, error)
+	GetProfile(ctx context.Context, requesterEmail string) (User, error)
+	UpdateProfile(ctx context.Context, req UpdateProfileRequest) (User, error)
+	ChangeRole(ctx context.Context, email string, req ChangeRoleRequest) (User, error)
+	RegisterUser(ctx context.Context, req RegisterUserRequest) (User, error)
 }
 
 // User represents the data about a User.
@@ -35,15 +49,24 @@ type CreateUserRequest struct {
 	Country        string     `json:"country"`
 }
 
-// UpdateUserRequest represents an user update request.
+// RegisterUserRequest represents a user who signs up on their own.
+type RegisterUserRequest struct {
+	EmailAddress string
+	Name         string
+	Country      string
+	// the code the user confirms their email address with
+	AuthCode string
+}
+
+// UpdateUserRequest represents an user update request. Empty fields are kept.
 type UpdateUserRequest struct {
 	RequesterUserEmail string `json:"requester_user_email"`
+	// the current role of the user. Roles are changed with ChangeRole.
 	Role               string `json:"role"`
 	Name               string `json:"name"`
 	Country            string `json:"country"`
 
 	// for internal use only
-	IncreaseScore      bool   `json:"increase_score"`
 	AuthCode           string `json:"auth_code"`
 	Authenticate       bool   `json:"authenticate"`
 	ResetAuth          bool   `json:"reset_auth"`
@@ -54,13 +77,40 @@ type DeleteUserRequest struct {
 	EmailAddress   string	  `json:"email_address"`
 }
 
+// RestoreUserRequest represents a request to restore a user from the trash.
+type RestoreUserRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
+
+// Sort orders of a user listing.
+const (
+	SortScore     = "score"
+	SortName      = "name"
+	SortCreatedAt = "created_at"
+)
+
+// QueryUsersRequest represents a request to list users.
+type QueryUsersRequest struct {
+	RequesterUserEmail string
+	UserFilter
+	// one of "score" (highest first), "name" or "created_at" (newest first). Defaults to "created_at".
+	Sort string
+}
+
 type userService struct {
 	repo   UsersRepository
 	logger log.Logger
+	events event.Publisher
+	transaction dbcontext.TransactionFunc
 }
 
 func (s userService) UserSignUp(ctx context.Context, email string, code string) (mes string, id string, err error) {
 
+	// self-registered users must receive a code they didn't choose, see the registration package
+	if user, err := s.GetUser(ctx, email); err == nil && user.SelfRegistered {
+		return "", "", errors.BadRequest("Use POST /v1/register/resend to confirm this email address")
+	}
+
 	mg := mailgun.NewMailgun(
 		//"YOUR_DOMAIN_NAME", // Domain name
 		"sandbox25224b1d21a0489d823328614e0bf07c.mailgun.org",
@@ -500,8 +550,8 @@ func (s userService) AuthenticateUser(ctx context.Context, email string, code st
 }
 
 // NewService creates a new user service.
-func NewUserService(repo UsersRepository, logger log.Logger) UserService {
-	return userService{repo, logger}
+func NewUserService(repo UsersRepository, logger log.Logger, events event.Publisher, transaction dbcontext.TransactionFunc) UserService {
+	return userService{repo, logger, events, transaction}
 }
 
 var SUPER_ADMIN = "super_admin"
@@ -509,6 +559,9 @@ var ADMIN = "admin"
 var VISITOR = "visitor"
 var roles = []string{SUPER_ADMIN, ADMIN, VISITOR}
 
+// ErrPermissionDenied is the error of CheckPermission when the requester may not manage the users of a role.
+var ErrPermissionDenied = errors.InternalServerError("Requester User doesn't have required permission")
+
 // constants
 var permissions = map[string][]string{
 	SUPER_ADMIN: {SUPER_ADMIN, ADMIN, VISITOR},
@@ -516,6 +569,42 @@ var permissions = map[string][]string{
 	VISITOR: []string{},
 }
 
+// IsAdmin reports whether the given role may administer the system.
+func IsAdmin(role string) bool {
+	return role == ADMIN || role == SUPER_ADMIN
+}
+
+// Roles returns the roles which exist in the system.
+func Roles() []string {
+	return append([]string{}, roles...)
+}
+
+// IsRole reports whether the given role exists in the system.
+func IsRole(role string) bool {
+	for i := range roles {
+		if roles[i] == role {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEmailAvailable returns an error if the email address belongs to a user, including a user in the trash,
+// as the email addresses of the users in the trash can't be reused until they are purged.
+func (s userService) checkEmailAvailable(ctx context.Context, email string) error {
+	if _, err := s.repo.GetUserByEmail(ctx, email); err == nil {
+		return errors.BadRequest("A user with this email address already exists : " + email)
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+	if _, err := s.repo.GetDeletedUserByEmail(ctx, email); err == nil {
+		return errors.BadRequest("A user with this email address is in the trash, restore them with POST /v1/admin/trash/users/" + email + "/restore")
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+	return nil
+}
+
 // Create creates a new user.
 func (s userService) CreateUser(ctx context.Context, req CreateUserRequest) (User, error) {
 	now := time.Now()
@@ -525,14 +614,68 @@ func (s userService) CreateUser(ctx context.Context, req CreateUserRequest) (Use
 	if !isPermitted {
 		return User{}, errMsg
 	}
+	if err := s.checkEmailAvailable(ctx, req.EmailAddress); err != nil {
+		return User{}, err
+	}
 
-	err := s.repo.CreateUser(ctx, entity.Users{
-		ID:           req.EmailAddress,
-		Role:         req.Role,
-		Name:         req.Name,
-		Country:      req.Country,
-		CreatedAt:    now,
-		UpdatedAt:    now,
+	id := entity.GenerateID()
+	err := s.transaction(ctx, func(ctx context.Context) error {
+		err := s.repo.CreateUser(ctx, entity.Users{
+			ID:           id,
+			Email:        req.EmailAddress,
+			Role:         req.Role,
+			Name:         req.Name,
+			Country:      req.Country,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		})
+		if err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.UserCreated, event.UserData{
+			ID:      id,
+			Email:   req.EmailAddress,
+			Role:    req.Role,
+			Name:    req.Name,
+			Country: req.Country,
+		})
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return s.GetUser(ctx, req.EmailAddress)
+}
+
+// RegisterUser creates a visitor who signed up on their own. They may not vote nor create content
+// until they confirm their email address with the code of the request.
+func (s userService) RegisterUser(ctx context.Context, req RegisterUserRequest) (User, error) {
+	if err := s.checkEmailAvailable(ctx, req.EmailAddress); err != nil {
+		return User{}, err
+	}
+	now := time.Now()
+	id := entity.GenerateID()
+	err := s.transaction(ctx, func(ctx context.Context) error {
+		err := s.repo.CreateUser(ctx, entity.Users{
+			ID:             id,
+			Email:          req.EmailAddress,
+			Role:           VISITOR,
+			Name:           req.Name,
+			Country:        req.Country,
+			AuthCode:       req.AuthCode,
+			SelfRegistered: true,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+		if err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.UserCreated, event.UserData{
+			ID:      id,
+			Email:   req.EmailAddress,
+			Role:    VISITOR,
+			Name:    req.Name,
+			Country: req.Country,
+		})
 	})
 	if err != nil {
 		return User{}, err
@@ -540,15 +683,52 @@ func (s userService) CreateUser(ctx context.Context, req CreateUserRequest) (Use
 	return s.GetUser(ctx, req.EmailAddress)
 }
 
+// CheckVerified returns an error if the user signed up on their own and hasn't confirmed their email address yet.
+func CheckVerified(user User) error {
+	if user.SelfRegistered && !user.IsAuth {
+		return errors.Forbidden("Requester User must confirm their email address first")
+	}
+	return nil
+}
+
 // Get returns the user with the specified the user email.
 func (s userService) GetUser(ctx context.Context, email string) (User, error) {
-	user, err := s.repo.GetUser(ctx, email)
+	user, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
 		return User{}, err
 	}
 	return User{user}, nil
 }
 
+// GetUserByID returns the user with the specified ID, which is what other records refer to users by.
+func (s userService) GetUserByID(ctx context.Context, id string) (User, error) {
+	user, err := s.repo.GetUser(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+	return User{user}, nil
+}
+
+// SetEmail changes the email address of the user with the specified ID. The caller is responsible for
+// verifying the new address. Records referring to the user are kept, as they use its ID.
+func (s userService) SetEmail(ctx context.Context, id string, email string) (User, error) {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+	if email != user.Email {
+		if err := s.checkEmailAvailable(ctx, email); err != nil {
+			return User{}, err
+		}
+	}
+	user.Email = email
+	user.UpdatedAt = time.Now()
+	if err := s.repo.UpdateUser(ctx, user.Users); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
 
 // Update updates the user
 func (s userService) UpdateUser(ctx context.Context, email string, req UpdateUserRequest, bypassAuth bool) (User, error) {
@@ -559,18 +739,21 @@ func (s userService) UpdateUser(ctx context.Context, email string, req UpdateUse
 		}
 
 	if !bypassAuth {
-		isPermitted, errMsg := s.CheckPermission(ctx, req.RequesterUserEmail, req.Role)
+		isPermitted, errMsg := s.CheckPermission(ctx, req.RequesterUserEmail, user.Role)
 
 		if !isPermitted {
 			return User{}, errMsg
 		}
-		user.Name = req.Name
-		user.Country = req.Country
-		user.Role = req.Role
-	}else {
-		if req.IncreaseScore {
-			user.Score++
+		if req.Role != "" && req.Role != user.Role {
+			return User{}, errors.BadRequest("The role of a user can only be changed with PUT /v1/admin/users/<email>/role")
+		}
+		if req.Name != "" {
+			user.Name = req.Name
 		}
+		if req.Country != "" {
+			user.Country = req.Country
+		}
+	}else {
 		if req.ResetAuth {
 			user.AuthCode = req.AuthCode
 			user.IsAuth = false
@@ -601,13 +784,100 @@ func (s userService) DeleteUser(ctx context.Context, email string, req DeleteUse
 		return User{}, errMsg
 	}
 
-	if err = s.repo.DeleteUser(ctx, email); err != nil {
+	if err = s.repo.DeleteUser(ctx, user.ID); err != nil {
 		return User{}, err
 	}
 	return user, nil
 }
 
 
+// Trash returns a page of the deleted users. Only admins may view the trash.
+func (s userService) Trash(ctx context.Context, requesterEmail string, page, perPage int) (*pagination.Pages, error) {
+	requester, err := s.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return nil, errors.InternalServerError("Requester User doesn't exists")
+	}
+	if !IsAdmin(requester.Role) {
+		return nil, errors.Forbidden("Requester User doesn't have required permission")
+	}
+
+	count, err := s.repo.CountDeletedUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	items, err := s.repo.QueryDeletedUsers(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	users := []User{}
+	for _, item := range items {
+		users = append(users, User{item})
+	}
+	pages.Items = users
+	return pages, nil
+}
+
+// RestoreUser moves the user with the specified email out of the trash.
+// The requester needs the same permission as for deleting the user.
+func (s userService) RestoreUser(ctx context.Context, email string, req RestoreUserRequest) (User, error) {
+	deleted, err := s.repo.GetDeletedUserByEmail(ctx, email)
+	if err != nil {
+		return User{}, err
+	}
+
+	isPermitted, errMsg := s.CheckPermission(ctx, req.RequesterUserEmail, deleted.Role)
+	if !isPermitted {
+		return User{}, errMsg
+	}
+
+	if err := s.repo.RestoreUser(ctx, deleted.ID); err != nil {
+		return User{}, err
+	}
+	return s.GetUserByID(ctx, deleted.ID)
+}
+
+// QueryUsers returns a page of the users matching the filters of the request. Only admins may list users.
+func (s userService) QueryUsers(ctx context.Context, req QueryUsersRequest, page, perPage int) (*pagination.Pages, error) {
+	requester, err := s.GetUser(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return nil, errors.InternalServerError("Requester User doesn't exists")
+	}
+	if !IsAdmin(requester.Role) {
+		return nil, errors.Forbidden("Requester User doesn't have required permission")
+	}
+	if req.Role != "" && !IsRole(req.Role) {
+		return nil, errors.BadRequest("This role doesn't exists in the system : " + req.Role)
+	}
+	if req.Sort == "" {
+		req.Sort = SortCreatedAt
+	}
+	if _, ok := userSortOrders[req.Sort]; !ok {
+		return nil, errors.BadRequest("This sort order doesn't exists in the system : " + req.Sort)
+	}
+
+	count, err := s.repo.CountUsers(ctx, req.UserFilter)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	items, err := s.repo.QueryUsers(ctx, req.UserFilter, req.Sort, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	users := []User{}
+	for _, item := range items {
+		users = append(users, User{item})
+	}
+	pages.Items = users
+	return pages, nil
+}
+
+// PurgeDeleted permanently removes the users deleted before the given time.
+func (s userService) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return s.repo.PurgeUsers(ctx, before)
+}
+
 func (s userService) CheckPermission(ctx context.Context, requesterEmail string, role string) (bool, error) {
 
 	requesterUser, errRqu :=  s.GetUser(ctx, requesterEmail)
@@ -641,8 +911,8 @@ func (s userService) CheckPermission(ctx context.Context, requesterEmail string,
 	}
 
 	if !rolePermitted {
-		return false, errors.InternalServerError("Requester User doesn't have required permission")
+		return false, ErrPermissionDenied
 	}
 
 	return true, errors.NotFound("")
-}
\ No newline at end of file
+}
@@ -0,0 +1,230 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// mockRepository keeps users in memory, including the users in the trash.
+type mockRepository struct {
+	UsersRepository
+	items []entity.Users
+}
+
+func (m *mockRepository) find(match func(u entity.Users) bool) (entity.Users, error) {
+	for _, u := range m.items {
+		if match(u) {
+			return u, nil
+		}
+	}
+	return entity.Users{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetUser(ctx context.Context, id string) (entity.Users, error) {
+	return m.find(func(u entity.Users) bool { return u.ID == id && u.DeletedAt == nil })
+}
+
+func (m *mockRepository) GetUserByEmail(ctx context.Context, email string) (entity.Users, error) {
+	return m.find(func(u entity.Users) bool { return u.Email == email && u.DeletedAt == nil })
+}
+
+func (m *mockRepository) GetDeletedUserByEmail(ctx context.Context, email string) (entity.Users, error) {
+	return m.find(func(u entity.Users) bool { return u.Email == email && u.DeletedAt != nil })
+}
+
+func (m *mockRepository) CreateUser(ctx context.Context, user entity.Users) error {
+	m.items = append(m.items, user)
+	return nil
+}
+
+func (m *mockRepository) UpdateUser(ctx context.Context, user entity.Users) error {
+	for i, u := range m.items {
+		if u.ID == user.ID {
+			m.items[i] = user
+		}
+	}
+	return nil
+}
+
+// matching returns the users outside the trash matching the role of the filter, the only criteria the tests use.
+func (m *mockRepository) matching(filter UserFilter) []entity.Users {
+	var users []entity.Users
+	for _, u := range m.items {
+		if u.DeletedAt == nil && (filter.Role == "" || u.Role == filter.Role) {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+func (m *mockRepository) CountUsers(ctx context.Context, filter UserFilter) (int, error) {
+	return len(m.matching(filter)), nil
+}
+
+func (m *mockRepository) QueryUsers(ctx context.Context, filter UserFilter, sort string, offset, limit int) ([]entity.Users, error) {
+	users := m.matching(filter)
+	if offset >= len(users) {
+		return nil, nil
+	}
+	users = users[offset:]
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+type mockPublisher struct {
+	types []string
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, eventType string, data interface{}) error {
+	m.types = append(m.types, eventType)
+	return nil
+}
+
+func newMockService(users ...entity.Users) (UserService, *mockRepository) {
+	repo := &mockRepository{items: users}
+	logger, _ := log.NewForTest()
+	transaction := func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	return NewUserService(repo, logger, &mockPublisher{}, transaction), repo
+}
+
+func TestUserService_CreateUser(t *testing.T) {
+	deletedAt := time.Now()
+	s, repo := newMockService(
+		entity.Users{ID: "1", Email: "admin@example.com", Role: SUPER_ADMIN},
+		entity.Users{ID: "2", Email: "trashed@example.com", Role: VISITOR, DeletedAt: &deletedAt},
+	)
+	ctx := context.Background()
+
+	u, err := s.CreateUser(ctx, CreateUserRequest{RequesterUserEmail: "admin@example.com", EmailAddress: "new@example.com", Role: VISITOR, Name: "New"})
+	assert.Nil(t, err)
+	assert.Equal(t, "new@example.com", u.Email)
+	assert.NotEqual(t, "new@example.com", u.ID)
+
+	_, err = s.CreateUser(ctx, CreateUserRequest{RequesterUserEmail: "admin@example.com", EmailAddress: "new@example.com", Role: VISITOR})
+	assert.EqualError(t, err, "A user with this email address already exists : new@example.com")
+
+	_, err = s.CreateUser(ctx, CreateUserRequest{RequesterUserEmail: "admin@example.com", EmailAddress: "trashed@example.com", Role: VISITOR})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "/v1/admin/trash/users/trashed@example.com/restore")
+	}
+	assert.Len(t, repo.items, 3)
+}
+
+func TestUserService_SetEmail(t *testing.T) {
+	deletedAt := time.Now()
+	s, repo := newMockService(
+		entity.Users{ID: "1", Email: "ann@example.com", Role: VISITOR},
+		entity.Users{ID: "2", Email: "bob@example.com", Role: VISITOR},
+		entity.Users{ID: "3", Email: "trashed@example.com", Role: VISITOR, DeletedAt: &deletedAt},
+	)
+	ctx := context.Background()
+
+	u, err := s.SetEmail(ctx, "1", "ann@example.org")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", u.ID)
+	assert.Equal(t, "ann@example.org", u.Email)
+	assert.Equal(t, "ann@example.org", repo.items[0].Email)
+
+	// setting the same address again changes nothing
+	_, err = s.SetEmail(ctx, "1", "ann@example.org")
+	assert.Nil(t, err)
+
+	_, err = s.SetEmail(ctx, "1", "bob@example.com")
+	assert.EqualError(t, err, "A user with this email address already exists : bob@example.com")
+	_, err = s.SetEmail(ctx, "1", "trashed@example.com")
+	assert.NotNil(t, err)
+	_, err = s.SetEmail(ctx, "4", "nobody@example.com")
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Equal(t, "ann@example.org", repo.items[0].Email)
+}
+
+func TestUserService_GetUserByID(t *testing.T) {
+	deletedAt := time.Now()
+	s, _ := newMockService(
+		entity.Users{ID: "1", Email: "ann@example.com"},
+		entity.Users{ID: "2", Email: "trashed@example.com", DeletedAt: &deletedAt},
+	)
+	ctx := context.Background()
+
+	u, err := s.GetUserByID(ctx, "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "ann@example.com", u.Email)
+
+	// users are not found by their email address, nor once in the trash
+	_, err = s.GetUserByID(ctx, "ann@example.com")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.GetUserByID(ctx, "2")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestUserService_QueryUsers(t *testing.T) {
+	deletedAt := time.Now()
+	s, _ := newMockService(
+		entity.Users{ID: "1", Email: "admin@example.com", Role: ADMIN},
+		entity.Users{ID: "2", Email: "ann@example.com", Role: VISITOR},
+		entity.Users{ID: "3", Email: "bob@example.com", Role: VISITOR},
+		entity.Users{ID: "4", Email: "cid@example.com", Role: VISITOR},
+		entity.Users{ID: "5", Email: "trashed@example.com", Role: VISITOR, DeletedAt: &deletedAt},
+	)
+	ctx := context.Background()
+
+	pages, err := s.QueryUsers(ctx, QueryUsersRequest{RequesterUserEmail: "admin@example.com"}, 1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, pages.TotalCount)
+	assert.Len(t, pages.Items, 4)
+
+	// the users are paginated
+	pages, err = s.QueryUsers(ctx, QueryUsersRequest{
+		RequesterUserEmail: "admin@example.com",
+		UserFilter:         UserFilter{Role: VISITOR},
+		Sort:               SortName,
+	}, 2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, pages.TotalCount)
+	assert.Equal(t, 2, pages.PageCount)
+	assert.Equal(t, 2, pages.Page)
+	if assert.Len(t, pages.Items, 1) {
+		assert.Equal(t, "cid@example.com", pages.Items.([]User)[0].Email)
+	}
+
+	// a page past the last one returns the last page
+	pages, err = s.QueryUsers(ctx, QueryUsersRequest{RequesterUserEmail: "admin@example.com"}, 5, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pages.Page)
+	assert.Len(t, pages.Items, 1)
+
+	// no user matches
+	pages, err = s.QueryUsers(ctx, QueryUsersRequest{RequesterUserEmail: "admin@example.com", UserFilter: UserFilter{Role: SUPER_ADMIN}}, 1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []User{}, pages.Items)
+}
+
+func TestUserService_QueryUsers_invalid(t *testing.T) {
+	s, _ := newMockService(
+		entity.Users{ID: "1", Email: "admin@example.com", Role: ADMIN},
+		entity.Users{ID: "2", Email: "ann@example.com", Role: VISITOR},
+	)
+	ctx := context.Background()
+
+	// only admins may list users
+	_, err := s.QueryUsers(ctx, QueryUsersRequest{RequesterUserEmail: "ann@example.com"}, 1, 10)
+	assert.EqualError(t, err, "Requester User doesn't have required permission")
+	_, err = s.QueryUsers(ctx, QueryUsersRequest{RequesterUserEmail: "nobody@example.com"}, 1, 10)
+	assert.NotNil(t, err)
+
+	_, err = s.QueryUsers(ctx, QueryUsersRequest{RequesterUserEmail: "admin@example.com", UserFilter: UserFilter{Role: "owner"}}, 1, 10)
+	assert.EqualError(t, err, "This role doesn't exists in the system : owner")
+	_, err = s.QueryUsers(ctx, QueryUsersRequest{RequesterUserEmail: "admin@example.com", Sort: "email"}, 1, 10)
+	assert.EqualError(t, err, "This sort order doesn't exists in the system : email")
+	for _, sort := range []string{SortScore, SortName, SortCreatedAt} {
+		_, err = s.QueryUsers(ctx, QueryUsersRequest{RequesterUserEmail: "admin@example.com", Sort: sort}, 1, 10)
+		assert.Nil(t, err, sort)
+	}
+}
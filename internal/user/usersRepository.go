@@ -2,17 +2,48 @@ package user
 
 import (
 	"context"
+	"github.com/go-ozzo/ozzo-dbx"
 	"github.com/qiangxue/go-rest-api/internal/entity"
 	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
 	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
 )
 
 // Repository encapsulates the logic to access users from the data source.
 type UsersRepository interface {
 	GetUser(ctx context.Context, id string) (entity.Users, error)
+	GetUserByEmail(ctx context.Context, email string) (entity.Users, error)
 	CreateUser(ctx context.Context, album entity.Users) error
 	UpdateUser(ctx context.Context, album entity.Users) error
 	DeleteUser(ctx context.Context, id string) error
+	GetDeletedUser(ctx context.Context, id string) (entity.Users, error)
+	GetDeletedUserByEmail(ctx context.Context, email string) (entity.Users, error)
+	CountDeletedUsers(ctx context.Context) (int, error)
+	QueryDeletedUsers(ctx context.Context, offset, limit int) ([]entity.Users, error)
+	RestoreUser(ctx context.Context, id string) error
+	PurgeUsers(ctx context.Context, before time.Time) (int64, error)
+	CountUsers(ctx context.Context, filter UserFilter) (int, error)
+	QueryUsers(ctx context.Context, filter UserFilter, sort string, offset, limit int) ([]entity.Users, error)
+}
+
+// UserFilter represents the conditions users are listed by. Empty conditions are ignored.
+type UserFilter struct {
+	Role    string
+	Country string
+	IsAuth  *bool
+	// the users created at or after this time
+	CreatedAfter *time.Time
+	// the users created before this time
+	CreatedBefore *time.Time
+	// a case-insensitive prefix of the name or the email address
+	Search string
+}
+
+// userSortOrders maps the sort options of a user listing to their ORDER BY clauses.
+var userSortOrders = map[string][]string{
+	SortScore:     {"score DESC", "id"},
+	SortName:      {"name", "id"},
+	SortCreatedAt: {"created_at DESC", "id"},
 }
 
 type usersRepository struct {
@@ -26,7 +57,14 @@ func NewUsersRepository(db *dbcontext.DB, logger log.Logger) UsersRepository {
 
 func (r usersRepository) GetUser(ctx context.Context, ID string) (entity.Users, error) {
 	var user entity.Users
-	err := r.db.With(ctx).Select().Model(ID, &user)
+	err := r.db.With(ctx).Select().Where(dbx.NewExp("deleted_at IS NULL")).Model(ID, &user)
+	return user, err
+}
+
+// GetUserByEmail reads the user with the specified email address.
+func (r usersRepository) GetUserByEmail(ctx context.Context, email string) (entity.Users, error) {
+	var user entity.Users
+	err := r.db.With(ctx).Select().Where(dbx.And(dbx.HashExp{"email": email}, dbx.NewExp("deleted_at IS NULL"))).One(&user)
 	return user, err
 }
 
@@ -38,10 +76,113 @@ func (r usersRepository) UpdateUser(ctx context.Context, user entity.Users) erro
 	return r.db.With(ctx).Model(&user).Update()
 }
 
-func (r usersRepository) DeleteUser(ctx context.Context, emailAddress string) error {
-	user, err := r.GetUser(ctx, emailAddress)
+func (r usersRepository) DeleteUser(ctx context.Context, ID string) error {
+	user, err := r.GetUser(ctx, ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user.DeletedAt = &now
+	return r.db.With(ctx).Model(&user).Update("DeletedAt")
+}
+
+// GetDeletedUser reads the user with the specified ID from the trash.
+func (r usersRepository) GetDeletedUser(ctx context.Context, ID string) (entity.Users, error) {
+	var user entity.Users
+	err := r.db.With(ctx).Select().Where(dbx.NewExp("deleted_at IS NOT NULL")).Model(ID, &user)
+	return user, err
+}
+
+// GetDeletedUserByEmail reads the user with the specified email address from the trash.
+func (r usersRepository) GetDeletedUserByEmail(ctx context.Context, email string) (entity.Users, error) {
+	var user entity.Users
+	err := r.db.With(ctx).Select().Where(dbx.And(dbx.HashExp{"email": email}, dbx.NewExp("deleted_at IS NOT NULL"))).One(&user)
+	return user, err
+}
+
+// CountDeletedUsers returns the number of users in the trash.
+func (r usersRepository) CountDeletedUsers(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("users").Where(dbx.NewExp("deleted_at IS NOT NULL")).Row(&count)
+	return count, err
+}
+
+// QueryDeletedUsers returns the users in the trash, most recently deleted first.
+func (r usersRepository) QueryDeletedUsers(ctx context.Context, offset, limit int) ([]entity.Users, error) {
+	var users []entity.Users
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.NewExp("deleted_at IS NOT NULL")).
+		OrderBy("deleted_at DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&users)
+	return users, err
+}
+
+// RestoreUser moves the user with the specified ID out of the trash.
+func (r usersRepository) RestoreUser(ctx context.Context, ID string) error {
+	user, err := r.GetDeletedUser(ctx, ID)
 	if err != nil {
 		return err
 	}
-	return r.db.With(ctx).Model(&user).Delete()
-}
\ No newline at end of file
+	user.DeletedAt = nil
+	return r.db.With(ctx).Model(&user).Update("DeletedAt")
+}
+
+// PurgeUsers permanently deletes the users moved to the trash before the given time.
+func (r usersRepository) PurgeUsers(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.With(ctx).
+		Delete("users", dbx.NewExp("deleted_at < {:before}", dbx.Params{"before": before})).
+		Execute()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountUsers returns the number of users matching the filter, excluding the trash.
+func (r usersRepository) CountUsers(ctx context.Context, filter UserFilter) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("users").Where(filterExp(filter)).Row(&count)
+	return count, err
+}
+
+// QueryUsers returns the users matching the filter, excluding the trash, in the given sort order.
+func (r usersRepository) QueryUsers(ctx context.Context, filter UserFilter, sort string, offset, limit int) ([]entity.Users, error) {
+	var users []entity.Users
+	err := r.db.With(ctx).
+		Select().
+		Where(filterExp(filter)).
+		OrderBy(userSortOrders[sort]...).
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&users)
+	return users, err
+}
+
+func filterExp(filter UserFilter) dbx.Expression {
+	exps := []dbx.Expression{dbx.NewExp("deleted_at IS NULL")}
+	if filter.Role != "" {
+		exps = append(exps, dbx.HashExp{"role": filter.Role})
+	}
+	if filter.Country != "" {
+		exps = append(exps, dbx.HashExp{"country": filter.Country})
+	}
+	if filter.IsAuth != nil {
+		exps = append(exps, dbx.HashExp{"is_auth": *filter.IsAuth})
+	}
+	if filter.CreatedAfter != nil {
+		exps = append(exps, dbx.NewExp("created_at >= {:after}", dbx.Params{"after": *filter.CreatedAfter}))
+	}
+	if filter.CreatedBefore != nil {
+		exps = append(exps, dbx.NewExp("created_at < {:before}", dbx.Params{"before": *filter.CreatedBefore}))
+	}
+	if filter.Search != "" {
+		email := dbx.Like("email", filter.Search).Match(false, true)
+		name := dbx.Like("name", filter.Search).Match(false, true)
+		email.Like, name.Like = "ILIKE", "ILIKE"
+		exps = append(exps, dbx.Or(email, name))
+	}
+	return dbx.And(exps...)
+}
@@ -0,0 +1,24 @@
+package user
+
+import (
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_filterExp(t *testing.T) {
+	db := dbx.NewFromDB(nil, "postgres")
+
+	params := dbx.Params{}
+	assert.Equal(t, "deleted_at IS NULL", filterExp(UserFilter{}).Build(db, params))
+
+	params = dbx.Params{}
+	sql := filterExp(UserFilter{Role: VISITOR, Search: "ann@ex"}).Build(db, params)
+	assert.Equal(t, `(deleted_at IS NULL) AND ("role"={:p0}) AND (("email" ILIKE {:p1}) OR ("name" ILIKE {:p2}))`, sql)
+	assert.Equal(t, dbx.Params{"p0": VISITOR, "p1": "ann@ex%", "p2": "ann@ex%"}, params)
+
+	// the wildcards of the search are escaped
+	params = dbx.Params{}
+	filterExp(UserFilter{Search: "100%_ann"}).Build(db, params)
+	assert.Equal(t, `100\%\_ann%`, params["p0"])
+}
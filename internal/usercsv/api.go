@@ -0,0 +1,71 @@
+package usercsv
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxFileSize is the maximum size of an imported CSV file in bytes.
+const maxFileSize = 5 << 20
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Post("/admin/users/import", res.importUsers)
+	r.Get("/admin/users/export", res.exportUsers)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// importUsers reads the CSV file from the request body. It responds with 422 if any row has errors.
+func (r resource) importUsers(c *routing.Context) error {
+	req := ImportRequest{RequesterUserEmail: c.Query("requester_user_email")}
+	if v := c.Query("dry_run"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.BadRequest("dry_run must be true or false")
+		}
+		req.DryRun = dryRun
+	}
+
+	body := http.MaxBytesReader(c.Response, c.Request.Body, maxFileSize)
+	result, err := r.service.Import(c.Request.Context(), req, body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(result.Errors) > 0:
+		return c.WriteWithStatus(result, http.StatusUnprocessableEntity)
+	case result.DryRun:
+		return c.Write(result)
+	}
+	return c.WriteWithStatus(result, http.StatusCreated)
+}
+
+func (r resource) exportUsers(c *routing.Context) error {
+	users, err := r.service.Export(c.Request.Context(), ExportRequest{
+		RequesterUserEmail: c.Query("requester_user_email"),
+		Filter: Filter{
+			Role:    c.Query("role"),
+			Country: c.Query("country"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	filename := "users-" + time.Now().Format("2006-01-02") + ".csv"
+	header := c.Response.Header()
+	header.Set("Content-Type", "text/csv; charset=utf-8")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	return WriteUsers(c.Response, users)
+}
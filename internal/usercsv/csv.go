@@ -0,0 +1,141 @@
+package usercsv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"io"
+	"strings"
+)
+
+// Columns are the columns of a CSV file of users, in the order they are exported.
+// Imported files may list them in any order, and only the email column is required.
+var Columns = []string{"email", "name", "role", "country"}
+
+// Row represents a user read from a CSV file.
+type Row struct {
+	// the number of the row in the file, not counting the header
+	Number  int    `json:"-"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Country string `json:"country"`
+}
+
+// RowError describes why a row of a CSV file cannot be imported.
+type RowError struct {
+	Row   int    `json:"row"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+// ReadRows reads the users of a CSV file whose first row names the columns. Rows that don't have as
+// many fields as the header are returned as row errors instead of rows.
+func ReadRows(r io.Reader) ([]Row, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("the file is empty")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		// spreadsheets often start the file with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !isColumn(name) {
+			return nil, nil, fmt.Errorf("unknown column %q, the columns are %s", name, strings.Join(Columns, ", "))
+		}
+		if _, ok := index[name]; ok {
+			return nil, nil, fmt.Errorf("the column %q appears twice", name)
+		}
+		index[name] = i
+	}
+	if _, ok := index["email"]; !ok {
+		return nil, nil, fmt.Errorf("the email column is required")
+	}
+
+	var rows []Row
+	var rowErrors []RowError
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if len(record) != len(header) {
+			rowErrors = append(rowErrors, RowError{
+				Row:   number,
+				Error: fmt.Sprintf("expected %d fields, found %d", len(header), len(record)),
+			})
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := index[name]; ok {
+				return strings.TrimSpace(unescapeFormula(record[i]))
+			}
+			return ""
+		}
+		rows = append(rows, Row{
+			Number:  number,
+			Email:   field("email"),
+			Name:    field("name"),
+			Role:    field("role"),
+			Country: field("country"),
+		})
+	}
+	return rows, rowErrors, nil
+}
+
+// WriteUsers writes the users as a CSV file which can be imported again. Values which a spreadsheet would run as
+// a formula are escaped.
+func WriteUsers(w io.Writer, users []entity.Users) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Columns); err != nil {
+		return err
+	}
+	for _, u := range users {
+		record := []string{u.Email, u.Name, u.Role, u.Country}
+		for i := range record {
+			record[i] = escapeFormula(record[i])
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formulaPrefixes are the characters which make spreadsheets run a cell as a formula when it starts with one of them.
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeFormula prefixes the values which a spreadsheet would run as a formula with a quote, so that they are shown
+// as text instead.
+func escapeFormula(value string) string {
+	if value != "" && strings.IndexByte(formulaPrefixes, value[0]) >= 0 {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeFormula removes the quote added by escapeFormula, so that an export can be imported again.
+func unescapeFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.IndexByte(formulaPrefixes, value[1]) >= 0 {
+		return value[1:]
+	}
+	return value
+}
+
+func isColumn(name string) bool {
+	for _, column := range Columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package usercsv
+
+import (
+	"bytes"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestReadRows(t *testing.T) {
+	rows, rowErrors, err := ReadRows(strings.NewReader("\ufeffName,Email\n" +
+		"Ada, ada@example.com\n" +
+		"Grace\n" +
+		"\"Hopper, Grace\",grace@example.com\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []Row{
+		{Number: 1, Email: "ada@example.com", Name: "Ada"},
+		{Number: 3, Email: "grace@example.com", Name: "Hopper, Grace"},
+	}, rows)
+	assert.Equal(t, []RowError{{Row: 2, Error: "expected 2 fields, found 1"}}, rowErrors)
+
+	_, _, err = ReadRows(strings.NewReader("name,country\n"))
+	assert.NotNil(t, err)
+	_, _, err = ReadRows(strings.NewReader("email,phone\n"))
+	assert.NotNil(t, err)
+	_, _, err = ReadRows(strings.NewReader(""))
+	assert.NotNil(t, err)
+}
+
+func TestWriteUsers(t *testing.T) {
+	users := []entity.Users{
+		{ID: "1", Email: "ada@example.com", Name: "Lovelace, Ada", Role: "admin", Country: "UK"},
+		{ID: "2", Email: "grace@example.com", Name: "Grace", Role: "visitor"},
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, WriteUsers(&buf, users))
+	assert.Equal(t, "email,name,role,country\n"+
+		"ada@example.com,\"Lovelace, Ada\",admin,UK\n"+
+		"grace@example.com,Grace,visitor,\n", buf.String())
+
+	// an export can be imported again
+	rows, rowErrors, err := ReadRows(&buf)
+	assert.Nil(t, err)
+	assert.Empty(t, rowErrors)
+	assert.Equal(t, Row{Number: 1, Email: "ada@example.com", Name: "Lovelace, Ada", Role: "admin", Country: "UK"}, rows[0])
+}
+
+func TestWriteUsers_formulas(t *testing.T) {
+	users := []entity.Users{
+		{ID: "1", Email: "ada@example.com", Name: "=HYPERLINK(\"http://example.com\")", Role: "visitor", Country: "+44"},
+		{ID: "2", Email: "@grace@example.com", Name: "-1", Role: "visitor", Country: "\tUK"},
+		{ID: "3", Email: "joan@example.com", Name: "Joan\r", Role: "visitor", Country: "\rFR"},
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, WriteUsers(&buf, users))
+	assert.Equal(t, "email,name,role,country\n"+
+		"ada@example.com,\"'=HYPERLINK(\"\"http://example.com\"\")\",visitor,'+44\n"+
+		"'@grace@example.com,'-1,visitor,'\tUK\n"+
+		"joan@example.com,\"Joan\r\",visitor,\"'\rFR\"\n", buf.String())
+
+	// the quotes are removed when the file is imported again
+	rows, rowErrors, err := ReadRows(&buf)
+	assert.Nil(t, err)
+	assert.Empty(t, rowErrors)
+	assert.Equal(t, Row{Number: 1, Email: "ada@example.com", Name: "=HYPERLINK(\"http://example.com\")", Role: "visitor", Country: "+44"}, rows[0])
+	assert.Equal(t, Row{Number: 2, Email: "@grace@example.com", Name: "-1", Role: "visitor", Country: "UK"}, rows[1])
+	assert.Equal(t, "FR", rows[2].Country)
+}
+
+func Test_validateRow(t *testing.T) {
+	assert.Nil(t, validateRow(Row{Email: "ada@example.com", Name: "Ada", Role: "visitor"}))
+	err := validateRow(Row{Email: "ada", Role: "owner"})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "email: must be a valid email address")
+		assert.Contains(t, err.Error(), "name: cannot be blank")
+		assert.Contains(t, err.Error(), "role: must be one of super_admin, admin, visitor")
+	}
+}
@@ -0,0 +1,72 @@
+package usercsv
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+)
+
+// Repository encapsulates the logic to access users in bulk from the data source.
+type Repository interface {
+	// TakenEmails returns which of the given email addresses belong to a user, including the users in the trash.
+	TakenEmails(ctx context.Context, emails []string) (map[string]bool, error)
+
+	// QueryUsers returns the users outside the trash matching the filter, ordered by email address.
+	QueryUsers(ctx context.Context, filter Filter) ([]entity.Users, error)
+}
+
+// Filter represents the conditions exported users are selected by. Empty conditions are ignored.
+type Filter struct {
+	Role    string
+	Country string
+}
+
+// repository reads and writes users in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new user CSV repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// TakenEmails returns which of the given email addresses belong to a user in the database, including the trash,
+// as the email addresses of the users in the trash can't be reused either.
+func (r repository) TakenEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	taken := map[string]bool{}
+	if len(emails) == 0 {
+		return taken, nil
+	}
+	values := make([]interface{}, len(emails))
+	for i, email := range emails {
+		values[i] = email
+	}
+	var found []string
+	err := r.db.With(ctx).Select("email").From("users").Where(dbx.In("email", values...)).Column(&found)
+	for _, email := range found {
+		taken[email] = true
+	}
+	return taken, err
+}
+
+// QueryUsers reads the users outside the trash matching the filter from the database, ordered by email address.
+func (r repository) QueryUsers(ctx context.Context, filter Filter) ([]entity.Users, error) {
+	exp := dbx.HashExp{}
+	if filter.Role != "" {
+		exp["role"] = filter.Role
+	}
+	if filter.Country != "" {
+		exp["country"] = filter.Country
+	}
+	var users []entity.Users
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.And(exp, dbx.NewExp("deleted_at IS NULL"))).
+		OrderBy("email").
+		All(&users)
+	return users, err
+}
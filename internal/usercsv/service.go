@@ -0,0 +1,228 @@
+// Package usercsv imports users in bulk from CSV files and exports them as CSV files.
+package usercsv
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxRows is the maximum number of users in an imported file.
+const MaxRows = 5000
+
+// Service encapsulates usecase logic for importing and exporting users.
+type Service interface {
+	Import(ctx context.Context, req ImportRequest, file io.Reader) (ImportResult, error)
+	Export(ctx context.Context, req ExportRequest) ([]entity.Users, error)
+}
+
+// ImportRequest represents a request to import the users of a CSV file.
+type ImportRequest struct {
+	RequesterUserEmail string
+	// whether the file is only validated
+	DryRun bool
+}
+
+// ImportResult represents the outcome of an import. Either every row is imported, or none if any has errors.
+type ImportResult struct {
+	DryRun bool `json:"dry_run"`
+	// the number of users in the file
+	Rows int `json:"rows"`
+	// the number of users created, which is 0 on a dry run or if any row has errors
+	Imported int        `json:"imported"`
+	Errors   []RowError `json:"errors"`
+}
+
+// ExportRequest represents a request to export users as a CSV file.
+type ExportRequest struct {
+	RequesterUserEmail string
+	Filter
+}
+
+type service struct {
+	repo        Repository
+	userService user.UserService
+	transaction dbcontext.TransactionFunc
+	logger      log.Logger
+}
+
+// NewService creates a new user CSV service.
+func NewService(repo Repository, userService user.UserService, transaction dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, userService, transaction, logger}
+}
+
+// Import validates every row of a CSV file of users and creates them all in one transaction, unless it is a
+// dry run or a row has errors. Only admins may import users, and only with the roles they may assign.
+// Rows without a role create visitors.
+func (s service) Import(ctx context.Context, req ImportRequest, file io.Reader) (ImportResult, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return ImportResult{}, err
+	}
+	rows, rowErrors, err := ReadRows(file)
+	if err != nil {
+		return ImportResult{}, errors.BadRequest("The CSV file is invalid : " + err.Error())
+	}
+	// the rows of the file, including the malformed ones
+	count := len(rows) + len(rowErrors)
+	if count > MaxRows {
+		return ImportResult{}, errors.BadRequest("The CSV file has too many rows, the maximum is 5000")
+	}
+	for i := range rows {
+		if rows[i].Role == "" {
+			rows[i].Role = user.VISITOR
+		}
+	}
+	validationErrors, err := s.validate(ctx, req.RequesterUserEmail, rows)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	rowErrors = append(rowErrors, validationErrors...)
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+
+	result := ImportResult{DryRun: req.DryRun, Rows: count, Errors: rowErrors}
+	if result.Errors == nil {
+		result.Errors = []RowError{}
+	}
+	if req.DryRun || len(rowErrors) > 0 {
+		return result, nil
+	}
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		for _, row := range rows {
+			if _, err := s.userService.CreateUser(ctx, user.CreateUserRequest{
+				RequesterUserEmail: req.RequesterUserEmail,
+				EmailAddress:       row.Email,
+				Role:               row.Role,
+				Name:               row.Name,
+				Country:            row.Country,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	result.Imported = len(rows)
+	s.logger.With(ctx, "requester", req.RequesterUserEmail).Infof("imported %d users", result.Imported)
+	return result, nil
+}
+
+// validate returns the errors of the rows of an import: invalid fields, roles the requester may not assign,
+// and email addresses which appear twice or already belong to a user.
+func (s service) validate(ctx context.Context, requesterEmail string, rows []Row) ([]RowError, error) {
+	var emails []string
+	for _, row := range rows {
+		emails = append(emails, row.Email)
+	}
+	taken, err := s.repo.TakenEmails(ctx, emails)
+	if err != nil {
+		return nil, err
+	}
+
+	var rowErrors []RowError
+	seen := map[string]int{}
+	permitted := map[string]bool{}
+	for _, row := range rows {
+		if err := validateRow(row); err != nil {
+			errs, ok := err.(validation.Errors)
+			if !ok {
+				return nil, err
+			}
+			var fields []string
+			for field := range errs {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			for _, field := range fields {
+				rowErrors = append(rowErrors, RowError{Row: row.Number, Field: field, Error: errs[field].Error()})
+			}
+			continue
+		}
+		if first, ok := seen[row.Email]; ok {
+			rowErrors = append(rowErrors, RowError{Row: row.Number, Field: "email",
+				Error: "this email address is already used by row " + strconv.Itoa(first)})
+			continue
+		}
+		seen[row.Email] = row.Number
+		if taken[row.Email] {
+			rowErrors = append(rowErrors, RowError{Row: row.Number, Field: "email",
+				Error: "a user with this email address already exists"})
+			continue
+		}
+		allowed, ok := permitted[row.Role]
+		if !ok {
+			allowed, err = s.userService.CheckPermission(ctx, requesterEmail, row.Role)
+			if !allowed && err != user.ErrPermissionDenied {
+				return nil, err
+			}
+			permitted[row.Role] = allowed
+		}
+		if !allowed {
+			rowErrors = append(rowErrors, RowError{Row: row.Number, Field: "role",
+				Error: "you may not create users with this role"})
+		}
+	}
+	return rowErrors, nil
+}
+
+// validateRow validates the fields of a row.
+func validateRow(row Row) error {
+	return validation.ValidateStruct(&row,
+		validation.Field(&row.Email, validation.Required, validation.Length(0, 254), validation.By(isEmail)),
+		validation.Field(&row.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&row.Role, validation.By(isRole)),
+		validation.Field(&row.Country, validation.Length(0, 128)),
+	)
+}
+
+func isEmail(value interface{}) error {
+	email, _ := value.(string)
+	if email != "" && (!strings.Contains(email, "@") || strings.ContainsAny(email, " \t\r\n/")) {
+		return validation.NewError("validation_is_email", "must be a valid email address")
+	}
+	return nil
+}
+
+func isRole(value interface{}) error {
+	if role, _ := value.(string); !user.IsRole(role) {
+		return validation.NewError("validation_is_role", "must be one of "+strings.Join(user.Roles(), ", "))
+	}
+	return nil
+}
+
+// Export returns the users outside the trash matching the filter of the request. Only admins may export users.
+func (s service) Export(ctx context.Context, req ExportRequest) ([]entity.Users, error) {
+	if err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return nil, err
+	}
+	if req.Role != "" && !user.IsRole(req.Role) {
+		return nil, errors.BadRequest("This role doesn't exists in the system : " + req.Role)
+	}
+	users, err := s.repo.QueryUsers(ctx, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.With(ctx, "requester", req.RequesterUserEmail).Infof("exported %d users", len(users))
+	return users, nil
+}
+
+// checkAdmin returns an error unless the requester is an admin.
+func (s service) checkAdmin(ctx context.Context, requesterEmail string) error {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return errors.InternalServerError("Requester User doesn't exists")
+	}
+	if !user.IsAdmin(requester.Role) {
+		return errors.Forbidden("Requester User doesn't have required permission")
+	}
+	return nil
+}
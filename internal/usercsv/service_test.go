@@ -0,0 +1,76 @@
+package usercsv
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type mockUserService struct {
+	user.UserService
+}
+
+func (m mockUserService) GetUser(ctx context.Context, email string) (user.User, error) {
+	return user.User{Users: entity.Users{ID: "1", Email: email, Role: user.SUPER_ADMIN}}, nil
+}
+
+func (m mockUserService) CheckPermission(ctx context.Context, requesterEmail string, role string) (bool, error) {
+	if requesterEmail == "failing@example.com" {
+		return false, errors.InternalServerError("")
+	}
+	if role == user.SUPER_ADMIN {
+		return false, user.ErrPermissionDenied
+	}
+	return true, nil
+}
+
+type mockRepository struct {
+	Repository
+}
+
+func (m mockRepository) TakenEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	return map[string]bool{"taken@example.com": true}, nil
+}
+
+func TestService_Import_rows(t *testing.T) {
+	logger, _ := log.NewForTest()
+	transaction := func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	s := NewService(mockRepository{}, mockUserService{}, transaction, logger)
+
+	result, err := s.Import(context.Background(), ImportRequest{RequesterUserEmail: "admin@example.com", DryRun: true},
+		strings.NewReader("email,name\n"+
+			"ada@example.com,Ada\n"+
+			"grace@example.com\n"+
+			"taken@example.com,Taken\n"+
+			"not an email,\n"))
+	assert.Nil(t, err)
+	// every row is counted once, whether it is malformed, invalid or has several errors
+	assert.Equal(t, 4, result.Rows)
+	assert.Len(t, result.Errors, 4)
+	assert.Equal(t, 0, result.Imported)
+}
+
+func TestService_Import_permissions(t *testing.T) {
+	logger, _ := log.NewForTest()
+	transaction := func(ctx context.Context, f func(ctx context.Context) error) error { return f(ctx) }
+	s := NewService(mockRepository{}, mockUserService{}, transaction, logger)
+	file := "email,name,role\n" +
+		"ada@example.com,Ada,admin\n" +
+		"grace@example.com,Grace,super_admin\n"
+
+	// the roles the requester may not assign are row errors
+	result, err := s.Import(context.Background(), ImportRequest{RequesterUserEmail: "admin@example.com", DryRun: true},
+		strings.NewReader(file))
+	assert.Nil(t, err)
+	assert.Equal(t, []RowError{{Row: 2, Field: "role", Error: "you may not create users with this role"}}, result.Errors)
+
+	// while the other errors of the permission check fail the import
+	_, err = s.Import(context.Background(), ImportRequest{RequesterUserEmail: "failing@example.com", DryRun: true},
+		strings.NewReader(file))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"net/http"
+	"strconv"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/admin/webhooks", res.query)
+	r.Post("/admin/webhooks", res.create)
+	r.Get("/admin/webhooks/<id>", res.get)
+	r.Put("/admin/webhooks/<id>", res.update)
+	r.Delete("/admin/webhooks/<id>", res.delete)
+	r.Get("/admin/webhooks/<id>/deliveries", res.deliveries)
+	r.Post("/admin/webhooks/<id>/deliveries/<deliveryId>/replay", res.replay)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	webhook, err := r.service.Get(c.Request.Context(), c.Query("requester_user_email"), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(webhook)
+}
+
+func (r resource) query(c *routing.Context) error {
+	webhooks, err := r.service.Query(c.Request.Context(), c.Query("requester_user_email"))
+	if err != nil {
+		return err
+	}
+	return c.Write(webhooks)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateWebhookRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	webhook, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(webhook, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	var input UpdateWebhookRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	webhook, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(webhook)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	var input DeleteWebhookRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	webhook, err := r.service.Delete(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(webhook)
+}
+
+func (r resource) deliveries(c *routing.Context) error {
+	page, _ := strconv.Atoi(c.Query(pagination.PageVar))
+	perPage, _ := strconv.Atoi(c.Query(pagination.PageSizeVar))
+
+	pages, err := r.service.Deliveries(c.Request.Context(), c.Query("requester_user_email"), c.Param("id"),
+		c.Query("status"), page, perPage)
+	if err != nil {
+		return err
+	}
+	return c.Write(pages)
+}
+
+func (r resource) replay(c *routing.Context) error {
+	var input ReplayRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	delivery, err := r.service.Replay(c.Request.Context(), c.Param("id"), c.Param("deliveryId"), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(delivery, http.StatusCreated)
+}
@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxAttempts is the number of attempts after which a delivery fails.
+	maxAttempts = 8
+	// baseBackoff is the delay before the first retry. Each retry waits twice as long as the previous one.
+	baseBackoff = 30 * time.Second
+	// maxBackoff is the longest delay between two attempts.
+	maxBackoff = time.Hour
+	// deliveryLease is how long a claimed delivery is kept from other dispatchers while it is being delivered.
+	deliveryLease = 5 * time.Minute
+	// maxResponseError is the number of bytes of an unexpected response kept in the delivery log.
+	maxResponseError = 512
+)
+
+// Headers of the requests posted to webhooks.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// the signature is "sha256=" followed by the hex encoded HMAC-SHA256 of the timestamp, a dot and the body
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Deliver makes the due attempts to deliver events to webhooks. It returns the number of attempts made.
+func (s service) Deliver(ctx context.Context, limit int) (int, error) {
+	now := time.Now()
+	deliveries, err := s.repo.ClaimDue(ctx, now, now.Add(deliveryLease), limit)
+	if err != nil {
+		return 0, err
+	}
+	webhooks := map[string]entity.Webhook{}
+	for _, delivery := range deliveries {
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			if webhook, err = s.repo.Get(ctx, delivery.WebhookID); err != nil {
+				return 0, err
+			}
+			webhooks[webhook.ID] = webhook
+		}
+		delivery = s.attempt(ctx, webhook, delivery, time.Now())
+		if delivery.Status == StatusFailed {
+			s.logger.With(ctx, "webhook", webhook.ID).Infof("delivery %s failed after %d attempts: %s",
+				delivery.ID, delivery.Attempts, delivery.Error)
+		}
+		if err := s.repo.UpdateDelivery(ctx, delivery); err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// attempt posts the event of a delivery to its webhook and records the outcome.
+func (s service) attempt(ctx context.Context, webhook entity.Webhook, delivery entity.WebhookDelivery, now time.Time) entity.WebhookDelivery {
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+	var err error
+	if webhook.Enabled {
+		delivery.ResponseCode, err = s.post(ctx, webhook, delivery, now)
+	} else {
+		delivery.ResponseCode, err = 0, fmt.Errorf("the webhook is disabled")
+		// there is no point in retrying until the webhook is enabled again and the delivery replayed
+		delivery.Attempts = maxAttempts
+	}
+	if err == nil {
+		delivery.Status = StatusSucceeded
+		delivery.Error = ""
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		return delivery
+	}
+	delivery.Error = err.Error()
+	if delivery.Attempts >= maxAttempts {
+		delivery.Status = StatusFailed
+		delivery.NextAttemptAt = nil
+		return delivery
+	}
+	next := now.Add(backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+	return delivery
+}
+
+// post sends the payload of a delivery to a webhook. It returns the status code of the response,
+// and an error unless the status code is 2xx.
+func (s service) post(ctx context.Context, webhook entity.Webhook, delivery entity.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, []byte(delivery.Payload)))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseError))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return res.StatusCode, nil
+}
+
+// Sign returns the signature of a payload sent at the given Unix timestamp, as found in the X-Webhook-Signature header.
+// Receivers should compute it with their copy of the secret and compare the results in constant time.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns the delay before the next attempt of a delivery after the given number of failed attempts.
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_backoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, backoff(1))
+	assert.Equal(t, time.Minute, backoff(2))
+	assert.Equal(t, 4*time.Minute, backoff(4))
+	assert.Equal(t, maxBackoff, backoff(maxAttempts))
+	assert.Equal(t, maxBackoff, backoff(100))
+}
+
+func Test_service_attempt(t *testing.T) {
+	status := http.StatusOK
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("oops"))
+	}))
+	defer server.Close()
+
+	s := service{client: server.Client(), logger: log.New()}
+	webhook := entity.Webhook{ID: "w1", URL: server.URL, Secret: "secret", Enabled: true}
+	now := time.Unix(1700000000, 0)
+	delivery := newDelivery("w1", "e1", EventIdeaCreated, `{"id":"e1"}`, now)
+
+	// a successful attempt is signed and completes the delivery
+	result := s.attempt(context.Background(), webhook, delivery, now)
+	assert.Equal(t, StatusSucceeded, result.Status)
+	assert.Equal(t, http.StatusOK, result.ResponseCode)
+	assert.Nil(t, result.NextAttemptAt)
+	if assert.NotNil(t, received) {
+		assert.Equal(t, `{"id":"e1"}`, string(body))
+		assert.Equal(t, EventIdeaCreated, received.Header.Get(HeaderEvent))
+		assert.Equal(t, "1700000000", received.Header.Get(HeaderTimestamp))
+		assert.Equal(t, Sign("secret", "1700000000", body), received.Header.Get(HeaderSignature))
+	}
+
+	// a failed attempt is retried later
+	status = http.StatusBadGateway
+	result = s.attempt(context.Background(), webhook, delivery, now)
+	assert.Equal(t, StatusPending, result.Status)
+	assert.Equal(t, http.StatusBadGateway, result.ResponseCode)
+	assert.Equal(t, "unexpected response 502: oops", result.Error)
+	if assert.NotNil(t, result.NextAttemptAt) {
+		assert.Equal(t, now.Add(baseBackoff), *result.NextAttemptAt)
+	}
+
+	// the last attempt fails the delivery
+	delivery.Attempts = maxAttempts - 1
+	result = s.attempt(context.Background(), webhook, delivery, now)
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Nil(t, result.NextAttemptAt)
+}
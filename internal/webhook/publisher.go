@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"time"
+)
+
+// Types of events that webhooks can subscribe to.
+const (
+	EventIdeaCreated     = "idea.created"
+	EventIdeaUpdated     = "idea.updated"
+	EventIdeaVoted       = "idea.voted"
+	EventIdeaDeleted     = "idea.deleted"
+	EventUserCreated     = "user.created"
+	EventUserRoleChanged = "user.role_changed"
+)
+
+// EventTypes lists the types of events that webhooks can subscribe to.
+var EventTypes = []string{
+	EventIdeaCreated, EventIdeaUpdated, EventIdeaVoted, EventIdeaDeleted, EventUserCreated, EventUserRoleChanged,
+}
+
+// Event is the JSON document posted to webhooks.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Publisher queues events for delivery to the webhooks subscribed to them.
+type Publisher interface {
+	// Publish queues an event of the given type carrying the given data, which is encoded as JSON.
+	Publish(ctx context.Context, eventType string, data interface{}) error
+}
+
+type publisher struct {
+	repo Repository
+}
+
+// NewPublisher creates a Publisher that saves deliveries with the given repository.
+func NewPublisher(repo Repository) Publisher {
+	return publisher{repo}
+}
+
+// Publish creates a pending delivery of the event for every enabled webhook subscribed to its type.
+func (p publisher) Publish(ctx context.Context, eventType string, data interface{}) error {
+	webhooks, err := p.repo.Subscribers(ctx, eventType)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+	now := time.Now()
+	event := Event{ID: entity.GenerateID(), Type: eventType, CreatedAt: now, Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		if err := p.repo.CreateDelivery(ctx, newDelivery(webhook.ID, event.ID, eventType, string(payload), now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newDelivery creates a pending delivery due immediately.
+func newDelivery(webhookID, eventID, eventType, payload string, now time.Time) entity.WebhookDelivery {
+	return entity.WebhookDelivery{
+		ID:            entity.GenerateID(),
+		WebhookID:     webhookID,
+		EventID:       eventID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        StatusPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"context"
+	"github.com/go-ozzo/ozzo-dbx"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/pkg/dbcontext"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Repository encapsulates the logic to access webhooks and their deliveries from the data source.
+type Repository interface {
+	// Get returns the webhook with the specified ID.
+	Get(ctx context.Context, id string) (entity.Webhook, error)
+
+	// Query returns every webhook, oldest first.
+	Query(ctx context.Context) ([]entity.Webhook, error)
+
+	// Create saves a new webhook in the storage.
+	Create(ctx context.Context, webhook entity.Webhook) error
+
+	// Update saves the changes to a webhook in the storage.
+	Update(ctx context.Context, webhook entity.Webhook) error
+
+	// Delete removes the webhook with the specified ID and its deliveries from the storage.
+	Delete(ctx context.Context, id string) error
+
+	// Subscribers returns the enabled webhooks subscribed to the given type of event.
+	Subscribers(ctx context.Context, eventType string) ([]entity.Webhook, error)
+
+	// GetDelivery returns the delivery with the specified ID.
+	GetDelivery(ctx context.Context, id string) (entity.WebhookDelivery, error)
+
+	// CreateDelivery saves a new delivery in the storage.
+	CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+
+	// UpdateDelivery saves the outcome of an attempt to deliver an event.
+	UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+
+	// CountDeliveries returns the number of deliveries of a webhook with the given status, or with any status if it is empty.
+	CountDeliveries(ctx context.Context, webhookID, status string) (int, error)
+
+	// QueryDeliveries returns the deliveries of a webhook with the given status, or with any status if it is empty, newest first.
+	QueryDeliveries(ctx context.Context, webhookID, status string, offset, limit int) ([]entity.WebhookDelivery, error)
+
+	// ClaimDue returns up to limit pending deliveries whose next attempt is due, and postpones
+	// their next attempt to leaseUntil so that they are not claimed again while being delivered.
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]entity.WebhookDelivery, error)
+}
+
+// repository persists webhooks in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new webhook repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the webhook with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Webhook, error) {
+	var webhook entity.Webhook
+	err := r.db.With(ctx).Select().Model(id, &webhook)
+	return webhook, err
+}
+
+// Query retrieves every webhook from the database.
+func (r repository) Query(ctx context.Context) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := r.db.With(ctx).Select().OrderBy("created_at", "id").All(&webhooks)
+	return webhooks, err
+}
+
+// Create saves a new webhook record in the database.
+func (r repository) Create(ctx context.Context, webhook entity.Webhook) error {
+	return r.db.With(ctx).Model(&webhook).Insert()
+}
+
+// Update saves the changes to a webhook in the database.
+func (r repository) Update(ctx context.Context, webhook entity.Webhook) error {
+	return r.db.With(ctx).Model(&webhook).Update()
+}
+
+// Delete deletes the webhook with the specified ID from the database. Its deliveries are deleted by cascade.
+func (r repository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.With(ctx).Delete("webhook", dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// Subscribers returns the enabled webhooks subscribed to the given type of event.
+func (r repository) Subscribers(ctx context.Context, eventType string) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.NewExp("enabled AND {:type} = ANY(event_types)", dbx.Params{"type": eventType})).
+		OrderBy("created_at", "id").
+		All(&webhooks)
+	return webhooks, err
+}
+
+// GetDelivery reads the delivery with the specified ID from the database.
+func (r repository) GetDelivery(ctx context.Context, id string) (entity.WebhookDelivery, error) {
+	var delivery entity.WebhookDelivery
+	err := r.db.With(ctx).Select().Model(id, &delivery)
+	return delivery, err
+}
+
+// CreateDelivery saves a new delivery record in the database.
+func (r repository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	return r.db.With(ctx).Model(&delivery).Insert()
+}
+
+// UpdateDelivery saves the changes to a delivery in the database.
+func (r repository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	return r.db.With(ctx).Model(&delivery).Update()
+}
+
+// CountDeliveries returns the number of deliveries of a webhook.
+func (r repository) CountDeliveries(ctx context.Context, webhookID, status string) (int, error) {
+	var count int
+	err := r.db.With(ctx).
+		Select("COUNT(*)").
+		From("webhook_delivery").
+		Where(deliveryExp(webhookID, status)).
+		Row(&count)
+	return count, err
+}
+
+// QueryDeliveries retrieves the deliveries of a webhook from the database.
+func (r repository) QueryDeliveries(ctx context.Context, webhookID, status string, offset, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).
+		Select().
+		Where(deliveryExp(webhookID, status)).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&deliveries)
+	return deliveries, err
+}
+
+// ClaimDue claims the pending deliveries whose next attempt is due. Rows locked by another
+// instance of the application are skipped so that every attempt is made only once.
+func (r repository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).NewQuery(`UPDATE webhook_delivery SET next_attempt_at = {:lease}
+		WHERE id IN (SELECT id FROM webhook_delivery
+			WHERE status = {:pending} AND next_attempt_at <= {:now}
+			ORDER BY next_attempt_at LIMIT {:limit} FOR UPDATE SKIP LOCKED)
+		RETURNING *`).
+		Bind(dbx.Params{
+			"pending": StatusPending,
+			"now":     now,
+			"lease":   leaseUntil,
+			"limit":   limit,
+		}).
+		All(&deliveries)
+	return deliveries, err
+}
+
+func deliveryExp(webhookID, status string) dbx.Expression {
+	if status == "" {
+		return dbx.HashExp{"webhook_id": webhookID}
+	}
+	return dbx.HashExp{"webhook_id": webhookID, "status": status}
+}
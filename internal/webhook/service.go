@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/qiangxue/go-rest-api/internal/errors"
+	"github.com/qiangxue/go-rest-api/internal/user"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"github.com/qiangxue/go-rest-api/pkg/pagination"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Statuses of a delivery.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Service encapsulates usecase logic for webhooks.
+type Service interface {
+	Publisher
+	Get(ctx context.Context, requesterEmail, id string) (entity.Webhook, error)
+	Query(ctx context.Context, requesterEmail string) ([]entity.Webhook, error)
+	Create(ctx context.Context, req CreateWebhookRequest) (CreatedWebhook, error)
+	Update(ctx context.Context, id string, req UpdateWebhookRequest) (entity.Webhook, error)
+	Delete(ctx context.Context, id string, req DeleteWebhookRequest) (entity.Webhook, error)
+	Deliveries(ctx context.Context, requesterEmail, id, status string, page, perPage int) (*pagination.Pages, error)
+	Replay(ctx context.Context, id, deliveryID string, req ReplayRequest) (entity.WebhookDelivery, error)
+	Deliver(ctx context.Context, limit int) (int, error)
+}
+
+// CreateWebhookRequest represents a webhook creation request.
+type CreateWebhookRequest struct {
+	RequesterUserEmail string   `json:"requester_user_email"`
+	URL                string   `json:"url"`
+	EventTypes         []string `json:"event_types"`
+	// the key the payloads are signed with. A random key is generated if empty.
+	Secret string `json:"secret"`
+	// whether events are delivered to the webhook. Defaults to true.
+	Enabled *bool `json:"enabled"`
+}
+
+// CreatedWebhook represents a webhook which was just created, along with its secret. The secret is not shown again.
+type CreatedWebhook struct {
+	entity.Webhook
+	Secret string `json:"secret"`
+}
+
+// UpdateWebhookRequest represents a webhook update request.
+type UpdateWebhookRequest struct {
+	RequesterUserEmail string   `json:"requester_user_email"`
+	URL                string   `json:"url"`
+	EventTypes         []string `json:"event_types"`
+	// the new key the payloads are signed with. The key is kept if empty.
+	Secret string `json:"secret"`
+	// whether events are delivered to the webhook. It is kept if omitted.
+	Enabled *bool `json:"enabled"`
+}
+
+// DeleteWebhookRequest represents a webhook deletion request.
+type DeleteWebhookRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
+
+// ReplayRequest represents a request to deliver an event to a webhook again.
+type ReplayRequest struct {
+	RequesterUserEmail string `json:"requester_user_email"`
+}
+
+type service struct {
+	Publisher
+	repo        Repository
+	userService user.UserService
+	client      *http.Client
+	logger      log.Logger
+}
+
+// NewService creates a new webhook service. If client is nil, a client with a timeout of 10 seconds is used.
+func NewService(repo Repository, userService user.UserService, client *http.Client, logger log.Logger) Service {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return service{NewPublisher(repo), repo, userService, client, logger}
+}
+
+// Get returns the webhook with the specified ID. Only admins may see webhooks.
+func (s service) Get(ctx context.Context, requesterEmail, id string) (entity.Webhook, error) {
+	if _, err := s.checkAdmin(ctx, requesterEmail); err != nil {
+		return entity.Webhook{}, err
+	}
+	return s.repo.Get(ctx, id)
+}
+
+// Query returns every webhook. Only admins may see webhooks.
+func (s service) Query(ctx context.Context, requesterEmail string) ([]entity.Webhook, error) {
+	if _, err := s.checkAdmin(ctx, requesterEmail); err != nil {
+		return nil, err
+	}
+	webhooks, err := s.repo.Query(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if webhooks == nil {
+		webhooks = []entity.Webhook{}
+	}
+	return webhooks, nil
+}
+
+// Create creates a new webhook. Only admins may create webhooks.
+func (s service) Create(ctx context.Context, req CreateWebhookRequest) (CreatedWebhook, error) {
+	requester, err := s.checkAdmin(ctx, req.RequesterUserEmail)
+	if err != nil {
+		return CreatedWebhook{}, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = generateSecret(); err != nil {
+			return CreatedWebhook{}, err
+		}
+	}
+	now := time.Now()
+	webhook := entity.Webhook{
+		ID:         entity.GenerateID(),
+		URL:        strings.TrimSpace(req.URL),
+		Secret:     secret,
+		EventTypes: req.EventTypes,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		CreatedBy:  requester.ID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := validate(webhook); err != nil {
+		return CreatedWebhook{}, err
+	}
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return CreatedWebhook{}, err
+	}
+	return CreatedWebhook{webhook, secret}, nil
+}
+
+// Update changes the URL, the events and the secret of a webhook. Only admins may update webhooks.
+func (s service) Update(ctx context.Context, id string, req UpdateWebhookRequest) (entity.Webhook, error) {
+	if _, err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return entity.Webhook{}, err
+	}
+	webhook, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	webhook.URL = strings.TrimSpace(req.URL)
+	webhook.EventTypes = req.EventTypes
+	if req.Secret != "" {
+		webhook.Secret = req.Secret
+	}
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+	webhook.UpdatedAt = time.Now()
+	if err := validate(webhook); err != nil {
+		return entity.Webhook{}, err
+	}
+	if err := s.repo.Update(ctx, webhook); err != nil {
+		return entity.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// Delete deletes a webhook together with its deliveries. Only admins may delete webhooks.
+func (s service) Delete(ctx context.Context, id string, req DeleteWebhookRequest) (entity.Webhook, error) {
+	if _, err := s.checkAdmin(ctx, req.RequesterUserEmail); err != nil {
+		return entity.Webhook{}, err
+	}
+	webhook, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return entity.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// Deliveries returns a page of the deliveries of a webhook with the given status, or with any status if it is empty.
+func (s service) Deliveries(ctx context.Context, requesterEmail, id, status string, page, perPage int) (*pagination.Pages, error) {
+	if _, err := s.Get(ctx, requesterEmail, id); err != nil {
+		return nil, err
+	}
+	if status != "" && status != StatusPending && status != StatusSucceeded && status != StatusFailed {
+		return nil, errors.BadRequest("This delivery status doesn't exists in the system : " + status)
+	}
+	count, err := s.repo.CountDeliveries(ctx, id, status)
+	if err != nil {
+		return nil, err
+	}
+	pages := pagination.New(page, perPage, count)
+	items, err := s.repo.QueryDeliveries(ctx, id, status, pages.Offset(), pages.Limit())
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []entity.WebhookDelivery{}
+	}
+	pages.Items = items
+	return pages, nil
+}
+
+// Replay queues a new delivery of the event of a finished delivery, e.g. after the receiver of a failed delivery was fixed.
+func (s service) Replay(ctx context.Context, id, deliveryID string, req ReplayRequest) (entity.WebhookDelivery, error) {
+	if _, err := s.Get(ctx, req.RequesterUserEmail, id); err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	original, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	if original.WebhookID != id {
+		return entity.WebhookDelivery{}, errors.NotFound("")
+	}
+	if original.Status == StatusPending {
+		return entity.WebhookDelivery{}, errors.BadRequest("The delivery is still pending")
+	}
+	delivery := newDelivery(id, original.EventID, original.EventType, original.Payload, time.Now())
+	delivery.ReplayOf = original.ID
+	if err := s.repo.CreateDelivery(ctx, delivery); err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+func (s service) checkAdmin(ctx context.Context, requesterEmail string) (user.User, error) {
+	requester, err := s.userService.GetUser(ctx, requesterEmail)
+	if err != nil {
+		return user.User{}, errors.InternalServerError("Requester User doesn't exist")
+	}
+	if !user.IsAdmin(requester.Role) {
+		return user.User{}, errors.Forbidden("Requester User doesn't have permission to manage webhooks")
+	}
+	return requester, nil
+}
+
+// validate checks the URL and the events of a webhook.
+func validate(webhook entity.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.BadRequest("The webhook URL must be an absolute http or https URL")
+	}
+	if len(webhook.EventTypes) == 0 {
+		return errors.BadRequest("At least one event type is required")
+	}
+	for _, eventType := range webhook.EventTypes {
+		known := false
+		for _, t := range EventTypes {
+			if t == eventType {
+				known = true
+			}
+		}
+		if !known {
+			return errors.BadRequest("This event type doesn't exists in the system : " + eventType)
+		}
+	}
+	return nil
+}
+
+// generateSecret returns a random signing key.
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
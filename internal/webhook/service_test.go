@@ -0,0 +1,21 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/qiangxue/go-rest-api/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCreatedWebhook_secret(t *testing.T) {
+	webhook := entity.Webhook{ID: "w1", URL: "https://example.com/hook", Secret: "s3cret"}
+
+	data, err := json.Marshal(webhook)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+
+	data, err = json.Marshal(CreatedWebhook{webhook, webhook.Secret})
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"secret":"s3cret"`)
+	assert.Contains(t, string(data), `"id":"w1"`)
+}
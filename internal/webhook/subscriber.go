@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/internal/event"
+)
+
+// subscriberName identifies the webhook service among the subscribers of domain events.
+const subscriberName = "webhook"
+
+// VoteEvent is the data of the idea.voted webhook event.
+type VoteEvent struct {
+	IdeaID  string `json:"idea_id"`
+	VoterID string `json:"voter_id"`
+	// the number of votes of the idea after the vote
+	Votes int `json:"votes"`
+}
+
+// RegisterSubscribers subscribes the webhook service to the domain events that webhooks can subscribe to.
+func RegisterSubscribers(bus event.Bus, service Service) {
+	for _, eventType := range []string{EventIdeaCreated, EventIdeaUpdated, EventIdeaDeleted} {
+		eventType := eventType
+		bus.Subscribe(eventType, subscriberName, func(ctx context.Context, e event.Event) error {
+			var data event.IdeaData
+			if err := e.Decode(&data); err != nil {
+				return err
+			}
+			return service.Publish(ctx, eventType, data.Idea)
+		})
+	}
+
+	bus.Subscribe(event.IdeaVoted, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.VoteData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return service.Publish(ctx, EventIdeaVoted, VoteEvent{data.Idea.ID, data.VoterID, data.Idea.Votes})
+	})
+
+	bus.Subscribe(event.UserCreated, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.UserData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return service.Publish(ctx, EventUserCreated, data)
+	})
+
+	bus.Subscribe(event.UserRoleChanged, subscriberName, func(ctx context.Context, e event.Event) error {
+		var data event.RoleChangeData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return service.Publish(ctx, EventUserRoleChanged, data)
+	})
+}
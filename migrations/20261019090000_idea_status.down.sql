@@ -0,0 +1,7 @@
+DROP TABLE idea_status_change;
+
+DROP INDEX idea_status_idx;
+
+ALTER TABLE idea
+    DROP COLUMN status,
+    DROP COLUMN status_changed_at;
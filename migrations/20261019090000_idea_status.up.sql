@@ -0,0 +1,20 @@
+ALTER TABLE idea
+    ADD COLUMN status            VARCHAR NOT NULL DEFAULT 'submitted',
+    ADD COLUMN status_changed_at TIMESTAMP;
+
+UPDATE idea SET status_changed_at = created_at;
+
+CREATE INDEX idea_status_idx ON idea (status);
+
+CREATE TABLE idea_status_change
+(
+    id          VARCHAR PRIMARY KEY,
+    idea_id     VARCHAR   NOT NULL REFERENCES idea (id) ON DELETE CASCADE,
+    from_status VARCHAR   NOT NULL,
+    to_status   VARCHAR   NOT NULL,
+    reason      VARCHAR,
+    changed_by  VARCHAR   NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idea_status_change_idea_id_idx ON idea_status_change (idea_id, created_at);
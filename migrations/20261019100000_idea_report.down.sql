@@ -0,0 +1 @@
+DROP TABLE idea_report;
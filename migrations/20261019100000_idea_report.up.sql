@@ -0,0 +1,16 @@
+CREATE TABLE idea_report
+(
+    id              VARCHAR PRIMARY KEY,
+    idea_id         VARCHAR   NOT NULL REFERENCES idea (id) ON DELETE CASCADE,
+    reporter_id     VARCHAR   NOT NULL,
+    reason          VARCHAR   NOT NULL,
+    details         VARCHAR,
+    status          VARCHAR   NOT NULL,
+    resolved_by     VARCHAR,
+    resolution_note VARCHAR,
+    resolved_at     TIMESTAMP,
+    created_at      TIMESTAMP NOT NULL,
+    UNIQUE (idea_id, reporter_id)
+);
+
+CREATE INDEX idea_report_status_idx ON idea_report (status, idea_id);
@@ -0,0 +1,11 @@
+CREATE TABLE moderation_action
+(
+    id           VARCHAR PRIMARY KEY,
+    idea_id      VARCHAR   NOT NULL,
+    moderator_id VARCHAR   NOT NULL,
+    action       VARCHAR   NOT NULL,
+    note         VARCHAR,
+    created_at   TIMESTAMP NOT NULL
+);
+
+CREATE INDEX moderation_action_idea_id_idx ON moderation_action (idea_id, created_at);
@@ -0,0 +1,5 @@
+DELETE FROM idea WHERE deleted_at IS NOT NULL;
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE idea DROP COLUMN deleted_at;
+ALTER TABLE users DROP COLUMN deleted_at;
@@ -0,0 +1,5 @@
+ALTER TABLE idea ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idea_deleted_at_idx ON idea (deleted_at);
+CREATE INDEX users_deleted_at_idx ON users (deleted_at);
@@ -0,0 +1,3 @@
+DROP INDEX idea_tags_idx;
+DROP TABLE tag_alias;
+DROP TABLE tag;
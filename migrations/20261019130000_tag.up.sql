@@ -0,0 +1,34 @@
+CREATE TABLE tag
+(
+    id         VARCHAR PRIMARY KEY,
+    name       VARCHAR   NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE tag_alias
+(
+    alias      VARCHAR PRIMARY KEY,
+    tag_id     VARCHAR   NOT NULL REFERENCES tag (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX tag_alias_tag_id_idx ON tag_alias (tag_id);
+
+-- rewrite the free-form tags of existing ideas into slugs and seed the catalogue with them
+UPDATE idea
+SET tags = ARRAY(
+        SELECT s
+        FROM (SELECT trim(BOTH '-' FROM lower(regexp_replace(t, '[^a-zA-Z0-9]+', '-', 'g'))) AS s, n
+              FROM unnest(tags) WITH ORDINALITY AS u(t, n)) AS slugs
+        WHERE s <> ''
+        GROUP BY s
+        ORDER BY MIN(n))
+WHERE tags IS NOT NULL;
+
+INSERT INTO tag (id, name, created_at, updated_at)
+SELECT DISTINCT t, t, now(), now()
+FROM idea, unnest(tags) AS t
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX idea_tags_idx ON idea USING GIN (tags);
@@ -0,0 +1,3 @@
+ALTER TABLE idea DROP COLUMN media_ids;
+
+DROP TABLE media;
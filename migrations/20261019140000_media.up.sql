@@ -0,0 +1,14 @@
+CREATE TABLE media
+(
+    id           VARCHAR PRIMARY KEY,
+    owner_id     VARCHAR   NOT NULL,
+    filename     VARCHAR   NOT NULL,
+    content_type VARCHAR   NOT NULL,
+    size         BIGINT    NOT NULL,
+    storage_key  VARCHAR   NOT NULL,
+    created_at   TIMESTAMP NOT NULL
+);
+
+CREATE INDEX media_owner_id_idx ON media (owner_id);
+
+ALTER TABLE idea ADD COLUMN media_ids text[];
@@ -0,0 +1,8 @@
+DROP TABLE media_variant;
+
+DROP INDEX media_status_idx;
+
+ALTER TABLE media DROP COLUMN updated_at;
+ALTER TABLE media DROP COLUMN height;
+ALTER TABLE media DROP COLUMN width;
+ALTER TABLE media DROP COLUMN status;
@@ -0,0 +1,24 @@
+ALTER TABLE media ADD COLUMN status VARCHAR NOT NULL DEFAULT 'ready';
+ALTER TABLE media ADD COLUMN width INT NOT NULL DEFAULT 0;
+ALTER TABLE media ADD COLUMN height INT NOT NULL DEFAULT 0;
+ALTER TABLE media ADD COLUMN updated_at TIMESTAMP;
+UPDATE media SET updated_at = created_at;
+ALTER TABLE media ALTER COLUMN updated_at SET NOT NULL;
+
+-- images uploaded before variants existed are processed by the background job
+UPDATE media SET status = 'pending' WHERE content_type IN ('image/jpeg', 'image/png', 'image/gif');
+
+CREATE INDEX media_status_idx ON media (status) WHERE status IN ('pending', 'processing');
+
+CREATE TABLE media_variant
+(
+    media_id     VARCHAR   NOT NULL REFERENCES media (id) ON DELETE CASCADE,
+    name         VARCHAR   NOT NULL,
+    storage_key  VARCHAR   NOT NULL,
+    content_type VARCHAR   NOT NULL,
+    width        INT       NOT NULL,
+    height       INT       NOT NULL,
+    size         BIGINT    NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    PRIMARY KEY (media_id, name)
+);
@@ -0,0 +1,7 @@
+DROP INDEX idea_rising_score_idx;
+DROP INDEX idea_hot_score_idx;
+
+ALTER TABLE idea DROP COLUMN rising_score;
+ALTER TABLE idea DROP COLUMN hot_score;
+
+DROP TABLE idea_vote;
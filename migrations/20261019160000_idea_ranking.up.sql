@@ -0,0 +1,20 @@
+CREATE TABLE idea_vote
+(
+    idea_id    VARCHAR   NOT NULL REFERENCES idea (id) ON DELETE CASCADE,
+    voter_id   VARCHAR   NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (idea_id, voter_id)
+);
+
+CREATE INDEX idea_vote_created_at_idx ON idea_vote (created_at);
+
+-- the time of past votes is unknown; the last update of the idea is the best estimate
+INSERT INTO idea_vote (idea_id, voter_id, created_at)
+SELECT DISTINCT id, unnest(voters_ids), updated_at FROM idea
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE idea ADD COLUMN hot_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE idea ADD COLUMN rising_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+CREATE INDEX idea_hot_score_idx ON idea (hot_score DESC) WHERE deleted_at IS NULL;
+CREATE INDEX idea_rising_score_idx ON idea (rising_score DESC) WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX idea_campaign_id_idx;
+
+ALTER TABLE idea DROP COLUMN campaign_id;
+
+DROP TABLE campaign;
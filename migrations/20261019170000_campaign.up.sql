@@ -0,0 +1,17 @@
+CREATE TABLE campaign
+(
+    id           VARCHAR PRIMARY KEY,
+    title        VARCHAR   NOT NULL,
+    description  TEXT      NOT NULL,
+    opens_at     TIMESTAMP NOT NULL,
+    closes_at    TIMESTAMP NOT NULL,
+    submit_roles text[]    NOT NULL DEFAULT '{}',
+    vote_roles   text[]    NOT NULL DEFAULT '{}',
+    created_by   VARCHAR   NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    updated_at   TIMESTAMP NOT NULL
+);
+
+ALTER TABLE idea ADD COLUMN campaign_id VARCHAR NOT NULL DEFAULT '';
+
+CREATE INDEX idea_campaign_id_idx ON idea (campaign_id) WHERE campaign_id <> '';
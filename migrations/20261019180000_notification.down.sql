@@ -0,0 +1,3 @@
+DROP TABLE notification;
+
+DROP TABLE idea_follower;
@@ -0,0 +1,31 @@
+CREATE TABLE idea_follower
+(
+    idea_id    VARCHAR   NOT NULL REFERENCES idea (id) ON DELETE CASCADE,
+    user_id    VARCHAR   NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (idea_id, user_id)
+);
+
+CREATE INDEX idea_follower_user_id_idx ON idea_follower (user_id);
+
+-- authors and voters follow their ideas
+INSERT INTO idea_follower (idea_id, user_id, created_at)
+SELECT id, author_email, created_at FROM idea WHERE author_email <> ''
+ON CONFLICT DO NOTHING;
+INSERT INTO idea_follower (idea_id, user_id, created_at)
+SELECT DISTINCT id, unnest(voters_ids), updated_at FROM idea
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE notification
+(
+    id         VARCHAR PRIMARY KEY,
+    user_id    VARCHAR   NOT NULL,
+    type       VARCHAR   NOT NULL,
+    idea_id    VARCHAR   NOT NULL,
+    actor_id   VARCHAR   NOT NULL,
+    message    TEXT      NOT NULL,
+    read_at    TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX notification_user_id_idx ON notification (user_id, created_at DESC);
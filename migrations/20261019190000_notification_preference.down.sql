@@ -0,0 +1,5 @@
+ALTER TABLE notification DROP COLUMN emailed_at;
+
+DROP TABLE notification_digest;
+
+DROP TABLE notification_preference;
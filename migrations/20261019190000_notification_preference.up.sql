@@ -0,0 +1,21 @@
+CREATE TABLE notification_preference
+(
+    user_id    VARCHAR   NOT NULL,
+    type       VARCHAR   NOT NULL,
+    delivery   VARCHAR   NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
+
+-- the last digest of each frequency sent to a user
+CREATE TABLE notification_digest
+(
+    user_id   VARCHAR   NOT NULL,
+    frequency VARCHAR   NOT NULL,
+    sent_at   TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, frequency)
+);
+
+ALTER TABLE notification ADD COLUMN emailed_at TIMESTAMP;
+
+CREATE INDEX notification_unemailed_idx ON notification (created_at) WHERE emailed_at IS NULL;
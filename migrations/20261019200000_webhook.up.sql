@@ -0,0 +1,32 @@
+CREATE TABLE webhook
+(
+    id          VARCHAR PRIMARY KEY,
+    url         VARCHAR   NOT NULL,
+    secret      VARCHAR   NOT NULL,
+    event_types VARCHAR[] NOT NULL,
+    enabled     BOOLEAN   NOT NULL,
+    created_by  VARCHAR   NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE webhook_delivery
+(
+    id              VARCHAR PRIMARY KEY,
+    webhook_id      VARCHAR   NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    event_id        VARCHAR   NOT NULL,
+    event_type      VARCHAR   NOT NULL,
+    payload         TEXT      NOT NULL,
+    status          VARCHAR   NOT NULL,
+    attempts        INT       NOT NULL,
+    response_code   INT       NOT NULL,
+    error           TEXT      NOT NULL,
+    replay_of       VARCHAR   NOT NULL,
+    next_attempt_at TIMESTAMP,
+    delivered_at    TIMESTAMP,
+    created_at      TIMESTAMP NOT NULL,
+    updated_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_delivery_webhook_id_idx ON webhook_delivery (webhook_id, created_at DESC);
+CREATE INDEX webhook_delivery_due_idx ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
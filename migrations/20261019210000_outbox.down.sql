@@ -0,0 +1,3 @@
+DROP TABLE outbox_handled;
+
+DROP TABLE outbox_event;
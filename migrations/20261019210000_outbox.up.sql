@@ -0,0 +1,22 @@
+CREATE TABLE outbox_event
+(
+    id              VARCHAR PRIMARY KEY,
+    type            VARCHAR   NOT NULL,
+    payload         TEXT      NOT NULL,
+    attempts        INT       NOT NULL,
+    error           TEXT      NOT NULL,
+    next_attempt_at TIMESTAMP,
+    dispatched_at   TIMESTAMP,
+    created_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX outbox_event_due_idx ON outbox_event (next_attempt_at) WHERE dispatched_at IS NULL;
+
+-- the subscribers which have handled an event, so that retries don't handle it twice
+CREATE TABLE outbox_handled
+(
+    event_id   VARCHAR   NOT NULL REFERENCES outbox_event (id) ON DELETE CASCADE,
+    subscriber VARCHAR   NOT NULL,
+    handled_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (event_id, subscriber)
+);
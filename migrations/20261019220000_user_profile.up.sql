@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN avatar VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN locale VARCHAR NOT NULL DEFAULT '';
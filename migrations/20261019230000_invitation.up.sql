@@ -0,0 +1,15 @@
+CREATE TABLE invitation
+(
+    id          VARCHAR PRIMARY KEY,
+    email       VARCHAR   NOT NULL,
+    role        VARCHAR   NOT NULL,
+    token_hash  VARCHAR   NOT NULL UNIQUE,
+    invited_by  VARCHAR   NOT NULL,
+    expires_at  TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    revoked_at  TIMESTAMP,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX invitation_email_idx ON invitation (email);
+CREATE INDEX invitation_created_at_idx ON invitation (created_at DESC);
@@ -0,0 +1,28 @@
+DROP TABLE email_change;
+
+CREATE TEMPORARY TABLE user_id_map ON COMMIT DROP AS SELECT id, email FROM users;
+
+UPDATE invitation SET invited_by = m.email FROM user_id_map m WHERE invitation.invited_by = m.id;
+UPDATE webhook SET created_by = m.email FROM user_id_map m WHERE webhook.created_by = m.id;
+UPDATE notification_digest SET user_id = m.email FROM user_id_map m WHERE notification_digest.user_id = m.id;
+UPDATE notification_preference SET user_id = m.email FROM user_id_map m WHERE notification_preference.user_id = m.id;
+UPDATE notification SET actor_id = m.email FROM user_id_map m WHERE notification.actor_id = m.id;
+UPDATE notification SET user_id = m.email FROM user_id_map m WHERE notification.user_id = m.id;
+UPDATE idea_follower SET user_id = m.email FROM user_id_map m WHERE idea_follower.user_id = m.id;
+UPDATE campaign SET created_by = m.email FROM user_id_map m WHERE campaign.created_by = m.id;
+UPDATE media SET owner_id = m.email FROM user_id_map m WHERE media.owner_id = m.id;
+UPDATE moderation_action SET moderator_id = m.email FROM user_id_map m WHERE moderation_action.moderator_id = m.id;
+UPDATE idea_report SET resolved_by = m.email FROM user_id_map m WHERE idea_report.resolved_by = m.id;
+UPDATE idea_report SET reporter_id = m.email FROM user_id_map m WHERE idea_report.reporter_id = m.id;
+UPDATE idea_status_change SET changed_by = m.email FROM user_id_map m WHERE idea_status_change.changed_by = m.id;
+UPDATE idea_vote SET voter_id = m.email FROM user_id_map m WHERE idea_vote.voter_id = m.id;
+UPDATE idea SET voters_ids = ARRAY(
+    SELECT COALESCE(m.email, v.id) FROM unnest(idea.voters_ids) WITH ORDINALITY AS v(id, n)
+    LEFT JOIN user_id_map m ON m.id = v.id ORDER BY v.n
+) WHERE voters_ids IS NOT NULL;
+UPDATE idea SET author_id = m.email FROM user_id_map m WHERE idea.author_id = m.id;
+ALTER TABLE idea RENAME COLUMN author_id TO author_email;
+
+UPDATE users SET id = email;
+DROP INDEX users_email_idx;
+ALTER TABLE users DROP COLUMN email;
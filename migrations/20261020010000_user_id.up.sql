@@ -0,0 +1,42 @@
+-- users get a stable ID decoupled from their email address, which moves to its own column
+ALTER TABLE users ADD COLUMN email VARCHAR;
+UPDATE users SET email = id;
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
+CREATE UNIQUE INDEX users_email_idx ON users (email);
+
+CREATE TEMPORARY TABLE user_id_map ON COMMIT DROP AS
+SELECT id AS email, md5(random()::text || clock_timestamp()::text || id)::uuid::text AS id FROM users;
+
+UPDATE users SET id = m.id FROM user_id_map m WHERE users.id = m.email;
+
+-- every reference to a user is re-keyed from the email address to the ID
+ALTER TABLE idea RENAME COLUMN author_email TO author_id;
+UPDATE idea SET author_id = m.id FROM user_id_map m WHERE idea.author_id = m.email;
+UPDATE idea SET voters_ids = ARRAY(
+    SELECT COALESCE(m.id, v.email) FROM unnest(idea.voters_ids) WITH ORDINALITY AS v(email, n)
+    LEFT JOIN user_id_map m ON m.email = v.email ORDER BY v.n
+) WHERE voters_ids IS NOT NULL;
+UPDATE idea_vote SET voter_id = m.id FROM user_id_map m WHERE idea_vote.voter_id = m.email;
+UPDATE idea_status_change SET changed_by = m.id FROM user_id_map m WHERE idea_status_change.changed_by = m.email;
+UPDATE idea_report SET reporter_id = m.id FROM user_id_map m WHERE idea_report.reporter_id = m.email;
+UPDATE idea_report SET resolved_by = m.id FROM user_id_map m WHERE idea_report.resolved_by = m.email;
+UPDATE moderation_action SET moderator_id = m.id FROM user_id_map m WHERE moderation_action.moderator_id = m.email;
+UPDATE media SET owner_id = m.id FROM user_id_map m WHERE media.owner_id = m.email;
+UPDATE campaign SET created_by = m.id FROM user_id_map m WHERE campaign.created_by = m.email;
+UPDATE idea_follower SET user_id = m.id FROM user_id_map m WHERE idea_follower.user_id = m.email;
+UPDATE notification SET user_id = m.id FROM user_id_map m WHERE notification.user_id = m.email;
+UPDATE notification SET actor_id = m.id FROM user_id_map m WHERE notification.actor_id = m.email;
+UPDATE notification_preference SET user_id = m.id FROM user_id_map m WHERE notification_preference.user_id = m.email;
+UPDATE notification_digest SET user_id = m.id FROM user_id_map m WHERE notification_digest.user_id = m.email;
+UPDATE webhook SET created_by = m.id FROM user_id_map m WHERE webhook.created_by = m.email;
+UPDATE invitation SET invited_by = m.id FROM user_id_map m WHERE invitation.invited_by = m.email;
+
+-- pending changes of email address, confirmed from the new address
+CREATE TABLE email_change
+(
+    user_id    VARCHAR PRIMARY KEY,
+    new_email  VARCHAR   NOT NULL,
+    token_hash VARCHAR   NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE user_badge
+(
+    user_id    VARCHAR   NOT NULL,
+    badge      VARCHAR   NOT NULL,
+    awarded_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, badge)
+);
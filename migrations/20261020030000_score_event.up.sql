@@ -0,0 +1,40 @@
+-- every change of the score of a user, so that leaderboards can be computed over any period
+CREATE TABLE score_event
+(
+    id         VARCHAR PRIMARY KEY,
+    user_id    VARCHAR   NOT NULL,
+    -- the domain event that earned the points, which makes recording them idempotent
+    event_id   VARCHAR   NOT NULL,
+    kind       VARCHAR   NOT NULL,
+    points     INTEGER   NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (event_id, user_id, kind)
+);
+CREATE INDEX score_event_created_at_idx ON score_event (created_at, user_id);
+CREATE INDEX score_event_user_id_idx ON score_event (user_id);
+
+-- the ledger starts with the contributions made so far, worth the default points
+INSERT INTO score_event (id, user_id, event_id, kind, points, created_at)
+SELECT md5('vote_cast:' || idea_id || ':' || voter_id)::uuid::text, voter_id, 'history:' || idea_id || ':' || voter_id,
+       'vote_cast', 1, created_at
+FROM idea_vote;
+INSERT INTO score_event (id, user_id, event_id, kind, points, created_at)
+SELECT md5('vote_received:' || v.idea_id || ':' || v.voter_id)::uuid::text, i.author_id,
+       'history:' || v.idea_id || ':' || v.voter_id, 'vote_received', 2, v.created_at
+FROM idea_vote v
+         JOIN idea i ON i.id = v.idea_id;
+INSERT INTO score_event (id, user_id, event_id, kind, points, created_at)
+SELECT md5('idea_created:' || id)::uuid::text, author_id, 'history:' || id, 'idea_created', 5, created_at
+FROM idea
+WHERE status <> 'draft';
+INSERT INTO score_event (id, user_id, event_id, kind, points, created_at)
+SELECT md5('idea_accepted:' || c.idea_id)::uuid::text, i.author_id, 'history:' || c.idea_id, 'idea_accepted', 20,
+       MIN(c.created_at)
+FROM idea_status_change c
+         JOIN idea i ON i.id = c.idea_id
+WHERE c.to_status = 'accepted'
+GROUP BY c.idea_id, i.author_id;
+
+-- the score becomes the sum of the ledger
+UPDATE users
+SET score = COALESCE((SELECT SUM(points) FROM score_event WHERE score_event.user_id = users.id), 0);
@@ -0,0 +1,32 @@
+-- the security-relevant and administrative actions, which are only ever appended
+CREATE TABLE audit_entry
+(
+    id          VARCHAR PRIMARY KEY,
+    -- empty when the actor is unknown, e.g. on a failed login
+    actor_id    VARCHAR   NOT NULL,
+    action      VARCHAR   NOT NULL,
+    target_type VARCHAR   NOT NULL,
+    target_id   VARCHAR   NOT NULL,
+    -- the JSON encoded values of the target before and after the action, empty if not applicable
+    before      TEXT      NOT NULL,
+    after       TEXT      NOT NULL,
+    ip          VARCHAR   NOT NULL,
+    request_id  VARCHAR   NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX audit_entry_created_at_idx ON audit_entry (created_at);
+CREATE INDEX audit_entry_actor_id_idx ON audit_entry (actor_id, created_at);
+CREATE INDEX audit_entry_target_idx ON audit_entry (target_type, target_id, created_at);
+CREATE INDEX audit_entry_action_idx ON audit_entry (action, created_at);
+
+CREATE FUNCTION audit_entry_append_only() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'the audit log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER audit_entry_append_only
+    BEFORE UPDATE OR DELETE
+    ON audit_entry
+    FOR EACH ROW
+EXECUTE PROCEDURE audit_entry_append_only();
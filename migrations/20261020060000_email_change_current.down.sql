@@ -0,0 +1,4 @@
+ALTER TABLE email_change
+    DROP COLUMN current_token_hash,
+    DROP COLUMN current_confirmed_at,
+    DROP COLUMN new_confirmed_at;
@@ -0,0 +1,7 @@
+-- the changes of email address are confirmed from the current address too. the pending changes, which were only
+-- confirmed from the new address, are dropped and must be requested again
+DELETE FROM email_change;
+ALTER TABLE email_change
+    ADD COLUMN current_token_hash   VARCHAR NOT NULL UNIQUE,
+    ADD COLUMN current_confirmed_at TIMESTAMP,
+    ADD COLUMN new_confirmed_at     TIMESTAMP;
@@ -0,0 +1 @@
+-- the personal data removed from the audit log cannot be restored
@@ -0,0 +1,10 @@
+-- the audit log no longer records personal data. it is removed from the entries recorded so far, which is the only
+-- change ever made to the log
+ALTER TABLE audit_entry DISABLE TRIGGER audit_entry_append_only;
+UPDATE audit_entry
+SET before = (before::jsonb - 'email' - 'name' - 'country' - 'reason' - 'note')::text
+WHERE before <> '';
+UPDATE audit_entry
+SET after = (after::jsonb - 'email' - 'name' - 'country' - 'username' - 'reason' - 'note')::text
+WHERE after <> '';
+ALTER TABLE audit_entry ENABLE TRIGGER audit_entry_append_only;
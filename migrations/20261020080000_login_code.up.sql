@@ -0,0 +1,8 @@
+-- the pending codes signing users in, emailed to their address
+CREATE TABLE login_code
+(
+    user_id    VARCHAR PRIMARY KEY,
+    code_hash  VARCHAR   NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,21 @@
+// Package blob provides a storage abstraction for binary objects such as uploaded files.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when the requested object does not exist in the storage.
+var ErrNotFound = errors.New("blob: object not found")
+
+// Storage stores binary objects identified by keys. Keys are slash-separated relative paths, e.g. "media/123.png".
+type Storage interface {
+	// Put stores the content read from r under the given key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns a reader of the object stored under the given key. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under the given key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
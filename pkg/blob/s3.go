@@ -0,0 +1,198 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config represents the configuration of an S3-compatible object storage.
+type S3Config struct {
+	// the base URL of the storage service, e.g. "https://s3.eu-west-1.amazonaws.com" or "http://127.0.0.1:9000"
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// s3 stores objects in a bucket of an S3-compatible storage service using path-style requests
+// signed with AWS Signature Version 4.
+type s3 struct {
+	config S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3 creates a Storage that keeps objects in a bucket of an S3-compatible storage service.
+// If client is nil, a client with a timeout of 1 minute is used, which bounds the transfer of an object
+// as well as the connection.
+func NewS3(config S3Config, client *http.Client) Storage {
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+	return s3{config, client, time.Now}
+}
+
+// Put uploads the object. The payload is streamed without being hashed, so the endpoint must support
+// unsigned payloads (all S3-compatible services do over HTTPS).
+func (s s3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Get downloads the object.
+func (s s3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Delete removes the object.
+func (s s3) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (s s3) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	if key == "" {
+		return nil, fmt.Errorf("blob: invalid key %q", key)
+	}
+	url := s.config.Endpoint + "/" + uriEncode(s.config.Bucket, false) + "/" + uriEncode(key, true)
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+// do signs and sends the request, turning error responses into errors.
+func (s s3) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, s.now().UTC())
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return nil, fmt.Errorf("blob: %s %s failed with status %d: %s", req.Method, req.URL.Path, res.StatusCode, msg)
+}
+
+const (
+	signAlgorithm   = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// sign adds the AWS Signature Version 4 headers to the request.
+func (s s3) sign(req *http.Request, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := day + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{signAlgorithm, amzDate, scope, hexSHA256(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), day)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, s.config.AccessKey, scope, signedHeaders, signature))
+}
+
+// uriEncode percent-encodes every byte except the unreserved characters, as required by Signature Version 4.
+// Slashes are kept as is when keepSlash is true.
+func uriEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	h := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,132 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible storage service.
+// It re-computes the signature of every request and rejects requests whose signature doesn't match.
+type fakeS3 struct {
+	sync.Mutex
+	signer  s3
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	t, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	got := r.Header.Get("Authorization")
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.EscapedPath(), nil)
+	f.signer.sign(check, t)
+	if got != check.Header.Get("Authorization") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		f.objects[key] = body
+		f.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	config := S3Config{Region: "eu-west-1", Bucket: "ideas", AccessKey: "AKID", SecretKey: "secret"}
+	fake := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	config.Endpoint = server.URL
+	fake.signer = NewS3(config, nil).(s3)
+
+	storage := NewS3(config, server.Client())
+	ctx := context.Background()
+
+	content := []byte("hello world")
+	err := storage.Put(ctx, "media/a b+c.txt", bytes.NewReader(content), int64(len(content)), "text/plain")
+	if assert.Nil(t, err) {
+		assert.Equal(t, content, fake.objects["/ideas/media/a%20b%2Bc.txt"])
+		assert.Equal(t, "text/plain", fake.types["/ideas/media/a%20b%2Bc.txt"])
+	}
+
+	r, err := storage.Get(ctx, "media/a b+c.txt")
+	if assert.Nil(t, err) {
+		body, _ := ioutil.ReadAll(r)
+		r.Close()
+		assert.Equal(t, content, body)
+	}
+
+	assert.Nil(t, storage.Delete(ctx, "media/a b+c.txt"))
+	_, err = storage.Get(ctx, "media/a b+c.txt")
+	assert.Equal(t, ErrNotFound, err)
+
+	wrongKey := NewS3(S3Config{Endpoint: server.URL, Region: "eu-west-1", Bucket: "ideas", AccessKey: "AKID", SecretKey: "wrong"}, nil)
+	err = wrongKey.Put(ctx, "media/x", strings.NewReader("x"), 1, "")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "403")
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blob")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	storage, err := NewLocal(dir)
+	if !assert.Nil(t, err) {
+		return
+	}
+	ctx := context.Background()
+
+	assert.Nil(t, storage.Put(ctx, "media/1.txt", strings.NewReader("one"), 3, "text/plain"))
+	r, err := storage.Get(ctx, "media/1.txt")
+	if assert.Nil(t, err) {
+		body, _ := ioutil.ReadAll(r)
+		r.Close()
+		assert.Equal(t, "one", string(body))
+	}
+	assert.Nil(t, storage.Delete(ctx, "media/1.txt"))
+	_, err = storage.Get(ctx, "media/1.txt")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NotNil(t, storage.Put(ctx, "../escape", strings.NewReader("x"), 1, ""))
+}
+
+func TestNewS3_client(t *testing.T) {
+	// without a client, requests to an unresponsive storage eventually time out
+	storage := NewS3(S3Config{Endpoint: "http://127.0.0.1:9000/"}, nil).(s3)
+	assert.Equal(t, time.Minute, storage.client.Timeout)
+	assert.Equal(t, "http://127.0.0.1:9000", storage.config.Endpoint)
+
+	client := &http.Client{}
+	assert.Same(t, client, NewS3(S3Config{}, client).(s3).client)
+}
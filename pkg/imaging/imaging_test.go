@@ -0,0 +1,90 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// withExif inserts an APP1 segment with an EXIF orientation and a camera model, and a comment, into a JPEG image.
+func withExif(data []byte, orientation int) []byte {
+	exif := orientationExif(orientation)
+	// pretend the IFD also carries a camera model
+	exif = append(exif, []byte("Canon EOS")...)
+	var out bytes.Buffer
+	out.Write(data[:2])
+	writeJPEGSegment(&out, jpegAPP1, exif)
+	writeJPEGSegment(&out, jpegCOM, []byte("taken at home"))
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var b bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&b, img, nil))
+	return b.Bytes()
+}
+
+func TestStripJPEG(t *testing.T) {
+	original := encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 4, 2)))
+	data := withExif(original, 6)
+	assert.Equal(t, 6, Orientation(data))
+
+	stripped, err := StripMetadata(data, "image/jpeg")
+	if assert.Nil(t, err) {
+		assert.False(t, bytes.Contains(stripped, []byte("Canon EOS")))
+		assert.False(t, bytes.Contains(stripped, []byte("taken at home")))
+		assert.Equal(t, 6, Orientation(stripped))
+		_, err = jpeg.Decode(bytes.NewReader(stripped))
+		assert.Nil(t, err)
+	}
+
+	stripped, err = StripMetadata(withExif(original, 1), "image/jpeg")
+	if assert.Nil(t, err) {
+		assert.Equal(t, original, stripped)
+	}
+
+	_, err = StripMetadata([]byte("not a jpeg"), "image/jpeg")
+	assert.Equal(t, ErrInvalidImage, err)
+}
+
+func TestStripPNG(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 2, 2))))
+	original := b.Bytes()
+
+	// insert a tEXt chunk right after the IHDR chunk
+	ihdrEnd := len(pngSignature) + 12 + 13
+	var data bytes.Buffer
+	data.Write(original[:ihdrEnd])
+	text := []byte("Comment\x00secret location")
+	binary.Write(&data, binary.BigEndian, uint32(len(text)))
+	data.WriteString("tEXt")
+	data.Write(text)
+	data.Write([]byte{0, 0, 0, 0})
+	data.Write(original[ihdrEnd:])
+
+	stripped, err := StripMetadata(data.Bytes(), "image/png")
+	if assert.Nil(t, err) {
+		assert.Equal(t, original, stripped)
+	}
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	img.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+
+	assert.Equal(t, image.Rect(0, 0, 100, 50), Fit(img, 100, 100).Rect)
+	assert.Equal(t, image.Rect(0, 0, 400, 200), Fit(img, 1000, 1000).Rect)
+	assert.Equal(t, image.Rect(0, 0, 64, 64), Fill(img, 64, 64).Rect)
+
+	// rotating 90 degrees clockwise moves the top-left pixel to the top-right corner
+	rotated := Orient(img, 6).(*image.RGBA)
+	assert.Equal(t, image.Rect(0, 0, 200, 400), rotated.Rect)
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, rotated.RGBAAt(199, 0))
+}
@@ -0,0 +1,234 @@
+// Package imaging provides the image processing needed for uploaded media: removing metadata,
+// applying the EXIF orientation and resizing.
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrInvalidImage is returned when the image data cannot be parsed.
+var ErrInvalidImage = errors.New("imaging: invalid image")
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader    = []byte("Exif\x00\x00")
+)
+
+const (
+	jpegAPP0 = 0xE0
+	jpegAPP1 = 0xE1
+	// APP13 holds the Photoshop IRB and IPTC records
+	jpegAPP13 = 0xED
+	jpegCOM   = 0xFE
+	jpegSOS   = 0xDA
+
+	tagOrientation = 0x0112
+)
+
+// StripMetadata removes EXIF, XMP, IPTC and textual metadata (camera details, GPS positions, comments...)
+// from a JPEG, PNG or WebP image without re-encoding it. The EXIF orientation of a JPEG image is kept so
+// that the image is still displayed the right way up. Other formats are returned unchanged.
+func StripMetadata(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+// Orientation returns the EXIF orientation (1 to 8) of a JPEG image, or 1 if the image has none.
+func Orientation(data []byte) int {
+	orientation := 1
+	walkJPEG(data, func(marker byte, segment []byte) {
+		if marker == jpegAPP1 && bytes.HasPrefix(segment, exifHeader) {
+			if o := exifOrientation(segment[len(exifHeader):]); o >= 1 && o <= 8 {
+				orientation = o
+			}
+		}
+	})
+	return orientation
+}
+
+// walkJPEG calls fn for every segment of a JPEG image before the image data, and returns the offset
+// at which the image data starts.
+func walkJPEG(data []byte, fn func(marker byte, segment []byte)) (int, error) {
+	if !bytes.HasPrefix(data, jpegSignature) {
+		return 0, ErrInvalidImage
+	}
+	pos := len(jpegSignature)
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return 0, ErrInvalidImage
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// fill byte
+			pos++
+			continue
+		}
+		if marker == jpegSOS {
+			return pos, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 0, ErrInvalidImage
+		}
+		fn(marker, data[pos+4:pos+2+length])
+		pos += 2 + length
+	}
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	orientation := Orientation(data)
+	var out bytes.Buffer
+	out.Write(jpegSignature)
+	wroteExif := orientation == 1
+	start, err := walkJPEG(data, func(marker byte, segment []byte) {
+		if marker == jpegAPP1 || marker == jpegAPP13 || marker == jpegCOM {
+			return
+		}
+		if !wroteExif && marker != jpegAPP0 {
+			writeJPEGSegment(&out, jpegAPP1, orientationExif(orientation))
+			wroteExif = true
+		}
+		writeJPEGSegment(&out, marker, segment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !wroteExif {
+		writeJPEGSegment(&out, jpegAPP1, orientationExif(orientation))
+	}
+	out.Write(data[start:])
+	return out.Bytes(), nil
+}
+
+func writeJPEGSegment(out *bytes.Buffer, marker byte, segment []byte) {
+	out.Write([]byte{0xFF, marker})
+	binary.Write(out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+}
+
+// exifOrientation reads the orientation tag from the first IFD of an EXIF (TIFF) structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == tagOrientation {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// orientationExif builds an EXIF segment that holds nothing but the orientation tag.
+func orientationExif(orientation int) []byte {
+	var b bytes.Buffer
+	b.Write(exifHeader)
+	b.WriteString("MM")
+	binary.Write(&b, binary.BigEndian, uint16(42))
+	binary.Write(&b, binary.BigEndian, uint32(8))
+	// a single IFD entry of type SHORT, followed by the offset of the next IFD (none)
+	binary.Write(&b, binary.BigEndian, uint16(1))
+	binary.Write(&b, binary.BigEndian, []uint16{tagOrientation, 3})
+	binary.Write(&b, binary.BigEndian, uint32(1))
+	binary.Write(&b, binary.BigEndian, []uint16{uint16(orientation), 0})
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	return b.Bytes()
+}
+
+// pngMetadataChunks lists the PNG chunks that carry metadata.
+var pngMetadataChunks = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrInvalidImage
+	}
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for pos := len(pngSignature); pos < len(data); {
+		if pos+12 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		// length, type, data and CRC
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			return nil, ErrInvalidImage
+		}
+		if !pngMetadataChunks[string(data[pos+4:pos+8])] {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes(), nil
+}
+
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrInvalidImage
+	}
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		// chunks are padded to an even size
+		end := pos + 8 + size + size&1
+		if end > len(data) || end < pos {
+			return nil, ErrInvalidImage
+		}
+		chunk := append([]byte{}, data[pos:end]...)
+		switch string(chunk[:4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			body.Write(chunk)
+		default:
+			body.Write(chunk)
+		}
+		pos = end
+	}
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
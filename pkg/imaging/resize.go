@@ -0,0 +1,120 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Orient transforms an image according to its EXIF orientation so that it is displayed the right way up.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.SetRGBA(x, y, src.RGBAAt(src.Rect.Min.X+sx, src.Rect.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// Fit scales an image down so that it fits within width x height, keeping its aspect ratio.
+// Images that already fit are returned unchanged.
+func Fit(img image.Image, width, height int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= width && h <= height {
+		return toRGBA(img)
+	}
+	if w*height > h*width {
+		return resample(toRGBA(img), width, max(1, h*width/w))
+	}
+	return resample(toRGBA(img), max(1, w*height/h), height)
+}
+
+// Fill scales and crops an image to exactly width x height, keeping the center of the image.
+func Fill(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	crop := src.Rect
+	if w*height > h*width {
+		cw := max(1, h*width/height)
+		crop.Min.X += (w - cw) / 2
+		crop.Max.X = crop.Min.X + cw
+	} else {
+		ch := max(1, w*height/width)
+		crop.Min.Y += (h - ch) / 2
+		crop.Max.Y = crop.Min.Y + ch
+	}
+	return resample(src.SubImage(crop).(*image.RGBA), width, height)
+}
+
+// resample resizes an image by averaging the source pixels covered by each destination pixel.
+func resample(src *image.RGBA, width, height int) *image.RGBA {
+	b := src.Rect
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * h / height
+		y1 := max(y0+1, (y+1)*h/height)
+		for x := 0; x < width; x++ {
+			x0 := x * w / width
+			x1 := max(x0+1, (x+1)*w/width)
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := src.RGBAAt(b.Min.X+sx, b.Min.Y+sy)
+					r += uint32(c.R)
+					g += uint32(c.G)
+					bl += uint32(c.B)
+					a += uint32(c.A)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,45 @@
+// Package scheduler provides support for running background jobs periodically.
+package scheduler
+
+import (
+	"context"
+	"github.com/qiangxue/go-rest-api/pkg/log"
+	"time"
+)
+
+// Job represents a unit of background work.
+type Job func(ctx context.Context) error
+
+// Every runs the given job immediately and then once every interval until the context is cancelled.
+// Errors returned by the job are logged and do not stop the schedule.
+// Every blocks, so it is usually called in a new goroutine.
+func Every(ctx context.Context, interval time.Duration, logger log.Logger, name string, job Job) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run(ctx, logger, name, job)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs the job once, recovering from any panic so that the schedule keeps going.
+func run(ctx context.Context, logger log.Logger, name string, job Job) {
+	l := logger.With(ctx, "job", name)
+	defer func() {
+		if e := recover(); e != nil {
+			l.Errorf("recovered from panic: %v", e)
+		}
+	}()
+
+	start := time.Now()
+	if err := job(ctx); err != nil {
+		l.Errorf("job failed: %v", err)
+		return
+	}
+	l.With(ctx, "duration", time.Now().Sub(start).Milliseconds()).Debug("job completed")
+}